@@ -0,0 +1,105 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// The program starts a pipeline with the package runpipeline, waits for
+// the run and ends with the exit code of its result:
+//
+//	AZURE_DEVOPS_TOKEN=... go run ./_example -org myorg -prj myproject -pipeline build -param env=dev
+package main
+
+import (
+	"adPipeline/runpipeline"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+)
+
+func main() {
+	baseURL := flag.String("ado-base-url", runpipeline.ADOURL, "Base URL of Azure DevOps")
+	org := flag.String("org", "", "Organization")
+	prj := flag.String("prj", "", "Project")
+	pipeline := flag.String("pipeline", "", "Name of the pipeline")
+	branch := flag.String("branch", "", "Branch of the run")
+	timeout := flag.Duration("timeout", time.Hour, "Time after that the run is canceled")
+	parameters := map[string]string{}
+	flag.Func("param", "Parameter like 'key=value', can be repeated", func(value string) error {
+		key, v, ok := strings.Cut(value, "=")
+		if !ok {
+			return fmt.Errorf("parameter '%s' does not contain '='", value)
+		}
+		parameters[key] = v
+		return nil
+	})
+	flag.Parse()
+
+	// the run is canceled, if the program is interrupted or times out
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+
+	client := runpipeline.NewClient(*org, *prj, os.Getenv("AZURE_DEVOPS_TOKEN"))
+	client.BaseURL = *baseURL
+	options := runpipeline.RunOptions{
+		Pipeline:   *pipeline,
+		Branch:     *branch,
+		Parameters: parameters,
+		NoWait:     true,
+	}
+	queued, err := client.Run(ctx, options)
+	if err != nil {
+		exit(err)
+	}
+	fmt.Printf("Run %d of pipeline '%s' is queued: %s\n", queued.RunID, queued.Pipeline, queued.URL)
+
+	options.RunID = queued.RunID
+	options.PipelineID = queued.PipelineID
+	for {
+		status, err := client.GetStatus(ctx, options)
+		if err != nil {
+			if ctx.Err() != nil {
+				if err := client.CancelRun(context.Background(), options); err != nil {
+					fmt.Fprintf(os.Stderr, "Run %d could not be canceled: %v\n", options.RunID, err)
+				}
+			}
+			exit(err)
+		}
+		if status.State == "completed" {
+			fmt.Printf("Run %d of pipeline '%s' %s.\n", status.RunID, status.Pipeline, status.Result)
+			os.Exit(status.ExitCode)
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(10 * time.Second):
+		}
+	}
+}
+
+// exit ends the program with the exit code of runPipeline, if there is
+// one.
+func exit(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	var exitErr *runpipeline.ExitError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.Code)
+	}
+	os.Exit(1)
+}
@@ -1,8 +1,10 @@
 #!/usr/bin/env bash
 
-package=runPipeline.go
+package=.
 package_name=runPipeline
 
+version=$(git describe --tags --always 2>/dev/null || echo dev)
+
 platforms=("linux/amd64" "darwin/amd64" "windows/amd64")
 
 for platform in "${platforms[@]}"
@@ -11,8 +13,11 @@ do
     GOOS=${platform_split[0]}
     GOARCH=${platform_split[1]}
     output_name=bin/${GOOS}-${GOARCH}/${package_name}
+    if [ $GOOS = "windows" ]; then
+        output_name+='.exe'
+    fi
 
-    env GOOS=${GOOS} GOARCH=${GOARCH} go build -o ${output_name} ${package}
+    env GOOS=${GOOS} GOARCH=${GOARCH} go build -ldflags "-X main.version=${version}" -o ${output_name} ${package}
     if [ $? -ne 0 ]; then
         echo 'An error has occurred during GO compilation! Aborting the script execution...'
         exit 1
@@ -22,4 +27,7 @@ do
         echo 'An error has occurred during packaging! Aborting the script execution...'
         exit 1
     fi
-done
\ No newline at end of file
+done
+
+# the checksums are verified by 'runPipeline -self-update'
+(cd dist && sha256sum *.tar.gz > checksums.txt)
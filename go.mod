@@ -3,9 +3,20 @@ module adPipeline
 go 1.19
 
 require (
-	github.com/alecthomas/kong v0.6.1 // indirect
-	github.com/google/uuid v1.1.1 // indirect
-	github.com/microsoft/azure-devops-go-api/azuredevops/v6 v6.0.1 // indirect
-	github.com/sirupsen/logrus v1.9.0 // indirect
-	golang.org/x/sys v0.0.0-20220715151400-c0bba94af5f8 // indirect
+	github.com/google/uuid v1.1.1
+	github.com/microsoft/azure-devops-go-api/azuredevops/v6 v6.0.1
+	github.com/sirupsen/logrus v1.9.0
+	github.com/spf13/cobra v1.6.1
+	github.com/zalando/go-keyring v0.2.2
+	golang.org/x/sys v0.0.0-20220715151400-c0bba94af5f8
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/alessio/shellescape v1.4.1 // indirect
+	github.com/danieljoos/wincred v1.1.2 // indirect
+	github.com/godbus/dbus/v5 v5.1.0 // indirect
+	github.com/inconshreveable/mousetrap v1.0.1 // indirect
+	github.com/spf13/pflag v1.0.5 // indirect
+	github.com/stretchr/testify v1.7.2 // indirect
 )
@@ -0,0 +1,137 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"fmt"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/build"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/webapi"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// annotationKey is the charset of the keys of annotations, that can be
+// used in every output format.
+var annotationKey = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// annotations are free-form 'key=value' pairs, that are passed through
+// to the outputs of the program. Like parameters, the last value of a
+// key wins.
+type annotations map[string]string
+
+func (a *annotations) String() string {
+	if a == nil {
+		return ""
+	}
+	pairs := make([]string, 0, len(*a))
+	for _, key := range a.keys() {
+		pairs = append(pairs, key+"="+(*a)[key])
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (a *annotations) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok {
+		return fmt.Errorf("annotation '%s' does not contain '='", value)
+	}
+	if !annotationKey.MatchString(key) {
+		return fmt.Errorf("key '%s' of the annotation may only contain up to 64 letters, digits, '_', '.' and '-'", key)
+	}
+	if *a == nil {
+		*a = make(annotations)
+	}
+	(*a)[key] = val
+	return nil
+}
+
+// keys returns the sorted keys of the annotations.
+func (a annotations) keys() []string {
+	keys := make([]string, 0, len(a))
+	for key := range a {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// tagAnnotations adds the annotations as 'key=value' tags to the run.
+// Failures are only logged as warnings.
+func (app *App) tagAnnotations(ctx context.Context, pr *pipelineRun) {
+	if !app.capabilities.available(subsystemTags) || !app.budget.allowOptional("annotationTags") {
+		return
+	}
+	tags := make([]string, 0, len(app.annotations))
+	for _, key := range app.annotations.keys() {
+		tags = append(tags, key+"="+app.annotations[key])
+	}
+	client, err := pr.prj.org.buildClient(ctx)
+	if err == nil {
+		args := &build.AddBuildTagsArgs{
+			Tags:    &tags,
+			Project: &pr.prj.name,
+			BuildId: &pr.runID,
+		}
+		_, err = client.AddBuildTags(ctx, *args)
+	}
+	if app.capabilities.denied(pr.log, subsystemTags, err) {
+		return
+	}
+	if err != nil {
+		pr.log.Warnf("Annotations could not be added as tags to run %d of pipeline '%s': %v", pr.runID, pr.name, err)
+		return
+	}
+	pr.log.Debugf("%d annotation(s) added as tags to run %d of pipeline '%s'.", len(tags), pr.runID, pr.name)
+}
+
+// propertyAnnotations adds the annotations as properties to the run, so
+// that they can be queried with the builds API. Failures are only logged
+// as warnings.
+func (app *App) propertyAnnotations(ctx context.Context, pr *pipelineRun) {
+	if !app.capabilities.available(subsystemProperties) || !app.budget.allowOptional("annotationProperties") {
+		return
+	}
+	document := make([]webapi.JsonPatchOperation, 0, len(app.annotations))
+	for _, key := range app.annotations.keys() {
+		// the charset of the keys needs no escaping in a JSON pointer
+		path := "/" + key
+		document = append(document, webapi.JsonPatchOperation{
+			Op:    &webapi.OperationValues.Add,
+			Path:  &path,
+			Value: app.annotations[key],
+		})
+	}
+	client, err := pr.prj.org.buildClient(ctx)
+	if err == nil {
+		args := &build.UpdateBuildPropertiesArgs{
+			Document: &document,
+			Project:  &pr.prj.name,
+			BuildId:  &pr.runID,
+		}
+		_, err = client.UpdateBuildProperties(ctx, *args)
+	}
+	if app.capabilities.denied(pr.log, subsystemProperties, err) {
+		return
+	}
+	if err != nil {
+		pr.log.Warnf("Annotations could not be added as properties to run %d of pipeline '%s': %v", pr.runID, pr.name, err)
+		return
+	}
+	pr.log.Debugf("%d annotation(s) added as properties to run %d of pipeline '%s'.", len(document), pr.runID, pr.name)
+}
@@ -0,0 +1,269 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"fmt"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/pipelines"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Client starts and watches the runs of the pipelines of a project. It
+// uses the same code as the command line program, the options are a
+// subset of its parameters.
+type Client struct {
+	// BaseURL is the base URL of Azure DevOps, the organization is
+	// appended as path. It defaults to https://dev.azure.com.
+	BaseURL string
+	Org     string
+	Project string
+	Token   string
+}
+
+// RunOptions selects the pipeline and, for GetStatus and CancelRun, the
+// run of the pipeline.
+type RunOptions struct {
+	// Pipeline is the name of the pipeline or 'org/project/name'.
+	Pipeline string
+	// PipelineID is the id of the pipeline, it is used instead of the name.
+	PipelineID int
+	// Branch is the branch of the run, the default branch of the pipeline
+	// is used, if it is empty.
+	Branch     string
+	Parameters map[string]string
+	// Variables are the variables, that are settable at queue time. They
+	// are the only values, that classic build definitions take.
+	Variables map[string]string
+	// Timeout cancels the run, if it is not completed in time.
+	Timeout time.Duration
+	// PollInterval is the wait time between the status checks of the run,
+	// it defaults to 10 seconds.
+	PollInterval time.Duration
+	// NoWait returns the queued run instead of waiting until it is
+	// completed.
+	NoWait bool
+	// RunID is the run of GetStatus and CancelRun.
+	RunID int
+}
+
+// RunResult is the run of a pipeline.
+type RunResult struct {
+	Pipeline    string
+	PipelineID  int
+	RunID       int
+	BuildNumber string
+	URL         string
+	// State is the state of the run, eg. 'inProgress' or 'completed'.
+	State string
+	// Result is the result of a completed run, eg. 'succeeded' or
+	// 'failed', or 'timedOut', if the run was canceled by the timeout.
+	Result string
+	// Created, Started and Finished are the times of the phases of the
+	// run, zero if a phase did not happen, eg. the start of a run, that
+	// never started.
+	Created  time.Time
+	Started  time.Time
+	Finished time.Time
+	// ExitCode is the exit code of the command line program for the
+	// result of a completed run, eg. 0 for 'succeeded' and 1 for 'failed'.
+	ExitCode int
+}
+
+// ExitError is returned, if the command line program would end with the
+// exit code, before the result of the run is known, eg. if the pipeline
+// does not exist. The reason is logged.
+type ExitError struct {
+	Code int
+	// Err is the cause of the exit, eg. the error of the API, or nil,
+	// if the reason is only logged.
+	Err error
+}
+
+func (e *ExitError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("runPipeline ended with exit code %d: %v", e.Code, e.Err)
+	}
+	return fmt.Sprintf("runPipeline ended with exit code %d, the reason is logged", e.Code)
+}
+
+// Unwrap returns the cause of the exit, so that it can be checked with
+// errors.Is and errors.As.
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// exitCode is the panic of exit, if the program is used as library.
+type exitCode int
+
+// NewClient returns a client of the project of the organization at
+// https://dev.azure.com.
+func NewClient(org string, project string, token string) *Client {
+	return &Client{BaseURL: ADOURL, Org: org, Project: project, Token: token}
+}
+
+// Run starts a run of the pipeline and waits until it is completed,
+// unless NoWait is set. A failed or canceled run is no error, its result
+// and exit code are returned.
+func (c *Client) Run(ctx context.Context, opts RunOptions) (result *RunResult, err error) {
+	if opts.Pipeline == "" && opts.PipelineID <= 0 {
+		return nil, fmt.Errorf("pipeline or pipeline id is required")
+	}
+	app, err := c.newApp(opts)
+	if err != nil {
+		return nil, err
+	}
+	defer app.recoverExit(&err)
+	pr := app.resolveRun(ctx, opts)
+	app.runs = []*pipelineRun{pr}
+	app.resolveBranches(ctx, app.runs)
+	app.resolveDefinitionKinds(ctx, app.runs)
+	app.startRun(ctx, pr)
+	if !opts.NoWait {
+		app.watchRun(ctx, pr)
+	}
+	return newRunResult(pr), nil
+}
+
+// GetStatus returns the current state of the run RunID of the pipeline.
+func (c *Client) GetStatus(ctx context.Context, opts RunOptions) (result *RunResult, err error) {
+	switch {
+	case opts.Pipeline == "" && opts.PipelineID <= 0:
+		return nil, fmt.Errorf("pipeline or pipeline id is required")
+	case opts.RunID <= 0:
+		return nil, fmt.Errorf("run id is required")
+	}
+	app, err := c.newApp(opts)
+	if err != nil {
+		return nil, err
+	}
+	defer app.recoverExit(&err)
+	pr := app.resolveRun(ctx, opts)
+	pr.runID = opts.RunID
+	pr.log = runLogger(pr)
+	app.resolveDefinitionKinds(ctx, []*pipelineRun{pr})
+	state, code, run := app.getRunStatus(ctx, pr)
+	pr.info.update(run)
+	if state == string(pipelines.RunStateValues.Completed) {
+		pr.exitCode = code
+	}
+	return newRunResult(pr), nil
+}
+
+// CancelRun requests the cancellation of the run RunID. The pipeline is
+// optional, Azure DevOps cancels the run asynchronously.
+func (c *Client) CancelRun(ctx context.Context, opts RunOptions) (err error) {
+	if opts.RunID <= 0 {
+		return fmt.Errorf("run id is required")
+	}
+	app, err := c.newApp(opts)
+	if err != nil {
+		return err
+	}
+	defer app.recoverExit(&err)
+	prj := app.project(ctx, app.org, app.prj)
+	client, err := prj.org.buildClient(ctx)
+	if err != nil {
+		return err
+	}
+	pr := &pipelineRun{prj: prj, name: opts.Pipeline, pipelineID: opts.PipelineID, runID: opts.RunID}
+	return app.cancelBuild(ctx, client, pr, opts.RunID)
+}
+
+// newApp returns the program with the options of the client, exit
+// returns the exit code as error.
+func (c *Client) newApp(opts RunOptions) (*App, error) {
+	if c.Org == "" || c.Project == "" || c.Token == "" {
+		return nil, fmt.Errorf("organization, project and token are required")
+	}
+	app := &App{
+		baseURL:          c.BaseURL,
+		org:              c.Org,
+		prj:              c.Project,
+		token:            c.Token,
+		branch:           opts.Branch,
+		variables:        opts.Variables,
+		timeout:          opts.Timeout,
+		pollStrategyName: pollFixed,
+		pollInterval:     opts.PollInterval,
+		output:           outputText,
+		embedded:         true,
+		run:              &runInfo{},
+		clock:            &serverClock{},
+		timer:            newPhaseTimer(),
+		// the start of a run is retried like on the command line
+		triggerMaxAttempts:    defaultTriggerAttempts,
+		triggerRetryBaseDelay: defaultTriggerRetryBaseDelay,
+		// the library does not replace the default transport, the budget
+		// is unlimited
+		budget: newAPIBudget(0, http.DefaultTransport),
+	}
+	if app.baseURL == "" {
+		app.baseURL = ADOURL
+	}
+	if app.pollInterval <= 0 {
+		app.pollInterval = defaultPollInterval
+	}
+	return app, nil
+}
+
+// resolveRun looks up the pipeline of the options in the project of the
+// client.
+func (app *App) resolveRun(ctx context.Context, opts RunOptions) *pipelineRun {
+	app.defaultProject = app.project(ctx, app.org, app.prj)
+	var pr *pipelineRun
+	if opts.PipelineID > 0 {
+		pr = app.resolvePipeline(ctx, app.defaultProject, "", opts.PipelineID)
+	} else {
+		prj, name, id := app.parseReference(ctx, strings.TrimSpace(opts.Pipeline))
+		pr = app.resolvePipeline(ctx, prj, name, id)
+	}
+	pr.parameters = opts.Parameters
+	pr.timeout = opts.Timeout
+	return pr
+}
+
+// recoverExit converts the exit of the program to an ExitError. It must
+// be deferred by the functions of the client.
+func (app *App) recoverExit(err *error) {
+	if r := recover(); r != nil {
+		code, ok := r.(exitCode)
+		if !ok {
+			panic(r)
+		}
+		*err = &ExitError{Code: int(code), Err: app.exitCause}
+	}
+}
+
+// newRunResult returns the result of the run.
+func newRunResult(pr *pipelineRun) *RunResult {
+	return &RunResult{
+		Pipeline:    pr.name,
+		PipelineID:  pr.pipelineID,
+		RunID:       pr.runID,
+		BuildNumber: pr.info.BuildNumber,
+		URL:         pr.info.URL,
+		State:       pr.info.State,
+		Result:      pr.info.Result,
+		Created:     pr.info.Created,
+		Started:     pr.info.Started,
+		Finished:    pr.info.Finished,
+		ExitCode:    pr.exitCode,
+	}
+}
@@ -0,0 +1,85 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"errors"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6"
+	"net/http"
+	"testing"
+)
+
+// TestClientExitError checks, that the library returns the cause of the
+// exit of the program.
+func TestClientExitError(t *testing.T) {
+	f := newFakeServer(t)
+	f.route(locationPipelines, "{project}/_apis/pipelines/{pipelineId}", func(req *fakeRequest) (int, interface{}) {
+		if req.values["pipelineId"] != "" {
+			return http.StatusNotFound, map[string]string{"message": "Pipeline 99 not found."}
+		}
+		return http.StatusOK, map[string]interface{}{"count": 0, "value": []interface{}{}}
+	})
+	client := &Client{BaseURL: f.URL, Org: "org", Project: "prj", Token: "token"}
+
+	tests := []struct {
+		name   string
+		opts   RunOptions
+		status int
+	}{
+		{"unknown id", RunOptions{PipelineID: 99}, http.StatusNotFound},
+		{"unknown name", RunOptions{Pipeline: "deploy"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := client.Run(context.Background(), tt.opts)
+			var exitErr *ExitError
+			if !errors.As(err, &exitErr) {
+				t.Fatalf("error %v, want ExitError", err)
+			}
+			if exitErr.Code != 1 || exitErr.Err == nil {
+				t.Errorf("exit code %d with cause %v, want 1 with a cause", exitErr.Code, exitErr.Err)
+			}
+			status := 0
+			var wrapped azuredevops.WrappedError
+			if errors.As(err, &wrapped) {
+				status = *wrapped.StatusCode
+			}
+			if status != tt.status {
+				t.Errorf("status %d of the cause %v, want %d", status, exitErr.Err, tt.status)
+			}
+		})
+	}
+}
+
+func TestExitErrorMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		err  *ExitError
+		want string
+	}{
+		{"logged", &ExitError{Code: 9}, "runPipeline ended with exit code 9, the reason is logged"},
+		{"cause", &ExitError{Code: 1, Err: errors.New("pipeline 'deploy' does not exist")}, "runPipeline ended with exit code 1: pipeline 'deploy' does not exist"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.err.Error(); got != tt.want {
+				t.Errorf("Error() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,338 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/build"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/pipelinesapproval"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// approvalsAPIVersion is the version of the Approvals API. The SDK has
+// only its models, therefore the requests are sent without a client.
+const approvalsAPIVersion = "7.1-preview.1"
+
+// approvalRecordType is the type of the timeline records of approvals,
+// whose id is the id of the approval.
+const approvalRecordType = "Checkpoint.Approval"
+
+// approvalStatusUnavailable is the status of the approval, if the token may
+// not read the approvals.
+const approvalStatusUnavailable = "unavailable"
+
+// approvalInfo is the approval of the stage of 'approve-stage'.
+type approvalInfo struct {
+	Stage        string   `json:"stage"`
+	ID           string   `json:"id,omitempty"`
+	Status       string   `json:"status"`
+	Instructions string   `json:"instructions,omitempty"`
+	Approvers    []string `json:"approvers,omitempty"`
+	// Action is 'approved' or 'rejected', if the program updated the
+	// approval
+	Action  string `json:"action,omitempty"`
+	Comment string `json:"comment,omitempty"`
+
+	// decided is true, if the program approved or rejected the approval
+	// or the approval was declined on the console
+	decided bool
+}
+
+// checkApproval looks for the approval of the stage of 'approve-stage'.
+// When the approval is pending, its details are logged once and with
+// 'approve' or 'reject' the approval is updated. Without these flags
+// the approval is only reported. The program ends with exit code 38, if
+// the token may not update the approval.
+func (app *App) checkApproval(ctx context.Context, pr *pipelineRun) {
+	if pr.approval != nil && (pr.approval.decided || pr.approval.Status != string(pipelinesapproval.ApprovalStatusValues.Pending)) {
+		return
+	}
+	if !app.capabilities.available(subsystemTimeline) || !app.capabilities.available(subsystemApprovals) {
+		app.approvalUnavailable(pr)
+		return
+	}
+	if !app.budget.allowOptional("approvals") {
+		return
+	}
+	ids, err := app.stageApprovalIDs(ctx, pr)
+	if app.capabilities.denied(pr.log, subsystemTimeline, err) {
+		app.approvalUnavailable(pr)
+		return
+	}
+	if err != nil {
+		pr.log.Warnf("Approvals of stage '%s' of run %d could not be read: %v", app.approveStage, pr.runID, err)
+		return
+	}
+	if len(ids) == 0 {
+		pr.log.Debugf("Stage '%s' of run %d of pipeline '%s' waits for no approval.", app.approveStage, pr.runID, pr.name)
+		return
+	}
+	approvals, err := app.queryApprovals(ctx, pr, ids)
+	if app.capabilities.denied(pr.log, subsystemApprovals, err) {
+		app.approvalUnavailable(pr)
+		return
+	}
+	if err != nil {
+		pr.log.Warnf("Approvals of stage '%s' of run %d could not be read: %v", app.approveStage, pr.runID, err)
+		return
+	}
+	for _, approval := range approvals {
+		if approval.Id == nil || approval.Status == nil || *approval.Status != pipelinesapproval.ApprovalStatusValues.Pending {
+			continue
+		}
+		if pr.approval == nil || pr.approval.ID != approval.Id.String() {
+			pr.approval = newApprovalInfo(app.approveStage, approval)
+			app.logApproval(pr)
+		}
+		if app.approve || app.reject {
+			app.decideApproval(ctx, pr, approval)
+		}
+		return
+	}
+	if pr.approval != nil {
+		// the approval was decided by somebody else
+		pr.approval.Status = approvalStatus(approvals, pr.approval.ID)
+		pr.log.Infof("Approval of stage '%s' of run %d of pipeline '%s' is %s.", app.approveStage, pr.runID, pr.name, pr.approval.Status)
+	}
+}
+
+// approvalUnavailable marks the approval as unavailable, because the
+// token may not read it. With 'approve' or 'reject' the program ends with
+// exit code 38, the approval can not be decided.
+func (app *App) approvalUnavailable(pr *pipelineRun) {
+	pr.approval = &approvalInfo{Stage: app.approveStage, Status: approvalStatusUnavailable}
+	switch {
+	case app.approve:
+		app.approvalForbidden(pr, "approve", fmt.Errorf("the approvals can not be read"))
+	case app.reject:
+		app.approvalForbidden(pr, "reject", fmt.Errorf("the approvals can not be read"))
+	}
+}
+
+// newApprovalInfo returns the details of the approval.
+func newApprovalInfo(stage string, approval pipelinesapproval.Approval) *approvalInfo {
+	info := &approvalInfo{
+		Stage:  stage,
+		ID:     approval.Id.String(),
+		Status: string(*approval.Status),
+	}
+	if approval.Instructions != nil {
+		info.Instructions = *approval.Instructions
+	}
+	if approval.Steps != nil {
+		for _, step := range *approval.Steps {
+			if step.AssignedApprover != nil && step.AssignedApprover.DisplayName != nil {
+				info.Approvers = append(info.Approvers, *step.AssignedApprover.DisplayName)
+			}
+		}
+	}
+	return info
+}
+
+// approvalStatus returns the status of the approval with the id.
+func approvalStatus(approvals []pipelinesapproval.Approval, id string) string {
+	for _, approval := range approvals {
+		if approval.Id != nil && approval.Id.String() == id && approval.Status != nil {
+			return string(*approval.Status)
+		}
+	}
+	return "unknown"
+}
+
+// logApproval logs the details of the pending approval.
+func (app *App) logApproval(pr *pipelineRun) {
+	a := pr.approval
+	pr.log.Infof("Stage '%s' of run %d of pipeline '%s' waits for approval %s.", a.Stage, pr.runID, pr.name, a.ID)
+	if a.Instructions != "" {
+		pr.log.Infof("Instructions: %s", a.Instructions)
+	}
+	if len(a.Approvers) > 0 {
+		pr.log.Infof("Approvers: %s", strings.Join(a.Approvers, ", "))
+	}
+}
+
+// decideApproval approves or rejects the pending approval. Without
+// 'approve-message' the decision is confirmed on the console first, a
+// declined approval stays pending and is only observed.
+func (app *App) decideApproval(ctx context.Context, pr *pipelineRun, approval pipelinesapproval.Approval) {
+	status, action := pipelinesapproval.ApprovalStatusValues.Approved, "approve"
+	if app.reject {
+		status, action = pipelinesapproval.ApprovalStatusValues.Rejected, "reject"
+	}
+	pr.approval.decided = true
+	if approval.Permissions != nil && !strings.Contains(string(*approval.Permissions), string(pipelinesapproval.ApprovalPermissionsValues.Update)) {
+		app.approvalForbidden(pr, action, fmt.Errorf("the permissions are '%s'", *approval.Permissions))
+	}
+	if app.approveMessage == "" && !app.confirmApproval(pr, action) {
+		pr.log.Infof("Approval of stage '%s' of run %d of pipeline '%s' is left pending.", pr.approval.Stage, pr.runID, pr.name)
+		return
+	}
+	comment := app.approveMessage
+	if comment == "" {
+		comment = fmt.Sprintf("%s by runPipeline", status)
+	}
+	auditCtx, call := app.auditContext(ctx, action, pr.name, pr.pipelineID, pr.runID)
+	err := app.updateApproval(auditCtx, pr, *approval.Id, status, comment)
+	if code := responseStatus(err); code == http.StatusUnauthorized || code == http.StatusForbidden {
+		app.approvalForbidden(pr, action, err)
+	}
+	if err != nil {
+		pr.log.Warnf("Approval of stage '%s' of run %d could not be updated: %v", pr.approval.Stage, pr.runID, err)
+		return
+	}
+	call.done(0, string(status))
+	pr.approval.Status = string(status)
+	pr.approval.Action = string(status)
+	pr.approval.Comment = comment
+	pr.log.Infof("Stage '%s' of run %d of pipeline '%s' is %s, the run is watched until it is finished.", pr.approval.Stage, pr.runID, pr.name, status)
+}
+
+// approvalForbidden ends the program with exit code 38, because the
+// token may not approve the stage.
+func (app *App) approvalForbidden(pr *pipelineRun, action string, err error) {
+	pr.log.Errorf("The token may not %s stage '%s' of run %d of pipeline '%s', check the approvers of the environment or resource: %v", action, pr.approval.Stage, pr.runID, pr.name, err)
+	app.exit(38)
+}
+
+// confirmApproval asks on the console, if the approval is approved or
+// rejected.
+func (app *App) confirmApproval(pr *pipelineRun, action string) bool {
+	app.promptLock.Lock()
+	defer app.promptLock.Unlock()
+	if app.stdin == nil {
+		app.stdin = bufio.NewReader(os.Stdin)
+	}
+	fmt.Fprintf(os.Stderr, "Do you want to %s stage '%s' of run %d of pipeline '%s'? [y/N]: ", action, pr.approval.Stage, pr.runID, pr.name)
+	answer, _ := app.readLine()
+	return strings.EqualFold(answer, "y") || strings.EqualFold(answer, "yes")
+}
+
+// stageApprovalIDs returns the ids of the approvals of the stage, which
+// are the ids of the approval records below the checkpoint of the stage
+// in the timeline of the run.
+func (app *App) stageApprovalIDs(ctx context.Context, pr *pipelineRun) ([]uuid.UUID, error) {
+	client, err := pr.prj.org.buildClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	args := &build.GetBuildTimelineArgs{
+		Project: &pr.prj.name,
+		BuildId: &pr.runID,
+	}
+	timeline, err := client.GetBuildTimeline(ctx, *args)
+	if err != nil || timeline == nil || timeline.Records == nil {
+		return nil, err
+	}
+	parents := make(map[uuid.UUID]uuid.UUID)
+	stages := make(map[uuid.UUID]bool)
+	for _, record := range *timeline.Records {
+		if record.Id == nil || record.Type == nil {
+			continue
+		}
+		if record.ParentId != nil {
+			parents[*record.Id] = *record.ParentId
+		}
+		if *record.Type == "Stage" && (record.Name != nil && strings.EqualFold(*record.Name, app.approveStage) ||
+			record.Identifier != nil && strings.EqualFold(*record.Identifier, app.approveStage)) {
+			stages[*record.Id] = true
+		}
+	}
+	var ids []uuid.UUID
+	for _, record := range *timeline.Records {
+		if record.Id == nil || record.Type == nil || *record.Type != approvalRecordType {
+			continue
+		}
+		// the approval belongs to the checkpoint of the stage
+		for id, ok := parents[*record.Id]; ok; id, ok = parents[id] {
+			if stages[id] {
+				ids = append(ids, *record.Id)
+				break
+			}
+		}
+	}
+	return ids, nil
+}
+
+// approvalsURL returns the URL of the Approvals API of the project.
+func approvalsURL(pr *pipelineRun, query url.Values) string {
+	u := strings.TrimSuffix(pr.prj.org.connection.BaseUrl, "/") + "/" + url.PathEscape(pr.prj.name) + "/_apis/pipelines/approvals"
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+// queryApprovals reads the approvals with their steps.
+func (app *App) queryApprovals(ctx context.Context, pr *pipelineRun, ids []uuid.UUID) ([]pipelinesapproval.Approval, error) {
+	list := make([]string, 0, len(ids))
+	for _, id := range ids {
+		list = append(list, id.String())
+	}
+	query := url.Values{}
+	query.Set("approvalIds", strings.Join(list, ","))
+	query.Set("$expand", string(pipelinesapproval.ApprovalDetailsExpandParameterValues.Steps)+","+string(pipelinesapproval.ApprovalDetailsExpandParameterValues.Permissions))
+	var approvals []pipelinesapproval.Approval
+	err := app.sendApprovals(ctx, pr, http.MethodGet, query, nil, &approvals)
+	return approvals, err
+}
+
+// updateApproval approves or rejects the approval.
+func (app *App) updateApproval(ctx context.Context, pr *pipelineRun, id uuid.UUID, status pipelinesapproval.ApprovalStatus, comment string) error {
+	body := []pipelinesapproval.ApprovalUpdateParameters{{
+		ApprovalId: &id,
+		Status:     &status,
+		Comment:    &comment,
+	}}
+	var updated []pipelinesapproval.Approval
+	return app.sendApprovals(ctx, pr, http.MethodPatch, nil, body, &updated)
+}
+
+// sendApprovals sends a request to the Approvals API and reads the
+// collection of the response.
+func (app *App) sendApprovals(ctx context.Context, pr *pipelineRun, method string, query url.Values, body interface{}, v interface{}) error {
+	var reader *bytes.Reader
+	mediaType := ""
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader, mediaType = bytes.NewReader(encoded), "application/json"
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	connection := pr.prj.org.connection
+	client := azuredevops.NewClient(connection, connection.BaseUrl)
+	req, err := client.CreateRequestMessage(ctx, method, approvalsURL(pr, query), approvalsAPIVersion, reader, mediaType, "application/json", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.SendRequest(req)
+	if err != nil {
+		return err
+	}
+	return client.UnmarshalCollectionBody(resp, v)
+}
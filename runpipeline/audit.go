@@ -0,0 +1,391 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/location"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"os"
+	"os/user"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// auditRecord is one line of the audit log file.
+type auditRecord struct {
+	SchemaVersion string `json:"schemaVersion"`
+
+	Time       string            `json:"time"`
+	Action     string            `json:"action"`
+	Pipeline   string            `json:"pipeline"`
+	PipelineID int               `json:"pipelineId"`
+	RunID      int               `json:"runId,omitempty"`
+	Parameters map[string]string `json:"parameters,omitempty"`
+	Result     string            `json:"result"`
+	Caller     string            `json:"caller"`
+	HTTPStatus int               `json:"httpStatus"`
+
+	Annotations annotations `json:"annotations,omitempty"`
+
+	RateLimitWaits  int   `json:"rateLimitWaits,omitempty"`
+	RateLimitWaitMs int64 `json:"rateLimitWaitMs,omitempty"`
+}
+
+// auditInvocation is the last line of the audit log file, that an
+// invocation of the program writes, when it ends.
+type auditInvocation struct {
+	SchemaVersion string `json:"schemaVersion"`
+
+	Time     string            `json:"time"`
+	Action   string            `json:"action"`
+	Caller   string            `json:"caller"`
+	User     string            `json:"user"`
+	Host     string            `json:"host"`
+	Options  map[string]string `json:"options"`
+	Runs     []auditRun        `json:"runs"`
+	ExitCode int               `json:"exitCode"`
+
+	Annotations annotations `json:"annotations,omitempty"`
+}
+
+// auditRun is a run of the invocation.
+type auditRun struct {
+	Pipeline   string `json:"pipeline"`
+	PipelineID int    `json:"pipelineId"`
+	RunID      int    `json:"runId,omitempty"`
+	URL        string `json:"url,omitempty"`
+	Result     string `json:"result,omitempty"`
+	runTimestamps
+}
+
+// auditLog writes the audit records as JSON lines.
+type auditLog struct {
+	lock   sync.Mutex
+	file   *os.File
+	caller string
+}
+
+func openAuditLog(path string) (*auditLog, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &auditLog{file: f, caller: "unknown"}, nil
+}
+
+func (l *auditLog) write(record auditRecord) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	record.Time = time.Now().UTC().Format(time.RFC3339Nano)
+	record.Caller = l.caller
+	l.append(record)
+}
+
+// append writes the record as one line with a single write, so that the
+// lines of concurrent invocations are not interleaved in the file opened
+// with O_APPEND, and syncs it, so that it survives a crash.
+func (l *auditLog) append(record interface{}) {
+	line, err := json.Marshal(record)
+	if err == nil {
+		_, err = l.file.Write(append(line, '\n'))
+	}
+	if err == nil {
+		err = l.file.Sync()
+	}
+	if err != nil {
+		log.Warnf("Audit log could not be written: %v", err)
+	}
+}
+
+// writeInvocation appends the record of the invocation with the runs and
+// the exit code of the program.
+func (app *App) writeInvocation(code int) {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	record := auditInvocation{
+		SchemaVersion: outputSchemaVersion,
+		Time:          time.Now().UTC().Format(time.RFC3339Nano),
+		Action:        "invocation",
+		User:          localUser(),
+		Host:          host,
+		Options:       auditOptions(),
+		Runs:          []auditRun{},
+		ExitCode:      code,
+
+		Annotations: app.annotations,
+	}
+	for _, pr := range app.runs {
+		record.Runs = append(record.Runs, auditRun{
+			Pipeline:   pr.name,
+			PipelineID: pr.pipelineID,
+			RunID:      pr.info.ID,
+			URL:        pr.info.URL,
+			Result:     pr.info.Result,
+
+			runTimestamps: pr.info.timestamps(),
+		})
+	}
+	app.auditLog.lock.Lock()
+	defer app.auditLog.lock.Unlock()
+	record.Caller = app.auditLog.caller
+	app.auditLog.append(record)
+}
+
+// localUser returns the name of the user, that runs the program.
+func localUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	for _, name := range []string{"USER", "USERNAME"} {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return "unknown"
+}
+
+// auditOptions returns the parameters of the command line. The token and
+// the values of parameters and variables, that look like secrets, are
+// masked.
+func auditOptions() map[string]string {
+	options := make(map[string]string)
+	flag.Visit(func(f *flag.Flag) {
+		value := f.Value.String()
+		switch {
+		case secretParameterName.MatchString(f.Name):
+			value = "***"
+		case f.Name == "param":
+			value = maskPairs(paramsSlice)
+		case f.Name == "var":
+			value = maskPairs(varsSlice)
+		}
+		options[f.Name] = value
+	})
+	return options
+}
+
+// maskPairs joins the 'key=value' pairs with ',' and hides the values,
+// that look like secrets.
+func maskPairs(pairs []string) string {
+	masked := make([]string, 0, len(pairs))
+	for _, pair := range pairs {
+		if name, _, ok := strings.Cut(pair, "="); ok && (secretParameterName.MatchString(name) || secretParameters[name]) {
+			pair = name + "=***"
+		}
+		masked = append(masked, pair)
+	}
+	return strings.Join(masked, ",")
+}
+
+// verifyAuditLog checks, that every line of the audit log file is a
+// complete JSON record with time and action. The corrupt lines are
+// reported on stderr and their number is returned.
+func verifyAuditLog(path string, out io.Writer) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	reader := bufio.NewReader(f)
+	records, corrupt := 0, 0
+	for number := 1; ; number++ {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return corrupt, err
+		}
+		if len(line) == 0 {
+			break
+		}
+		if problem := auditLineProblem(line); problem != "" {
+			fmt.Fprintf(os.Stderr, "Line %d of audit log file '%s' is corrupt: %s\n", number, path, problem)
+			corrupt++
+		} else {
+			records++
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	fmt.Fprintf(out, "Audit log file '%s' has %d record(s) and %d corrupt line(s).\n", path, records, corrupt)
+	return corrupt, nil
+}
+
+// auditLineProblem describes, why the line is no audit record, or returns
+// an empty string.
+func auditLineProblem(line []byte) string {
+	if line[len(line)-1] != '\n' {
+		return "the line is incomplete"
+	}
+	var record struct {
+		Time   string `json:"time"`
+		Action string `json:"action"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(line))
+	if err := decoder.Decode(&record); err != nil {
+		return err.Error()
+	}
+	if decoder.More() {
+		return "the line contains more than one record"
+	}
+	if record.Time == "" || record.Action == "" {
+		return "'time' or 'action' is missing"
+	}
+	return ""
+}
+
+var secretParameterName = regexp.MustCompile(`(?i)secret|password|passwd|pwd|token|credential|key`)
+
+// maskParameters hides the values of parameters, that look like secrets
+// or are secrets of the parameter file.
+func maskParameters(parameters map[string]string) map[string]string {
+	masked := make(map[string]string, len(parameters))
+	for name, value := range parameters {
+		if secretParameterName.MatchString(name) || secretParameters[name] {
+			value = "***"
+		}
+		masked[name] = value
+	}
+	return masked
+}
+
+type auditCallKey struct{}
+
+// auditCall is an API call, that is recorded in the audit log. The HTTP
+// status is taken from the response by the auditTransport.
+type auditCall struct {
+	lock    sync.Mutex
+	log     *auditLog
+	record  auditRecord
+	written bool
+}
+
+// auditContext returns a context, that records the API calls made with
+// it. Without audit log the context is returned unchanged.
+func (app *App) auditContext(ctx context.Context, action string, pipeline string, pipelineID int, runID int) (context.Context, *auditCall) {
+	if app.auditLog == nil {
+		return ctx, nil
+	}
+	call := &auditCall{
+		log: app.auditLog,
+		record: auditRecord{
+			SchemaVersion: outputSchemaVersion,
+			Action:        action,
+			Pipeline:      pipeline,
+			PipelineID:    pipelineID,
+			RunID:         runID,
+
+			Annotations: app.annotations,
+		},
+	}
+	return context.WithValue(ctx, auditCallKey{}, call), call
+}
+
+// done writes the record with the result of the call, if it is not
+// already written as failed call.
+func (c *auditCall) done(runID int, result string) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.written {
+		return
+	}
+	c.written = true
+	if runID > 0 {
+		c.record.RunID = runID
+	}
+	c.record.Result = result
+	c.log.write(c.record)
+}
+
+func (c *auditCall) setParameters(parameters map[string]string) {
+	if c != nil {
+		c.record.Parameters = maskParameters(parameters)
+	}
+}
+
+// addRateLimitWait sums up the waits of the call after rate limiting.
+func (c *auditCall) addRateLimitWait(delay time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.record.RateLimitWaits++
+	c.record.RateLimitWaitMs += delay.Milliseconds()
+}
+
+func (c *auditCall) setStatus(status int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.record.HTTPStatus = status
+}
+
+// auditTransport takes the HTTP status of the responses over to the
+// audit call of the request. Failed calls are written immediately,
+// because the program may end afterwards.
+type auditTransport struct {
+	next http.RoundTripper
+}
+
+func (t *auditTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	call, ok := req.Context().Value(auditCallKey{}).(*auditCall)
+	if !ok {
+		return resp, err
+	}
+	if err != nil {
+		call.setStatus(0)
+		call.done(0, "error: "+err.Error())
+		return resp, err
+	}
+	call.setStatus(resp.StatusCode)
+	if resp.StatusCode >= 400 {
+		call.done(0, "error: "+resp.Status)
+	}
+	return resp, err
+}
+
+// callerIdentity returns the name of the user, that is authenticated
+// by the token.
+func (app *App) callerIdentity(ctx context.Context) string {
+	client := location.NewClient(ctx, app.defaultProject.org.connection)
+	data, err := client.GetConnectionData(ctx, location.GetConnectionDataArgs{})
+	if err != nil || data.AuthenticatedUser == nil {
+		log.Warnf("Caller identity for the audit log could not be read: %v", err)
+		return "unknown"
+	}
+	user := data.AuthenticatedUser
+	name := ""
+	if user.ProviderDisplayName != nil {
+		name = *user.ProviderDisplayName
+	}
+	if user.Id != nil {
+		name += " (" + user.Id.String() + ")"
+	}
+	return name
+}
@@ -0,0 +1,56 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"time"
+)
+
+// batchFile is a manifest of pipelines, that are started together.
+type batchFile struct {
+	Pipelines []batchPipeline `yaml:"pipelines"`
+}
+
+// batchPipeline is a pipeline of the batch file. Empty attributes are
+// taken from the command line.
+type batchPipeline struct {
+	Name       string            `yaml:"name"`
+	ID         int               `yaml:"id"`
+	Branch     string            `yaml:"branch"`
+	Parameters map[string]string `yaml:"parameters"`
+	Timeout    time.Duration     `yaml:"timeout"`
+}
+
+func loadBatchFile(path string) (*batchFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	batch := &batchFile{}
+	if err = yaml.Unmarshal(data, batch); err != nil {
+		return nil, err
+	}
+	for i, p := range batch.Pipelines {
+		if p.Name == "" && p.ID == 0 {
+			return nil, fmt.Errorf("pipeline %d has neither name nor id", i+1)
+		}
+	}
+	return batch, nil
+}
@@ -0,0 +1,99 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"os/exec"
+	"strings"
+)
+
+// gitBranch returns the current branch of the git repository in the
+// working directory.
+func gitBranch() (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", "rev-parse", "--abbrev-ref", "HEAD")
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%v %s", err, strings.TrimSpace(stderr.String()))
+	}
+	branch := strings.TrimSpace(string(out))
+	if branch == "HEAD" {
+		return "", fmt.Errorf("HEAD is detached")
+	}
+	return branch, nil
+}
+
+// defaultBranch is used, if the default branch of a pipeline can not
+// be read.
+const defaultBranch = "master"
+
+// resolveBranches sets the branch of all runs. Without 'branch' the
+// branch of the run template, 'branch-default' or the default branch of
+// the pipeline is used. With 'branch-default-from-pipeline' the default
+// branch of the pipeline wins over 'branch-default'. The program ends,
+// if a branch does not match the 'branch-pattern'.
+func (app *App) resolveBranches(ctx context.Context, runs []*pipelineRun) {
+	for _, pr := range runs {
+		switch {
+		case pr.branch != "":
+			// branch of the batch file
+		case app.branch != "":
+			pr.branch = app.branch
+		case app.templateBranch() != "":
+			pr.branch = app.templateBranch()
+		case app.branchDefault != "" && !app.branchFromPipeline:
+			log.Debugf("Branch is not specified, branch '%s' of parameter 'branch-default' is used for pipeline '%s'.", app.branchDefault, pr.name)
+			pr.branch = app.branchDefault
+		default:
+			fallback := defaultBranch
+			if app.branchDefault != "" {
+				fallback = app.branchDefault
+			}
+			branch, err := app.pipelineDefaultBranch(ctx, pr)
+			if err != nil {
+				log.Warnf("Default branch of pipeline '%s' could not be read, branch '%s' is used: %v", pr.name, fallback, err)
+				branch = fallback
+			} else {
+				log.Debugf("Branch is not specified, the default branch of pipeline '%s' is used instead of '%s'.", pr.name, fallback)
+			}
+			log.Infof("Pipeline '%s' runs on branch '%s'.", pr.name, branch)
+			pr.branch = branch
+		}
+		if app.branchPattern != nil && !app.branchPattern.MatchString(strings.TrimPrefix(pr.branch, "refs/heads/")) {
+			log.Errorf("Branch '%s' of pipeline '%s' does not match pattern '%s'.", pr.branch, pr.name, app.branchPattern)
+			app.fail(9, fmt.Errorf("branch '%s' of pipeline '%s' does not match pattern '%s'", pr.branch, pr.name, app.branchPattern))
+		}
+	}
+}
+
+// pipelineDefaultBranch reads the default branch from the repository
+// of the pipeline definition.
+func (app *App) pipelineDefaultBranch(ctx context.Context, pr *pipelineRun) (string, error) {
+	definition, err := app.getDefinition(ctx, pr.prj, pr.pipelineID)
+	if err != nil {
+		return "", err
+	}
+	if definition.Repository == nil || definition.Repository.DefaultBranch == nil || *definition.Repository.DefaultBranch == "" {
+		return "", fmt.Errorf("the repository of the pipeline has no default branch")
+	}
+	return *definition.Repository.DefaultBranch, nil
+}
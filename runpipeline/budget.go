@@ -0,0 +1,187 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var errBudgetExhausted = errors.New("API call budget is exhausted")
+
+// optionalCall is an optional API call, that is disabled, when the
+// remaining part of the budget is below the threshold.
+type optionalCall struct {
+	name  string
+	below float64
+}
+
+// optionalCalls are the optional API calls in the order, in which they
+// are disabled, when the budget of API calls runs low. The enrichment of
+// the outputs by the timeline, the test results and the artifacts is
+// disabled first, the checks, that change runs, last. Every name, that
+// is passed to allowOptional, must be in this list.
+var optionalCalls = []optionalCall{
+	{"reportTimeline", 0.6},
+	{"reportTests", 0.6},
+	{"reportArtifacts", 0.6},
+	{"downloadLogs", 0.6},
+	{"downloadArtifacts", 0.6},
+	{"runVariables", 0.6},
+	{"stageDurations", 0.6},
+	{"startTime", 0.6},
+	{"ignoredParams", 0.4},
+	{"annotationTags", 0.4},
+	{"annotationProperties", 0.4},
+	{"failureIssue", 0.4},
+	{"commitStatus", 0.3},
+	{"retryOnCancel", 0.2},
+	{"cleanupOnSuccess", 0.2},
+	{"deleteIfNeverStarted", 0.2},
+	{"approvals", 0.15},
+	{"stageTimeouts", 0.15},
+	{"cancelSuperseded", 0.1},
+	{"environmentOverride", 0.1},
+}
+
+// apiBudget counts all outgoing API requests. With a maximum the
+// requests are refused, when the budget is exhausted.
+type apiBudget struct {
+	lock     sync.Mutex
+	next     http.RoundTripper
+	max      int
+	used     int
+	degraded []string
+}
+
+func newAPIBudget(max int, next http.RoundTripper) *apiBudget {
+	return &apiBudget{max: max, next: next}
+}
+
+func (b *apiBudget) RoundTrip(req *http.Request) (*http.Response, error) {
+	b.lock.Lock()
+	if b.max > 0 && b.used >= b.max {
+		b.lock.Unlock()
+		return nil, errBudgetExhausted
+	}
+	b.used++
+	used := b.used
+	b.lock.Unlock()
+	if b.max > 0 {
+		log.Debugf("API call %d/%d: %s %s", used, b.max, req.Method, req.URL.Path)
+	} else {
+		log.Debugf("API call %d: %s %s", used, req.Method, req.URL.Path)
+	}
+	return b.next.RoundTrip(req)
+}
+
+// calls returns the number of API requests sent so far.
+func (b *apiBudget) calls() int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.used
+}
+
+// exhausted is true, if no API request is left.
+func (b *apiBudget) exhausted() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.max > 0 && b.used >= b.max
+}
+
+// remaining returns the unused part of the budget between 0 and 1.
+func (b *apiBudget) remaining() float64 {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.max <= 0 {
+		return 1
+	}
+	return float64(b.max-b.used) / float64(b.max)
+}
+
+// allowOptional is false, if the optional API call is disabled to save
+// the budget for polling. A call, that is not in optionalCalls, is a
+// programming error and always denied.
+func (b *apiBudget) allowOptional(name string) bool {
+	remaining := b.remaining()
+	for _, call := range optionalCalls {
+		if call.name != name {
+			continue
+		}
+		if remaining >= call.below {
+			return true
+		}
+		b.degrade("optional call " + name + " disabled")
+		return false
+	}
+	log.Errorf("Optional API call '%s' is not known, it is not sent.", name)
+	return false
+}
+
+// pollInterval stretches the polling interval, when the budget runs low:
+// below 50% to the double, below 25% to the fourfold interval.
+func (b *apiBudget) pollInterval(interval time.Duration) time.Duration {
+	remaining := b.remaining()
+	switch {
+	case remaining < 0.25:
+		b.degrade("poll interval x4")
+		return 4 * interval
+	case remaining < 0.5:
+		b.degrade("poll interval x2")
+		return 2 * interval
+	}
+	return interval
+}
+
+// degrade records a degradation decision once.
+func (b *apiBudget) degrade(decision string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for _, d := range b.degraded {
+		if d == decision {
+			return
+		}
+	}
+	b.degraded = append(b.degraded, decision)
+	log.Debugf("API call budget: %d/%d calls used, %s.", b.used, b.max, decision)
+}
+
+// decisions returns the degradation decisions made so far.
+func (b *apiBudget) decisions() []string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return append([]string(nil), b.degraded...)
+}
+
+func (b *apiBudget) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.max > 0 {
+		return fmt.Sprintf("apiCalls %d/%d", b.used, b.max)
+	}
+	return fmt.Sprintf("apiCalls %d", b.used)
+}
+
+// budgetExhausted ends the program with the last known state of the run.
+func (app *App) budgetExhausted(pr *pipelineRun) {
+	pr.log.Errorf("API call budget of %d calls is exhausted. Run %d of pipeline '%s' was last in state '%s' (URL: %s).", app.budget.max, pr.runID, pr.name, pr.info.State, pr.info.URL)
+	app.exit(25)
+}
@@ -0,0 +1,123 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestAllowOptional checks the thresholds of the optional calls.
+func TestAllowOptional(t *testing.T) {
+	tests := []struct {
+		name string
+		max  int
+		used int
+		call string
+		want bool
+	}{
+		{"unlimited", 0, 1000, "reportTimeline", true},
+		{"timeline at 60%", 100, 40, "reportTimeline", true},
+		{"timeline below 60%", 100, 41, "reportTimeline", false},
+		{"artifacts below 60%", 100, 41, "downloadArtifacts", false},
+		{"ignored parameters below 60%", 100, 41, "ignoredParams", true},
+		{"ignored parameters below 40%", 100, 61, "ignoredParams", false},
+		{"commit status below 40%", 100, 61, "commitStatus", true},
+		{"commit status below 30%", 100, 71, "commitStatus", false},
+		{"retry below 20%", 100, 81, "retryOnCancel", false},
+		{"approvals below 20%", 100, 81, "approvals", true},
+		{"approvals below 15%", 100, 86, "approvals", false},
+		{"stage timeouts below 15%", 100, 86, "stageTimeouts", false},
+		{"environment override below 15%", 100, 86, "environmentOverride", true},
+		{"environment override below 10%", 100, 91, "environmentOverride", false},
+		{"unknown", 0, 0, "unknownCall", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newAPIBudget(tt.max, http.DefaultTransport)
+			b.used = tt.used
+			if got := b.allowOptional(tt.call); got != tt.want {
+				t.Errorf("allowOptional(%q) = %v, want %v", tt.call, got, tt.want)
+			}
+			if disabled := len(b.decisions()) > 0; disabled == tt.want && tt.call != "unknownCall" {
+				t.Errorf("decisions() = %v", b.decisions())
+			}
+		})
+	}
+}
+
+// TestOptionalCallsRegistered checks, that every name passed to
+// allowOptional is in the priority list and every entry of the list is
+// used.
+func TestOptionalCallsRegistered(t *testing.T) {
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	used := map[string]bool{}
+	fset := token.NewFileSet()
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ast.Inspect(f, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			sel, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok || sel.Sel.Name != "allowOptional" || len(call.Args) != 1 {
+				return true
+			}
+			lit, ok := call.Args[0].(*ast.BasicLit)
+			if !ok {
+				t.Errorf("%v: allowOptional is called without a constant name", fset.Position(call.Pos()))
+				return true
+			}
+			name, _ := strconv.Unquote(lit.Value)
+			used[name] = true
+			return true
+		})
+	}
+	registered := map[string]bool{}
+	for _, call := range optionalCalls {
+		registered[call.name] = true
+		if !used[call.name] {
+			t.Errorf("optional call '%s' is not used", call.name)
+		}
+	}
+	for name := range used {
+		if !registered[name] {
+			t.Errorf("optional call '%s' is not in optionalCalls", name)
+		}
+	}
+	for i := 1; i < len(optionalCalls); i++ {
+		if optionalCalls[i].below > optionalCalls[i-1].below {
+			t.Errorf("optional call '%s' is disabled before '%s'", optionalCalls[i].name, optionalCalls[i-1].name)
+		}
+	}
+}
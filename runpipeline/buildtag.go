@@ -0,0 +1,181 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"fmt"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/git"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// emptyObjectID is the old object of a ref, that is created.
+const emptyObjectID = "0000000000000000000000000000000000000000"
+
+// invalidTagName matches the names, that Git does not allow for refs.
+var invalidTagName = regexp.MustCompile(`[\x00-\x20~^:?*\[\\\x7f]|\.\.|@\{|//|^[/.]|[/.]$|\.lock$|/\.`)
+
+// buildTagTemplate is the value of the flag 'build-tag'. The value is a
+// Go template, that is parsed when the flag is set.
+type buildTagTemplate struct {
+	text     string
+	template *template.Template
+}
+
+func (t *buildTagTemplate) String() string {
+	return t.text
+}
+
+func (t *buildTagTemplate) Set(value string) error {
+	tmpl, err := template.New("build-tag").Option("missingkey=error").Parse(value)
+	if err != nil {
+		return err
+	}
+	t.text = value
+	t.template = tmpl
+	return nil
+}
+
+// buildTagData are the values available in the template of 'build-tag',
+// the values of 'run-name' and the values of the finished run.
+type buildTagData struct {
+	runNameData
+	RunID       int
+	BuildNumber string
+	Commit      string
+}
+
+// buildTag returns the name of the tag of the run from the template.
+func (app *App) buildTag(pr *pipelineRun, commit string) (string, error) {
+	data := buildTagData{
+		runNameData: runNameData{
+			Org:        pr.prj.org.name,
+			Project:    pr.prj.name,
+			Pipeline:   pr.name,
+			Branch:     strings.TrimPrefix(pr.branch, "refs/heads/"),
+			Timestamp:  time.Now().UTC().Format("20060102-150405"),
+			Parameters: app.runParameters(pr),
+		},
+		RunID:       pr.runID,
+		BuildNumber: pr.info.BuildNumber,
+		Commit:      commit,
+	}
+	var name strings.Builder
+	if err := app.buildTagTemplate.template.Execute(&name, data); err != nil {
+		return "", err
+	}
+	tag := strings.TrimPrefix(strings.TrimSpace(name.String()), "refs/tags/")
+	if tag == "" || invalidTagName.MatchString(tag) {
+		return "", fmt.Errorf("'%s' is not a valid name of a Git tag", tag)
+	}
+	return tag, nil
+}
+
+// tagBuiltCommit creates the tag of 'build-tag' on the commit, that the
+// run built. With 'build-tag-message' the tag is an annotated tag,
+// otherwise a lightweight tag. Failures are only logged as warnings, the
+// exit code is not changed.
+func (app *App) tagBuiltCommit(ctx context.Context, pr *pipelineRun) {
+	if err := app.createBuildTag(ctx, pr); err != nil {
+		pr.log.Warnf("Commit of run %d of pipeline '%s' could not be tagged: %v", pr.runID, pr.name, err)
+	}
+}
+
+func (app *App) createBuildTag(ctx context.Context, pr *pipelineRun) error {
+	buildClient, err := pr.prj.org.buildClient(ctx)
+	if err != nil {
+		return err
+	}
+	b, err := app.getBuild(ctx, buildClient, pr)
+	if err != nil {
+		return err
+	}
+	if b.Repository == nil || b.Repository.Id == nil || b.Repository.Type == nil || *b.Repository.Type != "TfsGit" {
+		return fmt.Errorf("the run does not build an Azure Repos Git repository")
+	}
+	if b.SourceVersion == nil || *b.SourceVersion == "" {
+		return fmt.Errorf("the commit of the run is not known")
+	}
+	commit := *b.SourceVersion
+	tag, err := app.buildTag(pr, commit)
+	if err != nil {
+		return err
+	}
+
+	gitClient, err := pr.prj.org.gitClient(ctx)
+	if err != nil {
+		return err
+	}
+	auditCtx, call := app.auditContext(ctx, "tag", pr.name, pr.pipelineID, pr.runID)
+	if app.buildTagMessage != "" {
+		args := &git.CreateAnnotatedTagArgs{
+			TagObject: &git.GitAnnotatedTag{
+				Name:         &tag,
+				Message:      &app.buildTagMessage,
+				TaggedObject: &git.GitObject{ObjectId: &commit},
+			},
+			Project:      &pr.prj.name,
+			RepositoryId: b.Repository.Id,
+		}
+		if _, err = gitClient.CreateAnnotatedTag(auditCtx, *args); err != nil {
+			return err
+		}
+	} else {
+		name := "refs/tags/" + tag
+		oldObjectID := emptyObjectID
+		args := &git.UpdateRefsArgs{
+			RefUpdates: &[]git.GitRefUpdate{{
+				Name:        &name,
+				OldObjectId: &oldObjectID,
+				NewObjectId: &commit,
+			}},
+			RepositoryId: b.Repository.Id,
+			Project:      &pr.prj.name,
+		}
+		results, err := gitClient.UpdateRefs(auditCtx, *args)
+		if err != nil {
+			return err
+		}
+		if results != nil {
+			for _, result := range *results {
+				if result.Success != nil && !*result.Success {
+					err = fmt.Errorf("tag '%s' was rejected: %s", tag, refUpdateReason(result))
+					call.done(0, "error: "+err.Error())
+					return err
+				}
+			}
+		}
+	}
+	call.done(0, "tagged "+tag)
+	pr.log.Infof("Commit %s of run %d of pipeline '%s' is tagged with '%s'.", commit, pr.runID, pr.name, tag)
+	return nil
+}
+
+// refUpdateReason returns the reason, why the update of a ref failed.
+func refUpdateReason(result git.GitRefUpdateResult) string {
+	switch {
+	case result.CustomMessage != nil && *result.CustomMessage != "":
+		return *result.CustomMessage
+	case result.UpdateStatus != nil:
+		return string(*result.UpdateStatus)
+	default:
+		return "unknown reason"
+	}
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"sync"
+)
+
+// subsystem is an optional API, that enriches the outputs. The runs are
+// started and watched without it.
+type subsystem string
+
+const (
+	subsystemTimeline   subsystem = "timeline"
+	subsystemLogs       subsystem = "logs"
+	subsystemArtifacts  subsystem = "artifacts"
+	subsystemApprovals  subsystem = "approvals"
+	subsystemTags       subsystem = "tags"
+	subsystemProperties subsystem = "properties"
+	subsystemTests      subsystem = "tests"
+	subsystemCleanup    subsystem = "cleanup"
+)
+
+// subsystemPermissions are the permissions of the pipelines, that the
+// subsystems need in addition to starting and reading runs.
+var subsystemPermissions = map[subsystem]string{
+	subsystemTimeline:   "View builds",
+	subsystemLogs:       "View builds",
+	subsystemArtifacts:  "View builds",
+	subsystemApprovals:  "View builds",
+	subsystemTags:       "Edit build quality",
+	subsystemProperties: "Update build information",
+	subsystemTests:      "View test runs",
+	subsystemCleanup:    "Delete builds",
+}
+
+// capabilities remembers the subsystems, whose API denied the token. The
+// first denial disables the subsystem for the rest of the program, so
+// that a forbidden API is not called on every poll.
+type capabilities struct {
+	lock     sync.Mutex
+	disabled map[subsystem]string
+}
+
+// available is false, if the subsystem is disabled.
+func (c *capabilities) available(s subsystem) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	_, disabled := c.disabled[s]
+	return !disabled
+}
+
+// denied is true, if the error is a response with the status 401 or 403.
+// The subsystem is disabled then and a warning is logged once.
+func (c *capabilities) denied(logger *log.Entry, s subsystem, err error) bool {
+	if code := responseStatus(err); code != http.StatusUnauthorized && code != http.StatusForbidden {
+		return false
+	}
+	c.lock.Lock()
+	if c.disabled == nil {
+		c.disabled = make(map[subsystem]string)
+	}
+	_, known := c.disabled[s]
+	c.disabled[s] = subsystemPermissions[s]
+	c.lock.Unlock()
+	if !known {
+		logger.Warnf("Azure DevOps denied the %s to the token, the permission '%s' may be missing, they are not requested again: %v", s, subsystemPermissions[s], err)
+	}
+	return true
+}
+
+// unavailable returns the missing permission of every disabled
+// subsystem.
+func (c *capabilities) unavailable() map[string]string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if len(c.disabled) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(c.disabled))
+	for s, permission := range c.disabled {
+		m[string(s)] = permission
+	}
+	return m
+}
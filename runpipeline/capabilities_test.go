@@ -0,0 +1,118 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestCapabilitiesDenied checks, that only a denial disables a
+// subsystem.
+func TestCapabilitiesDenied(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"no error", nil, false},
+		{"unauthorized", azuredevops.WrappedError{StatusCode: intPtr(http.StatusUnauthorized)}, true},
+		{"forbidden", &azuredevops.WrappedError{StatusCode: intPtr(http.StatusForbidden)}, true},
+		{"forbidden download", &statusError{http.StatusForbidden, "403 Forbidden"}, true},
+		{"wrapped", fmt.Errorf("timeline: %w", &statusError{http.StatusForbidden, "403 Forbidden"}), true},
+		{"not found", azuredevops.WrappedError{StatusCode: intPtr(http.StatusNotFound)}, false},
+		{"server error", azuredevops.WrappedError{StatusCode: intPtr(http.StatusInternalServerError)}, false},
+		{"network", errors.New("connection reset by peer"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &capabilities{}
+			if got := c.denied(log.WithField("test", tt.name), subsystemTimeline, tt.err); got != tt.want {
+				t.Errorf("denied() = %v, want %v", got, tt.want)
+			}
+			if got := c.available(subsystemTimeline); got == tt.want {
+				t.Errorf("available() = %v, want %v", got, !tt.want)
+			}
+			if !c.available(subsystemLogs) {
+				t.Error("other subsystem is not available")
+			}
+		})
+	}
+}
+
+// TestCapabilitiesRequestedOnce checks, that a forbidden subsystem is
+// requested only once for all runs and status checks, and that the
+// denial is logged once.
+func TestCapabilitiesRequestedOnce(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		requests int
+		denied   bool
+	}{
+		{"forbidden", http.StatusForbidden, 1, true},
+		{"unauthorized", http.StatusUnauthorized, 1, true},
+		{"server error", http.StatusInternalServerError, 4, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook := test.NewGlobal()
+			defer hook.Reset()
+			f := newFakeServer(t)
+			requests := 0
+			f.route(locationTimeline, "{project}/_apis/build/builds/{buildId}/timeline/{timelineId}", func(req *fakeRequest) (int, interface{}) {
+				requests++
+				return tt.status, map[string]string{"message": "access denied"}
+			})
+			app := &App{clock: &serverClock{}, budget: newAPIBudget(0, http.DefaultTransport), stageTimeouts: stageSLOs{{stage: "Deploy", max: 30 * time.Minute}}}
+			runs := []*pipelineRun{testRun(f.project(), "build", 1, 10), testRun(f.project(), "deploy", 2, 11)}
+
+			for check := 0; check < 2; check++ {
+				for _, pr := range runs {
+					app.checkStageTimeouts(context.Background(), pr)
+				}
+			}
+			if requests != tt.requests {
+				t.Errorf("%d requests of the timeline, want %d", requests, tt.requests)
+			}
+			logged := 0
+			for _, e := range hook.AllEntries() {
+				if strings.HasPrefix(e.Message, "Azure DevOps denied the timeline") {
+					logged++
+				}
+			}
+			if tt.denied && logged != 1 {
+				t.Errorf("denial logged %d times, want once", logged)
+			}
+			want := map[string]string(nil)
+			if tt.denied {
+				want = map[string]string{"timeline": "View builds"}
+			}
+			if got := app.capabilities.unavailable(); fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("unavailable() = %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"fmt"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/build"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/pipelines"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// processTypeDesigner is the process type of classic build
+	// definitions, YAML pipelines have the process type 2.
+	processTypeDesigner = 1
+	// triggerPipelines and triggerBuilds are the APIs, that start the runs.
+	triggerPipelines = "pipelines"
+	triggerBuilds    = "builds"
+)
+
+// resolveDefinitionKinds reads the definitions of the pipelines and marks
+// the classic build definitions, that the pipelines API does not handle
+// consistently. Their runs are queued and watched with the builds API.
+// The program ends with exit code 40, if a classic build definition gets
+// template parameters or run parameters of the run template, that it
+// does not take. If a definition can not be read, the pipeline is started
+// as YAML pipeline.
+func (app *App) resolveDefinitionKinds(ctx context.Context, runs []*pipelineRun) {
+	defer app.timer.begin("definition")()
+	for _, pr := range runs {
+		definition, err := app.getDefinition(ctx, pr.prj, pr.pipelineID)
+		if err != nil {
+			log.Warnf("Definition of pipeline '%s' could not be read, it is started as YAML pipeline: %v", pr.name, err)
+			continue
+		}
+		pr.classic = classicDefinition(definition)
+		if !pr.classic {
+			continue
+		}
+		log.Infof("Pipeline '%s' is a classic build definition, it is queued with the builds API.", pr.name)
+		if parameters := app.runParameters(pr); len(parameters) > 0 {
+			log.Errorf("Pipeline '%s' is a classic build definition, that takes no template parameters %s. Pass its variables with parameter 'var' instead of 'param'.",
+				pr.name, formatParameters(maskParameters(parameters)))
+			app.fail(40, fmt.Errorf("classic build definition '%s' takes no template parameters", pr.name))
+		}
+		if unsupported := app.unsupportedTemplateField(); unsupported != "" {
+			log.Errorf("Pipeline '%s' is a classic build definition, that does not take '%s' of the run template.", pr.name, unsupported)
+			app.fail(40, fmt.Errorf("classic build definition '%s' does not take '%s' of the run template", pr.name, unsupported))
+		}
+	}
+}
+
+// classicDefinition is true, if the definition is a classic build
+// definition of the designer.
+func classicDefinition(definition *build.BuildDefinition) bool {
+	if process, ok := definition.Process.(map[string]interface{}); ok {
+		if processType, ok := process["type"].(float64); ok {
+			return processType == processTypeDesigner
+		}
+	}
+	return false
+}
+
+// triggerAPI returns the API, that starts the run. Classic build
+// definitions and runs on an agent pool or with demands are queued with
+// the builds API.
+func (app *App) triggerAPI(pr *pipelineRun) string {
+	if pr.classic || app.queueBuilds() {
+		return triggerBuilds
+	}
+	return triggerPipelines
+}
+
+// readRun reads the run with the pipelines API or, if it is a run of a
+// classic build definition, with the builds API.
+func (app *App) readRun(ctx context.Context, pr *pipelineRun) (*pipelines.Run, error) {
+	if pr.classic {
+		client, err := pr.prj.org.buildClient(ctx)
+		if err != nil {
+			return nil, err
+		}
+		b, err := app.getBuild(ctx, client, pr)
+		if err != nil {
+			return nil, err
+		}
+		if b.StartTime != nil {
+			pr.info.Started = b.StartTime.Time
+		}
+		return buildRun(b), nil
+	}
+	args := &pipelines.GetRunArgs{
+		Project:    &pr.prj.name,
+		PipelineId: &pr.pipelineID,
+		RunId:      &pr.runID,
+	}
+	return pr.prj.org.pipelines.GetRun(ctx, *args)
+}
+
+// buildRun converts the build to a run of the pipelines API, so that the
+// runs of both APIs are watched and their results are mapped the same way.
+func buildRun(b *build.Build) *pipelines.Run {
+	state := pipelines.RunStateValues.InProgress
+	if b.Status != nil {
+		switch *b.Status {
+		case build.BuildStatusValues.Completed:
+			state = pipelines.RunStateValues.Completed
+		case build.BuildStatusValues.Cancelling:
+			state = pipelines.RunStateValues.Canceling
+		}
+	}
+	url := ""
+	if b.Url != nil {
+		url = *b.Url
+	}
+	run := &pipelines.Run{
+		Id:           b.Id,
+		Name:         b.BuildNumber,
+		State:        &state,
+		Links:        b.Links,
+		Url:          &url,
+		CreatedDate:  b.QueueTime,
+		FinishedDate: b.FinishTime,
+	}
+	if b.Result != nil {
+		result := pipelines.RunResult(*b.Result)
+		run.Result = &result
+	}
+	if b.Definition != nil {
+		run.Pipeline = &pipelines.PipelineReference{Id: b.Definition.Id, Name: b.Definition.Name}
+	}
+	return run
+}
@@ -0,0 +1,51 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/build"
+)
+
+// deleteSucceeded deletes the run, that succeeded, so that short-lived
+// runs, eg. of smoke tests, don't pile up in the history of the pipeline.
+// It is called after all outputs of the run are collected. Failures are
+// only logged as warnings, the exit code is not changed.
+func (app *App) deleteSucceeded(ctx context.Context, pr *pipelineRun) {
+	if pr.runID <= 0 || !app.capabilities.available(subsystemCleanup) || !app.budget.allowOptional("cleanupOnSuccess") {
+		return
+	}
+	client, err := pr.prj.org.buildClient(ctx)
+	if err != nil {
+		pr.log.Warnf("Run %d of pipeline '%s' could not be deleted: %v", pr.runID, pr.name, err)
+		return
+	}
+	args := &build.DeleteBuildArgs{
+		Project: &pr.prj.name,
+		BuildId: &pr.runID,
+	}
+	auditCtx, call := app.auditContext(ctx, "delete", pr.name, pr.pipelineID, pr.runID)
+	if err = client.DeleteBuild(auditCtx, *args); err != nil {
+		if !app.capabilities.denied(pr.log, subsystemCleanup, err) {
+			pr.log.Warnf("Run %d of pipeline '%s' succeeded, but could not be deleted: %v", pr.runID, pr.name, err)
+		}
+		return
+	}
+	call.done(0, "deleted")
+	pr.deleted = true
+	pr.log.Infof("Run %d of pipeline '%s' succeeded and is deleted.", pr.runID, pr.name)
+}
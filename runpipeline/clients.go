@@ -0,0 +1,173 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/build"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/git"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/pipelines"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/taskagent"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/test"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/workitemtracking"
+	"os"
+	"strings"
+	"sync"
+)
+
+// organization is the connection to an Azure DevOps organization. The
+// API clients are created on demand and cached.
+type organization struct {
+	name       string
+	connection *azuredevops.Connection
+	pipelines  pipelines.Client
+
+	lock      sync.Mutex
+	build     build.Client
+	git       git.Client
+	taskAgent taskagent.Client
+	test      test.Client
+	workItems workitemtracking.Client
+	// definitions are the read build definitions by project and id
+	definitions map[string]*build.BuildDefinition
+}
+
+// project is a project of an organization.
+type project struct {
+	org  *organization
+	name string
+}
+
+func (o *organization) buildClient(ctx context.Context) (build.Client, error) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.build == nil {
+		client, err := build.NewClient(ctx, o.connection)
+		if err != nil {
+			return nil, err
+		}
+		o.build = client
+	}
+	return o.build, nil
+}
+
+// definition returns the cached build definition.
+func (o *organization) definition(key string) *build.BuildDefinition {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.definitions[key]
+}
+
+// cacheDefinition caches the build definition, it is read once per
+// program.
+func (o *organization) cacheDefinition(key string, definition *build.BuildDefinition) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.definitions == nil {
+		o.definitions = make(map[string]*build.BuildDefinition)
+	}
+	o.definitions[key] = definition
+}
+
+func (o *organization) gitClient(ctx context.Context) (git.Client, error) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.git == nil {
+		client, err := git.NewClient(ctx, o.connection)
+		if err != nil {
+			return nil, err
+		}
+		o.git = client
+	}
+	return o.git, nil
+}
+
+func (o *organization) taskAgentClient(ctx context.Context) (taskagent.Client, error) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.taskAgent == nil {
+		client, err := taskagent.NewClient(ctx, o.connection)
+		if err != nil {
+			return nil, err
+		}
+		o.taskAgent = client
+	}
+	return o.taskAgent, nil
+}
+
+func (o *organization) testClient(ctx context.Context) (test.Client, error) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.test == nil {
+		client, err := test.NewClient(ctx, o.connection)
+		if err != nil {
+			return nil, err
+		}
+		o.test = client
+	}
+	return o.test, nil
+}
+
+func (o *organization) workItemClient(ctx context.Context) (workitemtracking.Client, error) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.workItems == nil {
+		client, err := workitemtracking.NewClient(ctx, o.connection)
+		if err != nil {
+			return nil, err
+		}
+		o.workItems = client
+	}
+	return o.workItems, nil
+}
+
+// project returns the project and creates the connection to its
+// organization, if the organization is used for the first time.
+func (app *App) project(ctx context.Context, org string, prj string) *project {
+	app.orgsLock.Lock()
+	defer app.orgsLock.Unlock()
+	if app.orgs == nil {
+		app.orgs = make(map[string]*organization)
+	}
+	o, ok := app.orgs[org]
+	if !ok {
+		client, connection := initClient(ctx, app.organizationURL(org), app.orgToken(org))
+		o = &organization{name: org, connection: connection, pipelines: client}
+		app.orgs[org] = o
+	}
+	return &project{org: o, name: prj}
+}
+
+// orgToken returns the token of the organization from the environment
+// variable RUNPIPELINE_TOKEN_<ORG>, the configuration file or the
+// keyring. The token of the command line is the fallback.
+func (app *App) orgToken(org string) string {
+	if org == app.org {
+		return app.token
+	}
+	if token := os.Getenv(envPrefix + "TOKEN_" + envNameInvalidChars.ReplaceAllString(strings.ToUpper(org), "_")); token != "" {
+		return token
+	}
+	if token, ok := app.orgTokens[org]; ok {
+		return token
+	}
+	if token, err := loadCredential(org); err == nil && token != "" {
+		return token
+	}
+	return app.token
+}
@@ -0,0 +1,156 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// clockSkewTolerance is the offset of the local clock, that is ignored.
+// The 'Date' header has a resolution of one second and the request takes
+// some time, so smaller offsets can not be measured.
+const clockSkewTolerance = 2 * time.Second
+
+// serverClock estimates the time of Azure DevOps from the 'Date' header
+// of the responses. Durations of runs are computed from the timestamps of
+// the server, the local clock is only used for the phases of the program.
+// If a duration mixes both, eg. the elapsed time of a running run, the
+// estimated time of the server is used instead of the local clock.
+type serverClock struct {
+	lock sync.Mutex
+	// skew is the offset of the local clock, it is positive, if the local
+	// clock is ahead of the server
+	skew   time.Duration
+	warned bool
+}
+
+// observe updates the skew from the 'Date' header of a response. The
+// time of the server lies between the request and the response, offsets
+// within this window and the tolerance are no skew.
+func (c *serverClock) observe(date string, requested time.Time, received time.Time) {
+	server, err := http.ParseTime(date)
+	if err != nil {
+		return
+	}
+	skew := time.Duration(0)
+	switch {
+	case server.Before(requested.Add(-clockSkewTolerance)):
+		skew = requested.Sub(server)
+	case server.After(received.Add(clockSkewTolerance)):
+		skew = received.Sub(server)
+	}
+	c.lock.Lock()
+	changed := (skew - c.skew).Abs() >= clockSkewTolerance
+	if changed {
+		c.skew = skew
+	}
+	c.lock.Unlock()
+	if changed {
+		log.Debugf("Estimated clock skew to Azure DevOps is %v.", skew.Round(time.Second))
+	}
+}
+
+// offset returns the estimated skew of the local clock.
+func (c *serverClock) offset() time.Duration {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.skew
+}
+
+// now returns the estimated time of the server.
+func (c *serverClock) now() time.Time {
+	return time.Now().Add(-c.offset())
+}
+
+// since returns the time since the timestamp of the server. A negative
+// duration is clamped to zero and logged as skew once.
+func (c *serverClock) since(logger *log.Entry, what string, t time.Time) time.Duration {
+	elapsed := c.now().Sub(t)
+	if elapsed < -clockSkewTolerance {
+		c.warnSkew(logger, what, elapsed)
+	}
+	if elapsed < 0 {
+		return 0
+	}
+	return elapsed
+}
+
+// warnSkew logs, that a duration is negative or implausible, with the
+// measured offset. It is logged once, skew is a property of the agent.
+func (c *serverClock) warnSkew(logger *log.Entry, what string, measured time.Duration) {
+	c.lock.Lock()
+	warned := c.warned
+	c.warned = true
+	skew := c.skew
+	c.lock.Unlock()
+	if !warned {
+		logger.Warnf("The %s is %v, the clock of this agent may be skewed (estimated offset %v), the value is clamped.",
+			what, measured.Round(time.Second), skew.Round(time.Second))
+	}
+}
+
+// serverDuration returns the duration between two timestamps of the
+// server. Negative durations are clamped to zero and logged as skew.
+func (c *serverClock) serverDuration(logger *log.Entry, what string, from time.Time, to time.Time) time.Duration {
+	if from.IsZero() || to.IsZero() {
+		return 0
+	}
+	d := to.Sub(from)
+	if d < 0 {
+		c.warnSkew(logger, what, d)
+		return 0
+	}
+	return d
+}
+
+// runElapsed returns the time since the creation of the run. The creation
+// time is a timestamp of the server, it is compared with the estimated
+// time of the server. If this time is implausible for a run, that was
+// triggered by the program, the local time since the trigger is used.
+func (app *App) runElapsed(pr *pipelineRun) time.Duration {
+	if pr.info.Created.IsZero() {
+		return 0
+	}
+	elapsed := app.clock.since(pr.log, "elapsed time of the run", pr.info.Created)
+	if !pr.triggered.IsZero() {
+		if local := time.Since(pr.triggered); elapsed > local+clockSkewTolerance {
+			app.clock.warnSkew(pr.log, "elapsed time of the run", elapsed)
+			return local
+		}
+	}
+	return elapsed
+}
+
+// clockTransport passes the 'Date' header of every response to the clock.
+type clockTransport struct {
+	clock *serverClock
+	next  http.RoundTripper
+}
+
+func (t *clockTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	requested := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	if err == nil {
+		if date := resp.Header.Get("Date"); date != "" {
+			t.clock.observe(date, requested, time.Now())
+		}
+	}
+	return resp, err
+}
@@ -0,0 +1,209 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// warnings returns the number of logged warnings.
+func warnings(hook *test.Hook) int {
+	count := 0
+	for _, e := range hook.AllEntries() {
+		if e.Level == log.WarnLevel {
+			count++
+		}
+	}
+	return count
+}
+
+// near is true, if the durations differ by less than a second.
+func near(got time.Duration, want time.Duration) bool {
+	return (got - want).Abs() < time.Second
+}
+
+// TestServerClockObserve checks the skew, that is estimated from the
+// 'Date' header of a response.
+func TestServerClockObserve(t *testing.T) {
+	requested := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	received := requested.Add(time.Second)
+	tests := []struct {
+		name   string
+		before time.Duration
+		date   string
+		want   time.Duration
+	}{
+		{"within the request", 0, requested.Format(http.TimeFormat), 0},
+		{"within the tolerance before", 0, requested.Add(-2 * time.Second).Format(http.TimeFormat), 0},
+		{"within the tolerance after", 0, received.Add(2 * time.Second).Format(http.TimeFormat), 0},
+		{"local clock ahead", 0, requested.Add(-10 * time.Minute).Format(http.TimeFormat), 10 * time.Minute},
+		{"local clock behind", 0, received.Add(10 * time.Minute).Format(http.TimeFormat), -10 * time.Minute},
+		{"skew fixed", 10 * time.Minute, requested.Format(http.TimeFormat), 0},
+		{"change within the tolerance", 10 * time.Minute, requested.Add(-10*time.Minute - time.Second).Format(http.TimeFormat), 10 * time.Minute},
+		{"invalid date", 10 * time.Minute, "yesterday", 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &serverClock{skew: tt.before}
+			c.observe(tt.date, requested, received)
+			if got := c.offset(); got != tt.want {
+				t.Errorf("offset() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestServerClockSince checks the elapsed time since a timestamp of the
+// server for skewed local clocks.
+func TestServerClockSince(t *testing.T) {
+	tests := []struct {
+		name string
+		skew time.Duration
+		// at is the timestamp relative to the local time
+		at   time.Duration
+		want time.Duration
+		warn bool
+	}{
+		{"no skew", 0, -time.Minute, time.Minute, false},
+		{"local clock ahead", 10 * time.Minute, -11 * time.Minute, time.Minute, false},
+		{"local clock behind", -10 * time.Minute, 9 * time.Minute, time.Minute, false},
+		{"unknown skew ahead", 0, 5 * time.Minute, 0, true},
+		{"within the tolerance", 0, time.Second, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook := test.NewGlobal()
+			defer hook.Reset()
+			c := &serverClock{skew: tt.skew}
+			got := c.since(log.WithField("test", tt.name), "elapsed time", time.Now().Add(tt.at))
+			if !near(got, tt.want) {
+				t.Errorf("since() = %v, want %v", got, tt.want)
+			}
+			if got := warnings(hook) > 0; got != tt.warn {
+				t.Errorf("warned = %v, want %v", got, tt.warn)
+			}
+		})
+	}
+}
+
+// TestServerDuration checks the duration between two timestamps of the
+// server, that may be skewed against each other.
+func TestServerDuration(t *testing.T) {
+	base := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		from time.Time
+		to   time.Time
+		want time.Duration
+		warn bool
+	}{
+		{"duration", base, base.Add(90 * time.Second), 90 * time.Second, false},
+		{"same time", base, base, 0, false},
+		{"end before start", base, base.Add(-5 * time.Second), 0, true},
+		{"no start", time.Time{}, base, 0, false},
+		{"no end", base, time.Time{}, 0, false},
+		{"other time zone", base, base.In(time.FixedZone("CET", 3600)).Add(time.Minute), time.Minute, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook := test.NewGlobal()
+			defer hook.Reset()
+			c := &serverClock{}
+			if got := c.serverDuration(log.WithField("test", tt.name), "duration", tt.from, tt.to); got != tt.want {
+				t.Errorf("serverDuration() = %v, want %v", got, tt.want)
+			}
+			if got := warnings(hook) > 0; got != tt.warn {
+				t.Errorf("warned = %v, want %v", got, tt.warn)
+			}
+		})
+	}
+}
+
+// TestServerClockWarnsOnce checks, that the skew is logged only once.
+func TestServerClockWarnsOnce(t *testing.T) {
+	hook := test.NewGlobal()
+	defer hook.Reset()
+	c := &serverClock{}
+	logger := log.WithField("test", "once")
+	base := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	c.since(logger, "elapsed time", time.Now().Add(time.Hour))
+	c.serverDuration(logger, "duration", base, base.Add(-time.Minute))
+	c.since(logger, "elapsed time", time.Now().Add(time.Hour))
+	if got := warnings(hook); got != 1 {
+		t.Errorf("%d warnings, want 1", got)
+	}
+}
+
+// TestRunElapsed checks, that the elapsed time of a run falls back to the
+// local time since the trigger, if the server time is implausible.
+func TestRunElapsed(t *testing.T) {
+	tests := []struct {
+		name    string
+		skew    time.Duration
+		created time.Duration
+		// triggered is the local time of the trigger, zero for runs, that
+		// were not triggered by the program
+		triggered time.Duration
+		want      time.Duration
+	}{
+		{"not created", 0, 0, -time.Minute, 0},
+		{"triggered", 0, -time.Minute, -time.Minute, time.Minute},
+		{"not triggered", 0, -time.Hour, 0, time.Hour},
+		{"server ahead", 0, -time.Hour, -time.Minute, time.Minute},
+		{"server ahead with known skew", -59 * time.Minute, -time.Hour, -time.Minute, time.Minute},
+		{"server behind", 0, 10 * time.Minute, -time.Minute, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &App{clock: &serverClock{skew: tt.skew}}
+			pr := testRun(&project{name: "prj"}, "build", 1, 10)
+			now := time.Now()
+			if tt.created != 0 {
+				pr.info.Created = now.Add(tt.created)
+			}
+			if tt.triggered != 0 {
+				pr.triggered = now.Add(tt.triggered)
+			}
+			if got := app.runElapsed(pr); !near(got, tt.want) {
+				t.Errorf("runElapsed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestClockTransport checks, that the skew is estimated from the responses.
+func TestClockTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat))
+	}))
+	defer server.Close()
+	c := &serverClock{}
+	client := &http.Client{Transport: &clockTransport{clock: c, next: http.DefaultTransport}}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := c.offset(); (got - time.Hour).Abs() > clockSkewTolerance {
+		t.Errorf("offset() = %v, want %v", got, time.Hour)
+	}
+}
@@ -0,0 +1,208 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/pipelines"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// command is the subcommand of the command line. A command line without
+// subcommand is the command 'run', so that the command lines of older
+// releases keep working.
+type command string
+
+const (
+	commandRun    command = "run"
+	commandStatus command = "status"
+	commandCancel command = "cancel"
+	commandList   command = "list"
+)
+
+// connectionFlags are the flags of every command. They define the
+// connection to Azure DevOps, the log and the API calls.
+var connectionFlags = []string{"org", "prj", "ado-base-url", "api-version", "user-agent", "user-agent-replace", "token", "timeout", "max-api-calls", "audit-log-file", "record", "replay", "generate-fixtures", "enforce-min-scopes", "token-expiry-warn", "fail-on-expiring-token", "connect-retries", "verify-connectivity", "fail-on-ado-degraded", "timing", "explain", "w", "i", "v", "h"}
+
+// pipelineFlags are the flags, that select the pipelines and the run of
+// the commands 'status' and 'cancel'.
+var pipelineFlags = []string{"pipeline", "pipeline-id", "batch-file", "pipeline-group-file", "group", "config", "pipeline-yaml-path", "pipeline-exists-retry", "pipeline-exists-timeout", "include-disabled-pipelines", "run-id"}
+
+// resultFlags are the flags, that write the result of a command.
+var resultFlags = []string{"output", "statsd-addr", "influx-file", "env-file", "env-file-append", "line-endings"}
+
+// commandFlags are the flags of the commands. The command 'run' has all
+// flags of the program, the other commands only the flags, that they use,
+// so that their usage lists them and other flags are rejected.
+var commandFlags = map[command][][]string{
+	commandStatus: {connectionFlags, pipelineFlags, resultFlags, {"branch", "strict-report", "report-md", "telemetry-endpoint", "telemetry-token", "on-success", "on-failure", "on-complete", "hook-failures-fatal", "best-effort"}},
+	commandCancel: {connectionFlags, pipelineFlags, resultFlags},
+	commandList:   {connectionFlags},
+}
+
+// useCommandFlags replaces the flag set of the program with the flag set
+// of the command, if the command has not all flags. The flags of the new
+// set share the values with the flags of the program.
+func useCommandFlags(cmd command) {
+	groups, ok := commandFlags[cmd]
+	if !ok {
+		return
+	}
+	all := flag.CommandLine
+	flagSet := flag.NewFlagSet(fmt.Sprintf("%s %s", all.Name(), cmd), all.ErrorHandling())
+	flagSet.SetOutput(all.Output())
+	for _, names := range groups {
+		for _, name := range names {
+			f := all.Lookup(name)
+			flagSet.Var(f.Value, f.Name, f.Usage)
+		}
+	}
+	// the usage of showUsage lists the flags of the new set
+	flagSet.Usage = func() { flag.Usage() }
+	flag.CommandLine = flagSet
+}
+
+// isCommand is true, if the first argument of the command line is not a
+// flag of the program, but a subcommand, including the commands
+// 'completion' and 'help' of cobra and the requests of the shell
+// completion. Unknown commands are reported by cobra.
+func isCommand(arg string) bool {
+	return !strings.HasPrefix(arg, "-") || arg == "--version"
+}
+
+// executeCommand runs the subcommand of the command line. The flags of
+// the commands are parsed by the package flag like without subcommand,
+// so that they keep the single dash.
+func executeCommand(buildVersion string) {
+	root := &cobra.Command{
+		Use:     "runPipeline",
+		Short:   "Starts and watches the runs of Azure DevOps pipelines",
+		Long:    "Starts and watches the runs of Azure DevOps pipelines. Without command the flags are the flags of 'run'.",
+		Version: buildVersion,
+		// errors of the command line are reported like the other errors
+		SilenceErrors: true,
+		SilenceUsage:  true,
+	}
+	// '-v' is the verbose log of the commands, not the version
+	root.Flags().Bool("version", false, "Prints the version of runPipeline")
+	for _, c := range []struct {
+		name  command
+		use   string
+		short string
+	}{
+		{commandRun, "run -org <org> -prj <project> -pipeline <name> [flags]", "Starts the pipelines and waits for the runs"},
+		{commandStatus, "status -org <org> -prj <project> -pipeline <name> [-run-id <id>] [flags]", "Reports the run of 'run-id' or the latest completed run of the pipelines"},
+		{commandCancel, "cancel -org <org> -prj <project> -run-id <id> [flags]", "Requests the cancellation of the run of 'run-id'"},
+		{commandList, "list -org <org> -prj <project> [flags]", "Lists the pipelines of the project"},
+	} {
+		name := c.name
+		root.AddCommand(&cobra.Command{
+			Use:   c.use,
+			Short: c.short,
+			Long:  c.short + ". The flags are listed with '-h'.",
+			// the flags are parsed by the package flag
+			DisableFlagParsing: true,
+			ValidArgsFunction:  completeFlags,
+			Run: func(cmd *cobra.Command, args []string) {
+				runCommand(buildVersion, name, args)
+			},
+		})
+	}
+	if err := root.Execute(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		fmt.Fprintf(os.Stderr, "Run '%s --help' for the commands.\n", root.Name())
+		os.Exit(5)
+	}
+}
+
+// completeFlags returns the flags of the command, that start with the
+// word, for the shell completion. Values of flags are completed as
+// file names.
+func completeFlags(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if !strings.HasPrefix(toComplete, "-") {
+		return nil, cobra.ShellCompDirectiveDefault
+	}
+	app := &App{flagsOnly: true, command: command(cmd.Name())}
+	app.ParseCommandLine()
+	var names []string
+	flag.VisitAll(func(f *flag.Flag) {
+		if name := "-" + f.Name; strings.HasPrefix(name, toComplete) {
+			usage := strings.SplitN(f.Usage, "\n", 2)[0]
+			names = append(names, name+"\t"+usage)
+		}
+	})
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+// listPipelines prints the pipelines of the project of 'prj' and returns
+// the exit code.
+func (app *App) listPipelines(ctx context.Context) int {
+	var list []pipelines.Pipeline
+	token := ""
+	for {
+		page, next, err := app.listPipelinesPage(ctx, app.defaultProject, token)
+		if err != nil {
+			log.Errorf("Pipelines of project '%s' could not be listed: %v", app.prj, err)
+			return 1
+		}
+		list = append(list, page...)
+		if next == "" {
+			break
+		}
+		token = next
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Id\tPipeline\tFolder")
+	for _, p := range list {
+		folder := ""
+		if p.Folder != nil {
+			folder = *p.Folder
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", intValue(p.Id), stringValue(p.Name), folder)
+	}
+	w.Flush()
+	return 0
+}
+
+// cancelCommandRun requests the cancellation of the run of 'run-id' and
+// returns the exit code. The pipelines are optional, they are only used
+// for the log and the audit log.
+func (app *App) cancelCommandRun(ctx context.Context) int {
+	pr := &pipelineRun{prj: app.defaultProject}
+	if len(app.runs) > 0 {
+		pr = app.runs[0]
+	}
+	pr.runID = app.runID
+	client, err := pr.prj.org.buildClient(ctx)
+	if err == nil {
+		err = app.cancelBuild(ctx, client, pr, app.runID)
+	}
+	if err != nil {
+		log.Errorf("Run %d could not be canceled: %v", app.runID, err)
+		return 43
+	}
+	if app.output.console() {
+		fmt.Printf("Cancellation of run %d is requested.\n", app.runID)
+	}
+	return 0
+}
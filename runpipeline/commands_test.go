@@ -0,0 +1,121 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"bytes"
+	"flag"
+	"strings"
+	"testing"
+)
+
+func TestIsCommand(t *testing.T) {
+	tests := []struct {
+		arg  string
+		want bool
+	}{
+		{"run", true},
+		{"status", true},
+		{"completion", true},
+		{"__complete", true},
+		{"--version", true},
+		{"-org", false},
+		{"-h", false},
+		{"--help", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			if got := isCommand(tt.arg); got != tt.want {
+				t.Errorf("isCommand(%s) = %v, want %v", tt.arg, got, tt.want)
+			}
+		})
+	}
+}
+
+// commandFlagSet defines the flags of the command on a new flag set of
+// the program, that returns the parse errors, and returns it.
+func commandFlagSet(t *testing.T, cmd command) (*flag.FlagSet, *bytes.Buffer) {
+	commandLine, usage := flag.CommandLine, flag.Usage
+	t.Cleanup(func() {
+		flag.CommandLine, flag.Usage = commandLine, usage
+	})
+	var out bytes.Buffer
+	flag.CommandLine = flag.NewFlagSet("runPipeline", flag.ContinueOnError)
+	flag.CommandLine.SetOutput(&out)
+	app := &App{flagsOnly: true, command: cmd}
+	app.ParseCommandLine()
+	return flag.CommandLine, &out
+}
+
+func TestCommandFlags(t *testing.T) {
+	tests := []struct {
+		cmd      command
+		usage    string
+		flags    []string
+		notFlags []string
+	}{
+		{commandRun, "Usage of runPipeline:", []string{"org", "pipeline", "trigger-max-retries", "run-id", "h"}, nil},
+		{commandStatus, "Usage of runPipeline status:", []string{"org", "pipeline", "run-id", "strict-report", "output", "h"}, []string{"trigger-max-retries", "param", "lock-dir"}},
+		{commandCancel, "Usage of runPipeline cancel:", []string{"org", "pipeline", "run-id", "output", "h"}, []string{"trigger-max-retries", "strict-report", "param"}},
+		{commandList, "Usage of runPipeline list:", []string{"org", "prj", "token", "h"}, []string{"pipeline", "run-id", "trigger-max-retries", "param"}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.cmd), func(t *testing.T) {
+			flagSet, out := commandFlagSet(t, tt.cmd)
+			flagSet.Usage()
+			usage := out.String()
+			if !strings.HasPrefix(usage, tt.usage+"\n") {
+				t.Errorf("usage starts with %q, want %q", strings.SplitN(usage, "\n", 2)[0], tt.usage)
+			}
+			for _, name := range tt.flags {
+				if flagSet.Lookup(name) == nil {
+					t.Errorf("flag '%s' is missing", name)
+				}
+				if !strings.Contains(usage, "  -"+name+" ") && !strings.Contains(usage, "  -"+name+"\t") && !strings.Contains(usage, "  -"+name+"\n") {
+					t.Errorf("usage does not list flag '%s'", name)
+				}
+			}
+			for _, name := range tt.notFlags {
+				if flagSet.Lookup(name) != nil {
+					t.Errorf("flag '%s' is a flag of the command", name)
+				}
+				if strings.Contains(usage, "  -"+name+" ") || strings.Contains(usage, "  -"+name+"\n") {
+					t.Errorf("usage lists flag '%s'", name)
+				}
+				out.Reset()
+				if err := flagSet.Parse([]string{"-" + name, "1"}); err == nil {
+					t.Errorf("flag '%s' is accepted", name)
+				}
+			}
+		})
+	}
+}
+
+func TestCommandFlagsShareValues(t *testing.T) {
+	flagSet, _ := commandFlagSet(t, commandList)
+	if err := flagSet.Parse([]string{"-org", "org", "--prj", "prj"}); err != nil {
+		t.Fatalf("flags could not be parsed: %v", err)
+	}
+	for name, want := range map[string]string{"org": "org", "prj": "prj"} {
+		if got := flagSet.Lookup(name).Value.String(); got != want {
+			t.Errorf("flag '%s' = %q, want %q", name, got, want)
+		}
+	}
+	if !isFlagSet("org") || isFlagSet("token") {
+		t.Errorf("isFlagSet does not use the flags of the command")
+	}
+}
@@ -0,0 +1,158 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"fmt"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/build"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/git"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/pipelines"
+	"regexp"
+	"strconv"
+)
+
+const commitStatusGenre = "runpipeline"
+
+// commitStatusMode is the value of the flag 'set-commit-status'. The flag
+// can be used without value for the final status only.
+type commitStatusMode string
+
+const (
+	commitStatusOff          commitStatusMode = ""
+	commitStatusFinal        commitStatusMode = "final"
+	commitStatusPendingFinal commitStatusMode = "pending+final"
+)
+
+func (m *commitStatusMode) String() string {
+	return string(*m)
+}
+
+func (m *commitStatusMode) Set(value string) error {
+	switch value {
+	case "true", "final":
+		*m = commitStatusFinal
+	case "false":
+		*m = commitStatusOff
+	case "pending+final":
+		*m = commitStatusPendingFinal
+	default:
+		return fmt.Errorf("unknown mode '%s', use 'final' or 'pending+final'", value)
+	}
+	return nil
+}
+
+func (m *commitStatusMode) IsBoolFlag() bool {
+	return true
+}
+
+var pullRequestRef = regexp.MustCompile(`^refs/pull/(\d+)/merge$`)
+
+// setCommitStatus posts the state of the run to the commit, that was
+// built. For runs of a pull request the status is posted to the pull
+// request. Failures are only logged as warnings.
+func (app *App) setCommitStatus(ctx context.Context, pr *pipelineRun, state git.GitStatusState, description string) {
+	if !app.budget.allowOptional("commitStatus") {
+		return
+	}
+	if err := app.postCommitStatus(ctx, pr, state, description); err != nil {
+		pr.log.Warnf("Status '%s' for pipeline '%s' could not be posted: %v", state, pr.name, err)
+	}
+}
+
+func (app *App) postCommitStatus(ctx context.Context, pr *pipelineRun, state git.GitStatusState, description string) error {
+	buildClient, err := pr.prj.org.buildClient(ctx)
+	if err != nil {
+		return err
+	}
+	args := &build.GetBuildArgs{
+		Project: &pr.prj.name,
+		BuildId: &pr.runID,
+	}
+	b, err := buildClient.GetBuild(ctx, *args)
+	if err != nil {
+		return err
+	}
+	if b.Repository == nil || b.Repository.Id == nil || b.Repository.Type == nil || *b.Repository.Type != "TfsGit" {
+		return fmt.Errorf("the run does not build an Azure Repos Git repository")
+	}
+
+	gitClient, err := pr.prj.org.gitClient(ctx)
+	if err != nil {
+		return err
+	}
+	genre := commitStatusGenre
+	statusContext := &git.GitStatusContext{
+		Genre: &genre,
+		Name:  &pr.name,
+	}
+	targetURL := pr.info.URL
+
+	if b.SourceBranch != nil {
+		if m := pullRequestRef.FindStringSubmatch(*b.SourceBranch); m != nil {
+			pullRequestID, _ := strconv.Atoi(m[1])
+			prArgs := &git.CreatePullRequestStatusArgs{
+				Status: &git.GitPullRequestStatus{
+					Context:     statusContext,
+					Description: &description,
+					State:       &state,
+					TargetUrl:   &targetURL,
+				},
+				RepositoryId:  b.Repository.Id,
+				PullRequestId: &pullRequestID,
+				Project:       &pr.prj.name,
+			}
+			_, err = gitClient.CreatePullRequestStatus(ctx, *prArgs)
+			if err == nil {
+				pr.log.Infof("Status '%s' posted to pull request %d.", state, pullRequestID)
+			}
+			return err
+		}
+	}
+
+	if b.SourceVersion == nil || *b.SourceVersion == "" {
+		return fmt.Errorf("the commit of the run is not known yet")
+	}
+	commitArgs := &git.CreateCommitStatusArgs{
+		GitCommitStatusToCreate: &git.GitStatus{
+			Context:     statusContext,
+			Description: &description,
+			State:       &state,
+			TargetUrl:   &targetURL,
+		},
+		CommitId:     b.SourceVersion,
+		RepositoryId: b.Repository.Id,
+		Project:      &pr.prj.name,
+	}
+	_, err = gitClient.CreateCommitStatus(ctx, *commitArgs)
+	if err == nil {
+		pr.log.Infof("Status '%s' posted to commit %s.", state, *b.SourceVersion)
+	}
+	return err
+}
+
+// commitStatusState maps the result of a run to the state of a status.
+func commitStatusState(result string) git.GitStatusState {
+	switch pipelines.RunResult(result) {
+	case pipelines.RunResultValues.Succeeded:
+		return git.GitStatusStateValues.Succeeded
+	case pipelines.RunResultValues.Failed:
+		return git.GitStatusStateValues.Failed
+	default:
+		return git.GitStatusStateValues.Error
+	}
+}
@@ -0,0 +1,137 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"bytes"
+	"encoding/json"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// signInHost is the host of the Azure AD sign-in page. Azure DevOps
+// redirects to it, if a request is not allowed to use the token.
+const signInHost = "login.microsoftonline.com"
+
+// conditionalAccessCodes are the error codes of Azure DevOps and Azure AD
+// for requests, that are blocked by a conditional access policy.
+var conditionalAccessCodes = []string{
+	// The conditional access policy defined by your Azure Active
+	// Directory administrator has failed.
+	"VS403463",
+	// Access has been blocked by Conditional Access policies.
+	"AADSTS53003",
+	// Device is not in required device state.
+	"AADSTS53000",
+	// Device is not managed.
+	"AADSTS53001",
+}
+
+// activityHeaders are the response headers with the id of the request,
+// that the administrators can look up.
+var activityHeaders = []string{"ActivityId", "X-VSS-E2EID", "X-Ms-Request-Id"}
+
+// activityIDPattern finds the correlation id in the sign-in page.
+var activityIDPattern = regexp.MustCompile(`(?i)(?:correlation|activity|request)[ _-]?id["']?\s*[:=]\s*["']?([0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12})`)
+
+// conditionalAccessTransport detects responses of organizations, that
+// block the request by a conditional access policy, eg. because of the
+// IP address of the agent. Without it the sign-in page is reported as
+// deserialization error by the SDK. The program ends with exit code 31.
+type conditionalAccessTransport struct {
+	app  *App
+	next http.RoundTripper
+}
+
+func (t *conditionalAccessTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || t.app.exiting.Load() {
+		return resp, err
+	}
+	reason, activityID := conditionalAccess(resp)
+	if reason == "" {
+		return resp, err
+	}
+	log.Errorf("Request %s %s is blocked: %s. The organization enforces conditional access policies and "+
+		"personal access tokens from this network or agent are not accepted. Ask the administrators of the "+
+		"organization to allow the agent.", req.Method, req.URL.Host, strings.TrimSuffix(reason, "."))
+	if activityID != "" {
+		log.Errorf("Activity id of the request is '%s'.", activityID)
+	}
+	t.app.exit(31)
+	return resp, err
+}
+
+// conditionalAccess returns the reason and the activity id, if the
+// response is a rejection by a conditional access policy. The body of
+// the response is kept for the caller.
+func conditionalAccess(resp *http.Response) (string, string) {
+	activityID := ""
+	for _, header := range activityHeaders {
+		if value := resp.Header.Get(header); value != "" {
+			activityID = value
+			break
+		}
+	}
+	if location := resp.Header.Get("Location"); resp.StatusCode >= 300 && resp.StatusCode < 400 && location != "" {
+		if u, err := url.Parse(location); err == nil && strings.EqualFold(u.Hostname(), signInHost) {
+			return "redirect to the sign-in page " + signInHost, activityID
+		}
+	}
+	switch resp.StatusCode {
+	case http.StatusNonAuthoritativeInfo, http.StatusUnauthorized, http.StatusForbidden:
+	default:
+		return "", ""
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return "", ""
+	}
+	if activityID == "" {
+		if match := activityIDPattern.FindSubmatch(body); match != nil {
+			activityID = string(match[1])
+		}
+	}
+	if strings.Contains(resp.Header.Get("Content-Type"), "text/html") {
+		if bytes.Contains(body, []byte(signInHost)) {
+			return "sign-in page " + signInHost + " instead of a result", activityID
+		}
+		return "", ""
+	}
+	var wrapped struct {
+		Message string `json:"message"`
+		TypeKey string `json:"typeKey"`
+	}
+	if json.Unmarshal(body, &wrapped) != nil {
+		return "", ""
+	}
+	if strings.Contains(wrapped.TypeKey, "ConditionalAccess") {
+		return wrapped.Message, activityID
+	}
+	for _, code := range conditionalAccessCodes {
+		if strings.Contains(wrapped.Message, code) {
+			return wrapped.Message, activityID
+		}
+	}
+	return "", ""
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/pipelines"
+	"github.com/sirupsen/logrus/hooks/test"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// TestConditionalAccess checks, that every shape of a rejection by a
+// conditional access policy ends the program with exit code 31, and that
+// other denials are errors of the request.
+func TestConditionalAccess(t *testing.T) {
+	const activityID = "4b9c1f3e-6a2d-4c8e-9f0a-1b2c3d4e5f60"
+	tests := []struct {
+		name         string
+		status       int
+		header       map[string]string
+		body         interface{}
+		want         int
+		wantReason   string
+		wantActivity string
+	}{
+		{"sign-in page", http.StatusNonAuthoritativeInfo, map[string]string{"Content-Type": "text/html; charset=utf-8"},
+			`<html><form action="https://login.microsoftonline.com/common/oauth2/authorize"></form>` +
+				`<script>var config = {"correlationId":"` + activityID + `"};</script></html>`,
+			31, "sign-in page login.microsoftonline.com", activityID},
+		{"redirect to the sign-in page", http.StatusFound, map[string]string{"Location": "https://login.microsoftonline.com/common/oauth2/authorize?client_id=1", "ActivityId": activityID},
+			"", 31, "redirect to the sign-in page", activityID},
+		{"type key", http.StatusUnauthorized, map[string]string{"X-VSS-E2EID": activityID},
+			map[string]string{"typeKey": "ConditionalAccessPolicyException", "message": "Access is blocked by a policy."},
+			31, "Access is blocked by a policy", activityID},
+		{"VS403463", http.StatusForbidden, nil,
+			map[string]string{"typeKey": "UnauthorizedRequestException", "message": "VS403463: The conditional access policy defined by your Azure Active Directory administrator has failed."},
+			31, "VS403463", ""},
+		{"AADSTS53003", http.StatusUnauthorized, map[string]string{"X-Ms-Request-Id": activityID},
+			map[string]string{"message": "AADSTS53003: Access has been blocked by Conditional Access policies."},
+			31, "AADSTS53003", activityID},
+		{"unauthorized", http.StatusUnauthorized, map[string]string{"ActivityId": activityID},
+			map[string]string{"typeKey": "UnauthorizedRequestException", "message": "TF400813: The user is not authorized to access this resource."},
+			-1, "", ""},
+		{"forbidden", http.StatusForbidden, nil,
+			map[string]string{"typeKey": "AccessCheckException", "message": "VS402904: Access denied: the user needs the permission 'View builds'."},
+			-1, "", ""},
+		{"html error page", http.StatusForbidden, map[string]string{"Content-Type": "text/html"},
+			"<html><body>Forbidden</body></html>", -1, "", ""},
+		{"redirect to another host", http.StatusFound, map[string]string{"Location": "/org/moved"},
+			"", -1, "", ""},
+		{"success", http.StatusOK, nil,
+			map[string]interface{}{"count": 0, "value": []interface{}{}}, -1, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook := test.NewGlobal()
+			defer hook.Reset()
+			f := newFakeServer(t)
+			f.route(locationPipelines, "{project}/_apis/pipelines/{pipelineId}", func(req *fakeRequest) (int, interface{}) {
+				for key, value := range tt.header {
+					req.header.Set(key, value)
+				}
+				return tt.status, tt.body
+			})
+			app := &App{}
+			withTransport(t, &conditionalAccessTransport{app: app, next: http.DefaultTransport})
+			prj := f.project()
+
+			code := exitCodeOf(t, app, func() {
+				prj.org.pipelines.ListPipelines(context.Background(), pipelines.ListPipelinesArgs{Project: &prj.name})
+			})
+			if code != tt.want {
+				t.Fatalf("exit code %d, want %d", code, tt.want)
+			}
+			var messages []string
+			for _, e := range hook.AllEntries() {
+				messages = append(messages, e.Message)
+			}
+			logged := strings.Join(messages, "\n")
+			if tt.wantReason != "" && !strings.Contains(logged, tt.wantReason) {
+				t.Errorf("log %q does not contain the reason '%s'", logged, tt.wantReason)
+			}
+			if got := strings.Contains(logged, "Activity id of the request is '"+activityID+"'."); got != (tt.wantActivity != "") {
+				t.Errorf("activity id logged = %v, want %v: %q", got, tt.wantActivity != "", logged)
+			}
+		})
+	}
+}
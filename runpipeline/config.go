@@ -0,0 +1,71 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"gopkg.in/yaml.v3"
+	"os"
+)
+
+// config is the content of the optional configuration file.
+type config struct {
+	// Presets are named bundles of pipeline parameters.
+	Presets map[string]map[string]string `yaml:"presets"`
+	// Tokens are the personal access tokens of other organizations.
+	Tokens map[string]string `yaml:"tokens"`
+	// Guard are patterns of pipelines, that must be confirmed.
+	Guard []string `yaml:"guard"`
+	// Report are the pipelines of '-report', if none is given.
+	Report []string `yaml:"report"`
+	// AuditLogFile is the audit log file, if '-audit-log-file' is not given.
+	AuditLogFile string `yaml:"auditLogFile"`
+}
+
+// groupFile is the content of the pipeline group file.
+type groupFile struct {
+	// Groups are named lists of pipeline names.
+	Groups map[string][]string `yaml:"groups"`
+}
+
+func loadGroupFile(path string) (*groupFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	groups := &groupFile{}
+	if err = yaml.Unmarshal(data, groups); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+func loadConfig(path string) (*config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &config{}
+	if err = yaml.Unmarshal(data, cfg); err != nil {
+		return nil, err
+	}
+	for _, pattern := range cfg.Guard {
+		if err = checkGuardPattern(pattern); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
@@ -0,0 +1,153 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// healthURL is the status of Azure DevOps Services.
+	healthURL = "https://status.dev.azure.com/_apis/status/health"
+	// connectivityTimeout limits the check of the connectivity.
+	connectivityTimeout = 10 * time.Second
+)
+
+// serviceHealth is the part of the health document of the status page,
+// that is reported.
+type serviceHealth struct {
+	Status struct {
+		Health  string `json:"health"`
+		Message string `json:"message"`
+	} `json:"status"`
+	Services []struct {
+		ID          string `json:"id"`
+		Geographies []struct {
+			Name   string `json:"name"`
+			Health string `json:"health"`
+		} `json:"geographies"`
+	} `json:"services"`
+}
+
+// degraded returns the services, that are not healthy, like
+// 'Pipelines (Europe): degraded'.
+func (h *serviceHealth) degraded() []string {
+	var list []string
+	for _, service := range h.Services {
+		for _, geography := range service.Geographies {
+			if !strings.EqualFold(geography.Health, "healthy") {
+				list = append(list, fmt.Sprintf("%s (%s): %s", service.ID, geography.Name, geography.Health))
+			}
+		}
+	}
+	return list
+}
+
+// verifyConnectivity checks before any request to the organization, that
+// Azure DevOps is reachable and healthy. For Azure DevOps Services the
+// status page is read, for a server the server must answer. A problem is
+// logged as warning and repeated at the end, if the program fails, or,
+// with 'fail-on-ado-degraded', ends the program with exit code 12.
+func (app *App) verifyConnectivity(ctx context.Context) {
+	if app.replay {
+		log.Debugf("Connectivity is not verified, the requests are replayed.")
+		return
+	}
+	defer app.timer.begin("connectivity")()
+	ctx, cancel := context.WithTimeout(ctx, connectivityTimeout)
+	defer cancel()
+	var problem string
+	if strings.TrimRight(app.baseURL, "/") == ADOURL {
+		problem = app.checkServiceHealth(ctx)
+	} else {
+		problem = app.checkServerReachable(ctx)
+	}
+	if problem == "" {
+		return
+	}
+	if app.failOnDegraded {
+		log.Errorf("%s, no pipeline is started.", problem)
+		app.exit(12)
+	}
+	log.Warnf("%s, failures may be caused by Azure DevOps.", problem)
+	app.connectivityProblem = problem
+}
+
+// checkServiceHealth reads the status page of Azure DevOps Services and
+// returns the problem or an empty string.
+func (app *App) checkServiceHealth(ctx context.Context) string {
+	resp, err := app.connectivityRequest(ctx, healthURL)
+	if err != nil {
+		return fmt.Sprintf("Status of Azure DevOps could not be read: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Sprintf("Status of Azure DevOps could not be read: %s", resp.Status)
+	}
+	var health serviceHealth
+	if err = json.NewDecoder(resp.Body).Decode(&health); err != nil {
+		return fmt.Sprintf("Status of Azure DevOps could not be read: %v", err)
+	}
+	if strings.EqualFold(health.Status.Health, "healthy") {
+		log.Debugf("Azure DevOps is healthy.")
+		return ""
+	}
+	problem := fmt.Sprintf("Azure DevOps is %s: %s", health.Status.Health, health.Status.Message)
+	if services := health.degraded(); len(services) > 0 {
+		problem += " (" + strings.Join(services, ", ") + ")"
+	}
+	return problem
+}
+
+// checkServerReachable returns the problem or an empty string, if the
+// server answers. Every HTTP status means, that it is reachable.
+func (app *App) checkServerReachable(ctx context.Context) string {
+	resp, err := app.connectivityRequest(ctx, app.baseURL)
+	if err != nil {
+		return fmt.Sprintf("Azure DevOps at %s is not reachable: %v", app.baseURL, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Sprintf("Azure DevOps at %s answers with %s", app.baseURL, resp.Status)
+	}
+	log.Debugf("Azure DevOps at %s is reachable.", app.baseURL)
+	return ""
+}
+
+func (app *App) connectivityRequest(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", app.userAgent(""))
+	return http.DefaultClient.Do(req)
+}
+
+// reportConnectivityProblem repeats the problem of the connectivity, when
+// the program fails, so that it is next to the error.
+func (app *App) reportConnectivityProblem(code int) {
+	if code != 0 && app.connectivityProblem != "" {
+		fmt.Fprintf(os.Stderr, "Connectivity at the start of the program: %s.\n", app.connectivityProblem)
+	}
+}
@@ -0,0 +1,145 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"fmt"
+	"github.com/zalando/go-keyring"
+	"os"
+	"sort"
+	"strings"
+)
+
+// credentialService is the service name of the tokens in the keyring of
+// the operating system (Windows Credential Manager, macOS Keychain or
+// Secret Service on Linux). The user name is the organization.
+const credentialService = "runPipeline"
+
+// credentialIndex is the entry with the list of organizations, because
+// the keyring can not be searched.
+const credentialIndex = "_organizations"
+
+// credentialCommand is the value of the flags 'save-credentials',
+// 'delete-credentials' and 'list-credentials'.
+type credentialCommand struct {
+	save   bool
+	delete bool
+	list   bool
+}
+
+func (c credentialCommand) given() bool {
+	return c.save || c.delete || c.list
+}
+
+// runCredentialCommand saves, deletes or lists the tokens in the keyring
+// and ends the program. Errors of the keyring end the program with exit
+// code 30.
+func (app *App) runCredentialCommand(cmd credentialCommand, org string, token string) {
+	if cmd.list {
+		orgs, err := credentialOrganizations()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Credentials could not be listed: %v\n", err)
+			app.exit(30)
+		}
+		for _, name := range orgs {
+			fmt.Println(name)
+		}
+		app.exit(0)
+	}
+	if org == "" {
+		fmt.Fprintln(os.Stderr, "Parameter 'org' is empty.")
+		app.exit(1)
+	}
+	if cmd.delete {
+		if err := deleteCredential(org); err != nil {
+			fmt.Fprintf(os.Stderr, "Token of organization '%s' could not be deleted: %v\n", org, err)
+			app.exit(30)
+		}
+		fmt.Printf("Token of organization '%s' is deleted.\n", org)
+		app.exit(0)
+	}
+	if token == "" {
+		fmt.Fprintln(os.Stderr, "Parameter 'token' is empty.")
+		app.exit(3)
+	}
+	if err := saveCredential(org, token); err != nil {
+		fmt.Fprintf(os.Stderr, "Token of organization '%s' could not be saved: %v\n", org, err)
+		app.exit(30)
+	}
+	fmt.Printf("Token of organization '%s' is saved.\n", org)
+	app.exit(0)
+}
+
+// loadCredential returns the token of the organization from the keyring.
+func loadCredential(org string) (string, error) {
+	return keyring.Get(credentialService, org)
+}
+
+func saveCredential(org string, token string) error {
+	if err := keyring.Set(credentialService, org, token); err != nil {
+		return err
+	}
+	orgs, err := credentialOrganizations()
+	if err != nil {
+		return err
+	}
+	if !containsString(orgs, org) {
+		orgs = append(orgs, org)
+	}
+	return saveCredentialOrganizations(orgs)
+}
+
+func deleteCredential(org string) error {
+	if err := keyring.Delete(credentialService, org); err != nil {
+		return err
+	}
+	orgs, err := credentialOrganizations()
+	if err != nil {
+		return err
+	}
+	var remaining []string
+	for _, name := range orgs {
+		if name != org {
+			remaining = append(remaining, name)
+		}
+	}
+	return saveCredentialOrganizations(remaining)
+}
+
+// credentialOrganizations returns the organizations with a saved token.
+func credentialOrganizations() ([]string, error) {
+	index, err := keyring.Get(credentialService, credentialIndex)
+	if err == keyring.ErrNotFound || (err == nil && index == "") {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(index, "\n"), nil
+}
+
+func saveCredentialOrganizations(orgs []string) error {
+	if len(orgs) == 0 {
+		err := keyring.Delete(credentialService, credentialIndex)
+		if err == keyring.ErrNotFound {
+			return nil
+		}
+		return err
+	}
+	sort.Strings(orgs)
+	return keyring.Set(credentialService, credentialIndex, strings.Join(orgs, "\n"))
+}
@@ -0,0 +1,79 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"strings"
+)
+
+const defaultStatsdAddr = "127.0.0.1:8125"
+
+// statsdTagReplacer replaces the characters, that can not be used in
+// the tags of DogStatsD.
+var statsdTagReplacer = strings.NewReplacer(",", "_", "|", "_", "#", "_", " ", "_")
+
+// sendMetrics sends the metrics of all finished runs to DogStatsD.
+// Failures are only logged as warnings.
+func (app *App) sendMetrics() {
+	conn, err := net.Dial("udp", app.statsdAddr)
+	if err != nil {
+		log.Warnf("Metrics could not be sent to '%s': %v", app.statsdAddr, err)
+		return
+	}
+	defer conn.Close()
+	for _, pr := range app.runs {
+		if pr.info.Result == "" {
+			continue
+		}
+		for _, metric := range runMetrics(pr, app.annotations) {
+			if _, err = conn.Write([]byte(metric)); err != nil {
+				log.Warnf("Metrics could not be sent to '%s': %v", app.statsdAddr, err)
+				return
+			}
+		}
+	}
+}
+
+// runMetrics returns the metrics of the run in the DogStatsD format. The
+// annotations are added as tags.
+func runMetrics(pr *pipelineRun, annotations annotations) []string {
+	tagList := []string{
+		statsdTag("pipeline", pr.name),
+		statsdTag("branch", strings.TrimPrefix(pr.branch, "refs/heads/")),
+		statsdTag("org", pr.prj.org.name),
+		statsdTag("result", pr.info.Result),
+	}
+	for _, key := range annotations.keys() {
+		tagList = append(tagList, statsdTag(key, annotations[key]))
+	}
+	tags := "#" + strings.Join(tagList, ",")
+	metrics := []string{
+		"runpipeline.run.count:1|c|" + tags,
+		"runpipeline.run.result:1|c|" + tags,
+	}
+	if duration := pr.info.duration(); duration > 0 {
+		metrics = append(metrics, fmt.Sprintf("runpipeline.run.duration:%g|g|%s", duration.Seconds(), tags))
+	}
+	return metrics
+}
+
+func statsdTag(key string, value string) string {
+	return key + ":" + statsdTagReplacer.Replace(value)
+}
@@ -0,0 +1,174 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"fmt"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/build"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/git"
+	"gopkg.in/yaml.v3"
+	"strconv"
+	"strings"
+)
+
+// pipelineParameter is a template parameter declared in the YAML file
+// of a pipeline.
+type pipelineParameter struct {
+	Name        string    `yaml:"name"`
+	DisplayName string    `yaml:"displayName"`
+	Type        string    `yaml:"type"`
+	Default     yaml.Node `yaml:"default"`
+	Values      []string  `yaml:"values"`
+}
+
+// required is true, if the parameter has no default value.
+func (p pipelineParameter) required() bool {
+	return p.Default.Kind == 0
+}
+
+// typeName returns the type of the parameter, the default type is string.
+func (p pipelineParameter) typeName() string {
+	if p.Type == "" {
+		return "string"
+	}
+	return p.Type
+}
+
+// scalar is true for parameters, that are entered as a single value. The
+// other types like object or stepList are YAML structures.
+func (p pipelineParameter) scalar() bool {
+	switch p.typeName() {
+	case "string", "number", "boolean":
+		return true
+	}
+	return false
+}
+
+// defaultValue returns the default value of a parameter, if it is a
+// single value.
+func (p pipelineParameter) defaultValue() (string, bool) {
+	if p.Default.Kind != yaml.ScalarNode {
+		return "", false
+	}
+	return p.Default.Value, true
+}
+
+// allowedValues returns the values offered for selection.
+func (p pipelineParameter) allowedValues() []string {
+	if len(p.Values) == 0 && p.Type == "boolean" {
+		return []string{"true", "false"}
+	}
+	return p.Values
+}
+
+func (app *App) getDefinition(ctx context.Context, prj *project, pipelineID int) (*build.BuildDefinition, error) {
+	key := prj.name + "/" + strconv.Itoa(pipelineID)
+	if definition := prj.org.definition(key); definition != nil {
+		return definition, nil
+	}
+	client, err := prj.org.buildClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	args := &build.GetDefinitionArgs{
+		Project:      &prj.name,
+		DefinitionId: &pipelineID,
+	}
+	definition, err := client.GetDefinition(ctx, *args)
+	if err != nil {
+		return nil, err
+	}
+	prj.org.cacheDefinition(key, definition)
+	return definition, nil
+}
+
+// yamlFilename returns the path of the YAML file of the definition
+// or an empty string for classic build definitions.
+func yamlFilename(definition *build.BuildDefinition) string {
+	if process, ok := definition.Process.(map[string]interface{}); ok {
+		if filename, ok := process["yamlFilename"].(string); ok {
+			return filename
+		}
+	}
+	return ""
+}
+
+// getPipelineParameters reads the parameters declared in the YAML file
+// of the pipeline on the branch of the run.
+func (app *App) getPipelineParameters(ctx context.Context, pr *pipelineRun) ([]pipelineParameter, error) {
+	definition, err := app.getDefinition(ctx, pr.prj, pr.pipelineID)
+	if err != nil {
+		return nil, err
+	}
+	filename := yamlFilename(definition)
+	if filename == "" {
+		return nil, fmt.Errorf("pipeline is not defined in a YAML file")
+	}
+	if definition.Repository == nil || definition.Repository.Type == nil || *definition.Repository.Type != "TfsGit" {
+		return nil, fmt.Errorf("YAML file is not stored in an Azure Repos Git repository")
+	}
+
+	client, err := pr.prj.org.gitClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	branch := strings.TrimPrefix(pr.branch, "refs/heads/")
+	args := &git.GetItemTextArgs{
+		RepositoryId: definition.Repository.Id,
+		Path:         &filename,
+		Project:      &pr.prj.name,
+		VersionDescriptor: &git.GitVersionDescriptor{
+			Version:     &branch,
+			VersionType: &git.GitVersionTypeValues.Branch,
+		},
+	}
+	reader, err := client.GetItemText(ctx, *args)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var content struct {
+		Parameters yaml.Node `yaml:"parameters"`
+	}
+	if err = yaml.NewDecoder(reader).Decode(&content); err != nil {
+		return nil, err
+	}
+	return decodeParameters(&content.Parameters)
+}
+
+// decodeParameters supports the parameter list as well as the older
+// syntax with a mapping of names to default values.
+func decodeParameters(node *yaml.Node) ([]pipelineParameter, error) {
+	var parameters []pipelineParameter
+	switch node.Kind {
+	case yaml.SequenceNode:
+		if err := node.Decode(&parameters); err != nil {
+			return nil, err
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			parameters = append(parameters, pipelineParameter{
+				Name:    node.Content[i].Value,
+				Type:    "string",
+				Default: *node.Content[i+1],
+			})
+		}
+	}
+	return parameters, nil
+}
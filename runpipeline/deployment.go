@@ -0,0 +1,192 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"fmt"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/build"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/pipelines"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/taskagent"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+// deploymentInfo is the deployment of a run to the environment of
+// 'wait-for-deployment' or 'wait-for-environment'.
+type deploymentInfo struct {
+	Environment   string `json:"environment"`
+	EnvironmentID int    `json:"environmentId,omitempty"`
+	// Jobs are the deployment jobs of the run, that target the
+	// environment.
+	Jobs   []string `json:"jobs,omitempty"`
+	Result string   `json:"result,omitempty"`
+	URL    string   `json:"url,omitempty"`
+}
+
+// deploymentResults maps the results of deployment jobs to the results
+// of runs.
+var deploymentResults = map[taskagent.TaskResult]string{
+	taskagent.TaskResultValues.Succeeded:           string(pipelines.RunResultValues.Succeeded),
+	taskagent.TaskResultValues.SucceededWithIssues: string(build.BuildResultValues.PartiallySucceeded),
+	taskagent.TaskResultValues.Failed:              string(pipelines.RunResultValues.Failed),
+	taskagent.TaskResultValues.Canceled:            string(pipelines.RunResultValues.Canceled),
+	taskagent.TaskResultValues.Abandoned:           string(pipelines.RunResultValues.Canceled),
+	taskagent.TaskResultValues.Skipped:             resultSkipped,
+}
+
+// checkDeployment reads the deployments of the run to the environment
+// of 'wait-for-deployment' or 'wait-for-environment'. It returns true, if all deployment jobs of
+// the run to the environment are finished, and the exit code of their
+// worst result.
+func (app *App) checkDeployment(ctx context.Context, pr *pipelineRun) (bool, int) {
+	if pr.deployment == nil {
+		pr.deployment = app.resolveDeployment(ctx, pr)
+	}
+	if pr.deployment.EnvironmentID == 0 {
+		return false, 0
+	}
+	client, err := pr.prj.org.taskAgentClient(ctx)
+	if err != nil {
+		pr.log.Warnf("Deployments of environment '%s' could not be read: %v", pr.deployment.Environment, err)
+		return false, 0
+	}
+	args := &taskagent.GetEnvironmentDeploymentExecutionRecordsArgs{
+		Project:       &pr.prj.name,
+		EnvironmentId: &pr.deployment.EnvironmentID,
+		Top:           intPtr(environmentDeploymentsTop),
+	}
+	records, err := client.GetEnvironmentDeploymentExecutionRecords(ctx, *args)
+	if err != nil {
+		pr.log.Warnf("Deployments of environment '%s' could not be read: %v", pr.deployment.Environment, err)
+		return false, 0
+	}
+	var jobs []string
+	finished := true
+	worst, worstResult := 0, ""
+	for _, record := range records.Value {
+		if record.Owner == nil || record.Owner.Id == nil || *record.Owner.Id != pr.runID {
+			continue
+		}
+		if record.JobName != nil {
+			jobs = append(jobs, *record.JobName)
+		}
+		if record.Result == nil || record.FinishTime == nil {
+			finished = false
+			continue
+		}
+		result, ok := deploymentResults[*record.Result]
+		if !ok {
+			result = string(*record.Result)
+		}
+		code := resultExitCode(result)
+		if worstResult == "" || exitCodeSeverity[code] > exitCodeSeverity[worst] {
+			worst, worstResult = code, result
+		}
+	}
+	if len(jobs) == 0 {
+		return false, 0
+	}
+	pr.deployment.Jobs = jobs
+	if !finished {
+		pr.log.Debugf("Deployment of run %d of pipeline '%s' to environment '%s' is running.", pr.runID, pr.name, pr.deployment.Environment)
+		return false, 0
+	}
+	pr.deployment.Result = worstResult
+	pr.log.Infof("Deployment of run %d of pipeline '%s' to environment '%s' finished with result '%s'.", pr.runID, pr.name, pr.deployment.Environment, worstResult)
+	return true, worst
+}
+
+// waitForEnvironmentDeployment polls the deployments of the completed run
+// to the environment of 'wait-for-environment', because the Environments
+// API can report them later than the run. It returns the exit code of
+// their worst result, 24 if they are not finished within
+// 'wait-for-environment-timeout', or the exit code of the run, if the run
+// did not succeed or the environment does not exist.
+func (app *App) waitForEnvironmentDeployment(ctx context.Context, pr *pipelineRun, code int) int {
+	if code != 0 {
+		pr.log.Infof("Run %d of pipeline '%s' did not succeed, the deployment to environment '%s' is not awaited.", pr.runID, pr.name, app.waitForEnvironment)
+		return code
+	}
+	done := app.timer.begin("environment")
+	defer done()
+	deadline := time.Now().Add(app.waitForEnvironmentTimeout)
+	if !app.jobDeadline.IsZero() && app.jobDeadline.Before(deadline) {
+		deadline = app.jobDeadline
+	}
+	for {
+		if app.budget.exhausted() {
+			app.budgetExhausted(pr)
+		}
+		deployed, deploymentCode := app.checkDeployment(ctx, pr)
+		if deployed {
+			return deploymentCode
+		}
+		if pr.deployment.EnvironmentID == 0 {
+			return code
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			pr.log.Errorf("Deployment of run %d of pipeline '%s' to environment '%s' is not finished within %v.", pr.runID, pr.name, app.waitForEnvironment, app.waitForEnvironmentTimeout)
+			pr.deployment.Result = resultTimedOut
+			return 24
+		}
+		time.Sleep(minDuration(app.budget.pollInterval(app.pollInterval), remaining))
+	}
+}
+
+// deploymentEnvironment returns the environment of 'wait-for-deployment'
+// or 'wait-for-environment'.
+func (app *App) deploymentEnvironment() string {
+	if app.waitForEnvironment != "" {
+		return app.waitForEnvironment
+	}
+	return app.waitForDeployment
+}
+
+// resolveDeployment looks up the environment of 'wait-for-deployment' or
+// 'wait-for-environment' in the project of the run.
+func (app *App) resolveDeployment(ctx context.Context, pr *pipelineRun) *deploymentInfo {
+	deployment := &deploymentInfo{Environment: app.deploymentEnvironment()}
+	client, err := pr.prj.org.taskAgentClient(ctx)
+	if err == nil {
+		deployment.EnvironmentID = app.environmentID(ctx, client, pr.prj, deployment.Environment)
+	}
+	if deployment.EnvironmentID == 0 {
+		pr.log.Warnf("Environment '%s' of project '%s' is not found, the whole run of pipeline '%s' is watched.", deployment.Environment, pr.prj.name, pr.name)
+		return deployment
+	}
+	deployment.URL = fmt.Sprintf("%s/%s/_environments/%d?view=deployments", app.organizationURL(pr.prj.org.name), pr.prj.name, deployment.EnvironmentID)
+	return deployment
+}
+
+func printDeployments(out io.Writer, runs []*pipelineRun) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Environment\tPipeline\tRun id\tResult\tURL")
+	for _, pr := range runs {
+		if pr.deployment == nil {
+			continue
+		}
+		result := pr.deployment.Result
+		if result == "" {
+			result = "not deployed"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", pr.deployment.Environment, pr.name, pr.runID, result, pr.deployment.URL)
+	}
+	w.Flush()
+}
@@ -0,0 +1,47 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package runpipeline starts Azure DevOps pipelines and waits for their
+// runs. It is the implementation of the command line program runPipeline,
+// Main is the program itself. Go programs use a Client instead of
+// executing the program:
+//
+//	client := runpipeline.NewClient("myorg", "myproject", os.Getenv("AZURE_DEVOPS_TOKEN"))
+//	result, err := client.Run(ctx, runpipeline.RunOptions{
+//		Pipeline:   "deploy",
+//		Branch:     "main",
+//		Parameters: map[string]string{"env": "prod"},
+//		Timeout:    30 * time.Minute,
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	fmt.Printf("Run %d %s (%s)\n", result.RunID, result.Result, result.URL)
+//
+// A queued run is watched with GetStatus and canceled with CancelRun:
+//
+//	result, err := client.Run(ctx, runpipeline.RunOptions{Pipeline: "deploy", NoWait: true})
+//	...
+//	status, err := client.GetStatus(ctx, runpipeline.RunOptions{Pipeline: "deploy", RunID: result.RunID})
+//	...
+//	err = client.CancelRun(ctx, runpipeline.RunOptions{RunID: result.RunID})
+//
+// The package logs with the standard logger of logrus. Errors, that end
+// the command line program before the result of a run is known, are
+// returned as ExitError with the exit code of the program and the cause,
+// that errors.Is and errors.As find. The directory _example contains a
+// complete program.
+package runpipeline
@@ -0,0 +1,337 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/build"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+const (
+	// downloadAttempts is the number of requests for a file, every retry
+	// resumes at the current size of the partial file.
+	downloadAttempts = 6
+	// downloadBackoff is the wait time before the first retry, it is
+	// doubled for every further retry.
+	downloadBackoff = time.Second
+	// downloadProgressInterval is the interval of the progress log.
+	downloadProgressInterval = 5 * time.Second
+	// partialSuffix is appended to the file name during the download.
+	partialSuffix = ".partial"
+)
+
+// buildLogsLocation is the location of the logs of a build. The zip of
+// all logs is requested with the SDK client, because the SDK has no
+// parameter for the 'Range' header.
+var buildLogsLocation = uuid.MustParse("35a80daf-7f30-45fc-86e8-6b813d9c90df")
+
+var contentRange = regexp.MustCompile(`^bytes (\d+)-(\d+)/(\d+|\*)$`)
+
+// rangeFetcher requests the file with the additional headers. It returns
+// an error for responses without 2xx status.
+type rangeFetcher func(ctx context.Context, headers map[string]string) (*http.Response, error)
+
+// statusError is the error of a response without 2xx status.
+type statusError struct {
+	code   int
+	status string
+}
+
+func (e *statusError) Error() string {
+	return "server returned " + e.status
+}
+
+// responseStatus returns the HTTP status of the error or zero.
+func responseStatus(err error) int {
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.code
+	}
+	// the SDK returns the wrapped error as value and as pointer
+	var we azuredevops.WrappedError
+	if errors.As(err, &we) && we.StatusCode != nil {
+		return *we.StatusCode
+	}
+	var wp *azuredevops.WrappedError
+	if errors.As(err, &wp) && wp.StatusCode != nil {
+		return *wp.StatusCode
+	}
+	return 0
+}
+
+// retryable is true for network errors and responses, that may succeed
+// later.
+func retryable(err error) bool {
+	switch code := responseStatus(err); {
+	case code == 0:
+		return true
+	case code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= 500:
+		return true
+	default:
+		return false
+	}
+}
+
+// downloadFile downloads the file to path. The data is written to a
+// '.partial' file first, that is renamed when the download is complete.
+// Failed requests are retried with backoff. If the server supports
+// ranges, a retry and a later call resume at the size of the partial
+// file, otherwise the download starts again. The size of the file is
+// verified, if the server sent it. It returns the size of the file.
+func downloadFile(ctx context.Context, path string, fetch rangeFetcher) (int64, error) {
+	partial := path + partialSuffix
+	var offset int64
+	if info, err := os.Stat(partial); err == nil {
+		offset = info.Size()
+	}
+	backoff := downloadBackoff
+	var lastErr error
+	for attempt := 1; attempt <= downloadAttempts; attempt++ {
+		if attempt > 1 {
+			log.Infof("Download of '%s' failed, retry %d/%d in %v at byte %d: %v", path, attempt-1, downloadAttempts-1, backoff, offset, lastErr)
+			select {
+			case <-ctx.Done():
+				return offset, ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+		complete, size, err := downloadPart(ctx, path, partial, offset, fetch)
+		offset = size
+		if err == nil && complete {
+			if err = os.Rename(partial, path); err != nil {
+				return offset, err
+			}
+			return offset, nil
+		}
+		if err != nil && !retryable(err) {
+			return offset, err
+		}
+		if err == nil {
+			err = fmt.Errorf("the connection was closed before the end of the file")
+		}
+		lastErr = err
+	}
+	return offset, lastErr
+}
+
+// downloadPart requests the file from the offset and appends the data to
+// the partial file. It returns, whether the file is complete, and the size
+// of the partial file.
+func downloadPart(ctx context.Context, path string, partial string, offset int64, fetch rangeFetcher) (bool, int64, error) {
+	headers := map[string]string{}
+	if offset > 0 {
+		headers["Range"] = fmt.Sprintf("bytes=%d-", offset)
+	}
+	resp, err := fetch(ctx, headers)
+	if responseStatus(err) == http.StatusRequestedRangeNotSatisfiable {
+		// the partial file does not belong to the file on the server
+		log.Infof("Partial file of '%s' is discarded, the server rejected byte %d.", path, offset)
+		if err = os.Remove(partial); err != nil {
+			return false, offset, err
+		}
+		offset = 0
+		resp, err = fetch(ctx, map[string]string{})
+	}
+	if err != nil {
+		return false, offset, err
+	}
+	defer resp.Body.Close()
+
+	total := int64(-1)
+	flags := os.O_CREATE | os.O_WRONLY
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		m := contentRange.FindStringSubmatch(resp.Header.Get("Content-Range"))
+		if m == nil || m[1] != strconv.FormatInt(offset, 10) {
+			return false, offset, fmt.Errorf("unexpected content range '%s' for byte %d", resp.Header.Get("Content-Range"), offset)
+		}
+		if m[3] != "*" {
+			total, _ = strconv.ParseInt(m[3], 10, 64)
+		}
+		flags |= os.O_APPEND
+	case http.StatusOK:
+		if offset > 0 {
+			log.Infof("Server does not support ranges, the download of '%s' starts again.", path)
+		}
+		offset = 0
+		total = resp.ContentLength
+		flags |= os.O_TRUNC
+	default:
+		return false, offset, &statusError{resp.StatusCode, resp.Status}
+	}
+
+	file, err := os.OpenFile(partial, flags, 0o644)
+	if err != nil {
+		return false, offset, err
+	}
+	progress := &downloadProgress{path: path, written: offset, total: total, last: time.Now()}
+	_, copyErr := io.Copy(file, io.TeeReader(resp.Body, progress))
+	closeErr := file.Close()
+	size := progress.written
+	if copyErr != nil {
+		return false, size, copyErr
+	}
+	if closeErr != nil {
+		return false, size, closeErr
+	}
+	if total >= 0 && size != total {
+		if size > total {
+			// the partial file does not belong to the file on the server
+			os.Remove(partial)
+			return false, 0, fmt.Errorf("file has %d bytes instead of %d", size, total)
+		}
+		return false, size, nil
+	}
+	return true, size, nil
+}
+
+// downloadProgress counts the written bytes and logs the progress.
+type downloadProgress struct {
+	path    string
+	written int64
+	total   int64
+	last    time.Time
+}
+
+func (p *downloadProgress) Write(data []byte) (int, error) {
+	p.written += int64(len(data))
+	if time.Since(p.last) >= downloadProgressInterval {
+		p.last = time.Now()
+		if p.total > 0 {
+			log.Infof("Download of '%s': %d of %d MB (%d%%).", p.path, p.written>>20, p.total>>20, p.written*100/p.total)
+		} else {
+			log.Infof("Download of '%s': %d MB.", p.path, p.written>>20)
+		}
+	}
+	return len(data), nil
+}
+
+// downloadLogs downloads the zip of the logs of the run to the directory
+// of 'download-logs'. Failures are only logged as warnings.
+func (app *App) downloadLogs(ctx context.Context, pr *pipelineRun) {
+	if pr.runID <= 0 || !app.budget.allowOptional("downloadLogs") || !app.capabilities.available(subsystemLogs) {
+		return
+	}
+	connection := pr.prj.org.connection
+	client := azuredevops.NewClient(connection, connection.BaseUrl)
+	routeValues := map[string]string{
+		"project": pr.prj.name,
+		"buildId": strconv.Itoa(pr.runID),
+	}
+	fetch := func(ctx context.Context, headers map[string]string) (*http.Response, error) {
+		return client.Send(ctx, http.MethodGet, buildLogsLocation, "6.0", routeValues, nil, nil, "", "application/zip", headers)
+	}
+	path := filepath.Join(app.downloadLogsDir, fmt.Sprintf("%s-%d-logs.zip", safeFileName(pr.name), pr.runID))
+	app.download(ctx, pr, subsystemLogs, "Logs", path, fetch)
+}
+
+// downloadArtifacts downloads the artifacts of the run as zip files to a
+// directory of the run in the directory of 'download-artifacts'.
+// Artifacts without download URL are skipped. Failures are only logged as
+// warnings.
+func (app *App) downloadArtifacts(ctx context.Context, pr *pipelineRun) {
+	if pr.runID <= 0 || !app.budget.allowOptional("downloadArtifacts") || !app.capabilities.available(subsystemArtifacts) {
+		return
+	}
+	client, err := pr.prj.org.buildClient(ctx)
+	var artifacts *[]build.BuildArtifact
+	if err == nil {
+		args := &build.GetArtifactsArgs{
+			Project: &pr.prj.name,
+			BuildId: &pr.runID,
+		}
+		artifacts, err = client.GetArtifacts(ctx, *args)
+	}
+	if app.capabilities.denied(pr.log, subsystemArtifacts, err) {
+		return
+	}
+	if err != nil {
+		pr.log.Warnf("Artifacts of run %d of pipeline '%s' could not be read: %v", pr.runID, pr.name, err)
+		return
+	}
+	authorization := pr.prj.org.connection.AuthorizationString
+	for _, artifact := range *artifacts {
+		if artifact.Name == nil || artifact.Resource == nil || artifact.Resource.DownloadUrl == nil || *artifact.Resource.DownloadUrl == "" {
+			continue
+		}
+		url := *artifact.Resource.DownloadUrl
+		fetch := func(ctx context.Context, headers map[string]string) (*http.Response, error) {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set("Authorization", authorization)
+			for key, value := range headers {
+				req.Header.Set(key, value)
+			}
+			resp, err := (&http.Client{}).Do(req)
+			if err != nil {
+				return nil, err
+			}
+			if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+				resp.Body.Close()
+				return nil, &statusError{resp.StatusCode, resp.Status}
+			}
+			return resp, nil
+		}
+		dir := filepath.Join(app.downloadArtifactsDir, fmt.Sprintf("%s-%d", safeFileName(pr.name), pr.runID))
+		path := filepath.Join(dir, safeFileName(*artifact.Name)+".zip")
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			pr.log.Warnf("Artifact '%s' of run %d could not be downloaded: %v", *artifact.Name, pr.runID, err)
+			continue
+		}
+		if !app.capabilities.available(subsystemArtifacts) {
+			return
+		}
+		app.download(ctx, pr, subsystemArtifacts, fmt.Sprintf("Artifact '%s'", *artifact.Name), path, fetch)
+	}
+}
+
+// download downloads the file of the subsystem and logs the result.
+func (app *App) download(ctx context.Context, pr *pipelineRun, s subsystem, what string, path string, fetch rangeFetcher) {
+	started := time.Now()
+	size, err := downloadFile(ctx, path, fetch)
+	if app.capabilities.denied(pr.log, s, err) {
+		return
+	}
+	if err != nil {
+		pr.log.Warnf("%s of run %d of pipeline '%s' could not be downloaded to '%s': %v", what, pr.runID, pr.name, path, err)
+		return
+	}
+	pr.log.Infof("%s of run %d of pipeline '%s' downloaded to '%s' (%d bytes in %v).", what, pr.runID, pr.name, path, size, time.Since(started).Round(time.Millisecond))
+}
+
+// safeFileName replaces the characters of the name, that are not allowed
+// in file names on all platforms.
+func safeFileName(name string) string {
+	return unsafeFileChars.ReplaceAllString(name, "_")
+}
+
+var unsafeFileChars = regexp.MustCompile(`[<>:"/\\|?*\x00-\x1f]`)
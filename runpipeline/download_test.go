@@ -0,0 +1,207 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// downloadServer serves the content. The responses of the attempts in
+// drops end after that many bytes of the body with a closed connection.
+type downloadServer struct {
+	content []byte
+	ranges  bool
+	drops   map[int]int
+	// ranges requested by the attempts, empty without 'Range' header
+	requested []string
+}
+
+func (s *downloadServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.requested = append(s.requested, r.Header.Get("Range"))
+	start := 0
+	status := http.StatusOK
+	if value := r.Header.Get("Range"); value != "" && s.ranges {
+		start, _ = strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(value, "bytes="), "-"))
+		if start >= len(s.content) {
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		status = http.StatusPartialContent
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(s.content)-1, len(s.content)))
+	}
+	body := s.content[start:]
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(status)
+	drop, ok := s.drops[len(s.requested)]
+	if !ok {
+		w.Write(body)
+		return
+	}
+	w.Write(body[:drop])
+	w.(http.Flusher).Flush()
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err == nil {
+		conn.Close()
+	}
+}
+
+// fetcher returns a rangeFetcher for the URL, like the one of the
+// artifacts.
+func fetcher(url string) rangeFetcher {
+	return func(ctx context.Context, headers map[string]string) (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			resp.Body.Close()
+			return nil, &statusError{resp.StatusCode, resp.Status}
+		}
+		return resp, nil
+	}
+}
+
+// TestDownloadFile checks, that a download resumes after a dropped
+// connection at the size of the partial file, and that the file is
+// renamed only when it is complete.
+func TestDownloadFile(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	tests := []struct {
+		name    string
+		ranges  bool
+		drops   map[int]int
+		partial []byte
+		// requested are the 'Range' headers of the attempts
+		requested []string
+	}{
+		{"complete", true, nil, nil, []string{""}},
+		{"resumed", true, map[int]int{1: 4000}, nil, []string{"", "bytes=4000-"}},
+		{"resumed twice", true, map[int]int{1: 4000, 2: 1000}, nil, []string{"", "bytes=4000-", "bytes=5000-"}},
+		{"without ranges", false, map[int]int{1: 4000}, nil, []string{"", "bytes=4000-"}},
+		{"partial file", true, nil, content[:3000], []string{"bytes=3000-"}},
+		{"partial file dropped", true, map[int]int{1: 2000}, content[:3000], []string{"bytes=3000-", "bytes=5000-"}},
+		{"partial file too large", true, nil, append(append([]byte{}, content...), content[:10]...), []string{"bytes=10010-", ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &downloadServer{content: content, ranges: tt.ranges, drops: tt.drops}
+			server := httptest.NewServer(s)
+			defer server.Close()
+			path := filepath.Join(t.TempDir(), "logs.zip")
+			if tt.partial != nil {
+				if err := os.WriteFile(path+partialSuffix, tt.partial, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			size, err := downloadFile(context.Background(), path, fetcher(server.URL))
+			if err != nil {
+				t.Fatalf("downloadFile() error = %v", err)
+			}
+			if size != int64(len(content)) {
+				t.Errorf("downloadFile() = %d, want %d", size, len(content))
+			}
+			if got, err := os.ReadFile(path); err != nil || !bytes.Equal(got, content) {
+				t.Errorf("file has %d bytes (%v), want the %d bytes of the content", len(got), err, len(content))
+			}
+			if _, err := os.Stat(path + partialSuffix); !os.IsNotExist(err) {
+				t.Errorf("partial file exists after the download: %v", err)
+			}
+			if fmt.Sprint(s.requested) != fmt.Sprint(tt.requested) {
+				t.Errorf("requested ranges = %q, want %q", s.requested, tt.requested)
+			}
+		})
+	}
+}
+
+// TestDownloadFileFailed checks, that a failed download keeps the partial
+// file for the next call and does not create the file.
+func TestDownloadFileFailed(t *testing.T) {
+	tests := []struct {
+		name     string
+		handler  http.HandlerFunc
+		requests int
+		// partial is the size of the partial file after the download
+		partial int
+	}{
+		{"not found", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		}, 1, -1},
+		{"forbidden", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+		}, 1, -1},
+		{"not found with partial file", func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Range") != "bytes=5-" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusNotFound)
+		}, 1, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				tt.handler(w, r)
+			}))
+			defer server.Close()
+			path := filepath.Join(t.TempDir(), "logs.zip")
+			if tt.partial > 0 {
+				if err := os.WriteFile(path+partialSuffix, make([]byte, tt.partial), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if _, err := downloadFile(ctx, path, fetcher(server.URL)); err == nil {
+				t.Fatal("downloadFile() succeeded, want an error")
+			}
+			if requests != tt.requests {
+				t.Errorf("%d requests, want %d", requests, tt.requests)
+			}
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("file exists after the failed download: %v", err)
+			}
+			info, err := os.Stat(path + partialSuffix)
+			switch {
+			case tt.partial < 0 && !os.IsNotExist(err):
+				t.Errorf("partial file exists: %v", err)
+			case tt.partial > 0 && (err != nil || info.Size() != int64(tt.partial)):
+				t.Errorf("partial file was not kept: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"fmt"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/pipelines"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const envPrefix = "RUNPIPELINE_"
+
+// runInfo collects the information of the triggered run that is
+// handed over to subsequent steps.
+type runInfo struct {
+	ID          int
+	URL         string
+	Result      string
+	State       string
+	BuildNumber string
+	ExitCode    int
+	Outputs     map[string]string
+	Created     time.Time
+	Started     time.Time
+	Finished    time.Time
+}
+
+// update takes over all available values of the run.
+func (ri *runInfo) update(run *pipelines.Run) {
+	if run == nil {
+		return
+	}
+	if run.Id != nil {
+		ri.ID = *run.Id
+	}
+	if run.Name != nil {
+		ri.BuildNumber = *run.Name
+	}
+	if run.Result != nil {
+		ri.Result = string(normalizeResult(string(*run.Result)))
+	}
+	if run.State != nil {
+		ri.State = fmt.Sprintf("%v", *run.State)
+	}
+	if url := webURL(run); url != "" {
+		ri.URL = url
+	}
+	if run.CreatedDate != nil {
+		ri.Created = run.CreatedDate.Time
+	}
+	if run.FinishedDate != nil {
+		ri.Finished = run.FinishedDate.Time
+	}
+}
+
+// statusText returns the result of the run or its state, if the run is
+// not completed.
+func (ri *runInfo) statusText() string {
+	if ri.Result != "" {
+		return ri.Result
+	}
+	return ri.State
+}
+
+// duration returns the time from the creation to the end of the run or
+// zero, if the run is not finished. Both are timestamps of the server, a
+// negative duration is clamped to zero.
+func (ri *runInfo) duration() time.Duration {
+	if ri.Created.IsZero() || ri.Finished.IsZero() || ri.Finished.Before(ri.Created) {
+		return 0
+	}
+	return ri.Finished.Sub(ri.Created)
+}
+
+// webURL returns the link of the run in the web UI and falls back
+// to the REST URL of the run.
+func webURL(run *pipelines.Run) string {
+	if links, ok := run.Links.(map[string]interface{}); ok {
+		if web, ok := links["web"].(map[string]interface{}); ok {
+			if href, ok := web["href"].(string); ok {
+				return href
+			}
+		}
+	}
+	if run.Url != nil {
+		return *run.Url
+	}
+	return ""
+}
+
+var envNameInvalidChars = regexp.MustCompile("[^A-Z0-9_]")
+
+// envVar is a variable of the run information, the key is used with
+// the prefix RUNPIPELINE_.
+type envVar struct {
+	key   string
+	value string
+}
+
+// line returns the variable as KEY=value line of the env file.
+func (v envVar) line() string {
+	return envPrefix + v.key + "=" + quoteEnvValue(v.value)
+}
+
+// environ returns the variable for the environment of a process.
+func (v envVar) environ() string {
+	return envPrefix + v.key + "=" + v.value
+}
+
+// envVars returns the run information as variables.
+func (ri *runInfo) envVars() []envVar {
+	runID := ""
+	if ri.ID > 0 {
+		runID = strconv.Itoa(ri.ID)
+	}
+	vars := []envVar{
+		{"RUN_ID", runID},
+		{"RUN_URL", ri.URL},
+		{"RESULT", ri.Result},
+		{"BUILD_NUMBER", ri.BuildNumber},
+		{"EXIT_CODE", strconv.Itoa(ri.ExitCode)},
+	}
+	t := ri.timestamps()
+	for _, phase := range []struct {
+		key   string
+		epoch *int64
+		iso   *string
+	}{{"CREATED", t.CreatedAt, t.Created}, {"STARTED", t.StartedAt, t.Started}, {"FINISHED", t.FinishedAt, t.Finished}} {
+		epoch, iso := "", ""
+		if phase.epoch != nil {
+			epoch, iso = strconv.FormatInt(*phase.epoch, 10), *phase.iso
+		}
+		vars = append(vars, envVar{phase.key + "_AT", epoch}, envVar{phase.key, iso})
+	}
+
+	names := make([]string, 0, len(ri.Outputs))
+	for name := range ri.Outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		key := "OUT_" + envNameInvalidChars.ReplaceAllString(strings.ToUpper(name), "_")
+		vars = append(vars, envVar{key, ri.Outputs[name]})
+	}
+	return vars
+}
+
+// envVars returns the information of the run, of the pull request and
+// the annotations.
+func (app *App) envVars() []envVar {
+	vars := app.run.envVars()
+	if app.pullRequest != nil {
+		vars = append(vars, app.pullRequest.envVars()...)
+	}
+	for _, key := range app.annotations.keys() {
+		name := "ANNOTATION_" + envNameInvalidChars.ReplaceAllString(strings.ToUpper(key), "_")
+		vars = append(vars, envVar{name, app.annotations[key]})
+	}
+	return vars
+}
+
+var envSafeValue = regexp.MustCompile(`^[A-Za-z0-9_./:@%+,=-]*$`)
+
+// quoteEnvValue quotes values with spaces or special characters, so
+// that the file can be sourced by a shell and read by docker-compose.
+func quoteEnvValue(value string) string {
+	if envSafeValue.MatchString(value) {
+		return value
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`", "\r", `\r`, "\n", `\n`)
+	return `"` + r.Replace(value) + `"`
+}
+
+func (app *App) writeEnvFile() error {
+	mode := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if app.envFileAppend {
+		mode = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	f, err := os.OpenFile(app.envFile, mode, 0644)
+	if err != nil {
+		return err
+	}
+	eol := app.lineEnding.sequence()
+	for _, v := range app.envVars() {
+		if _, err = fmt.Fprint(f, v.line(), eol); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
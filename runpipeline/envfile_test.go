@@ -0,0 +1,120 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCapturesRunVariables(t *testing.T) {
+	tests := []struct {
+		name        string
+		captureFile string
+		envFile     string
+		want        bool
+	}{
+		{"none", "", "", false},
+		{"capture file", "vars.txt", "", true},
+		{"env file", "", "run.env", true},
+		{"both", "vars.txt", "run.env", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &App{captureFile: tt.captureFile, envFile: tt.envFile}
+			if got := app.capturesRunVariables(); got != tt.want {
+				t.Errorf("capturesRunVariables() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestEnvFileOutputVariables checks, that the output variables of the run
+// are written to the env file without 'capture-run-variables'.
+func TestEnvFileOutputVariables(t *testing.T) {
+	f := newFakeServer(t)
+	f.route(locationTimeline, "{project}/_apis/build/builds/{buildId}/timeline/{timelineId}", func(req *fakeRequest) (int, interface{}) {
+		if req.values["buildId"] != "7" {
+			return http.StatusNotFound, map[string]string{"message": "build not found"}
+		}
+		return http.StatusOK, `{"records": [
+			{"type": "Job", "name": "Build", "variables": {
+				"image.tag": {"value": "1.2.3"},
+				"password": {"isSecret": true}}},
+			{"type": "Job", "name": "Test", "variables": {
+				"report": {"value": "all tests passed"}}}]}`
+	})
+	path := filepath.Join(t.TempDir(), "run.env")
+	app := &App{envFile: path, budget: newAPIBudget(0, http.DefaultTransport)}
+	pr := testRun(f.project(), "build", 1, 7)
+	pr.info.ID = 7
+	pr.info.Result = "succeeded"
+	app.run = &pr.info
+
+	if !app.capturesRunVariables() {
+		t.Fatal("run variables are not captured for the env file")
+	}
+	app.captureRunVariables(context.Background(), pr)
+	if err := app.writeEnvFile(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := string(data)
+	for _, line := range []string{
+		"RUNPIPELINE_RUN_ID=7\n",
+		"RUNPIPELINE_RESULT=succeeded\n",
+		"RUNPIPELINE_OUT_IMAGE_TAG=1.2.3\n",
+		"RUNPIPELINE_OUT_REPORT=\"all tests passed\"\n",
+	} {
+		if !strings.Contains(content, line) {
+			t.Errorf("env file does not contain %q:\n%s", line, content)
+		}
+	}
+	if strings.Contains(content, "PASSWORD") {
+		t.Errorf("env file contains the secret variable:\n%s", content)
+	}
+}
+
+func TestQuoteEnvValue(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"", ""},
+		{"1.2.3", "1.2.3"},
+		{"https://dev.azure.com/org/prj/_build/results?buildId=1", "\"https://dev.azure.com/org/prj/_build/results?buildId=1\""},
+		{"two words", `"two words"`},
+		{`say "hi"`, `"say \"hi\""`},
+		{"$HOME", `"\$HOME"`},
+		{"`id`", "\"\\`id\\`\""},
+		{"a\nb", `"a\nb"`},
+		{"a\r\nb", `"a\r\nb"`},
+		{`back\slash`, `"back\\slash"`},
+	}
+	for _, tt := range tests {
+		if got := quoteEnvValue(tt.value); got != tt.want {
+			t.Errorf("quoteEnvValue(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"fmt"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/taskagent"
+	log "github.com/sirupsen/logrus"
+	"strings"
+)
+
+// environmentOverride is an environment, that the runs must not use,
+// and the environment, that is meant instead.
+type environmentOverride struct {
+	from string
+	to   string
+	// fromID is the id of the environment 'from' by 'org/project', 0 if
+	// the project has no such environment. It is filled before the runs
+	// are started.
+	fromID map[string]int
+}
+
+// environmentOverrides is the value of the flag 'environment-override'.
+type environmentOverrides []*environmentOverride
+
+func (e *environmentOverrides) String() string {
+	var list []string
+	for _, o := range *e {
+		list = append(list, o.from+"="+o.to)
+	}
+	return fmt.Sprintf("%s", list)
+}
+
+func (e *environmentOverrides) Set(value string) error {
+	kv := strings.SplitN(value, "=", 2)
+	if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+		return fmt.Errorf("use 'from=to', eg. 'prod=staging'")
+	}
+	*e = append(*e, &environmentOverride{from: kv[0], to: kv[1], fromID: make(map[string]int)})
+	return nil
+}
+
+// environmentDeploymentsTop is the number of the latest deployments of
+// an environment, that are searched for the run.
+const environmentDeploymentsTop = 50
+
+// resolveEnvironmentOverrides reads the ids of the overridden
+// environments of the projects of the runs. Overrides, that can not
+// match, are logged as warning.
+func (app *App) resolveEnvironmentOverrides(ctx context.Context, runs []*pipelineRun) {
+	for _, pr := range runs {
+		key := pr.prj.org.name + "/" + pr.prj.name
+		for _, override := range app.environmentOverrides {
+			if _, ok := override.fromID[key]; ok {
+				continue
+			}
+			client, err := pr.prj.org.taskAgentClient(ctx)
+			if err != nil {
+				log.Warnf("Environments of project '%s' could not be read: %v", pr.prj.name, err)
+				override.fromID[key] = 0
+				continue
+			}
+			override.fromID[key] = app.environmentID(ctx, client, pr.prj, override.from)
+			if override.fromID[key] == 0 {
+				log.Warnf("Project '%s' has no environment '%s', the override to '%s' has no effect.", pr.prj.name, override.from, override.to)
+			} else if app.environmentID(ctx, client, pr.prj, override.to) == 0 {
+				log.Warnf("Project '%s' has no environment '%s'.", pr.prj.name, override.to)
+			}
+		}
+	}
+}
+
+// checkEnvironmentOverrides looks for deployments of the run to an
+// environment, that is overridden. Azure DevOps has no API to move a
+// queued deployment job to another environment, therefore the run is
+// canceled instead of deploying to the wrong environment.
+func (app *App) checkEnvironmentOverrides(ctx context.Context, pr *pipelineRun) {
+	if pr.environmentOverridden || !app.budget.allowOptional("environmentOverride") {
+		return
+	}
+	client, err := pr.prj.org.taskAgentClient(ctx)
+	if err != nil {
+		pr.log.Warnf("Environments of pipeline '%s' could not be read: %v", pr.name, err)
+		return
+	}
+	for _, override := range app.environmentOverrides {
+		id := override.fromID[pr.prj.org.name+"/"+pr.prj.name]
+		if id == 0 {
+			continue
+		}
+		args := &taskagent.GetEnvironmentDeploymentExecutionRecordsArgs{
+			Project:       &pr.prj.name,
+			EnvironmentId: &id,
+			Top:           intPtr(environmentDeploymentsTop),
+		}
+		records, err := client.GetEnvironmentDeploymentExecutionRecords(ctx, *args)
+		if err != nil {
+			pr.log.Warnf("Deployments of environment '%s' could not be read: %v", override.from, err)
+			continue
+		}
+		for _, record := range records.Value {
+			if record.Owner == nil || record.Owner.Id == nil || *record.Owner.Id != pr.runID {
+				continue
+			}
+			job := ""
+			if record.JobName != nil {
+				job = *record.JobName
+			}
+			pr.environmentOverridden = true
+			pr.log.Errorf("Job '%s' of run %d of pipeline '%s' targets environment '%s'. Azure DevOps can not redirect it to environment '%s', the run is canceled.", job, pr.runID, pr.name, override.from, override.to)
+			buildClient, err := pr.prj.org.buildClient(ctx)
+			if err != nil {
+				pr.log.Warnf("Run %d of pipeline '%s' could not be canceled: %v", pr.runID, pr.name, err)
+				return
+			}
+			app.cancelRun(ctx, buildClient, pr, pr.runID)
+			return
+		}
+	}
+}
+
+// environmentID returns the id of the environment of the project, 0 if
+// the environment does not exist.
+func (app *App) environmentID(ctx context.Context, client taskagent.Client, prj *project, name string) int {
+	args := &taskagent.GetEnvironmentsArgs{
+		Project: &prj.name,
+		Name:    &name,
+	}
+	environments, err := client.GetEnvironments(ctx, *args)
+	if err != nil {
+		log.Warnf("Environment '%s' of project '%s' could not be read: %v", name, prj.name, err)
+		return 0
+	}
+	for _, environment := range environments.Value {
+		if environment.Id != nil && environment.Name != nil && strings.EqualFold(*environment.Name, name) {
+			return *environment.Id
+		}
+	}
+	log.Debugf("Project '%s' has no environment '%s'.", prj.name, name)
+	return 0
+}
@@ -0,0 +1,79 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline_test
+
+import (
+	"adPipeline/runpipeline"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+func ExampleClient_Run() {
+	ctx := context.Background()
+	client := runpipeline.NewClient("myorg", "myproject", os.Getenv("AZURE_DEVOPS_TOKEN"))
+	result, err := client.Run(ctx, runpipeline.RunOptions{
+		Pipeline:   "deploy",
+		Branch:     "main",
+		Parameters: map[string]string{"env": "prod"},
+		Timeout:    30 * time.Minute,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	fmt.Printf("Run %d %s (%s)\n", result.RunID, result.Result, result.URL)
+}
+
+func ExampleClient_GetStatus() {
+	ctx := context.Background()
+	client := runpipeline.NewClient("myorg", "myproject", os.Getenv("AZURE_DEVOPS_TOKEN"))
+	queued, err := client.Run(ctx, runpipeline.RunOptions{Pipeline: "deploy", NoWait: true})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	status, err := client.GetStatus(ctx, runpipeline.RunOptions{PipelineID: queued.PipelineID, RunID: queued.RunID})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	fmt.Printf("Run %d is %s\n", status.RunID, status.State)
+}
+
+func ExampleClient_CancelRun() {
+	client := runpipeline.NewClient("myorg", "myproject", os.Getenv("AZURE_DEVOPS_TOKEN"))
+	if err := client.CancelRun(context.Background(), runpipeline.RunOptions{RunID: 1234}); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
+
+func ExampleExitError() {
+	// an error of Client, eg. because the wait for the run was canceled
+	var err error = &runpipeline.ExitError{Code: 1, Err: context.Canceled}
+
+	var exitErr *runpipeline.ExitError
+	if errors.As(err, &exitErr) {
+		fmt.Println("exit code:", exitErr.Code)
+	}
+	fmt.Println("canceled:", errors.Is(err, context.Canceled))
+	// Output:
+	// exit code: 1
+	// canceled: true
+}
@@ -0,0 +1,366 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// explanation is the numbered plan of 'explain'.
+type explanation struct {
+	steps []string
+}
+
+func (e *explanation) add(format string, args ...interface{}) {
+	e.steps = append(e.steps, fmt.Sprintf(format, args...))
+}
+
+// explain writes the steps, that the program would take with the
+// parameters of the command line. No API call is made, the plan is
+// derived from the parameters only, so that names are not resolved and
+// values, that are read from Azure DevOps, are described.
+func (app *App) explain(w io.Writer) {
+	e := &explanation{}
+	source := "the token of parameter 'token'"
+	if app.tokenSaved {
+		source = "the token saved in the keyring"
+	}
+	e.add("Authenticate to organization '%s' at %s with %s.", app.org, app.baseURL, source)
+	if app.tokenExpiryWarn > 0 {
+		action := "warn"
+		if app.failOnExpiringToken {
+			action = "end with exit code 33"
+		}
+		e.add("Read the expiry of the token and %s, if it expires within %v.", action, app.tokenExpiryWarn)
+	}
+	if app.pullRequest != nil {
+		e.add("Read pull request %d and use its source branch.", app.pullRequest.ID)
+	}
+	switch app.command {
+	case commandList:
+		e.add("List the pipelines of project '%s' without starting a run.", app.prj)
+		writeExplanation(w, e)
+		return
+	case commandCancel:
+		e.add("Request the cancellation of run %d.", app.runID)
+		app.explainOutputs(e)
+		writeExplanation(w, e)
+		return
+	}
+	app.explainPipelines(e)
+	switch {
+	case app.report && app.runID > 0:
+		e.add("Read run %d of the pipeline and report its state without starting a run.", app.runID)
+		app.explainOutputs(e)
+		writeExplanation(w, e)
+		return
+	case app.report:
+		e.add("Read the latest run of every pipeline and report its result without starting a run.")
+		app.explainOutputs(e)
+		writeExplanation(w, e)
+		return
+	case app.branch != "":
+		e.add("Run on branch '%s'.", app.branch)
+	case app.pullRequest == nil && app.branchDefault != "" && app.branchFromPipeline:
+		e.add("Run on the default branch of the pipeline or on '%s', if it can not be read.", app.branchDefault)
+	case app.pullRequest == nil && app.branchDefault != "":
+		e.add("Run on branch '%s'.", app.branchDefault)
+	case app.pullRequest == nil:
+		e.add("Run on the default branch of the pipeline.")
+	}
+	if app.branchPattern != nil {
+		e.add("Check, that the branch matches '%s'.", app.branchPattern)
+	}
+	app.explainChecks(e)
+	app.explainTrigger(e)
+	app.explainWait(e)
+	app.explainOutputs(e)
+	writeExplanation(w, e)
+}
+
+// explainPipelines describes the lookup of the pipelines.
+func (app *App) explainPipelines(e *explanation) {
+	for _, ref := range app.pipelines {
+		parts := strings.Split(ref, "/")
+		if len(parts) == 3 && parts[0] != "" && parts[1] != "" && parts[2] != "" {
+			e.add("Look up pipeline '%s' in project '%s' of organization '%s'.", parts[2], parts[1], parts[0])
+		} else {
+			e.add("Look up pipeline '%s' in project '%s'.", ref, app.prj)
+		}
+	}
+	for _, id := range app.ids {
+		e.add("Read pipeline %d in project '%s'.", id, app.prj)
+	}
+	if app.pipelineExistsRetry && (len(app.pipelines) > 0 || app.batch != nil) {
+		e.add("Look up pipelines, that do not exist yet, every %v for up to %v.", pipelineExistsInterval, app.pipelineExistsTimeout)
+	}
+	if app.includeDisabled {
+		e.add("Include disabled pipelines in the lookup and warn, if a pipeline is disabled or paused.")
+	}
+	if app.batch != nil {
+		names := make([]string, 0, len(app.batch.Pipelines))
+		for _, bp := range app.batch.Pipelines {
+			if bp.ID > 0 {
+				names = append(names, fmt.Sprintf("%d", bp.ID))
+			} else {
+				names = append(names, bp.Name)
+			}
+		}
+		e.add("Look up the pipelines of the batch file: %s.", strings.Join(names, ", "))
+	}
+}
+
+// explainChecks describes the checks before the runs are started.
+func (app *App) explainChecks(e *explanation) {
+	if len(app.paramsSecrets) > 0 {
+		file := &paramsFile{Secrets: app.paramsSecrets}
+		e.add("Read the secrets %s of the parameter file from Azure Key Vault.", strings.Join(file.secretNames(), ", "))
+	}
+	if app.skipIfDeployed.template != nil {
+		e.add("Skip the pipelines, whose last successful deployment to environment '%s' is tagged with version '%s'.", app.skipIfDeployed.environment, app.skipIfDeployed.version)
+	}
+	if len(app.guard) > 0 {
+		e.add("Ask for confirmation of pipelines, that match the guards %s.", strings.Join(app.guard, ", "))
+	}
+	if len(app.environmentOverrides) > 0 {
+		e.add("Resolve the environment overrides %s.", app.environmentOverrides.String())
+	}
+	if app.pool != "" {
+		e.add("Look up agent pool '%s' and check, that it is authorized for the pipelines.", app.pool)
+	}
+	if app.pipelineRevision != "" {
+		e.add("Look up the %s revision of the pipelines.", app.pipelineRevision)
+	}
+	if app.enforceMinScopes {
+		e.add("Check, that the token has the scopes, that the parameters need.")
+	}
+	if app.interactive {
+		e.add("Ask on the console for required pipeline parameters, that are not specified.")
+	}
+	if app.interactiveParams {
+		e.add("Ask on the console for all declared pipeline parameters and for confirmation.")
+	}
+	if app.paramSchema != nil {
+		e.add("Validate the parameters against '%s'.", app.paramSchemaFile)
+	}
+	if !app.skipParamValidation && len(app.getParameters()) > 0 {
+		action := "warn about"
+		if app.failOnIgnoredParams {
+			action = "end with exit code 26 for"
+		}
+		e.add("Preview the runs and %s parameters, that the pipelines do not declare.", action)
+	}
+	if app.lockBackend != nil {
+		if app.lockWait > 0 {
+			e.add("Acquire a lock per pipeline and branch, waiting up to %v.", app.lockWait)
+		} else {
+			e.add("Acquire a lock per pipeline and branch without waiting.")
+		}
+	}
+	if app.cancelSuperseded {
+		e.add("Cancel older runs of the pipelines on the same branch.")
+	}
+}
+
+// explainTrigger describes how the runs are started.
+func (app *App) explainTrigger(e *explanation) {
+	how := "in parallel"
+	if app.sequential {
+		how = "one after the other"
+	}
+	api := "pipelines API, classic build definitions with the builds API,"
+	if app.queueBuilds() {
+		api = "builds API"
+	}
+	e.add("Trigger the runs %s with the %s and the parameters %s.", how, api, formatParameters(maskParameters(app.getParameters())))
+	if len(app.paramsFromLastRun) > 0 {
+		e.add("Read the last successful run of the pipelines and set the parameters %s to its output variables.", app.paramsFromLastRun.String())
+	}
+	if len(app.variables) > 0 {
+		e.add("Set the variables %s at queue time.", formatParameters(app.variables))
+	}
+	if app.batch != nil {
+		e.add("Add the parameters, branches and timeouts of the batch file to its pipelines.")
+	}
+	if len(app.demands) > 0 {
+		e.add("Demand %s of the agents.", app.demands.String())
+	}
+	if app.runNameTemplate.template != nil {
+		e.add("Name the runs with the template of parameter 'run-name'.")
+	}
+	if app.annotationsAsTags && len(app.annotations) > 0 {
+		e.add("Tag the runs with the annotations.")
+	}
+	if app.annotationsAsProperties && len(app.annotations) > 0 {
+		e.add("Add the annotations as properties to the runs.")
+	}
+	if app.commitStatus == commitStatusPendingFinal {
+		e.add("Post a pending status to the built commit.")
+	}
+	if app.reportToPRCheck {
+		e.add("Post a pending check to pull request %d before every start.", app.pullRequest.ID)
+	}
+}
+
+// explainWait describes how the runs are watched.
+func (app *App) explainWait(e *explanation) {
+	strategy := string(app.pollStrategyName)
+	if strategy == "" {
+		strategy = string(pollFixed)
+	}
+	until := "until they are completed"
+	if app.timeout > 0 {
+		until += fmt.Sprintf(" or the timeout of %v, that cancels the runs", app.timeout)
+	}
+	if !app.jobDeadline.IsZero() {
+		until += fmt.Sprintf(" or %v before the deadline of the job", app.deadlineMargin)
+	}
+	if app.maxPollCount > 0 {
+		until += fmt.Sprintf(" or %d status checks, that end the program with exit code 13", app.maxPollCount)
+	}
+	e.add("Poll the runs with the %s strategy and at most %v between the status checks %s.", strategy, app.pollInterval, until)
+	switch {
+	case app.approve || app.reject:
+		how := "after confirmation on the console"
+		if app.approveMessage != "" {
+			how = fmt.Sprintf("with the comment '%s'", app.approveMessage)
+		}
+		verb := "Approve"
+		if app.reject {
+			verb = "Reject"
+		}
+		e.add("%s the pending approval of stage '%s' %s.", verb, app.approveStage, how)
+	case app.approveStage != "":
+		e.add("Report the pending approval of stage '%s'.", app.approveStage)
+	}
+	if app.waitForDeployment != "" {
+		e.add("Decide the result by the deployment to environment '%s'.", app.waitForDeployment)
+	}
+	if len(app.stageSLOs) > 0 {
+		e.add("Check the durations of the stages %s.", app.stageSLOs.String())
+	}
+	if len(app.stageTimeouts) > 0 {
+		e.add("Cancel the stages %s, when they run longer, and end with exit code 14.", app.stageTimeouts.String())
+	}
+	if app.retryOnCancel > 0 {
+		e.add("Start a run again up to %d times, if it is canceled by Azure DevOps.", app.retryOnCancel)
+	}
+	if app.deleteIfNeverStarted {
+		e.add("Delete runs, that never started, when the program stops waiting.")
+	}
+	if app.resumeFile != "" {
+		e.add("Poll the runs of '%s' instead of starting their pipelines, if the file exists, and delete it after the runs are completed.", app.resumeFile)
+	}
+	if app.pollOnExit {
+		e.add("Write the started runs to '%s' on SIGTERM, so that the next invocation resumes polling them.", app.resumeFile)
+	}
+	if app.buildTagTemplate.template != nil {
+		kind := "lightweight"
+		if app.buildTagMessage != "" {
+			kind = "annotated"
+		}
+		e.add("Create the %s Git tag '%s' on the built commit of runs, that succeeded.", kind, app.buildTagTemplate.text)
+	}
+	if app.cleanupOnSuccess {
+		e.add("Delete runs, that succeeded, after their outputs are written.")
+	}
+	if app.waitForEnvironment != "" {
+		e.add("Wait up to %v for the deployment to environment '%s'.", app.waitForEnvironmentTimeout, app.waitForEnvironment)
+	}
+}
+
+// explainOutputs describes, what is done with the results.
+func (app *App) explainOutputs(e *explanation) {
+	if app.summaryInterval > 0 {
+		e.add("Print a summary of several runs every %v while they are running.", app.summaryInterval)
+	}
+	if app.captureFile != "" {
+		e.add("Write the output variables of the runs to '%s'.", app.captureFile)
+	}
+	if app.downloadLogsDir != "" {
+		e.add("Download the logs to '%s'.", app.downloadLogsDir)
+	}
+	if app.downloadArtifactsDir != "" {
+		e.add("Download the artifacts to '%s'.", app.downloadArtifactsDir)
+	}
+	if app.commitStatus != commitStatusOff {
+		e.add("Post the result as status to the built commit.")
+	}
+	if app.reportToPRCheck {
+		e.add("Post the result as check to pull request %d.", app.pullRequest.ID)
+	}
+	if app.failureIssue {
+		e.add("Create a bug work item for failed runs.")
+	}
+	if app.telemetryEndpoint != "" {
+		e.add("Send telemetry to %s.", app.telemetryEndpoint)
+	}
+	for _, hook := range []struct {
+		when     string
+		commands stringSlice
+	}{
+		{"on success", app.hooks.onSuccess},
+		{"on failure", app.hooks.onFailure},
+		{"on completion", app.hooks.onComplete},
+	} {
+		for _, command := range hook.commands {
+			e.add("Execute '%s' %s.", command, hook.when)
+		}
+	}
+	if app.envFile != "" {
+		e.add("Write the run information and the output variables of the runs to '%s'.", app.envFile)
+	}
+	if app.reportMdFile != "" {
+		e.add("Write the report of the runs as Markdown to '%s'.", app.reportMdFile)
+	}
+	if app.output == outputInflux {
+		e.add("Append the runs in the InfluxDB line protocol to '%s'.", app.influxFile)
+	}
+	if app.output == outputGitHubSummary {
+		e.add("Append a table of the runs to the summary of the GitHub Actions step in $%s.", githubStepSummary)
+	}
+	output := app.output
+	if output == "" {
+		output = outputText
+	}
+	e.add("Write the result as %s and end with the exit code of the result.", output)
+}
+
+// formatParameters returns the parameters sorted by name like
+// '{env: prod, version: 1.2}'.
+func formatParameters(parameters map[string]string) string {
+	names := make([]string, 0, len(parameters))
+	for name := range parameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	list := make([]string, 0, len(names))
+	for _, name := range names {
+		list = append(list, name+": "+parameters[name])
+	}
+	return "{" + strings.Join(list, ", ") + "}"
+}
+
+func writeExplanation(w io.Writer, e *explanation) {
+	for i, step := range e.steps {
+		fmt.Fprintf(w, "%d. %s\n", i+1, step)
+	}
+	fmt.Fprintln(w, "No API call was made.")
+}
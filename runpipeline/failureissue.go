@@ -0,0 +1,131 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"fmt"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/build"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/webapi"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/workitemtracking"
+	"html"
+	"strings"
+	"time"
+)
+
+// failureIssueType is the type of the work item, that is created for a
+// failed run.
+const failureIssueType = "Bug"
+
+// createFailureIssue opens a bug for the failed run, that links to the
+// run. Failures are only logged as warnings.
+func (app *App) createFailureIssue(ctx context.Context, pr *pipelineRun) {
+	if !app.budget.allowOptional("failureIssue") {
+		return
+	}
+	id, err := app.postFailureIssue(ctx, pr)
+	if err != nil {
+		pr.log.Warnf("Work item for the failed run %d of pipeline '%s' could not be created: %v", pr.runID, pr.name, err)
+		return
+	}
+	pr.log.Infof("Work item %d created for the failed run %d of pipeline '%s'.", id, pr.runID, pr.name)
+}
+
+func (app *App) postFailureIssue(ctx context.Context, pr *pipelineRun) (int, error) {
+	finished := pr.info.Finished
+	if finished.IsZero() {
+		finished = app.clock.now()
+	}
+	title := fmt.Sprintf("Pipeline '%s' failed on branch '%s' at %s", pr.name, app.failureBranch(ctx, pr), finished.UTC().Format(time.RFC3339))
+	description := fmt.Sprintf("Run %d (%s) of pipeline '%s' failed: <a href=\"%s\">%s</a>",
+		pr.runID, html.EscapeString(pr.info.BuildNumber), html.EscapeString(pr.name), html.EscapeString(pr.info.URL), html.EscapeString(pr.info.URL))
+
+	document := []webapi.JsonPatchOperation{
+		addField("System.Title", title),
+		addField("Microsoft.VSTS.TCM.ReproSteps", description),
+	}
+	if app.failureIssueAreaPath != "" {
+		document = append(document, addField("System.AreaPath", app.failureIssueAreaPath))
+	}
+	if app.failureIssueIterationPath != "" {
+		document = append(document, addField("System.IterationPath", app.failureIssueIterationPath))
+	}
+	if pr.info.URL != "" {
+		document = append(document, addRelation("Hyperlink", pr.info.URL, fmt.Sprintf("Run %d", pr.runID)))
+	}
+
+	client, err := pr.prj.org.workItemClient(ctx)
+	if err != nil {
+		return 0, err
+	}
+	workItemType := failureIssueType
+	args := &workitemtracking.CreateWorkItemArgs{
+		Document: &document,
+		Project:  &pr.prj.name,
+		Type:     &workItemType,
+	}
+	item, err := client.CreateWorkItem(ctx, *args)
+	if err != nil {
+		return 0, err
+	}
+	if item == nil || item.Id == nil {
+		return 0, fmt.Errorf("the response contains no work item")
+	}
+	return *item.Id, nil
+}
+
+// failureBranch returns the branch of the run. Runs of the default branch
+// have no branch on the command line, the branch is read from the build.
+func (app *App) failureBranch(ctx context.Context, pr *pipelineRun) string {
+	if pr.branch != "" {
+		return strings.TrimPrefix(pr.branch, "refs/heads/")
+	}
+	client, err := pr.prj.org.buildClient(ctx)
+	if err == nil {
+		args := &build.GetBuildArgs{
+			Project: &pr.prj.name,
+			BuildId: &pr.runID,
+		}
+		b, err := client.GetBuild(ctx, *args)
+		if err == nil && b.SourceBranch != nil {
+			return strings.TrimPrefix(*b.SourceBranch, "refs/heads/")
+		}
+	}
+	return "default"
+}
+
+func addField(name string, value string) webapi.JsonPatchOperation {
+	path := "/fields/" + name
+	return webapi.JsonPatchOperation{
+		Op:    &webapi.OperationValues.Add,
+		Path:  &path,
+		Value: value,
+	}
+}
+
+func addRelation(rel string, url string, comment string) webapi.JsonPatchOperation {
+	path := "/relations/-"
+	return webapi.JsonPatchOperation{
+		Op:   &webapi.OperationValues.Add,
+		Path: &path,
+		Value: map[string]interface{}{
+			"rel":        rel,
+			"url":        url,
+			"attributes": map[string]string{"comment": comment},
+		},
+	}
+}
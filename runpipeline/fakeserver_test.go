@@ -0,0 +1,201 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/pipelines"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Location ids of the APIs, that the tests serve.
+const (
+	locationPipelines = "28e1305e-2afe-47bf-abaf-cbb0e6a91988"
+	locationRuns      = "7859261e-d2e9-4a68-b820-a5d84cc5bb3d"
+	locationBuilds    = "0cd358e1-9217-4d94-8269-1c1ee6f93dcf"
+	locationTimeline  = "8baac422-4c6e-4de5-8532-db96d92acffa"
+	locationAreas     = "e81700f7-3be2-46de-8624-2eb35882fcaa"
+	locationStages    = "b8aac6c9-744b-46e1-88fc-3550969f9313"
+)
+
+// fakeRequest is a request to the fake server with the route values of
+// its location.
+type fakeRequest struct {
+	*http.Request
+	values map[string]string
+	body   string
+	// header is added to the response, eg. the continuation token.
+	header http.Header
+}
+
+// fakeHandler answers a request with the status and the body, that is
+// encoded as JSON unless it is a string.
+type fakeHandler func(req *fakeRequest) (int, interface{})
+
+type fakeRoute struct {
+	location string
+	template string
+	pattern  *regexp.Regexp
+	names    []string
+	handler  fakeHandler
+}
+
+// fakeServer is an Azure DevOps organization 'org' for the tests. It
+// serves the locations of the registered routes, so that the clients of
+// the SDK find them, and records the requests.
+type fakeServer struct {
+	*httptest.Server
+	t *testing.T
+
+	lock     sync.Mutex
+	routes   []fakeRoute
+	requests []string
+	// maxVersion is the API version of the locations, eg. 5.1 of Azure
+	// DevOps Server 2019. It is 7.1 by default.
+	maxVersion string
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	f := &fakeServer{t: t, maxVersion: "7.1"}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.Close)
+	// like Azure DevOps Server, the clients of all areas use the URL of
+	// the organization
+	f.route(locationAreas, "_apis/ResourceAreas/{areaId}", func(req *fakeRequest) (int, interface{}) {
+		return http.StatusOK, map[string]interface{}{"count": 0, "value": []interface{}{}}
+	})
+	return f
+}
+
+// route registers the handler for the route template of the location,
+// eg. '{project}/_apis/pipelines/{pipelineId}/runs/{runId}'. Segments
+// with a route value are optional like on the server.
+func (f *fakeServer) route(location string, template string, handler fakeHandler) {
+	var names []string
+	pattern := "^/org"
+	for _, segment := range strings.Split(template, "/") {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			names = append(names, strings.Trim(segment, "{}"))
+			pattern += "(?:/([^/]+))?"
+			continue
+		}
+		pattern += "/" + regexp.QuoteMeta(segment)
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.routes = append(f.routes, fakeRoute{
+		location: location,
+		template: template,
+		pattern:  regexp.MustCompile(pattern + "$"),
+		names:    names,
+		handler:  handler,
+	})
+}
+
+// requested returns the requests as 'METHOD path?query' without the
+// lookups of the resource areas.
+func (f *fakeServer) requested() []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return append([]string(nil), f.requests...)
+}
+
+func (f *fakeServer) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions && strings.TrimRight(r.URL.Path, "/") == "/org/_apis" {
+		locations := f.locations()
+		f.write(w, http.StatusOK, map[string]interface{}{"count": len(locations), "value": locations})
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	f.lock.Lock()
+	if !strings.Contains(r.URL.Path, "/_apis/ResourceAreas") {
+		f.requests = append(f.requests, strings.TrimSuffix(r.Method+" "+r.URL.Path+"?"+r.URL.RawQuery, "?"))
+	}
+	routes := f.routes
+	f.lock.Unlock()
+	for _, route := range routes {
+		match := route.pattern.FindStringSubmatch(r.URL.Path)
+		if match == nil {
+			continue
+		}
+		values := make(map[string]string)
+		for i, name := range route.names {
+			if match[i+1] != "" {
+				values[name] = match[i+1]
+			}
+		}
+		req := &fakeRequest{Request: r, values: values, body: string(body), header: make(http.Header)}
+		status, response := route.handler(req)
+		for key, value := range req.header {
+			w.Header()[key] = value
+		}
+		f.write(w, status, response)
+		return
+	}
+	f.write(w, http.StatusNotFound, map[string]string{"message": "no route for " + r.URL.Path})
+}
+
+func (f *fakeServer) locations() []map[string]interface{} {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	var list []map[string]interface{}
+	for _, route := range f.routes {
+		list = append(list, map[string]interface{}{
+			"id":              route.location,
+			"area":            "fake",
+			"resourceName":    "fake",
+			"routeTemplate":   route.template,
+			"resourceVersion": 1,
+			"minVersion":      "1.0",
+			"maxVersion":      f.maxVersion,
+			"releasedVersion": f.maxVersion,
+		})
+	}
+	return list
+}
+
+func (f *fakeServer) write(w http.ResponseWriter, status int, response interface{}) {
+	data, ok := response.(string)
+	if !ok {
+		encoded, err := json.Marshal(response)
+		if err != nil {
+			f.t.Errorf("response could not be encoded: %v", err)
+		}
+		data = string(encoded)
+	}
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	}
+	w.WriteHeader(status)
+	fmt.Fprint(w, data)
+}
+
+// project returns the project 'prj' of the organization of the server.
+func (f *fakeServer) project() *project {
+	connection := azuredevops.NewPatConnection(f.URL+"/org", "token")
+	client := pipelines.NewClient(context.Background(), connection)
+	return &project{org: &organization{name: "org", connection: connection, pipelines: client}, name: "prj"}
+}
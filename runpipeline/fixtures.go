@@ -0,0 +1,260 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// fixtureOrigin replaces the URLs of Azure DevOps in the recorded
+// responses. The generated server replaces it with its own URL.
+const fixtureOrigin = "http://fixture.invalid"
+
+// fixtureEmail replaces the email addresses of users.
+var fixtureEmail = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+
+// fixtureGenerator collects the exchanges of 'generate-fixtures', that
+// are written as Go test file, when the program ends.
+type fixtureGenerator struct {
+	dir      string
+	recorder *recordTransport
+}
+
+// anonymization is a replacement of a name in the recorded exchanges.
+type anonymization struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// writeFixture writes the recorded exchanges as Go test file with a test
+// server, that replays them, and returns the path of the file. Nothing
+// is written, if no request was sent.
+func (app *App) writeFixture() (string, error) {
+	exchanges := app.fixtures.recorder.recorded()
+	if len(exchanges) == 0 {
+		return "", nil
+	}
+	anonymizations := app.fixtureAnonymizations()
+	for i := range exchanges {
+		exchanges[i].URL = anonymize(exchanges[i].URL, anonymizations)
+		exchanges[i].ResponseBody = anonymize(exchanges[i].ResponseBody, anonymizations)
+	}
+	pkg, err := fixturePackage(app.fixtures.dir)
+	if err != nil {
+		return "", err
+	}
+	names := make([]string, 0, len(app.runs))
+	for _, pr := range app.runs {
+		names = append(names, pr.name)
+	}
+	words := identifierWords(names)
+	src, err := format.Source(generateFixture(pkg, words, exchanges))
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(app.fixtures.dir, strings.ToLower(strings.Join(words, "_"))+"_fixture_test.go")
+	return path, os.WriteFile(path, src, 0644)
+}
+
+// fixtureAnonymizations replaces the hosts of Azure DevOps, the names of
+// the organizations and projects and the email addresses. The first
+// organization is 'org', the next 'org2' and so on, the same for the
+// projects.
+func (app *App) fixtureAnonymizations() []anonymization {
+	var list []anonymization
+	if base, err := url.Parse(app.baseURL); err == nil && base.Host != "" {
+		// the resource areas like vssps.dev.azure.com are replaced as well
+		pattern := regexp.MustCompile(`https?://([A-Za-z0-9-]+\.)*` + regexp.QuoteMeta(base.Host))
+		list = append(list, anonymization{pattern, fixtureOrigin})
+	}
+	orgs := make(map[string]string)
+	projects := make(map[string]string)
+	for _, pr := range app.runs {
+		if _, ok := orgs[pr.prj.org.name]; !ok {
+			orgs[pr.prj.org.name] = numberedName("org", len(orgs))
+			list = append(list, anonymizeName(pr.prj.org.name, orgs[pr.prj.org.name])...)
+		}
+		if _, ok := projects[pr.prj.name]; !ok {
+			projects[pr.prj.name] = numberedName("prj", len(projects))
+			list = append(list, anonymizeName(pr.prj.name, projects[pr.prj.name])...)
+		}
+	}
+	return append(list, anonymization{fixtureEmail, "user@example.com"})
+}
+
+func numberedName(prefix string, index int) string {
+	if index == 0 {
+		return prefix
+	}
+	return prefix + strconv.Itoa(index+1)
+}
+
+// anonymizeName replaces the name and its escaped forms. The name must be
+// a whole word, so that short names do not change other words.
+func anonymizeName(name string, replacement string) []anonymization {
+	var list []anonymization
+	for _, variant := range []string{name, url.PathEscape(name), url.QueryEscape(name)} {
+		pattern := regexp.QuoteMeta(variant)
+		if r, _ := utf8.DecodeRuneInString(variant); isWordRune(r) {
+			pattern = `\b` + pattern
+		}
+		if r, _ := utf8.DecodeLastRuneInString(variant); isWordRune(r) {
+			pattern += `\b`
+		}
+		list = append(list, anonymization{regexp.MustCompile("(?i)" + pattern), replacement})
+	}
+	return list
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+func anonymize(value string, anonymizations []anonymization) string {
+	for _, a := range anonymizations {
+		value = a.pattern.ReplaceAllLiteralString(value, a.replacement)
+	}
+	return value
+}
+
+// fixturePackage returns the package of the Go files in the directory or,
+// if there are none, the name of the directory as package.
+func fixturePackage(dir string) (string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return "", err
+	}
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(token.NewFileSet(), file, nil, parser.PackageClauseOnly)
+		if err == nil {
+			return f.Name.Name, nil
+		}
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	name := strings.Map(func(r rune) rune {
+		if r == '_' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, strings.ToLower(filepath.Base(abs)))
+	if name == "" || unicode.IsDigit(rune(name[0])) {
+		name = "fixtures"
+	}
+	return name, nil
+}
+
+// identifierWords splits the names of the pipelines into words, that the
+// names of the function and the file are made of.
+func identifierWords(names []string) []string {
+	var words []string
+	for _, name := range names {
+		words = append(words, strings.FieldsFunc(name, func(r rune) bool {
+			return r >= utf8.RuneSelf || !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})...)
+	}
+	if len(words) == 0 || unicode.IsDigit(rune(words[0][0])) {
+		words = append([]string{"pipeline"}, words...)
+	}
+	return words
+}
+
+// generateFixture returns the source of the test file. The exchanges are
+// matched by method and URL, every exchange is used once.
+func generateFixture(pkg string, words []string, exchanges []exchange) []byte {
+	name := ""
+	for _, word := range words {
+		name += strings.ToUpper(word[:1]) + word[1:]
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by runPipeline -generate-fixtures. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&b, "package %s\n\n", pkg)
+	fmt.Fprintf(&b, "import (\n\t\"net/http\"\n\t\"net/http/httptest\"\n\t\"strings\"\n\t\"sync\"\n\t\"testing\"\n)\n\n")
+	fmt.Fprintf(&b, "// new%sFixture starts a server, that answers the requests of the\n", name)
+	fmt.Fprintf(&b, "// recorded runs with the responses of Azure DevOps. Use the URL of the\n")
+	fmt.Fprintf(&b, "// server as base URL, 'org' as organization and 'prj' as project. Every\n")
+	fmt.Fprintf(&b, "// exchange is used once, a request without exchange fails the test.\n")
+	fmt.Fprintf(&b, "func new%sFixture(t *testing.T) *httptest.Server {\n", name)
+	fmt.Fprintf(&b, "t.Helper()\n")
+	fmt.Fprintf(&b, "exchanges := []struct {\nmethod string\nurl string\nstatus int\nheaders map[string]string\nresponse string\n}{\n")
+	for _, e := range exchanges {
+		fmt.Fprintf(&b, "{\nmethod: %s,\nurl: %s,\nstatus: %d,\n", strconv.Quote(e.Method), goString(e.URL), e.Status)
+		if len(e.Headers) > 0 {
+			fmt.Fprintf(&b, "headers: map[string]string{")
+			for _, header := range recordedHeaders {
+				if value, ok := e.Headers[header]; ok {
+					fmt.Fprintf(&b, "%s: %s, ", strconv.Quote(header), strconv.Quote(value))
+				}
+			}
+			fmt.Fprintf(&b, "},\n")
+		}
+		fmt.Fprintf(&b, "response: %s,\n},\n", goString(e.ResponseBody))
+	}
+	fmt.Fprintf(&b, "}\n")
+	fmt.Fprintf(&b, `used := make([]bool, len(exchanges))
+var lock sync.Mutex
+var server *httptest.Server
+server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+lock.Lock()
+defer lock.Unlock()
+for i, e := range exchanges {
+if used[i] || e.method != r.Method || e.url != r.URL.RequestURI() {
+continue
+}
+used[i] = true
+for name, value := range e.headers {
+w.Header().Set(name, value)
+}
+w.WriteHeader(e.status)
+w.Write([]byte(strings.ReplaceAll(e.response, %s, server.URL)))
+return
+}
+t.Errorf("Request %%s %%s is not recorded.", r.Method, r.URL.RequestURI())
+http.Error(w, "not recorded", http.StatusNotImplemented)
+}))
+t.Cleanup(server.Close)
+return server
+}
+`, strconv.Quote(fixtureOrigin))
+	return b.Bytes()
+}
+
+// goString returns the value as raw string literal, if possible, so that
+// the JSON of the responses stays readable.
+func goString(value string) string {
+	if utf8.ValidString(value) && !strings.ContainsAny(value, "`\r\x00\uFEFF") {
+		return "`" + value + "`"
+	}
+	return strconv.Quote(value)
+}
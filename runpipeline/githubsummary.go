@@ -0,0 +1,82 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// githubStepSummary is the environment variable of GitHub Actions with
+// the path of the Markdown file, that is shown in the summary of the
+// workflow run.
+const githubStepSummary = "GITHUB_STEP_SUMMARY"
+
+// writeWorkflowSummary appends a table of the runs to the summary file
+// of the GitHub Actions step. Other steps of the job write to the same
+// file, therefore the file is never truncated.
+func (app *App) writeWorkflowSummary(path string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = f.WriteString(workflowSummary(app.runs)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// workflowSummary returns the runs as GitHub-flavored Markdown table with
+// one row per pipeline. The heading separates the table from the output
+// of the previous steps.
+func workflowSummary(runs []*pipelineRun) string {
+	var md strings.Builder
+	md.WriteString("### Pipeline runs\n\n")
+	md.WriteString("| Pipeline | Branch | Result | Duration | URL |\n")
+	md.WriteString("|----------|--------|--------|----------|-----|\n")
+	for _, pr := range runs {
+		result := pr.info.Result
+		if result == "" {
+			result = "unknown"
+		}
+		url := "-"
+		if pr.info.URL != "" {
+			url = pr.info.URL
+		}
+		branch := strings.TrimPrefix(pr.branch, "refs/heads/")
+		if branch == "" {
+			branch = "-"
+		}
+		fmt.Fprintf(&md, "| %s | %s | %s %s | %s | %s |\n", markdownText(pr.name), markdownText(branch),
+			workflowSummaryEmoji(pr.info.Result), markdownText(result), reportDuration(pr.info.duration()), url)
+	}
+	md.WriteString("\n")
+	return md.String()
+}
+
+// workflowSummaryEmoji returns the emoji of the result in the workflow
+// summary. Unlike the Markdown report a canceled run is a warning, not a
+// failure.
+func workflowSummaryEmoji(result string) string {
+	switch result {
+	case "canceled", "abandoned":
+		return "⚠️"
+	}
+	return resultEmoji(result)
+}
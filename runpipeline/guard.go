@@ -0,0 +1,110 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/pipelines"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"path"
+	"strings"
+)
+
+// checkGuard refuses to start pipelines, that match a guard pattern of
+// the configuration file and are not confirmed with 'confirm' or on the
+// console. The program ends with exit code 29 before any run is created.
+func (app *App) checkGuard(ctx context.Context, runs []*pipelineRun) {
+	for _, pr := range runs {
+		pattern, ok := app.guardPattern(ctx, pr)
+		if !ok {
+			continue
+		}
+		if containsString(app.confirm, pr.name) || containsString(app.confirm, pipelinePath(pr)) {
+			log.Infof("Pipeline '%s' matches the guard '%s' and is confirmed.", pr.name, pattern)
+			continue
+		}
+		if app.stdin != nil || isTerminal(os.Stdin) {
+			if app.stdin == nil {
+				app.stdin = bufio.NewReader(os.Stdin)
+			}
+			fmt.Fprintf(os.Stderr, "Pipeline '%s' matches the guard '%s'. Type the name of the pipeline to confirm: ", pr.name, pattern)
+			answer, _ := app.readLine()
+			if answer == pr.name {
+				continue
+			}
+			fmt.Fprintln(os.Stderr, "The name does not match.")
+		}
+		log.Errorf("Pipeline '%s' matches the guard '%s' and is not confirmed, use -confirm '%s'.", pr.name, pattern, pr.name)
+		app.exit(29)
+	}
+}
+
+// guardPattern returns the first guard pattern, that matches the
+// pipeline. Patterns with a slash are matched against the folder and the
+// name of the pipeline, eg. '/prod/*', others against the name only.
+func (app *App) guardPattern(ctx context.Context, pr *pipelineRun) (string, bool) {
+	for _, pattern := range app.guard {
+		subject := pr.name
+		if strings.Contains(pattern, "/") {
+			if pr.folder == "" {
+				app.readFolder(ctx, pr)
+			}
+			subject = pipelinePath(pr)
+			pattern = "/" + strings.TrimPrefix(pattern, "/")
+		}
+		if ok, _ := path.Match(pattern, subject); ok {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+// checkGuardPattern returns an error, if the pattern is malformed. A
+// malformed pattern would match no pipeline and the guard would not
+// protect it.
+func checkGuardPattern(pattern string) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("guard pattern '%s' is invalid: %v", pattern, err)
+	}
+	return nil
+}
+
+// readFolder sets the folder of the pipeline, it is only known if the
+// pipeline is resolved by id.
+func (app *App) readFolder(ctx context.Context, pr *pipelineRun) {
+	args := &pipelines.GetPipelineArgs{
+		Project:    &pr.prj.name,
+		PipelineId: &pr.pipelineID,
+	}
+	pipeline, err := pr.prj.org.pipelines.GetPipeline(ctx, *args)
+	if err != nil || pipeline.Folder == nil {
+		log.Warnf("Folder of pipeline '%s' could not be read: %v", pr.name, err)
+		pr.folder = "\\"
+		return
+	}
+	pr.folder = *pipeline.Folder
+}
+
+// pipelinePath returns the folder and the name of the pipeline with
+// slashes, eg. '/prod/deploy'.
+func pipelinePath(pr *pipelineRun) string {
+	folder := strings.TrimRight(strings.ReplaceAll(pr.folder, "\\", "/"), "/")
+	return folder + "/" + pr.name
+}
@@ -0,0 +1,122 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGuardPattern(t *testing.T) {
+	tests := []struct {
+		name     string
+		guard    []string
+		pipeline string
+		folder   string
+		want     string
+	}{
+		{"exact name", []string{"deploy-prod"}, "deploy-prod", "\\", "deploy-prod"},
+		{"glob", []string{"*-prod"}, "deploy-prod", "\\", "*-prod"},
+		{"no match", []string{"*-prod"}, "deploy-test", "\\", ""},
+		{"character class", []string{"deploy-[pq]rod"}, "deploy-qrod", "\\", "deploy-[pq]rod"},
+		{"folder", []string{"/prod/*"}, "deploy", "\\prod", "/prod/*"},
+		{"folder without leading slash", []string{"prod/*"}, "deploy", "\\prod", "/prod/*"},
+		{"other folder", []string{"/prod/*"}, "deploy", "\\test", ""},
+		{"nested folder", []string{"/prod/*"}, "deploy", "\\prod\\eu", ""},
+		{"name pattern ignores folder", []string{"deploy"}, "deploy", "\\prod\\eu", "deploy"},
+		{"first match", []string{"nightly", "*"}, "deploy", "\\", "*"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &App{guard: tt.guard}
+			pr := &pipelineRun{name: tt.pipeline, folder: tt.folder}
+			pattern, ok := app.guardPattern(context.Background(), pr)
+			if ok != (tt.want != "") || pattern != tt.want {
+				t.Errorf("guardPattern() = %q, %v, want %q", pattern, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckGuardPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		valid   bool
+	}{
+		{"deploy-*", true},
+		{"/prod/*", true},
+		{"deploy-[pq]rod", true},
+		{"deploy-[prod", false},
+		{"prod-\\", false},
+	}
+	for _, tt := range tests {
+		if err := checkGuardPattern(tt.pattern); (err == nil) != tt.valid {
+			t.Errorf("checkGuardPattern(%q) = %v, want valid %v", tt.pattern, err, tt.valid)
+		}
+	}
+}
+
+// TestLoadConfigInvalidGuard checks, that a malformed guard pattern is a
+// configuration error instead of a guard, that matches nothing.
+func TestLoadConfigInvalidGuard(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("guard:\n  - deploy-*\n  - 'prod-[eu'\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadConfig(path); err == nil || !strings.Contains(err.Error(), "prod-[eu") {
+		t.Errorf("loadConfig() error = %v, want the invalid guard pattern", err)
+	}
+}
+
+func TestCheckGuard(t *testing.T) {
+	tests := []struct {
+		name    string
+		confirm []string
+		input   string
+		want    int
+	}{
+		{"not confirmed", nil, "", 29},
+		{"confirmed by name", []string{"deploy-prod"}, "", -1},
+		{"confirmed by path", []string{"/prod/deploy-prod"}, "", -1},
+		{"other pipeline confirmed", []string{"deploy-test"}, "", 29},
+		{"confirmed on the console", nil, "deploy-prod\n", -1},
+		{"wrong name on the console", nil, "deploy-test\n", 29},
+		{"empty input on the console", nil, "\n", 29},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &App{guard: []string{"*-prod"}, confirm: tt.confirm}
+			if tt.input != "" {
+				app.stdin = bufio.NewReader(strings.NewReader(tt.input))
+			}
+			runs := []*pipelineRun{
+				{name: "deploy-test", folder: "\\test"},
+				{name: "deploy-prod", folder: "\\prod"},
+			}
+			code := exitCodeOf(t, app, func() {
+				app.checkGuard(context.Background(), runs)
+			})
+			if code != tt.want {
+				t.Errorf("exit code %d, want %d", code, tt.want)
+			}
+		})
+	}
+}
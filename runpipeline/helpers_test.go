@@ -0,0 +1,46 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"testing"
+)
+
+// testRun returns a run of the pipeline in the project with its logger.
+func testRun(prj *project, name string, pipelineID int, runID int) *pipelineRun {
+	pr := &pipelineRun{prj: prj, name: name, pipelineID: pipelineID, runID: runID, branch: "refs/heads/main"}
+	pr.log = runLogger(pr)
+	return pr
+}
+
+// exitCodeOf returns the exit code, if the function ends the program of
+// the embedded app, or -1.
+func exitCodeOf(t *testing.T, app *App, f func()) (code int) {
+	t.Helper()
+	app.embedded = true
+	defer func() {
+		if r := recover(); r != nil {
+			c, ok := r.(exitCode)
+			if !ok {
+				panic(r)
+			}
+			code = int(c)
+		}
+	}()
+	f()
+	return -1
+}
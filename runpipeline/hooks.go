@@ -0,0 +1,129 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"bufio"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"sync"
+)
+
+// hooks are the local commands, that are executed when the result of
+// the runs is known.
+type hooks struct {
+	onSuccess  stringSlice
+	onFailure  stringSlice
+	onComplete stringSlice
+	fatal      bool
+}
+
+func (h *hooks) empty() bool {
+	return len(h.onSuccess) == 0 && len(h.onFailure) == 0 && len(h.onComplete) == 0
+}
+
+// runHooks executes the hooks matching the exit code of the runs. The
+// hooks are only executed, if a run was started and the runs are not
+// handed over to the next invocation by 'poll-on-exit', that executes
+// them with the result of the runs. If a hook fails and
+// 'hook-failures-fatal' is set, the exit code is 28.
+func (app *App) runHooks(code int) int {
+	if app.hooks.empty() || !app.runStarted() {
+		return code
+	}
+	if app.handedOver {
+		log.Infof("Hooks are not executed, the runs are handed over to the next invocation.")
+		return code
+	}
+	resultCode := code
+	if app.bestEffort && code == 0 {
+		// the result of the run, before best-effort mode
+		resultCode = app.mappedExitCode
+	}
+	commands := app.hooks.onFailure
+	if resultCode == 0 {
+		commands = app.hooks.onSuccess
+	}
+	commands = append(append(stringSlice{}, commands...), app.hooks.onComplete...)
+
+	env := os.Environ()
+	for _, v := range app.envVars() {
+		env = append(env, v.environ())
+	}
+	failed := false
+	for _, command := range commands {
+		if err := runHook(command, env); err != nil {
+			log.Errorf("Hook '%s' failed: %v", command, err)
+			failed = true
+		}
+	}
+	if failed && app.hooks.fatal {
+		return 28
+	}
+	return code
+}
+
+// runStarted is true, if at least one run was triggered.
+func (app *App) runStarted() bool {
+	for _, pr := range app.runs {
+		if pr.runID > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// runHook executes the command with the shell of the platform. The
+// output of the command is logged at info level.
+func runHook(command string, env []string) error {
+	log.Infof("Hook '%s' is executed.", command)
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	cmd.Env = env
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+	var wg sync.WaitGroup
+	for _, r := range []io.Reader{stdout, stderr} {
+		wg.Add(1)
+		go func(r io.Reader) {
+			defer wg.Done()
+			scanner := bufio.NewScanner(r)
+			for scanner.Scan() {
+				log.Infof("[hook] %s", scanner.Text())
+			}
+		}(r)
+	}
+	// the output must be read completely before Wait closes the pipes
+	wg.Wait()
+	return cmd.Wait()
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+	"sort"
+	"strings"
+)
+
+// checkIgnoredParameters compares the parameters of the run with the
+// parameters declared in the expanded YAML of a preview run. Parameters,
+// that are not declared, are ignored by the pipeline. If the preview is
+// not possible or the parameter validation is skipped, the check is
+// skipped.
+func (app *App) checkIgnoredParameters(ctx context.Context, pr *pipelineRun) {
+	if app.skipParamValidation {
+		log.Debugf("Parameters of pipeline '%s' are not validated.", pr.name)
+		return
+	}
+	if !app.supports(previewRuns) {
+		log.Debugf("Preview runs are not supported by the server, parameters of pipeline '%s' are not checked.", pr.name)
+		return
+	}
+	args := app.runPipelineArgs(pr)
+	sent := *args.RunParameters.TemplateParameters
+	if len(sent) == 0 || !app.budget.allowOptional("ignoredParams") {
+		return
+	}
+	preview := true
+	args.RunParameters.PreviewRun = &preview
+	run, err := pr.prj.org.pipelines.RunPipeline(ctx, *args)
+	if err != nil || run == nil || run.FinalYaml == nil {
+		log.Debugf("Preview of pipeline '%s' is not possible, parameters are not checked: %v", pr.name, err)
+		return
+	}
+	var content struct {
+		Parameters yaml.Node `yaml:"parameters"`
+	}
+	if err = yaml.Unmarshal([]byte(*run.FinalYaml), &content); err != nil {
+		log.Debugf("Expanded YAML of pipeline '%s' could not be read, parameters are not checked: %v", pr.name, err)
+		return
+	}
+	declared, err := decodeParameters(&content.Parameters)
+	if err != nil {
+		log.Debugf("Parameters of pipeline '%s' could not be read, parameters are not checked: %v", pr.name, err)
+		return
+	}
+	names := make(map[string]bool, len(declared))
+	for _, p := range declared {
+		names[p.Name] = true
+	}
+	for name := range sent {
+		if !names[name] {
+			pr.ignoredParameters = append(pr.ignoredParameters, name)
+		}
+	}
+	if len(pr.ignoredParameters) == 0 {
+		return
+	}
+	sort.Strings(pr.ignoredParameters)
+	log.Warnf("Pipeline '%s' does not declare the parameters %s, they are ignored.", pr.name, strings.Join(pr.ignoredParameters, ", "))
+	if app.failOnIgnoredParams {
+		log.Errorf("Pipeline '%s' is not started, because parameters are ignored.", pr.name)
+		app.exit(26)
+	}
+}
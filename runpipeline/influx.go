@@ -0,0 +1,90 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// influxMeasurement is the measurement of the lines of '-output influx'.
+const influxMeasurement = "runpipeline"
+
+var (
+	// influxTagReplacer escapes the keys and values of the tags in the
+	// InfluxDB line protocol.
+	influxTagReplacer = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", `\n`)
+	// influxStringReplacer escapes the string values of the fields.
+	influxStringReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+)
+
+// writeInfluxFile appends a line in the InfluxDB line protocol for every
+// finished run to the file of 'influx-file', so that the file collects
+// the runs of repeated invocations.
+func (app *App) writeInfluxFile() error {
+	f, err := os.OpenFile(app.influxFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	for _, pr := range app.runs {
+		if pr.info.Result == "" {
+			continue
+		}
+		if _, err = fmt.Fprintln(f, influxLine(pr, app.annotations, time.Now())); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// influxLine returns the run as line of the measurement 'runpipeline'
+// with the pipeline, the branch, the org and the annotations as tags.
+// The timestamp in nanoseconds is the end of the run or now, if the end
+// is unknown.
+func influxLine(pr *pipelineRun, annotations annotations, now time.Time) string {
+	var line strings.Builder
+	line.WriteString(influxMeasurement)
+	tags := [][2]string{
+		{"pipeline", pr.name},
+		{"branch", strings.TrimPrefix(pr.branch, "refs/heads/")},
+		{"org", pr.prj.org.name},
+	}
+	for _, key := range annotations.keys() {
+		if key != "pipeline" && key != "branch" && key != "org" {
+			tags = append(tags, [2]string{key, annotations[key]})
+		}
+	}
+	for _, tag := range tags {
+		// empty tag values are not allowed
+		if tag[1] != "" {
+			line.WriteString("," + influxTagReplacer.Replace(tag[0]) + "=" + influxTagReplacer.Replace(tag[1]))
+		}
+	}
+	line.WriteString(` result="` + influxStringReplacer.Replace(pr.info.Result) + `"`)
+	if duration := pr.info.duration(); duration > 0 {
+		fmt.Fprintf(&line, ",duration_ms=%d", duration.Milliseconds())
+	}
+	timestamp := pr.info.Finished
+	if timestamp.IsZero() {
+		timestamp = now
+	}
+	fmt.Fprintf(&line, " %d", timestamp.UnixNano())
+	return line.String()
+}
@@ -0,0 +1,268 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// promptParameters asks on the console for all required parameters of
+// the pipelines, that are not specified on the command line.
+func (app *App) promptParameters(ctx context.Context, runs []*pipelineRun) {
+	if app.promptedParameters == nil {
+		app.promptedParameters = make(map[string]string)
+	}
+	for _, pr := range runs {
+		declared, err := app.getPipelineParameters(ctx, pr)
+		if err != nil {
+			log.Warnf("Parameters of pipeline '%s' could not be read: %v", pr.name, err)
+			continue
+		}
+		given := app.runParameters(pr)
+		for _, p := range declared {
+			if _, ok := given[p.Name]; ok || !p.required() {
+				continue
+			}
+			value, err := app.promptParameter(pr.name, p)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Required parameter '%s' of pipeline '%s' was not entered: %v\n", p.Name, pr.name, err)
+				app.exit(7)
+			}
+			app.promptedParameters[p.Name] = value
+			given[p.Name] = value
+		}
+	}
+}
+
+func (app *App) promptParameter(pipeline string, p pipelineParameter) (string, error) {
+	if app.stdin == nil {
+		app.stdin = bufio.NewReader(os.Stdin)
+	}
+	label := p.Name
+	if p.DisplayName != "" {
+		label = fmt.Sprintf("%s (%s)", p.DisplayName, p.Name)
+	}
+
+	values := p.allowedValues()
+	if len(values) == 0 {
+		for {
+			fmt.Fprintf(os.Stderr, "Pipeline '%s' requires parameter %s: ", pipeline, label)
+			answer, err := app.readLine()
+			if answer != "" || err != nil {
+				return answer, err
+			}
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Pipeline '%s' requires parameter %s:\n", pipeline, label)
+	for i, value := range values {
+		fmt.Fprintf(os.Stderr, "  %d) %s\n", i+1, value)
+	}
+	for {
+		fmt.Fprintf(os.Stderr, "Select [1-%d]: ", len(values))
+		answer, err := app.readLine()
+		if err != nil {
+			return "", err
+		}
+		i, err := strconv.Atoi(answer)
+		if err == nil && i >= 1 && i <= len(values) {
+			return values[i-1], nil
+		}
+	}
+}
+
+// readLine reads one line from the console.
+func (app *App) readLine() (string, error) {
+	line, err := app.stdin.ReadString('\n')
+	line = strings.TrimSpace(line)
+	if line != "" {
+		return line, nil
+	}
+	return "", err
+}
+
+// promptDeclaredParameters asks on the console for every parameter
+// declared by the pipelines, that is not specified on the command line.
+// A default value is accepted with enter and is not sent, so that the
+// default of the pipeline applies. The collected parameters are shown
+// for confirmation before any run is started.
+func (app *App) promptDeclaredParameters(ctx context.Context, runs []*pipelineRun) {
+	for _, pr := range runs {
+		declared, err := app.getPipelineParameters(ctx, pr)
+		if err != nil {
+			log.Warnf("Parameters of pipeline '%s' could not be read: %v", pr.name, err)
+			continue
+		}
+		given := app.runParameters(pr)
+		entered := make(map[string]string)
+		for _, p := range declared {
+			if _, ok := given[p.Name]; ok {
+				continue
+			}
+			if !p.scalar() && !p.required() {
+				fmt.Fprintf(os.Stderr, "Parameter '%s' of pipeline '%s' has type %s and keeps its default.\n", p.Name, pr.name, p.typeName())
+				continue
+			}
+			value, err := app.promptDeclaredParameter(pr.name, p)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Parameter '%s' of pipeline '%s' was not entered: %v\n", p.Name, pr.name, err)
+				app.exit(7)
+			}
+			if value != "" {
+				entered[p.Name] = value
+			}
+		}
+		if len(entered) > 0 {
+			// the parameters of the batch file may be shared by the runs
+			parameters := make(map[string]string, len(pr.parameters)+len(entered))
+			for key, value := range pr.parameters {
+				parameters[key] = value
+			}
+			for key, value := range entered {
+				parameters[key] = value
+			}
+			pr.parameters = parameters
+		}
+	}
+	app.confirmParameters(runs)
+}
+
+// promptDeclaredParameter asks for the value of the parameter, showing its
+// type and default value. Booleans and numbers are checked before they are
+// accepted. An empty value means the default.
+func (app *App) promptDeclaredParameter(pipeline string, p pipelineParameter) (string, error) {
+	if app.stdin == nil {
+		app.stdin = bufio.NewReader(os.Stdin)
+	}
+	label := p.Name
+	if p.DisplayName != "" {
+		label = fmt.Sprintf("%s (%s)", p.DisplayName, p.Name)
+	}
+	defaultValue, hasDefault := p.defaultValue()
+	details := p.typeName()
+	if hasDefault {
+		details += fmt.Sprintf(", default '%s'", defaultValue)
+	} else if !p.required() {
+		details += ", default of the pipeline"
+	}
+
+	values := p.allowedValues()
+	if len(values) > 0 {
+		fmt.Fprintf(os.Stderr, "Parameter %s of pipeline '%s' (%s):\n", label, pipeline, details)
+		for i, value := range values {
+			fmt.Fprintf(os.Stderr, "  %d) %s\n", i+1, value)
+		}
+		for {
+			fmt.Fprintf(os.Stderr, "Select [1-%d]: ", len(values))
+			answer, err := app.readLine()
+			if err != nil && (answer != "" || p.required()) {
+				return "", err
+			}
+			if answer == "" && !p.required() {
+				return "", nil
+			}
+			// the value can be selected by its number or entered
+			selected := ""
+			if i, err := strconv.Atoi(answer); err == nil && i >= 1 && i <= len(values) {
+				selected = values[i-1]
+			}
+			for _, value := range values {
+				if strings.EqualFold(answer, value) {
+					selected = value
+				}
+			}
+			if selected == "" {
+				continue
+			}
+			if hasDefault && selected == defaultValue {
+				return "", nil
+			}
+			return selected, nil
+		}
+	}
+
+	for {
+		fmt.Fprintf(os.Stderr, "Parameter %s of pipeline '%s' (%s): ", label, pipeline, details)
+		answer, err := app.readLine()
+		if err != nil && (answer != "" || p.required()) {
+			return "", err
+		}
+		if answer == "" {
+			if !p.required() {
+				return "", nil
+			}
+			continue
+		}
+		if value, ok := checkParameterValue(p, answer); ok {
+			return value, nil
+		}
+	}
+}
+
+// checkParameterValue checks the value of a boolean or number parameter
+// and returns it in the form, that Azure DevOps expects.
+func checkParameterValue(p pipelineParameter, value string) (string, bool) {
+	switch p.typeName() {
+	case "boolean":
+		if strings.EqualFold(value, "true") || strings.EqualFold(value, "false") {
+			return strings.ToLower(value), true
+		}
+		fmt.Fprintf(os.Stderr, "Value '%s' is not a boolean, enter 'true' or 'false'.\n", value)
+		return "", false
+	case "number":
+		if _, err := strconv.ParseFloat(value, 64); err == nil {
+			return value, true
+		}
+		fmt.Fprintf(os.Stderr, "Value '%s' is not a number.\n", value)
+		return "", false
+	}
+	return value, true
+}
+
+// confirmParameters shows the parameters of every run and asks, if the
+// runs are started. The program ends with exit code 7, if not.
+func (app *App) confirmParameters(runs []*pipelineRun) {
+	for _, pr := range runs {
+		parameters := app.runParameters(pr)
+		names := make([]string, 0, len(parameters))
+		for name := range parameters {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(os.Stderr, "Pipeline '%s' is started with the parameters:\n", pr.name)
+		masked := maskParameters(parameters)
+		for _, name := range names {
+			fmt.Fprintf(os.Stderr, "  %s=%s\n", name, masked[name])
+		}
+		if len(names) == 0 {
+			fmt.Fprintln(os.Stderr, "  (defaults of the pipeline)")
+		}
+	}
+	fmt.Fprint(os.Stderr, "Start? [y/N]: ")
+	answer, _ := app.readLine()
+	if !strings.EqualFold(answer, "y") && !strings.EqualFold(answer, "yes") {
+		fmt.Fprintln(os.Stderr, "The runs are not started.")
+		app.exit(7)
+	}
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultDeadlineMargin is the time before the deadline of the job, when
+// the program stops waiting.
+const defaultDeadlineMargin = 2 * time.Minute
+
+// jobTimeoutVariable is the timeout of the job in minutes. Azure DevOps
+// does not pass the timeout of a job to its steps, the variable can be
+// mapped in the step, eg. 'SYSTEM_JOBTIMEOUT: 60'.
+const jobTimeoutVariable = "SYSTEM_JOBTIMEOUT"
+
+// jobDeadline returns the time, when the program stops waiting for the
+// runs, or zero without deadline. The deadline is given as RFC 3339
+// time or computed from the timeout of the job, that is counted from
+// now. The margin is subtracted from the deadline.
+func jobDeadline(value string, getenv func(string) string, now time.Time, margin time.Duration) (time.Time, error) {
+	var deadline time.Time
+	if value != "" {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("parameter 'deadline' is not a RFC 3339 time like '2022-10-16T12:00:00Z'")
+		}
+		deadline = t
+	} else if timeout := strings.TrimSpace(getenv(jobTimeoutVariable)); timeout != "" {
+		minutes, err := strconv.Atoi(timeout)
+		if err != nil || minutes < 0 {
+			return time.Time{}, fmt.Errorf("variable %s is not a number of minutes: '%s'", jobTimeoutVariable, timeout)
+		}
+		if minutes == 0 {
+			// jobs without timeout
+			return time.Time{}, nil
+		}
+		deadline = now.Add(time.Duration(minutes) * time.Minute)
+	} else {
+		return time.Time{}, nil
+	}
+	return deadline.Add(-margin), nil
+}
+
+// jobDeadlineReached logs the last known state of the unfinished runs and
+// ends the program with exit code 24. The runs are not canceled, the job
+// is about to end and the outputs are written before it is killed. Only
+// with 'delete-if-never-started' the queued runs are canceled and deleted.
+func (app *App) jobDeadlineReached() {
+	log.Errorf("The deadline of the job is reached, the program stops waiting %v before it.", app.deadlineMargin)
+	for _, pr := range app.runs {
+		if pr.runID <= 0 || pr.info.Result != "" {
+			continue
+		}
+		pr.log.Errorf("Run %d of pipeline '%s' was last in state '%s' (URL: %s).", pr.runID, pr.name, pr.info.State, pr.info.URL)
+		pr.exitCode = 24
+	}
+	app.deleteUnfinishedNeverStarted(context.Background())
+	app.exit(24)
+}
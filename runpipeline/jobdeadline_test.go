@@ -0,0 +1,98 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestJobDeadline(t *testing.T) {
+	now := time.Date(2022, 10, 16, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		value   string
+		timeout string
+		margin  time.Duration
+		want    time.Time
+		valid   bool
+	}{
+		{"none", "", "", 2 * time.Minute, time.Time{}, true},
+		{"deadline", "2022-10-16T13:00:00Z", "", 2 * time.Minute, now.Add(58 * time.Minute), true},
+		{"deadline before the job timeout", "2022-10-16T12:30:00+02:00", "60", time.Minute, now.Add(-91 * time.Minute), true},
+		{"job timeout", "", "60", 2 * time.Minute, now.Add(58 * time.Minute), true},
+		{"job timeout with spaces", "", " 30 ", 0, now.Add(30 * time.Minute), true},
+		{"job without timeout", "", "0", 2 * time.Minute, time.Time{}, true},
+		{"invalid deadline", "tomorrow", "", 2 * time.Minute, time.Time{}, false},
+		{"invalid job timeout", "", "1h", 2 * time.Minute, time.Time{}, false},
+		{"negative job timeout", "", "-5", 2 * time.Minute, time.Time{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			getenv := func(name string) string {
+				if name == jobTimeoutVariable {
+					return tt.timeout
+				}
+				return ""
+			}
+			got, err := jobDeadline(tt.value, getenv, now, tt.margin)
+			if (err == nil) != tt.valid {
+				t.Fatalf("error %v, want valid %v", err, tt.valid)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("deadline %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestJobDeadlineReached checks, that the program stops waiting for the
+// unfinished run with exit code 24, when the deadline is reached.
+func TestJobDeadlineReached(t *testing.T) {
+	f := newFakeServer(t)
+	f.route(locationRuns, "{project}/_apis/pipelines/{pipelineId}/runs/{runId}", func(req *fakeRequest) (int, interface{}) {
+		return http.StatusOK, map[string]interface{}{"id": 1234, "state": "inProgress", "createdDate": time.Now().UTC().Format(time.RFC3339)}
+	})
+	pr := testRun(f.project(), "build", 7, 1234)
+	app := &App{
+		clock:            &serverClock{},
+		timer:            newPhaseTimer(),
+		budget:           newAPIBudget(0, http.DefaultTransport),
+		pollStrategyName: pollFixed,
+		pollInterval:     time.Hour,
+		runs:             []*pipelineRun{pr},
+		// the deadline of the job minus the margin has just passed
+		jobDeadline:    time.Now().Add(-time.Second),
+		deadlineMargin: 2 * time.Minute,
+	}
+
+	start := time.Now()
+	if code := exitCodeOf(t, app, func() { app.logStatus(context.Background(), pr) }); code != 24 {
+		t.Errorf("exit code %d, want 24", code)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("program waited %v for the poll interval", elapsed)
+	}
+	if pr.exitCode != 24 {
+		t.Errorf("exit code of the run %d, want 24", pr.exitCode)
+	}
+	if got := len(f.requested()); got != 1 {
+		t.Errorf("%d status checks, want 1", got)
+	}
+}
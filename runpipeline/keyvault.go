@@ -0,0 +1,261 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	// keyVaultURL is the URL of a vault, '{vault}' is replaced with the
+	// name of the vault.
+	keyVaultURL        = "https://{vault}.vault.azure.net"
+	keyVaultAPIVersion = "7.4"
+	// keyVaultResource is the resource of the access token.
+	keyVaultResource = "https://vault.azure.net"
+	// keyVaultTimeout limits every request for a token or a secret.
+	keyVaultTimeout = 30 * time.Second
+	// authorityHost is the host of Azure Active Directory, the variable
+	// AZURE_AUTHORITY_HOST overrides it for other clouds.
+	authorityHost = "https://login.microsoftonline.com"
+	// managedIdentityURL is the token endpoint of the managed identity of
+	// Azure VMs.
+	managedIdentityURL = "http://169.254.169.254/metadata/identity/oauth2/token"
+	// managedIdentityTimeout is short, the endpoint does not exist outside
+	// of Azure.
+	managedIdentityTimeout = 2 * time.Second
+)
+
+// keyVault reads secrets of Azure Key Vault with the REST API. Resolved
+// secrets are cached in memory for the lifetime of the program and are
+// never written to a file.
+type keyVault struct {
+	client *http.Client
+	token  string
+	// secrets are the values by reference
+	secrets map[string]string
+}
+
+func newKeyVault() *keyVault {
+	return &keyVault{
+		client:  &http.Client{Timeout: keyVaultTimeout},
+		secrets: make(map[string]string),
+	}
+}
+
+// resolveSecrets replaces the references of the secrets of the parameter
+// file with their values. The program ends with exit code 39, if a
+// secret can not be read.
+func (app *App) resolveSecrets(ctx context.Context) {
+	if len(app.paramsSecrets) == 0 {
+		return
+	}
+	defer app.timer.begin("secrets")()
+	if app.keyVault == nil {
+		app.keyVault = newKeyVault()
+	}
+	file := &paramsFile{Secrets: app.paramsSecrets}
+	for _, name := range file.secretNames() {
+		value, err := app.keyVault.secret(ctx, app.paramsSecrets[name])
+		if err != nil {
+			log.Errorf("Secret '%s' of the parameter file could not be read from Azure Key Vault: %v", name, err)
+			app.exit(39)
+		}
+		app.fileParameters[name] = value
+	}
+	log.Infof("%d secrets of the parameter file are read from Azure Key Vault.", len(app.paramsSecrets))
+}
+
+// secret returns the value of the referenced secret.
+func (kv *keyVault) secret(ctx context.Context, reference string) (string, error) {
+	if value, ok := kv.secrets[reference]; ok {
+		return value, nil
+	}
+	match := secretReference.FindStringSubmatch(reference)
+	if match == nil {
+		return "", fmt.Errorf("'%s' is not like 'akv://vault-name/secret-name/version'", reference)
+	}
+	if kv.token == "" {
+		token, err := kv.accessToken(ctx)
+		if err != nil {
+			return "", err
+		}
+		kv.token = token
+	}
+	base := keyVaultURL
+	if override := os.Getenv(envPrefix + "AKV_URL"); override != "" {
+		base = override
+	}
+	u := strings.TrimSuffix(strings.ReplaceAll(base, "{vault}", match[1]), "/") + "/secrets/" + match[2]
+	if match[3] != "" {
+		u += "/" + match[3]
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u+"?api-version="+keyVaultAPIVersion, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+kv.token)
+	var secret struct {
+		Value *string `json:"value"`
+	}
+	if err = kv.send(req, &secret); err != nil {
+		return "", err
+	}
+	if secret.Value == nil {
+		return "", fmt.Errorf("secret '%s' of vault '%s' has no value", match[2], match[1])
+	}
+	kv.secrets[reference] = *secret.Value
+	return *secret.Value, nil
+}
+
+// accessToken returns a token for Azure Key Vault like the credential
+// chain of the Azure SDK: a service principal from the variables
+// AZURE_TENANT_ID, AZURE_CLIENT_ID and AZURE_CLIENT_SECRET, the login of
+// the Azure CLI, eg. in the task 'AzureCLI', or the managed identity of
+// the agent.
+func (kv *keyVault) accessToken(ctx context.Context) (string, error) {
+	tenant, clientID, secret := os.Getenv("AZURE_TENANT_ID"), os.Getenv("AZURE_CLIENT_ID"), os.Getenv("AZURE_CLIENT_SECRET")
+	if tenant != "" && clientID != "" && secret != "" {
+		return kv.servicePrincipalToken(ctx, tenant, clientID, secret)
+	}
+	var problems []string
+	token, err := azureCLIToken(ctx)
+	if err == nil {
+		return token, nil
+	}
+	problems = append(problems, "Azure CLI: "+err.Error())
+	token, err = kv.managedIdentityToken(ctx)
+	if err == nil {
+		return token, nil
+	}
+	problems = append(problems, "managed identity: "+err.Error())
+	return "", fmt.Errorf("no credential for Azure Key Vault, set AZURE_TENANT_ID, AZURE_CLIENT_ID and AZURE_CLIENT_SECRET or log in with the Azure CLI (%s)", strings.Join(problems, "; "))
+}
+
+// tokenResponse is the response of the token endpoints.
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+}
+
+func (kv *keyVault) servicePrincipalToken(ctx context.Context, tenant string, clientID string, secret string) (string, error) {
+	host := authorityHost
+	if override := os.Getenv("AZURE_AUTHORITY_HOST"); override != "" {
+		host = override
+	}
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	form.Set("client_id", clientID)
+	form.Set("client_secret", secret)
+	form.Set("scope", keyVaultResource+"/.default")
+	u := strings.TrimSuffix(host, "/") + "/" + url.PathEscape(tenant) + "/oauth2/v2.0/token"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var token tokenResponse
+	if err = kv.send(req, &token); err != nil {
+		return "", fmt.Errorf("token of service principal '%s' could not be read: %w", clientID, err)
+	}
+	return token.AccessToken, nil
+}
+
+func (kv *keyVault) managedIdentityToken(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, managedIdentityTimeout)
+	defer cancel()
+	query := url.Values{}
+	query.Set("api-version", "2018-02-01")
+	query.Set("resource", keyVaultResource)
+	if clientID := os.Getenv("AZURE_CLIENT_ID"); clientID != "" {
+		query.Set("client_id", clientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, managedIdentityURL+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata", "true")
+	var token tokenResponse
+	if err = kv.send(req, &token); err != nil {
+		return "", err
+	}
+	return token.AccessToken, nil
+}
+
+// azureCLIToken returns the token of the login of the Azure CLI.
+func azureCLIToken(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, keyVaultTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "az", "account", "get-access-token", "--resource", keyVaultResource, "--output", "json").Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("%s", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", err
+	}
+	var token struct {
+		AccessToken string `json:"accessToken"`
+	}
+	if err = json.Unmarshal(out, &token); err != nil {
+		return "", err
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("the Azure CLI returned no token")
+	}
+	return token.AccessToken, nil
+}
+
+// send sends the request and decodes the JSON response. An error
+// response is returned with its message and HTTP status.
+func (kv *keyVault) send(req *http.Request, v interface{}) error {
+	resp, err := kv.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+			Description string `json:"error_description"`
+		}
+		_ = json.Unmarshal(body, &failure)
+		message := failure.Error.Message
+		if message == "" {
+			message = failure.Description
+		}
+		if message == "" {
+			message = resp.Status
+		}
+		return fmt.Errorf("%s (HTTP %d)", message, resp.StatusCode)
+	}
+	return json.Unmarshal(body, v)
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"strings"
+)
+
+// lastRunParameter is a template parameter, whose value is the output
+// variable of the last successful run of the pipeline.
+type lastRunParameter struct {
+	name     string
+	variable string
+}
+
+// lastRunParameters is the value of the flag 'param-from-last-run'.
+type lastRunParameters []lastRunParameter
+
+func (p *lastRunParameters) String() string {
+	var list []string
+	for _, parameter := range *p {
+		list = append(list, parameter.name+"="+parameter.variable)
+	}
+	return fmt.Sprintf("%s", list)
+}
+
+func (p *lastRunParameters) Set(value string) error {
+	kv := strings.SplitN(value, "=", 2)
+	if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+		return fmt.Errorf("use 'key=source_key', eg. 'imageTag=build.imageTag'")
+	}
+	*p = append(*p, lastRunParameter{name: kv[0], variable: kv[1]})
+	return nil
+}
+
+// resolveLastRunParameters sets the parameters of 'param-from-last-run'
+// of every run to the output variables of the last successful run of
+// its pipeline on any branch. The value overrides a parameter of the
+// same name. The program ends before a run is started, if a value can
+// not be read.
+func (app *App) resolveLastRunParameters(ctx context.Context, runs []*pipelineRun) {
+	for _, pr := range runs {
+		filter := runFilter{states: []string{"completed"}, results: []string{"succeeded"}, maxCount: 1}
+		records, err := app.listRuns(ctx, pr.prj, pr.pipelineID, filter)
+		if err != nil {
+			log.Errorf("Runs of pipeline '%s' could not be read: %v", pr.name, err)
+			app.exit(42)
+		}
+		if len(records) == 0 {
+			log.Errorf("Pipeline '%s' has no successful run, the parameters %s can not be read from it.", pr.name, app.paramsFromLastRun.String())
+			app.exit(42)
+		}
+		runID := records[0].ID
+		variables, err := readRunVariables(ctx, pr.prj, runID)
+		if err != nil {
+			log.Errorf("Variables of run %d of pipeline '%s' could not be read: %v", runID, pr.name, err)
+			app.exit(42)
+		}
+		if pr.parameters == nil {
+			pr.parameters = make(map[string]string)
+		}
+		for _, parameter := range app.paramsFromLastRun {
+			value, ok := variables[parameter.variable]
+			if !ok {
+				log.Errorf("Run %d of pipeline '%s' has no output variable '%s' for parameter '%s', secret variables can not be read.", runID, pr.name, parameter.variable, parameter.name)
+				app.exit(42)
+			}
+			pr.parameters[parameter.name] = value
+			log.Infof("Parameter '%s' of pipeline '%s' is set to variable '%s' of run %d.", parameter.name, pr.name, parameter.variable, runID)
+		}
+	}
+}
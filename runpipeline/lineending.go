@@ -0,0 +1,83 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// lineEnding is the flag 'line-endings'. It sets the end of the lines of
+// the env file, the file of the run variables and the status file.
+type lineEnding string
+
+const (
+	lineEndingLF     lineEnding = "lf"
+	lineEndingCRLF   lineEnding = "crlf"
+	lineEndingNative lineEnding = "native"
+)
+
+func (e *lineEnding) String() string {
+	return string(*e)
+}
+
+func (e *lineEnding) Set(value string) error {
+	switch lineEnding(value) {
+	case lineEndingLF, lineEndingCRLF, lineEndingNative:
+		*e = lineEnding(value)
+	default:
+		return fmt.Errorf("unknown line ending '%s', use 'lf', 'crlf' or 'native'", value)
+	}
+	return nil
+}
+
+// sequence returns the characters, that end a line. 'native' is CRLF on
+// Windows and LF on the other platforms, the default is LF.
+func (e lineEnding) sequence() string {
+	switch e {
+	case lineEndingCRLF:
+		return "\r\n"
+	case lineEndingNative:
+		return nativeLineEnding
+	default:
+		return "\n"
+	}
+}
+
+// withLineEnding replaces the line feeds of the data with the line
+// ending. Values in the files are quoted or JSON encoded, so every line
+// feed ends a line.
+func withLineEnding(data []byte, eol string) []byte {
+	if eol == "\n" {
+		return data
+	}
+	return bytes.ReplaceAll(data, []byte("\n"), []byte(eol))
+}
+
+// lineEndingWriter replaces the line feeds of everything written to it.
+type lineEndingWriter struct {
+	w   io.Writer
+	eol string
+}
+
+func (w *lineEndingWriter) Write(p []byte) (int, error) {
+	if _, err := w.w.Write(withLineEnding(p, w.eol)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,146 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestLineEndingSequence checks the characters of the flag values.
+func TestLineEndingSequence(t *testing.T) {
+	tests := []struct {
+		value lineEnding
+		want  string
+	}{
+		{"", "\n"},
+		{lineEndingLF, "\n"},
+		{lineEndingCRLF, "\r\n"},
+		{lineEndingNative, nativeLineEnding},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.value), func(t *testing.T) {
+			if got := tt.value.sequence(); got != tt.want {
+				t.Errorf("sequence() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestEnvFileLineEndings checks, that every line of the env file ends with
+// the line ending, also for values with line breaks.
+func TestEnvFileLineEndings(t *testing.T) {
+	tests := []struct {
+		ending lineEnding
+		want   string
+	}{
+		{lineEndingLF, "RUNPIPELINE_OUT_NOTES=\"first\\r\\nsecond\"\nRUNPIPELINE_OUT_TAG=1.2.3\n"},
+		{lineEndingCRLF, "RUNPIPELINE_OUT_NOTES=\"first\\r\\nsecond\"\r\nRUNPIPELINE_OUT_TAG=1.2.3\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.ending), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "run.env")
+			app := &App{envFile: path, lineEnding: tt.ending}
+			app.run = &runInfo{ID: 7, Outputs: map[string]string{"tag": "1.2.3", "notes": "first\r\nsecond"}}
+			if err := app.writeEnvFile(); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			content := string(data)
+			if !strings.HasSuffix(content, tt.want) {
+				t.Errorf("env file ends with %q, want %q", content[strings.Index(content, "RUNPIPELINE_OUT_"):], tt.want)
+			}
+			lines := strings.Count(content, "\n")
+			if tt.ending == lineEndingCRLF && strings.Count(content, "\r\n") != lines {
+				t.Errorf("env file has lines without CRLF: %q", content)
+			}
+			if tt.ending == lineEndingLF && strings.Contains(content, "\r") {
+				t.Errorf("env file has a carriage return: %q", content)
+			}
+		})
+	}
+}
+
+// TestLineEndingWriter checks, that JSON lines are written with the line
+// ending, and that escaped line breaks in values are kept.
+func TestLineEndingWriter(t *testing.T) {
+	tests := []struct {
+		eol  string
+		want string
+	}{
+		{"\n", "{\"notes\":\"a\\r\\nb\"}\n{\"tag\":\"1.2.3\"}\n"},
+		{"\r\n", "{\"notes\":\"a\\r\\nb\"}\r\n{\"tag\":\"1.2.3\"}\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(strings.ReplaceAll(strings.ReplaceAll(tt.eol, "\r", "CR"), "\n", "LF"), func(t *testing.T) {
+			var out strings.Builder
+			encoder := json.NewEncoder(&lineEndingWriter{&out, tt.eol})
+			encoder.Encode(map[string]string{"notes": "a\r\nb"})
+			encoder.Encode(map[string]string{"tag": "1.2.3"})
+			if out.String() != tt.want {
+				t.Errorf("written %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+// TestParamsFileLineEndings checks, that a parameter file, that was saved
+// with CRLF on Windows, has the same values as with LF.
+func TestParamsFileLineEndings(t *testing.T) {
+	content := "parameters:\n" +
+		"  environment: staging\n" +
+		"  image: \"registry/app:1.2.3\"\n" +
+		"  notes: |\n" +
+		"    first\n" +
+		"    second\n" +
+		"secrets:\n" +
+		"  password: akv://vault/password\n"
+	tests := []struct {
+		name string
+		eol  string
+	}{
+		{"lf", "\n"},
+		{"crlf", "\r\n"},
+		{"cr", "\r"},
+	}
+	want := &paramsFile{
+		Parameters: map[string]string{"environment": "staging", "image": "registry/app:1.2.3", "notes": "first\nsecond\n"},
+		Secrets:    map[string]string{"password": "akv://vault/password"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "params.yaml")
+			if err := os.WriteFile(path, []byte(strings.ReplaceAll(content, "\n", tt.eol)), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := loadParamsFile(path)
+			if err != nil {
+				t.Fatalf("loadParamsFile() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("loadParamsFile() = %q, want %q", *got, *want)
+			}
+		})
+	}
+}
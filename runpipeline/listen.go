@@ -0,0 +1,249 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"encoding/json"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// statusServer serves '/healthz' and '/status' and writes the status
+// file while the program waits for the runs. The state of the runs is copied on every update, so that
+// requests never read the runs, that are changed by the watchers.
+type statusServer struct {
+	servers []*http.Server
+	started time.Time
+
+	lock      sync.Mutex
+	runs      []*runStatus
+	byRun     map[*pipelineRun]*runStatus
+	lastError string
+
+	// file is the status file, it is written on every change of a run and
+	// on every heartbeat with the line ending fileEOL
+	file       string
+	fileEOL    string
+	polls      int
+	fileFailed bool
+
+	annotations annotations
+}
+
+// runStatus is the snapshot of a run in the '/status' document.
+type runStatus struct {
+	Org      string     `json:"org"`
+	Project  string     `json:"project"`
+	Pipeline string     `json:"pipeline"`
+	RunID    int        `json:"runId,omitempty"`
+	State    string     `json:"state,omitempty"`
+	Result   string     `json:"result,omitempty"`
+	URL      string     `json:"url,omitempty"`
+	LastPoll *time.Time `json:"lastPoll,omitempty"`
+	runTimestamps
+
+	// triggered is the time, when the run id was seen first
+	triggered time.Time
+}
+
+// healthDocument is the response of '/healthz'. The status is 'polling'
+// while a run is watched and 'idle' before the runs are started and after
+// they are finished.
+type healthDocument struct {
+	Status  string `json:"status"`
+	RunID   int    `json:"runId,omitempty"`
+	Elapsed string `json:"elapsed,omitempty"`
+}
+
+// statusDocument is the response of '/status'.
+type statusDocument struct {
+	SchemaVersion string `json:"schemaVersion"`
+
+	Elapsed   string       `json:"elapsed"`
+	Runs      []*runStatus `json:"runs"`
+	LastError string       `json:"lastError,omitempty"`
+
+	Annotations annotations `json:"annotations,omitempty"`
+}
+
+// listen binds the address and serves '/healthz' and '/status' in the
+// background. Binding failures end the program before a pipeline is
+// triggered.
+func (app *App) listen(addr string) {
+	mux := http.NewServeMux()
+	s := app.ensureStatusServer()
+	mux.HandleFunc("/healthz", s.serveHealth)
+	mux.HandleFunc("/status", s.serveStatus)
+	listener := app.serve(addr, mux)
+	log.Infof("Status endpoint listens on %s.", listener.Addr())
+}
+
+// listenLiveness binds the address and serves '/healthz' only, eg. for
+// the liveness probe of a Kubernetes sidecar.
+func (app *App) listenLiveness(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", app.ensureStatusServer().serveHealth)
+	listener := app.serve(addr, mux)
+	log.Infof("Liveness endpoint listens on %s.", listener.Addr())
+}
+
+// ensureStatusServer returns the status server, that is shared by the
+// endpoints, and creates it on the first call.
+func (app *App) ensureStatusServer() *statusServer {
+	if app.statusServer == nil {
+		app.statusServer = &statusServer{started: time.Now(), byRun: make(map[*pipelineRun]*runStatus), annotations: app.annotations}
+		log.AddHook(app.statusServer)
+	}
+	return app.statusServer
+}
+
+// serve binds the address and serves the handler in the background.
+// Binding failures end the program.
+func (app *App) serve(addr string, handler http.Handler) net.Listener {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Errorf("Address '%s' could not be bound: %v", addr, err)
+		app.exit(5)
+	}
+	server := &http.Server{Handler: handler, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Warnf("Endpoint %s stopped: %v", listener.Addr(), err)
+		}
+	}()
+	s := app.statusServer
+	s.lock.Lock()
+	s.servers = append(s.servers, server)
+	s.lock.Unlock()
+	return listener
+}
+
+// serveHealth reports the first run, that is watched. Only GET and HEAD
+// are allowed.
+func (s *statusServer) serveHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	doc := healthDocument{Status: "idle"}
+	s.lock.Lock()
+	for _, rs := range s.runs {
+		if rs.RunID > 0 && rs.State != "completed" && rs.Result == "" {
+			doc.Status = "polling"
+			doc.RunID = rs.RunID
+			doc.Elapsed = time.Since(rs.triggered).Round(time.Second).String()
+			break
+		}
+	}
+	s.lock.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(doc)
+}
+
+func (s *statusServer) serveStatus(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	doc := s.document()
+	s.lock.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(doc)
+}
+
+// document returns the '/status' document with copies of the runs. The
+// lock must be held.
+func (s *statusServer) document() statusDocument {
+	doc := statusDocument{
+		SchemaVersion: outputSchemaVersion,
+
+		Elapsed:   time.Since(s.started).Round(time.Millisecond).String(),
+		Runs:      make([]*runStatus, 0, len(s.runs)),
+		LastError: s.lastError,
+
+		Annotations: s.annotations,
+	}
+	for _, rs := range s.runs {
+		c := *rs
+		doc.Runs = append(doc.Runs, &c)
+	}
+	return doc
+}
+
+// update copies the state of the run and writes the status file, if the
+// state changed or on every heartbeat. It is safe to call on nil.
+func (s *statusServer) update(pr *pipelineRun, polled bool) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	rs, ok := s.byRun[pr]
+	if !ok {
+		rs = &runStatus{Org: pr.prj.org.name, Project: pr.prj.name, Pipeline: pr.name}
+		s.byRun[pr] = rs
+		s.runs = append(s.runs, rs)
+	}
+	changed := !ok || rs.RunID != pr.runID || rs.State != pr.info.State || rs.Result != pr.info.Result || rs.URL != pr.info.URL
+	if pr.runID > 0 && rs.RunID != pr.runID {
+		rs.triggered = time.Now()
+	}
+	rs.RunID = pr.runID
+	rs.State = pr.info.State
+	rs.Result = pr.info.Result
+	rs.URL = pr.info.URL
+	rs.runTimestamps = pr.info.timestamps()
+	if polled {
+		now := time.Now()
+		rs.LastPoll = &now
+		s.polls++
+	}
+	warn := func() {}
+	if changed || (polled && s.polls%statusFileHeartbeat == 0) {
+		warn = s.writeFile()
+	}
+	s.lock.Unlock()
+	warn()
+}
+
+// close stops the server without waiting for open requests. It is safe
+// to call on nil.
+func (s *statusServer) close() {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, server := range s.servers {
+		server.Close()
+	}
+}
+
+// Levels and Fire make the server a log hook, that keeps the last
+// warning or error.
+func (s *statusServer) Levels() []log.Level {
+	return []log.Level{log.PanicLevel, log.FatalLevel, log.ErrorLevel, log.WarnLevel}
+}
+
+func (s *statusServer) Fire(entry *log.Entry) error {
+	s.lock.Lock()
+	s.lastError = entry.Message
+	s.lock.Unlock()
+	return nil
+}
@@ -0,0 +1,251 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errLockHeld is returned, if the lock is held by another process.
+var errLockHeld = errors.New("lock is held by another process")
+
+// LockBackend stores locks, that prevent that the same pipeline is
+// started twice at the same time. A lock expires after its ttl, so that
+// locks of crashed processes do not block forever.
+type LockBackend interface {
+	Acquire(key string, ttl time.Duration) error
+	Release(key string) error
+}
+
+// lockBackendKind is the flag 'lock-backend'.
+type lockBackendKind string
+
+const (
+	lockBackendFile  lockBackendKind = "file"
+	lockBackendRedis lockBackendKind = "redis"
+	lockBackendEtcd  lockBackendKind = "etcd"
+)
+
+func (k *lockBackendKind) String() string {
+	return string(*k)
+}
+
+func (k *lockBackendKind) Set(value string) error {
+	switch lockBackendKind(value) {
+	case lockBackendFile, lockBackendRedis, lockBackendEtcd:
+		*k = lockBackendKind(value)
+	default:
+		return fmt.Errorf("unknown lock backend '%s', use 'file', 'redis' or 'etcd'", value)
+	}
+	return nil
+}
+
+// fileLockBackend stores locks as files in a shared directory. The file
+// holds the token of the process, so that a process, whose lock expired,
+// does not release the lock of the next holder. An expired lock is
+// renamed before it is removed, so that only one waiter takes it over.
+type fileLockBackend struct {
+	dir string
+
+	lock   sync.Mutex
+	tokens map[string]string
+}
+
+func newFileLockBackend(dir string) *fileLockBackend {
+	return &fileLockBackend{dir: dir, tokens: make(map[string]string)}
+}
+
+// lockFile is the content of a lock file.
+type lockFile struct {
+	expiry int64
+	token  string
+}
+
+func (b *fileLockBackend) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(b.dir, "runpipeline-"+hex.EncodeToString(sum[:8])+".lock")
+}
+
+func (b *fileLockBackend) Acquire(key string, ttl time.Duration) error {
+	token, err := lockToken()
+	if err != nil {
+		return err
+	}
+	path := b.path(key)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			host, _ := os.Hostname()
+			_, err = fmt.Fprintf(f, "%d\n%s\n%d\n%s\n%s\n", time.Now().Add(ttl).Unix(), host, os.Getpid(), key, token)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err == nil {
+				b.lock.Lock()
+				b.tokens[key] = token
+				b.lock.Unlock()
+			}
+			return err
+		}
+		if !os.IsExist(err) {
+			return err
+		}
+		stale, ok := readLockFile(path)
+		if !ok || !stale.expired() {
+			return errLockHeld
+		}
+		// the expired lock is renamed, only one waiter succeeds, and is
+		// checked again, because another waiter may have taken it over
+		// between the read and the rename
+		moved := path + "." + fileToken(token) + ".expired"
+		if err = os.Rename(path, moved); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		if current, ok := readLockFile(moved); !ok || current.token != stale.token || !current.expired() {
+			restoreLockFile(moved, path)
+			return errLockHeld
+		}
+		log.Infof("Expired lock '%s' is removed.", path)
+		if err = os.Remove(moved); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+}
+
+// Release removes the lock file, if it still holds the token of this
+// process. The file is renamed before the check, so that it is not
+// taken over in between.
+func (b *fileLockBackend) Release(key string) error {
+	b.lock.Lock()
+	token, ok := b.tokens[key]
+	delete(b.tokens, key)
+	b.lock.Unlock()
+	if !ok {
+		return fmt.Errorf("lock '%s' is not held", key)
+	}
+	path := b.path(key)
+	moved := path + "." + fileToken(token) + ".released"
+	if err := os.Rename(path, moved); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("lock '%s' expired and was removed by another process", key)
+		}
+		return err
+	}
+	if current, ok := readLockFile(moved); !ok || current.token != token {
+		restoreLockFile(moved, path)
+		return fmt.Errorf("lock '%s' expired and is held by another process", key)
+	}
+	return os.Remove(moved)
+}
+
+// readLockFile reads the expiry and the token of the lock file. It is
+// false, if the file does not exist or is written right now.
+func readLockFile(path string) (lockFile, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return lockFile{}, false
+	}
+	lines := strings.Split(string(data), "\n")
+	expiry, err := strconv.ParseInt(lines[0], 10, 64)
+	if err != nil {
+		return lockFile{}, false
+	}
+	lf := lockFile{expiry: expiry}
+	if len(lines) > 4 {
+		lf.token = lines[4]
+	}
+	return lf, true
+}
+
+// expired is true, if the ttl of the lock has passed.
+func (lf lockFile) expired() bool {
+	return time.Now().Unix() > lf.expiry
+}
+
+// restoreLockFile moves the lock of another process back, that was
+// renamed by mistake. The link fails, if the lock was acquired again in
+// the meantime, the lock of the other process is lost then.
+func restoreLockFile(moved string, path string) {
+	if err := os.Link(moved, path); err != nil {
+		log.Warnf("Lock '%s' of another process could not be restored: %v", path, err)
+	}
+	if err := os.Remove(moved); err != nil && !os.IsNotExist(err) {
+		log.Warnf("Lock file '%s' could not be removed: %v", moved, err)
+	}
+}
+
+// fileToken returns a part of a file name, that is unique for the token.
+func fileToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:8])
+}
+
+// lockKey identifies a pipeline run on a branch.
+func (app *App) lockKey(pr *pipelineRun) string {
+	return strings.Join([]string{pr.prj.org.name, pr.prj.name, pr.name, branchRef(pr.branch)}, "/")
+}
+
+// acquireLock waits up to 'lock-wait' for the lock of the pipeline run.
+// The program ends, if the lock can not be acquired.
+func (app *App) acquireLock(pr *pipelineRun) {
+	key := app.lockKey(pr)
+	deadline := time.Now().Add(app.lockWait)
+	for {
+		err := app.lockBackend.Acquire(key, app.lockTTL)
+		if err == nil {
+			log.Debugf("Lock '%s' acquired.", key)
+			app.heldLocks = append(app.heldLocks, key)
+			return
+		}
+		if err != errLockHeld || time.Now().After(deadline) {
+			log.Errorf("Lock '%s' could not be acquired: %v", key, err)
+			app.exit(23)
+		}
+		log.Infof("Lock '%s' is held by another process, waiting ...", key)
+		time.Sleep(minDuration(5*time.Second, time.Until(deadline)+time.Millisecond))
+	}
+}
+
+// releaseLocks releases all locks acquired by this process.
+func (app *App) releaseLocks() {
+	for _, key := range app.heldLocks {
+		if err := app.lockBackend.Release(key); err != nil {
+			log.Warnf("Lock '%s' could not be released: %v", key, err)
+		}
+	}
+	app.heldLocks = nil
+}
+
+func minDuration(a time.Duration, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
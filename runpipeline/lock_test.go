@@ -0,0 +1,137 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// writeExpiredLock writes the lock file of a process, whose lock expired.
+func writeExpiredLock(t *testing.T, b *fileLockBackend, key string, token string) {
+	t.Helper()
+	content := fmt.Sprintf("%d\nhost\n1\n%s\n%s", time.Now().Add(-time.Minute).Unix(), key, token)
+	if err := os.WriteFile(b.path(key), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// lockFiles returns the names of the files in the lock directory.
+func lockFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, filepath.Ext(e.Name()))
+	}
+	return names
+}
+
+// TestFileLockBackend checks, that a lock is held by one process and that
+// only the holder releases it.
+func TestFileLockBackend(t *testing.T) {
+	tests := []struct {
+		name string
+		// existing is the token of an expired lock file, '-' for none and
+		// empty for a lock file without token
+		existing string
+		ttl      time.Duration
+		// expire lets the lock of the first process expire, before the
+		// second process acquires it
+		expire      bool
+		second      error
+		release     bool
+		secondFiles []string
+	}{
+		{"held", "-", time.Minute, false, errLockHeld, true, nil},
+		{"expired lock of a crashed process", "host/1/0123456789abcdef", time.Minute, false, errLockHeld, true, nil},
+		{"expired lock without token", "", time.Minute, false, errLockHeld, true, nil},
+		{"taken over after the expiry", "-", time.Minute, true, nil, false, []string{".lock"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			first := newFileLockBackend(dir)
+			second := newFileLockBackend(dir)
+			if tt.existing != "-" {
+				writeExpiredLock(t, first, "org/prj/deploy/main", tt.existing)
+			}
+			if err := first.Acquire("org/prj/deploy/main", tt.ttl); err != nil {
+				t.Fatalf("Acquire() error = %v", err)
+			}
+			if tt.expire {
+				writeExpiredLock(t, first, "org/prj/deploy/main", first.tokens["org/prj/deploy/main"])
+			}
+			if err := second.Acquire("org/prj/deploy/main", tt.ttl); !errors.Is(err, tt.second) {
+				t.Fatalf("Acquire() of the second process error = %v, want %v", err, tt.second)
+			}
+			err := first.Release("org/prj/deploy/main")
+			if released := err == nil; released != tt.release {
+				t.Errorf("Release() error = %v, want released %v", err, tt.release)
+			}
+			if got := lockFiles(t, dir); fmt.Sprint(got) != fmt.Sprint(tt.secondFiles) {
+				t.Errorf("lock files %v, want %v", got, tt.secondFiles)
+			}
+		})
+	}
+}
+
+// TestFileLockBackendTakeOver checks, that only one of the processes, that
+// wait for an expired lock, takes it over.
+func TestFileLockBackendTakeOver(t *testing.T) {
+	dir := t.TempDir()
+	for round := 0; round < 20; round++ {
+		writeExpiredLock(t, newFileLockBackend(dir), "deploy", "host/1/crashed")
+		var wg sync.WaitGroup
+		var lock sync.Mutex
+		var holders []*fileLockBackend
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				b := newFileLockBackend(dir)
+				err := b.Acquire("deploy", time.Minute)
+				if err != nil && err != errLockHeld {
+					t.Errorf("Acquire() error = %v", err)
+				}
+				if err == nil {
+					lock.Lock()
+					holders = append(holders, b)
+					lock.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		if len(holders) != 1 {
+			t.Fatalf("round %d: %d processes hold the lock, want 1", round, len(holders))
+		}
+		if err := holders[0].Release("deploy"); err != nil {
+			t.Fatalf("round %d: Release() error = %v", round, err)
+		}
+		if files := lockFiles(t, dir); len(files) != 0 {
+			t.Fatalf("round %d: files %v are left", round, files)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// etcdLockBackend stores locks as keys in etcd, that are attached to a
+// lease with the ttl of the lock. The key is only put, if it does not
+// exist yet. The client uses the JSON gateway of the API v3 of etcd.
+type etcdLockBackend struct {
+	endpoints []string
+	client    *http.Client
+
+	lock   sync.Mutex
+	leases map[string]string
+}
+
+func newEtcdLockBackend(endpoints []string) *etcdLockBackend {
+	return &etcdLockBackend{
+		endpoints: endpoints,
+		// the client is not the client of the SDK, requests to etcd are
+		// no API calls of Azure DevOps
+		client: &http.Client{
+			Timeout:   lockTimeout,
+			Transport: &http.Transport{Proxy: http.ProxyFromEnvironment},
+		},
+		leases: make(map[string]string),
+	}
+}
+
+// etcdLease is the response of a lease grant. The gateway encodes 64 bit
+// integers as strings.
+type etcdLease struct {
+	ID    string `json:"ID"`
+	Error string `json:"error"`
+}
+
+func (b *etcdLockBackend) Acquire(key string, ttl time.Duration) error {
+	seconds := int64((ttl + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	var lease etcdLease
+	if err := b.post("/v3/lease/grant", map[string]interface{}{"TTL": strconv.FormatInt(seconds, 10)}, &lease); err != nil {
+		return err
+	}
+	if lease.ID == "" {
+		return fmt.Errorf("etcd granted no lease: %s", lease.Error)
+	}
+	name := base64.StdEncoding.EncodeToString([]byte(lockKeyPrefix + key))
+	token, err := lockToken()
+	if err != nil {
+		return err
+	}
+	txn := map[string]interface{}{
+		"compare": []map[string]string{{"key": name, "target": "CREATE", "result": "EQUAL", "create_revision": "0"}},
+		"success": []map[string]interface{}{{"request_put": map[string]string{
+			"key":   name,
+			"value": base64.StdEncoding.EncodeToString([]byte(token)),
+			"lease": lease.ID,
+		}}},
+	}
+	var result struct {
+		Succeeded bool `json:"succeeded"`
+	}
+	if err = b.post("/v3/kv/txn", txn, &result); err != nil || !result.Succeeded {
+		if revokeErr := b.revoke(lease.ID); revokeErr != nil {
+			log.Debugf("Lease %s could not be revoked: %v", lease.ID, revokeErr)
+		}
+		if err != nil {
+			return err
+		}
+		return errLockHeld
+	}
+	b.lock.Lock()
+	b.leases[key] = lease.ID
+	b.lock.Unlock()
+	return nil
+}
+
+// Release revokes the lease of the lock, which deletes the key.
+func (b *etcdLockBackend) Release(key string) error {
+	b.lock.Lock()
+	id, ok := b.leases[key]
+	delete(b.leases, key)
+	b.lock.Unlock()
+	if !ok {
+		return fmt.Errorf("lock '%s' is not held", key)
+	}
+	return b.revoke(id)
+}
+
+func (b *etcdLockBackend) revoke(id string) error {
+	var response etcdLease
+	if err := b.post("/v3/lease/revoke", map[string]string{"ID": id}, &response); err != nil {
+		return err
+	}
+	if response.Error != "" {
+		return fmt.Errorf("etcd: %s", response.Error)
+	}
+	return nil
+}
+
+// post sends the request to the endpoints in turn, until one of them
+// answers.
+func (b *etcdLockBackend) post(path string, request interface{}, response interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	for _, endpoint := range b.endpoints {
+		var resp *http.Response
+		resp, err = b.client.Post(strings.TrimSuffix(endpoint, "/")+path, "application/json", bytes.NewReader(body))
+		if err != nil {
+			log.Debugf("etcd endpoint '%s' is not available: %v", endpoint, err)
+			continue
+		}
+		data, readErr := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if readErr != nil {
+			return readErr
+		}
+		if resp.StatusCode >= 300 {
+			var failure etcdLease
+			if json.Unmarshal(data, &failure) == nil && failure.Error != "" {
+				return fmt.Errorf("etcd: %s", failure.Error)
+			}
+			return fmt.Errorf("etcd answered with status %s", resp.Status)
+		}
+		return json.Unmarshal(data, response)
+	}
+	return err
+}
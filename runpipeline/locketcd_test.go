@@ -0,0 +1,84 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// failingTransport fails the test, if a request is sent with it.
+type failingTransport struct {
+	t *testing.T
+}
+
+func (f failingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.t.Errorf("request %s %s was sent with the default transport", req.Method, req.URL)
+	return nil, errors.New("default transport is not allowed")
+}
+
+// TestEtcdLockBackend checks the requests of a lock and that they are not
+// sent with the default transport, which counts the API calls of Azure
+// DevOps.
+func TestEtcdLockBackend(t *testing.T) {
+	tests := []struct {
+		name      string
+		succeeded bool
+		want      error
+		requested []string
+	}{
+		{"free", true, nil, []string{"/v3/lease/grant", "/v3/kv/txn", "/v3/lease/revoke"}},
+		{"held", false, errLockHeld, []string{"/v3/lease/grant", "/v3/kv/txn", "/v3/lease/revoke"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requested []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requested = append(requested, r.URL.Path)
+				var response interface{} = map[string]string{}
+				switch r.URL.Path {
+				case "/v3/lease/grant":
+					response = map[string]string{"ID": "7587862072069011234", "TTL": "60"}
+				case "/v3/kv/txn":
+					response = map[string]bool{"succeeded": tt.succeeded}
+				}
+				json.NewEncoder(w).Encode(response)
+			}))
+			defer server.Close()
+			withTransport(t, failingTransport{t})
+			b := newEtcdLockBackend([]string{"http://127.0.0.1:1", server.URL})
+
+			err := b.Acquire("deploy", time.Minute)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Acquire() error = %v, want %v", err, tt.want)
+			}
+			if err == nil {
+				if err := b.Release("deploy"); err != nil {
+					t.Errorf("Release() error = %v", err)
+				}
+			}
+			if fmt.Sprint(requested) != fmt.Sprint(tt.requested) {
+				t.Errorf("requested %v, want %v", requested, tt.requested)
+			}
+		})
+	}
+}
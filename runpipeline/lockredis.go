@@ -0,0 +1,172 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// lockTimeout limits the requests to the lock servers.
+const lockTimeout = 10 * time.Second
+
+// lockKeyPrefix is the prefix of the keys of the locks in Redis and etcd.
+const lockKeyPrefix = "runpipeline/lock/"
+
+// redisReleaseScript deletes the key only, if it still holds the token of
+// this process, so that an expired lock, that another process acquired
+// since, is not released.
+const redisReleaseScript = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) else return 0 end`
+
+// redisLockBackend stores locks as keys with expiry in Redis. The keys
+// are set with 'SET NX PX', so that only one process acquires a lock.
+// The client speaks the protocol of Redis without further dependencies.
+type redisLockBackend struct {
+	addr     string
+	password string
+
+	lock   sync.Mutex
+	tokens map[string]string
+}
+
+func newRedisLockBackend(addr string, password string) *redisLockBackend {
+	return &redisLockBackend{addr: addr, password: password, tokens: make(map[string]string)}
+}
+
+func (b *redisLockBackend) Acquire(key string, ttl time.Duration) error {
+	token, err := lockToken()
+	if err != nil {
+		return err
+	}
+	reply, err := b.do("SET", lockKeyPrefix+key, token, "NX", "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	if err != nil {
+		return err
+	}
+	if reply == nil {
+		return errLockHeld
+	}
+	b.lock.Lock()
+	b.tokens[key] = token
+	b.lock.Unlock()
+	return nil
+}
+
+func (b *redisLockBackend) Release(key string) error {
+	b.lock.Lock()
+	token, ok := b.tokens[key]
+	delete(b.tokens, key)
+	b.lock.Unlock()
+	if !ok {
+		return fmt.Errorf("lock '%s' is not held", key)
+	}
+	reply, err := b.do("EVAL", redisReleaseScript, "1", lockKeyPrefix+key, token)
+	if err != nil {
+		return err
+	}
+	if reply == int64(0) {
+		return fmt.Errorf("lock '%s' expired and is held by another process", key)
+	}
+	return nil
+}
+
+// do sends the command on a new connection, after it is authenticated
+// with the password, and returns the reply of the command.
+func (b *redisLockBackend) do(args ...string) (interface{}, error) {
+	conn, err := net.DialTimeout("tcp", b.addr, lockTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err = conn.SetDeadline(time.Now().Add(lockTimeout)); err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(conn)
+	if b.password != "" {
+		if _, err = redisCommand(conn, reader, "AUTH", b.password); err != nil {
+			return nil, fmt.Errorf("authentication at Redis failed: %w", err)
+		}
+	}
+	return redisCommand(conn, reader, args...)
+}
+
+// redisCommand writes the command as array of bulk strings and reads the
+// reply. Error replies are returned as error, a nil reply as nil.
+func redisCommand(w io.Writer, r *bufio.Reader, args ...string) (interface{}, error) {
+	var command strings.Builder
+	fmt.Fprintf(&command, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&command, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(w, command.String()); err != nil {
+		return nil, err
+	}
+	return redisReply(r)
+}
+
+// redisReply reads a simple string, an error, an integer or a bulk
+// string. Arrays are not needed for locks.
+func redisReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("empty reply of Redis")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, fmt.Errorf("Redis: %s", line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		data := make([]byte, size+2)
+		if _, err = io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return string(data[:size]), nil
+	}
+	return nil, fmt.Errorf("unexpected reply of Redis: %q", line)
+}
+
+// lockToken returns a value, that identifies the lock of this process.
+func lockToken() (string, error) {
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s/%d/%s", host, os.Getpid(), hex.EncodeToString(random)), nil
+}
@@ -0,0 +1,100 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"net/http"
+	"testing"
+)
+
+// checkRunFields checks, that the entry with the message carries the
+// fields of the run.
+func checkRunFields(t *testing.T, hook *test.Hook, message string, want log.Fields) {
+	t.Helper()
+	for _, e := range hook.AllEntries() {
+		if e.Message != message {
+			continue
+		}
+		for key, value := range want {
+			if e.Data[key] != value {
+				t.Errorf("field %s of '%s' is %v, want %v", key, message, e.Data[key], value)
+			}
+		}
+		return
+	}
+	t.Errorf("no entry '%s'", message)
+}
+
+func TestRunPipelineLogFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		message string
+		want    log.Fields
+	}{
+		{"started", http.StatusOK, "Run pipeline 'build'. Run id is '42' and state is 'inProgress'.",
+			log.Fields{"pipeline": "build", "runId": 42, "branch": "main"}},
+		{"failed", http.StatusBadRequest, "pipeline parameters are invalid",
+			log.Fields{"pipeline": "build", "runId": 0, "branch": "main"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook := test.NewGlobal()
+			defer hook.Reset()
+			level := log.GetLevel()
+			log.SetLevel(log.DebugLevel)
+			defer log.SetLevel(level)
+
+			f := newFakeServer(t)
+			f.route(locationRuns, "{project}/_apis/pipelines/{pipelineId}/runs/{runId}", func(req *fakeRequest) (int, interface{}) {
+				if tt.status != http.StatusOK {
+					return tt.status, map[string]string{"message": "pipeline parameters are invalid"}
+				}
+				return http.StatusOK, map[string]interface{}{"id": 42, "name": "20221016.1", "state": "inProgress"}
+			})
+			app := &App{clock: &serverClock{}, timer: newPhaseTimer()}
+			pr := testRun(f.project(), "build", 1, 0)
+
+			exitCodeOf(t, app, func() { app.runPipeline(context.Background(), pr) })
+			checkRunFields(t, hook, tt.message, tt.want)
+		})
+	}
+}
+
+func TestAddPipelineRunLogFields(t *testing.T) {
+	hook := test.NewGlobal()
+	defer hook.Reset()
+	prj := &project{name: "prj"}
+	run := &pipelineRun{prj: prj, name: "build", pipelineID: 1, branch: "refs/heads/release/1.0"}
+
+	runs := addPipelineRun(addPipelineRun(nil, run), run)
+	if len(runs) != 1 {
+		t.Errorf("%d runs, want 1", len(runs))
+	}
+	checkRunFields(t, hook, "Pipeline 'build (id: 1)' is specified more than once.",
+		log.Fields{"pipeline": "build", "runId": 0, "branch": "release/1.0"})
+}
+
+func TestPipelineLoggerFields(t *testing.T) {
+	hook := test.NewGlobal()
+	defer hook.Reset()
+	pipelineLogger("build").Info("Pipeline build has ID 1.")
+	checkRunFields(t, hook, "Pipeline build has ID 1.", log.Fields{"pipeline": "build"})
+}
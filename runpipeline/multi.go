@@ -0,0 +1,283 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"fmt"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/pipelines"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// resultSkipped is the result of a pipeline, that is not started in
+// sequential mode.
+const resultSkipped = "skipped"
+
+// exitCodeSeverity orders the exit codes of a run from best to worst.
+var exitCodeSeverity = map[int]int{0: 0, 3: 1, 2: 2, 14: 3, 24: 4, 1: 5}
+
+// resolvePipelines looks up all pipelines given by name or id. The
+// program ends, if one of them does not exist.
+func (app *App) resolvePipelines(ctx context.Context) []*pipelineRun {
+	var runs []*pipelineRun
+	for _, ref := range app.pipelines {
+		prj, name, id := app.parseReference(ctx, ref)
+		runs = addPipelineRun(runs, app.resolvePipeline(ctx, prj, name, id))
+	}
+	for _, id := range app.ids {
+		runs = addPipelineRun(runs, app.resolvePipeline(ctx, app.defaultProject, "", id))
+	}
+	if app.batch != nil {
+		for _, bp := range app.batch.Pipelines {
+			prj, name, id := app.defaultProject, bp.Name, bp.ID
+			if id == 0 {
+				prj, name, id = app.parseReference(ctx, bp.Name)
+			}
+			pr := app.resolvePipeline(ctx, prj, name, id)
+			pr.branch = bp.Branch
+			pr.parameters = bp.Parameters
+			pr.timeout = bp.Timeout
+			runs = addPipelineRun(runs, pr)
+		}
+	}
+	return runs
+}
+
+// resolvePipeline looks up a pipeline of the project by id or, if the id
+// is 0, by name.
+func (app *App) resolvePipeline(ctx context.Context, prj *project, name string, id int) *pipelineRun {
+	if id == 0 {
+		pipelineID := app.getPipelineID(ctx, prj, name)
+		if pipelineID == -1 && app.pipelineExistsRetry {
+			pipelineID = app.waitForPipeline(ctx, prj, name)
+		}
+		if pipelineID == -1 {
+			pipelineLogger(name).Errorf("Pipeline '%s' does not exists!", name)
+			app.fail(1, fmt.Errorf("pipeline '%s' does not exist", name))
+		}
+		pr := &pipelineRun{prj: prj, name: name, pipelineID: pipelineID}
+		app.warnIfDisabled(ctx, pr)
+		return pr
+	}
+	pipelineID := id
+	args := &pipelines.GetPipelineArgs{
+		Project:    &prj.name,
+		PipelineId: &pipelineID,
+	}
+	pipeline, err := prj.org.pipelines.GetPipeline(ctx, *args)
+	if err != nil {
+		log.WithField("pipelineId", id).Errorf("Pipeline with id %d does not exists! %v", id, err)
+		app.fail(1, err)
+	}
+	if app.yamlPath != "" {
+		app.verifyYamlPath(ctx, prj, *pipeline.Name, pipelineID)
+	}
+	pr := &pipelineRun{prj: prj, name: *pipeline.Name, pipelineID: pipelineID}
+	if pipeline.Folder != nil {
+		pr.folder = *pipeline.Folder
+	}
+	app.warnIfDisabled(ctx, pr)
+	return pr
+}
+
+// parseReference splits a fully qualified pipeline reference of the form
+// org/project/name or org/project/id. Other references are names of
+// pipelines in the project given on the command line.
+func (app *App) parseReference(ctx context.Context, ref string) (*project, string, int) {
+	parts := strings.Split(ref, "/")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return app.defaultProject, ref, 0
+	}
+	prj := app.defaultProject
+	if parts[0] != app.org || parts[1] != app.prj {
+		prj = app.project(ctx, parts[0], parts[1])
+	}
+	if id, err := strconv.Atoi(parts[2]); err == nil && id > 0 {
+		return prj, "", id
+	}
+	return prj, parts[2], 0
+}
+
+// addPipelineRun adds the run, if the pipeline is not already started
+// on the same branch.
+func addPipelineRun(runs []*pipelineRun, run *pipelineRun) []*pipelineRun {
+	for _, pr := range runs {
+		if pr.prj.org == run.prj.org && pr.prj.name == run.prj.name && pr.pipelineID == run.pipelineID && pr.branch == run.branch {
+			runLogger(run).Warnf("Pipeline '%s (id: %d)' is specified more than once.", run.name, run.pipelineID)
+			return runs
+		}
+	}
+	return append(runs, run)
+}
+
+// watchRuns waits until all runs are completed and returns the exit code
+// of the worst run. More than one run is watched concurrently and a
+// summary is printed at the end.
+func (app *App) watchRuns(ctx context.Context, runs []*pipelineRun) int {
+	if len(runs) == 1 {
+		pr := runs[0]
+		app.run = &pr.info
+		app.watchRun(ctx, pr)
+		return pr.exitCode
+	}
+
+	var wg sync.WaitGroup
+	for _, pr := range runs {
+		wg.Add(1)
+		go func(pr *pipelineRun) {
+			defer wg.Done()
+			app.watchRun(ctx, pr)
+		}(pr)
+	}
+	wg.Wait()
+
+	return app.summarize(runs)
+}
+
+// runSequential starts the pipelines one after another and waits for
+// each run. After the first unsuccessful run the remaining pipelines are
+// skipped.
+func (app *App) runSequential(ctx context.Context, runs []*pipelineRun) int {
+	if len(runs) == 1 {
+		app.startRun(ctx, runs[0])
+		return app.watchRuns(ctx, runs)
+	}
+	failed := false
+	for _, pr := range runs {
+		if failed {
+			runLogger(pr).Warnf("Pipeline '%s' is skipped.", pr.name)
+			pr.info.Result = resultSkipped
+			app.statusServer.update(pr, false)
+			continue
+		}
+		app.startRun(ctx, pr)
+		app.watchRun(ctx, pr)
+		failed = pr.exitCode != 0
+	}
+	return app.summarize(runs)
+}
+
+// summarize prints the summary of all runs and returns the exit code of
+// the worst run.
+func (app *App) summarize(runs []*pipelineRun) int {
+	if app.output.console() {
+		done := app.timer.begin("summary")
+		printSummary(runs)
+		done()
+	}
+
+	worst := runs[0]
+	for _, pr := range runs[1:] {
+		if exitCodeSeverity[pr.exitCode] > exitCodeSeverity[worst.exitCode] {
+			worst = pr
+		}
+	}
+	app.run = &worst.info
+	return worst.exitCode
+}
+
+func (app *App) watchRun(ctx context.Context, pr *pipelineRun) {
+	pr.exitCode = app.logStatus(ctx, pr)
+	for retry := 1; retry <= app.retryOnCancel && pr.info.Result == string(pipelines.RunResultValues.Canceled); retry++ {
+		if !app.budget.allowOptional("retryOnCancel") {
+			break
+		}
+		if !app.canceledBySystem(ctx, pr) {
+			pr.log.Infof("Run %d of pipeline '%s' was canceled by a user and is not started again.", pr.runID, pr.name)
+			break
+		}
+		pr.log.Warnf("Run %d of pipeline '%s' was canceled by Azure DevOps. Start again (%d/%d).", pr.runID, pr.name, retry, app.retryOnCancel)
+		pr.info = runInfo{}
+		pr.runID = app.runPipeline(ctx, pr)
+		if pr.runID == -1 {
+			pr.log.Errorf("Pipeline '%s' start failed.", pr.name)
+			app.fail(1, fmt.Errorf("pipeline '%s' start failed", pr.name))
+		}
+		pr.log = runLogger(pr)
+		pr.exitCode = app.logStatus(ctx, pr)
+	}
+	if app.waitForEnvironment != "" {
+		pr.exitCode = app.waitForEnvironmentDeployment(ctx, pr, pr.exitCode)
+	}
+	if pr.exitCode == 3 {
+		pr.log.Warnf("It was not possible to identify the correct return value for pipeline '%s'.", pr.name)
+	}
+	if app.capturesRunVariables() {
+		app.captureRunVariables(ctx, pr)
+	}
+	if app.downloadLogsDir != "" {
+		app.downloadLogs(ctx, pr)
+	}
+	if app.downloadArtifactsDir != "" {
+		app.downloadArtifacts(ctx, pr)
+	}
+	if app.reportMdFile != "" {
+		app.collectReportDetails(ctx, pr)
+	}
+	if app.commitStatus != commitStatusOff {
+		description := fmt.Sprintf("Run %s %s", pr.info.BuildNumber, pr.info.Result)
+		app.setCommitStatus(ctx, pr, commitStatusState(pr.info.Result), description)
+	}
+	if app.reportToPRCheck {
+		description := fmt.Sprintf("Run %s %s", pr.info.BuildNumber, pr.info.Result)
+		app.postPullRequestCheck(ctx, pr, commitStatusState(pr.info.Result), description)
+	}
+	if app.buildTagTemplate.template != nil && pr.info.Result == string(pipelines.RunResultValues.Succeeded) {
+		app.tagBuiltCommit(ctx, pr)
+	}
+	if app.failureIssue && pr.info.Result == string(pipelines.RunResultValues.Failed) {
+		app.createFailureIssue(ctx, pr)
+	}
+	if app.telemetryEndpoint != "" {
+		app.sendTelemetry(ctx, pr)
+	}
+	if app.cleanupOnSuccess && pr.info.Result == string(pipelines.RunResultValues.Succeeded) {
+		app.deleteSucceeded(ctx, pr)
+	}
+}
+
+func printSummary(runs []*pipelineRun) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Org\tPipeline\tId\tRun id\tResult\tExit code\tURL")
+	for _, pr := range runs {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t%d\t%s\n", pr.prj.org.name, pr.name, pr.pipelineID, pr.runID, pr.info.Result, pr.exitCode, pr.info.URL)
+	}
+	w.Flush()
+}
+
+func containsString(list []string, value string) bool {
+	for _, s := range list {
+		if s == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(list []int, value int) bool {
+	for _, i := range list {
+		if i == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/build"
+	"time"
+)
+
+const (
+	// cancelWaitPolls limits the status checks of a canceled run, before
+	// it is deleted.
+	cancelWaitPolls = 10
+	// cancelWaitInterval is the wait time between the status checks of a
+	// canceled run.
+	cancelWaitInterval = 2 * time.Second
+)
+
+// deleteNeverStarted cancels the run, if it is still queued, waits until
+// it is completed and deletes it, so that no orphaned run is left behind,
+// when the program gives up. Runs, that started, are never deleted.
+// Failures are only logged as warnings, the exit code is not changed.
+func (app *App) deleteNeverStarted(ctx context.Context, pr *pipelineRun, canceled bool) {
+	if pr.runID <= 0 || !app.budget.allowOptional("deleteIfNeverStarted") {
+		return
+	}
+	client, err := pr.prj.org.buildClient(ctx)
+	if err != nil {
+		pr.log.Warnf("Run %d of pipeline '%s' could not be read: %v", pr.runID, pr.name, err)
+		return
+	}
+	b, err := app.getBuild(ctx, client, pr)
+	if err != nil {
+		pr.log.Warnf("Run %d of pipeline '%s' could not be read, it is not deleted: %v", pr.runID, pr.name, err)
+		return
+	}
+	if b.StartTime != nil {
+		pr.log.Debugf("Run %d of pipeline '%s' started, it is not deleted.", pr.runID, pr.name)
+		return
+	}
+	if !canceled && !buildCompleted(b) {
+		app.cancelRun(ctx, client, pr, pr.runID)
+	}
+	for polls := 1; !buildCompleted(b); polls++ {
+		if polls > cancelWaitPolls {
+			pr.log.Warnf("Run %d of pipeline '%s' is still '%s' after it was canceled, it is not deleted.", pr.runID, pr.name, *b.Status)
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(cancelWaitInterval):
+		}
+		if b, err = app.getBuild(ctx, client, pr); err != nil {
+			pr.log.Warnf("Run %d of pipeline '%s' could not be read, it is not deleted: %v", pr.runID, pr.name, err)
+			return
+		}
+		if b.StartTime != nil {
+			pr.log.Infof("Run %d of pipeline '%s' started before it was canceled, it is not deleted.", pr.runID, pr.name)
+			return
+		}
+	}
+
+	args := &build.DeleteBuildArgs{
+		Project: &pr.prj.name,
+		BuildId: &pr.runID,
+	}
+	auditCtx, call := app.auditContext(ctx, "delete", pr.name, pr.pipelineID, pr.runID)
+	if err = client.DeleteBuild(auditCtx, *args); err != nil {
+		pr.log.Warnf("Run %d of pipeline '%s' never started, but could not be deleted: %v", pr.runID, pr.name, err)
+		return
+	}
+	call.done(0, "deleted")
+	pr.log.Infof("Run %d of pipeline '%s' never started and is deleted.", pr.runID, pr.name)
+}
+
+// deleteUnfinishedNeverStarted deletes the unfinished runs, that never
+// started, when the program ends before the runs are finished.
+func (app *App) deleteUnfinishedNeverStarted(ctx context.Context) {
+	if !app.deleteIfNeverStarted {
+		return
+	}
+	for _, pr := range app.runs {
+		if pr.runID > 0 && pr.info.Result == "" {
+			app.deleteNeverStarted(ctx, pr, false)
+		}
+	}
+}
+
+func (app *App) getBuild(ctx context.Context, client build.Client, pr *pipelineRun) (*build.Build, error) {
+	args := &build.GetBuildArgs{
+		Project: &pr.prj.name,
+		BuildId: &pr.runID,
+	}
+	return client.GetBuild(ctx, *args)
+}
+
+// buildCompleted is true, if the build has the status completed.
+func buildCompleted(b *build.Build) bool {
+	return b.Status != nil && *b.Status == build.BuildStatusValues.Completed
+}
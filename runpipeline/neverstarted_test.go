@@ -0,0 +1,126 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestDeleteNeverStarted checks the sequence of the requests: a queued run
+// is canceled, polled until it is completed and deleted, a run, that
+// started, is never deleted.
+func TestDeleteNeverStarted(t *testing.T) {
+	started := time.Now().UTC().Format(time.RFC3339)
+	tests := []struct {
+		name     string
+		canceled bool
+		// statuses are the states of the run for every read, a status
+		// with '+' has a start time
+		statuses []string
+		// deleteStatus is the response status of the deletion
+		deleteStatus int
+		requested    []string
+		deleted      bool
+	}{
+		{"queued", false, []string{"notStarted", "completed"}, http.StatusNoContent, []string{"GET", "PATCH", "GET", "DELETE"}, true},
+		{"canceled before", true, []string{"cancelling", "completed"}, http.StatusNoContent, []string{"GET", "GET", "DELETE"}, true},
+		{"completed", false, []string{"completed"}, http.StatusNoContent, []string{"GET", "DELETE"}, true},
+		{"started", false, []string{"inProgress+"}, http.StatusNoContent, []string{"GET"}, false},
+		{"started before the cancellation", false, []string{"notStarted", "inProgress+"}, http.StatusNoContent, []string{"GET", "PATCH", "GET"}, false},
+		{"deletion failed", false, []string{"completed"}, http.StatusForbidden, []string{"GET", "DELETE"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeServer(t)
+			reads := 0
+			deleted := false
+			f.route(locationBuilds, "{project}/_apis/build/builds/{buildId}", func(req *fakeRequest) (int, interface{}) {
+				switch req.Method {
+				case http.MethodPatch:
+					if !strings.Contains(req.body, `"cancelling"`) {
+						t.Errorf("update %s, want the cancellation", req.body)
+					}
+					return http.StatusOK, map[string]interface{}{"id": 10, "status": "cancelling"}
+				case http.MethodDelete:
+					deleted = tt.deleteStatus == http.StatusNoContent
+					if !deleted {
+						return tt.deleteStatus, map[string]string{"message": "permission denied"}
+					}
+					return tt.deleteStatus, ""
+				}
+				status := tt.statuses[reads]
+				if reads < len(tt.statuses)-1 {
+					reads++
+				}
+				b := map[string]interface{}{"id": 10, "status": strings.TrimSuffix(status, "+")}
+				if strings.HasSuffix(status, "+") {
+					b["startTime"] = started
+				}
+				return http.StatusOK, b
+			})
+			app := &App{clock: &serverClock{}, budget: newAPIBudget(0, http.DefaultTransport)}
+			pr := testRun(f.project(), "build", 1, 10)
+
+			app.deleteNeverStarted(context.Background(), pr, tt.canceled)
+			var methods []string
+			for _, r := range f.requested() {
+				methods = append(methods, strings.SplitN(r, " ", 2)[0])
+			}
+			if fmt.Sprint(methods) != fmt.Sprint(tt.requested) {
+				t.Errorf("requested %v, want %v", f.requested(), tt.requested)
+			}
+			if deleted != tt.deleted {
+				t.Errorf("deleted = %v, want %v", deleted, tt.deleted)
+			}
+		})
+	}
+}
+
+// TestDeleteUnfinishedNeverStarted checks, that only the unfinished runs
+// are deleted, when the program ends.
+func TestDeleteUnfinishedNeverStarted(t *testing.T) {
+	f := newFakeServer(t)
+	f.route(locationBuilds, "{project}/_apis/build/builds/{buildId}", func(req *fakeRequest) (int, interface{}) {
+		if req.Method == http.MethodDelete {
+			return http.StatusNoContent, ""
+		}
+		id, _ := strconv.Atoi(req.values["buildId"])
+		return http.StatusOK, map[string]interface{}{"id": id, "status": "completed"}
+	})
+	finished := testRun(f.project(), "build", 1, 10)
+	finished.info.Result = "succeeded"
+	unfinished := testRun(f.project(), "deploy", 2, 11)
+	notTriggered := testRun(f.project(), "test", 3, 0)
+	app := &App{
+		clock:                &serverClock{},
+		budget:               newAPIBudget(0, http.DefaultTransport),
+		deleteIfNeverStarted: true,
+		runs:                 []*pipelineRun{finished, unfinished, notTriggered},
+	}
+
+	app.deleteUnfinishedNeverStarted(context.Background())
+	want := []string{"GET /org/prj/_apis/build/builds/11", "DELETE /org/prj/_apis/build/builds/11"}
+	if got := f.requested(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("requested %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,171 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// outputFormat is the value of the flag 'output'.
+type outputFormat string
+
+const (
+	outputText    outputFormat = "text"
+	outputJSON    outputFormat = "json"
+	outputTAP     outputFormat = "tap"
+	outputDatadog outputFormat = "datadog"
+	outputInflux  outputFormat = "influx"
+	// outputGitHubSummary writes the text output and a table of the runs
+	// to the summary of the GitHub Actions step
+	outputGitHubSummary outputFormat = "github-workflow-summary"
+)
+
+func (f *outputFormat) String() string {
+	return string(*f)
+}
+
+func (f *outputFormat) Set(value string) error {
+	switch outputFormat(value) {
+	case outputText, outputJSON, outputTAP, outputDatadog, outputInflux, outputGitHubSummary:
+		*f = outputFormat(value)
+	default:
+		return fmt.Errorf("unknown format '%s', use 'text', 'json', 'tap', 'datadog', 'influx' or 'github-workflow-summary'", value)
+	}
+	return nil
+}
+
+// console is true, if the log and the summary are written to stdout.
+// The other formats reserve stdout for the result document.
+func (f outputFormat) console() bool {
+	return f == outputText || f == outputDatadog || f == outputInflux || f == outputGitHubSummary
+}
+
+// resultDocument is written to stdout with '-output json'.
+type resultDocument struct {
+	SchemaVersion  string        `json:"schemaVersion"`
+	ExitCode       int           `json:"exitCode"`
+	MappedExitCode *int          `json:"mappedExitCode,omitempty"`
+	Runs           []runDocument `json:"runs"`
+	APICalls       int           `json:"apiCalls"`
+	Degraded       []string      `json:"degraded,omitempty"`
+	// Unavailable are the subsystems, that Azure DevOps denied, with the
+	// missing permission
+	Unavailable  map[string]string `json:"unavailable,omitempty"`
+	Timings      map[string]int64  `json:"timings,omitempty"`
+	TokenExpires *time.Time        `json:"tokenExpires,omitempty"`
+	Annotations  annotations       `json:"annotations,omitempty"`
+}
+
+type runDocument struct {
+	Org         string `json:"org"`
+	Project     string `json:"project"`
+	Pipeline    string `json:"pipeline"`
+	PipelineID  int    `json:"pipelineId"`
+	RunID       int    `json:"runId,omitempty"`
+	BuildNumber string `json:"buildNumber,omitempty"`
+	State       string `json:"state,omitempty"`
+	Result      string `json:"result,omitempty"`
+	URL         string `json:"url,omitempty"`
+	ExitCode    int    `json:"exitCode"`
+	// TriggerAPI is the API, that started the run, 'pipelines' or
+	// 'builds' for classic build definitions, agent pools and demands
+	TriggerAPI string `json:"triggerApi,omitempty"`
+	runTimestamps
+
+	IgnoredParameters []string        `json:"ignoredParameters,omitempty"`
+	Deployment        *deploymentInfo `json:"deployment,omitempty"`
+	Approval          *approvalInfo   `json:"approval,omitempty"`
+	// Deleted is true, if the run was deleted by 'cleanup-on-success',
+	// its URL is not valid anymore
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// writeOutput writes the result of the program in the selected format.
+func (app *App) writeOutput(code int) {
+	switch app.output {
+	case outputJSON:
+		doc := resultDocument{SchemaVersion: outputSchemaVersion, ExitCode: code, Runs: []runDocument{}, Annotations: app.annotations}
+		if app.bestEffort {
+			// exit code of the run result, before best-effort mode
+			doc.MappedExitCode = &app.mappedExitCode
+		}
+		for _, pr := range app.runs {
+			doc.Runs = append(doc.Runs, runDocument{
+				Org:         pr.prj.org.name,
+				Project:     pr.prj.name,
+				Pipeline:    pr.name,
+				PipelineID:  pr.pipelineID,
+				RunID:       pr.info.ID,
+				BuildNumber: pr.info.BuildNumber,
+				State:       pr.info.State,
+				Result:      pr.info.Result,
+				URL:         pr.info.URL,
+				ExitCode:    pr.exitCode,
+				TriggerAPI:  pr.triggerAPI,
+
+				runTimestamps: pr.info.timestamps(),
+
+				IgnoredParameters: pr.ignoredParameters,
+				Deployment:        pr.deployment,
+				Approval:          pr.approval,
+				Deleted:           pr.deleted,
+			})
+		}
+		if app.timing {
+			doc.Timings = app.timer.milliseconds()
+		}
+		doc.TokenExpires = app.tokenExpires
+		doc.APICalls = app.budget.calls()
+		doc.Degraded = app.budget.decisions()
+		doc.Unavailable = app.capabilities.unavailable()
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(doc); err != nil {
+			fmt.Fprintf(os.Stderr, "Result could not be written: %v\n", err)
+		}
+	case outputTAP:
+		writeTAP(os.Stdout, app.runs, app.annotations, code)
+	case outputDatadog:
+		app.sendMetrics()
+		if app.timing {
+			fmt.Printf("%s, %v\n", app.timer.breakdown(), app.budget)
+		}
+	case outputInflux:
+		if err := app.writeInfluxFile(); err != nil {
+			fmt.Fprintf(os.Stderr, "Influx file '%s' could not be written: %v\n", app.influxFile, err)
+		}
+		if app.timing {
+			fmt.Printf("%s, %v\n", app.timer.breakdown(), app.budget)
+		}
+	case outputGitHubSummary:
+		if path := os.Getenv(githubStepSummary); path == "" {
+			fmt.Fprintf(os.Stderr, "Workflow summary is not written, the environment variable %s is not set.\n", githubStepSummary)
+		} else if err := app.writeWorkflowSummary(path); err != nil {
+			fmt.Fprintf(os.Stderr, "Workflow summary '%s' could not be written: %v\n", path, err)
+		}
+		if app.timing {
+			fmt.Printf("%s, %v\n", app.timer.breakdown(), app.budget)
+		}
+	default:
+		if app.timing {
+			fmt.Printf("%s, %v\n", app.timer.breakdown(), app.budget)
+		}
+	}
+}
@@ -0,0 +1,395 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"math"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// paramSchema is the subset of JSON Schema, that is used to validate the
+// template parameters of a run. The schema describes the parameters as
+// object. Unknown keywords are ignored like in JSON Schema, references
+// are not supported.
+type paramSchema struct {
+	Type                 schemaTypes             `json:"type"`
+	Enum                 []interface{}           `json:"enum"`
+	Const                json.RawMessage         `json:"const"`
+	Properties           map[string]*paramSchema `json:"properties"`
+	Required             []string                `json:"required"`
+	AdditionalProperties *schemaOrBool           `json:"additionalProperties"`
+	Pattern              string                  `json:"pattern"`
+	MinLength            *int                    `json:"minLength"`
+	MaxLength            *int                    `json:"maxLength"`
+	Minimum              *float64                `json:"minimum"`
+	Maximum              *float64                `json:"maximum"`
+	ExclusiveMinimum     *float64                `json:"exclusiveMinimum"`
+	ExclusiveMaximum     *float64                `json:"exclusiveMaximum"`
+	Items                *paramSchema            `json:"items"`
+	MinItems             *int                    `json:"minItems"`
+	MaxItems             *int                    `json:"maxItems"`
+	AllOf                []*paramSchema          `json:"allOf"`
+	AnyOf                []*paramSchema          `json:"anyOf"`
+	OneOf                []*paramSchema          `json:"oneOf"`
+	Not                  *paramSchema            `json:"not"`
+	Ref                  string                  `json:"$ref"`
+
+	pattern *regexp.Regexp
+}
+
+// schemaTypes is the keyword 'type', that is a name or a list of names.
+type schemaTypes []string
+
+func (t *schemaTypes) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*t = schemaTypes{name}
+		return nil
+	}
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return fmt.Errorf("type must be a name or a list of names")
+	}
+	*t = names
+	return nil
+}
+
+// schemaOrBool is the keyword 'additionalProperties', that is a schema or
+// a boolean.
+type schemaOrBool struct {
+	allowed bool
+	schema  *paramSchema
+}
+
+func (s *schemaOrBool) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &s.allowed); err == nil {
+		return nil
+	}
+	s.allowed = true
+	return json.Unmarshal(data, &s.schema)
+}
+
+// loadParamSchema reads the JSON Schema file of the template parameters.
+func loadParamSchema(path string) (*paramSchema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	schema := &paramSchema{}
+	if err = json.Unmarshal(data, schema); err != nil {
+		return nil, err
+	}
+	if err = schema.compile("#"); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+// compile checks the schema and compiles its patterns.
+func (s *paramSchema) compile(path string) error {
+	if s.Ref != "" {
+		return fmt.Errorf("%s: '$ref' is not supported", path)
+	}
+	if s.Pattern != "" {
+		pattern, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("%s: pattern is not a valid regular expression: %v", path, err)
+		}
+		s.pattern = pattern
+	}
+	var children []*paramSchema
+	var paths []string
+	for name, child := range s.Properties {
+		children = append(children, child)
+		paths = append(paths, path+"/properties/"+name)
+	}
+	if s.AdditionalProperties != nil && s.AdditionalProperties.schema != nil {
+		children = append(children, s.AdditionalProperties.schema)
+		paths = append(paths, path+"/additionalProperties")
+	}
+	if s.Items != nil {
+		children = append(children, s.Items)
+		paths = append(paths, path+"/items")
+	}
+	if s.Not != nil {
+		children = append(children, s.Not)
+		paths = append(paths, path+"/not")
+	}
+	for keyword, list := range map[string][]*paramSchema{"allOf": s.AllOf, "anyOf": s.AnyOf, "oneOf": s.OneOf} {
+		for i, child := range list {
+			children = append(children, child)
+			paths = append(paths, fmt.Sprintf("%s/%s/%d", path, keyword, i))
+		}
+	}
+	for i, child := range children {
+		if child == nil {
+			continue
+		}
+		if err := child.compile(paths[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateParameters validates the parameters of the runs against the
+// schema of 'template-parameters-schema-file' before a run is started.
+// All violations are logged and the program ends with exit code 34.
+func (app *App) validateParameters(runs []*pipelineRun) {
+	if app.skipParamValidation {
+		log.Infof("Parameters are not validated against schema '%s'.", app.paramSchemaFile)
+		return
+	}
+	valid := true
+	for _, pr := range runs {
+		violations := app.paramSchema.validateParameters(app.runParameters(pr))
+		if len(violations) == 0 {
+			continue
+		}
+		valid = false
+		log.Errorf("Parameters of pipeline '%s' do not match schema '%s'.", pr.name, app.paramSchemaFile)
+		for _, violation := range violations {
+			log.Errorf("  %s", violation)
+		}
+	}
+	if !valid {
+		app.exit(34)
+	}
+}
+
+// validateParameters returns the violations of the parameters. The values
+// of the parameters are strings, they are converted to the types of their
+// schema before they are validated.
+func (s *paramSchema) validateParameters(parameters map[string]string) []string {
+	object := make(map[string]interface{}, len(parameters))
+	for name, value := range parameters {
+		object[name] = s.propertySchema(name).convert(value)
+	}
+	return s.validate("parameters", object)
+}
+
+// propertySchema returns the schema of the property or nil.
+func (s *paramSchema) propertySchema(name string) *paramSchema {
+	if child, ok := s.Properties[name]; ok {
+		return child
+	}
+	if s.AdditionalProperties != nil {
+		return s.AdditionalProperties.schema
+	}
+	return nil
+}
+
+// convert returns the value as the first type of the schema, that it can
+// be converted to. Strings are not converted, if the schema allows them.
+func (s *paramSchema) convert(value string) interface{} {
+	if s == nil || len(s.Type) == 0 || s.Type.contains("string") {
+		return value
+	}
+	for _, t := range s.Type {
+		switch t {
+		case "boolean":
+			if b, err := strconv.ParseBool(value); err == nil {
+				return b
+			}
+		case "integer", "number":
+			if f, err := strconv.ParseFloat(value, 64); err == nil {
+				return f
+			}
+		case "object", "array":
+			var v interface{}
+			if err := json.Unmarshal([]byte(value), &v); err == nil {
+				return v
+			}
+		case "null":
+			if value == "" || value == "null" {
+				return nil
+			}
+		}
+	}
+	return value
+}
+
+func (t schemaTypes) contains(name string) bool {
+	for _, n := range t {
+		if n == name || (n == "number" && name == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// validate returns the violations of the value at the path.
+func (s *paramSchema) validate(path string, value interface{}) []string {
+	if s == nil {
+		return nil
+	}
+	var violations []string
+	add := func(format string, args ...interface{}) {
+		violations = append(violations, path+": "+fmt.Sprintf(format, args...))
+	}
+	if len(s.Type) > 0 && !s.Type.contains(jsonType(value)) {
+		add("%s is not of type %s", describe(value), strings.Join(s.Type, " or "))
+		return violations
+	}
+	if s.Enum != nil && !containsValue(s.Enum, value) {
+		var allowed []string
+		for _, e := range s.Enum {
+			allowed = append(allowed, describe(e))
+		}
+		add("%s is not one of %s", describe(value), strings.Join(allowed, ", "))
+	}
+	if s.Const != nil {
+		var c interface{}
+		if err := json.Unmarshal(s.Const, &c); err == nil && !containsValue([]interface{}{c}, value) {
+			add("%s is not %s", describe(value), describe(c))
+		}
+	}
+	switch v := value.(type) {
+	case string:
+		length := utf8.RuneCountInString(v)
+		if s.MinLength != nil && length < *s.MinLength {
+			add("%s is shorter than %d characters", describe(v), *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			add("%s is longer than %d characters", describe(v), *s.MaxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			add("%s does not match pattern '%s'", describe(v), s.Pattern)
+		}
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			add("%v is less than %v", v, *s.Minimum)
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			add("%v is greater than %v", v, *s.Maximum)
+		}
+		if s.ExclusiveMinimum != nil && v <= *s.ExclusiveMinimum {
+			add("%v is not greater than %v", v, *s.ExclusiveMinimum)
+		}
+		if s.ExclusiveMaximum != nil && v >= *s.ExclusiveMaximum {
+			add("%v is not less than %v", v, *s.ExclusiveMaximum)
+		}
+	case []interface{}:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			add("has less than %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			add("has more than %d items", *s.MaxItems)
+		}
+		for i, item := range v {
+			violations = append(violations, s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item)...)
+		}
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				add("required property '%s' is missing", name)
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			child := path + "." + name
+			if property, ok := s.Properties[name]; ok {
+				violations = append(violations, property.validate(child, v[name])...)
+			} else if s.AdditionalProperties != nil && !s.AdditionalProperties.allowed {
+				violations = append(violations, child+": property is not allowed")
+			} else if s.AdditionalProperties != nil {
+				violations = append(violations, s.AdditionalProperties.schema.validate(child, v[name])...)
+			}
+		}
+	}
+	for _, child := range s.AllOf {
+		violations = append(violations, child.validate(path, value)...)
+	}
+	if len(s.AnyOf) > 0 && s.matches(s.AnyOf, value) == 0 {
+		add("%s matches none of the schemas of 'anyOf'", describe(value))
+	}
+	if len(s.OneOf) > 0 {
+		if n := s.matches(s.OneOf, value); n != 1 {
+			add("%s matches %d of the schemas of 'oneOf' instead of one", describe(value), n)
+		}
+	}
+	if s.Not != nil && len(s.Not.validate(path, value)) == 0 {
+		add("%s matches the schema of 'not'", describe(value))
+	}
+	return violations
+}
+
+// matches returns the number of schemas, that the value matches.
+func (s *paramSchema) matches(schemas []*paramSchema, value interface{}) int {
+	n := 0
+	for _, child := range schemas {
+		if len(child.validate("", value)) == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// jsonType returns the JSON Schema type of the value.
+func jsonType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+func containsValue(values []interface{}, value interface{}) bool {
+	for _, v := range values {
+		if reflect.DeepEqual(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// describe returns the value for a violation.
+func describe(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return "'" + s + "'"
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
@@ -0,0 +1,150 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// paramsFile is the content of the parameter file.
+type paramsFile struct {
+	// Parameters are the values of the pipeline parameters.
+	Parameters map[string]string `yaml:"parameters"`
+	// Secrets are the pipeline parameters, whose values are references
+	// to secrets of Azure Key Vault like 'akv://vault/name/version'.
+	Secrets map[string]string `yaml:"secrets"`
+}
+
+// secretParameters are the names of the parameters from the secrets of
+// the parameter file, their values are never shown.
+var secretParameters = make(map[string]bool)
+
+// secretReference is the reference of a secret of Azure Key Vault, the
+// version is optional.
+var secretReference = regexp.MustCompile(`^akv://([0-9a-zA-Z-]{3,24})/([0-9a-zA-Z-]{1,127})(?:/([0-9a-zA-Z]+))?$`)
+
+// parameterReference is a reference like '${base_url}' to another
+// parameter of the parameter file. '$${name}' is kept as '${name}'.
+var parameterReference = regexp.MustCompile(`\$?\$\{([0-9a-zA-Z_.-]+)\}`)
+
+func loadParamsFile(path string) (*paramsFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	file := &paramsFile{}
+	if err = yaml.Unmarshal(data, file); err != nil {
+		return nil, err
+	}
+	for _, name := range file.secretNames() {
+		if !secretReference.MatchString(file.Secrets[name]) {
+			return nil, fmt.Errorf("secret '%s' is not like 'akv://vault-name/secret-name/version'", name)
+		}
+		if _, ok := file.Parameters[name]; ok {
+			return nil, fmt.Errorf("parameter '%s' is a parameter and a secret", name)
+		}
+	}
+	return file, nil
+}
+
+// secretNames returns the sorted names of the secrets.
+func (f *paramsFile) secretNames() []string {
+	names := make([]string, 0, len(f.Secrets))
+	for name := range f.Secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// interpolate replaces the references to other parameters in the values
+// of the parameters. The parameters are resolved in topological order,
+// so that a referenced value is complete, before it is inserted. Cycles,
+// unknown parameters and references to secrets are errors, the values of
+// the secrets must not appear in other parameters.
+func (f *paramsFile) interpolate() error {
+	resolved := make(map[string]bool, len(f.Parameters))
+	var resolve func(name string, path []string) error
+	resolve = func(name string, path []string) error {
+		if resolved[name] {
+			return nil
+		}
+		for i, previous := range path {
+			if previous == name {
+				return fmt.Errorf("the references of parameter '%s' are a cycle: %s", name, strings.Join(append(path[i:], name), " -> "))
+			}
+		}
+		path = append(path, name)
+		var err error
+		value := parameterReference.ReplaceAllStringFunc(f.Parameters[name], func(reference string) string {
+			if strings.HasPrefix(reference, "$$") {
+				return reference[1:]
+			}
+			referenced := parameterReference.FindStringSubmatch(reference)[1]
+			if _, ok := f.Parameters[referenced]; !ok {
+				if err == nil {
+					if _, secret := f.Secrets[referenced]; secret {
+						err = fmt.Errorf("parameter '%s' references secret '%s'", name, referenced)
+					} else {
+						err = fmt.Errorf("parameter '%s' references unknown parameter '%s'", name, referenced)
+					}
+				}
+				return reference
+			}
+			if err == nil {
+				err = resolve(referenced, path)
+			}
+			return f.Parameters[referenced]
+		})
+		if err != nil {
+			return err
+		}
+		f.Parameters[name] = value
+		resolved[name] = true
+		return nil
+	}
+	names := make([]string, 0, len(f.Parameters))
+	for name := range f.Parameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := resolve(name, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// useParamsFile takes the parameters of the file. The secrets keep their
+// references, until they are resolved before the runs are started.
+func (app *App) useParamsFile(file *paramsFile) {
+	app.fileParameters = make(map[string]string, len(file.Parameters)+len(file.Secrets))
+	for name, value := range file.Parameters {
+		app.fileParameters[name] = value
+	}
+	for name, reference := range file.Secrets {
+		app.fileParameters[name] = reference
+		secretParameters[name] = true
+	}
+	app.paramsSecrets = file.Secrets
+}
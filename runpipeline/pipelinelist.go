@@ -0,0 +1,167 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/build"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/pipelines"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	pipelinePageSize = 100
+	// defaultPipelineExistsTimeout is the default maximum wait time for a
+	// pipeline, that does not exist yet.
+	defaultPipelineExistsTimeout = 5 * time.Minute
+	// pipelineExistsInterval is the wait time between the lookups of a
+	// pipeline, that does not exist yet.
+	pipelineExistsInterval = 10 * time.Second
+)
+
+// listPipelinesLocation is the location id of the pipelines list API.
+var listPipelinesLocation = uuid.MustParse("28e1305e-2afe-47bf-abaf-cbb0e6a91988")
+
+// findPipelines returns all pipelines with the name. The pipelines are
+// fetched page by page in name order, so that the search stops as soon
+// as a page has passed the name. If the server ignores the order, all
+// pages are fetched.
+func (app *App) findPipelines(ctx context.Context, prj *project, name string) ([]pipelines.Pipeline, error) {
+	var found []pipelines.Pipeline
+	target := strings.ToLower(name)
+	ordered := true
+	previous := ""
+	pages := 0
+	token := ""
+	for {
+		page, next, err := app.listPipelinesPage(ctx, prj, token)
+		if err != nil {
+			return nil, err
+		}
+		pages++
+		passed := false
+		for _, p := range page {
+			current := strings.ToLower(*p.Name)
+			if current < previous && ordered {
+				log.Debugf("Pipelines are not ordered by name, all pipelines are searched.")
+				ordered = false
+			}
+			previous = current
+			if *p.Name == name {
+				found = append(found, p)
+			} else if current > target {
+				passed = true
+			}
+		}
+		if next == "" || (ordered && passed) {
+			break
+		}
+		token = next
+	}
+	log.Debugf("%d page(s) of pipelines fetched to find pipeline '%s'.", pages, name)
+	return found, nil
+}
+
+// waitForPipeline looks up the pipeline until it exists or the timeout
+// of 'pipeline-exists-retry' expires, eg. if the pipeline is created by
+// the same deployment, that starts it. It returns the id of the pipeline
+// or -1, if it does not exist in time.
+func (app *App) waitForPipeline(ctx context.Context, prj *project, name string) int {
+	defer app.timer.begin("pipelineExists")()
+	deadline := time.Now().Add(app.pipelineExistsTimeout)
+	if !app.deadline.IsZero() && app.deadline.Before(deadline) {
+		deadline = app.deadline
+	}
+	log.Infof("Pipeline '%s' does not exist in project '%s' yet, it is looked up again until %s.", name, prj.name, deadline.Local().Format(time.RFC3339))
+	for attempt := 2; ; attempt++ {
+		wait := minDuration(pipelineExistsInterval, time.Until(deadline))
+		if wait <= 0 {
+			log.Warnf("Pipeline '%s' does not exist after %d lookups within %v.", name, attempt-1, app.pipelineExistsTimeout)
+			return -1
+		}
+		if !app.replay {
+			// the recorded responses are available immediately
+			select {
+			case <-ctx.Done():
+				return -1
+			case <-time.After(wait):
+			}
+		}
+		if id := app.getPipelineID(ctx, prj, name); id != -1 {
+			log.Infof("Pipeline '%s' exists after %d lookups.", name, attempt)
+			return id
+		}
+		log.Debugf("Pipeline '%s' does not exist yet (lookup %d).", name, attempt)
+	}
+}
+
+// listPipelinesPage fetches one page of pipelines ordered by name and
+// returns the continuation token of the next page.
+func (app *App) listPipelinesPage(ctx context.Context, prj *project, token string) ([]pipelines.Pipeline, string, error) {
+	client := prj.org.connection.GetClientByUrl(prj.org.connection.BaseUrl)
+	routeValues := map[string]string{"project": prj.name}
+	queryParams := url.Values{}
+	queryParams.Add("orderBy", "name asc")
+	queryParams.Add("$top", strconv.Itoa(pipelinePageSize))
+	if token != "" {
+		queryParams.Add("continuationToken", token)
+	}
+	if app.includeDisabled {
+		// servers, that filter disabled pipelines, list them as well
+		queryParams.Add("disabled", "true")
+	}
+	resp, err := client.Send(ctx, http.MethodGet, listPipelinesLocation, "6.0-preview.1", routeValues, queryParams, nil, "", "application/json", nil)
+	if err != nil {
+		return nil, "", err
+	}
+	var page []pipelines.Pipeline
+	if err = client.UnmarshalCollectionBody(resp, &page); err != nil {
+		return nil, "", err
+	}
+	return page, resp.Header.Get(azuredevops.HeaderKeyContinuationToken), nil
+}
+
+// warnIfDisabled logs a warning, if the queue of the pipeline is disabled
+// or paused, because the start of the run may fail or the run is not
+// started by Azure DevOps. It is only checked with
+// 'include-disabled-pipelines', so that no request is added otherwise.
+func (app *App) warnIfDisabled(ctx context.Context, pr *pipelineRun) {
+	if !app.includeDisabled {
+		return
+	}
+	definition, err := app.getDefinition(ctx, pr.prj, pr.pipelineID)
+	if err != nil {
+		log.Debugf("Queue status of pipeline '%s' could not be read: %v", pr.name, err)
+		return
+	}
+	if definition.QueueStatus == nil {
+		return
+	}
+	switch *definition.QueueStatus {
+	case build.DefinitionQueueStatusValues.Disabled:
+		log.Warnf("Pipeline '%s' is disabled, the start of the run may fail. Enable the pipeline in its settings.", pr.name)
+	case build.DefinitionQueueStatusValues.Paused:
+		log.Warnf("Pipeline '%s' is paused, the run is queued, but not started until the pipeline is enabled.", pr.name)
+	}
+}
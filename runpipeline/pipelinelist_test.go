@@ -0,0 +1,99 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// routePipelinePages serves the pipelines in the given order in pages
+// of the requested size, that are continued by the index of the next
+// pipeline as token. Like older servers, it ignores 'orderBy'.
+func routePipelinePages(f *fakeServer, names []string) {
+	f.route(locationPipelines, "{project}/_apis/pipelines/{pipelineId}", func(req *fakeRequest) (int, interface{}) {
+		query := req.URL.Query()
+		start, _ := strconv.Atoi(query.Get("continuationToken"))
+		top, _ := strconv.Atoi(query.Get("$top"))
+		end := start + top
+		if end >= len(names) {
+			end = len(names)
+		} else {
+			req.header.Set("X-MS-ContinuationToken", strconv.Itoa(end))
+		}
+		page := []interface{}{}
+		for i := start; i < end; i++ {
+			page = append(page, map[string]interface{}{"id": i + 1, "name": names[i], "folder": "\\"})
+		}
+		return http.StatusOK, map[string]interface{}{"count": len(page), "value": page}
+	})
+}
+
+func TestFindPipelines(t *testing.T) {
+	var ordered []string
+	for i := 0; i < 350; i++ {
+		ordered = append(ordered, fmt.Sprintf("pipeline-%03d", i))
+	}
+	// the same name in two folders
+	ordered = append(ordered, "pipeline-349")
+	reversed := append([]string(nil), ordered...)
+	sort.Sort(sort.Reverse(sort.StringSlice(reversed)))
+
+	tests := []struct {
+		name   string
+		names  []string
+		target string
+		found  int
+		pages  int
+	}{
+		{"first page", ordered, "pipeline-050", 1, 1},
+		{"third page", ordered, "pipeline-250", 1, 3},
+		{"case insensitive order", ordered, "Pipeline-050", 0, 1},
+		{"before the first", ordered, "build", 0, 1},
+		{"after the last", ordered, "release", 0, 4},
+		{"duplicate name", ordered, "pipeline-349", 2, 4},
+		{"order ignored", reversed, "pipeline-300", 1, 4},
+		{"order ignored and missing", reversed, "build", 0, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeServer(t)
+			routePipelinePages(f, tt.names)
+			app := &App{}
+
+			found, err := app.findPipelines(context.Background(), f.project(), tt.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(found) != tt.found {
+				t.Errorf("%d pipelines found, want %d", len(found), tt.found)
+			}
+			requested := f.requested()
+			if len(requested) != tt.pages {
+				t.Errorf("%d pages fetched, want %d: %v", len(requested), tt.pages, requested)
+			}
+			if len(requested) > 0 && !strings.Contains(requested[0], "orderBy=name+asc") {
+				t.Errorf("pipelines are not requested in name order: %s", requested[0])
+			}
+		})
+	}
+}
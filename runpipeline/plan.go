@@ -0,0 +1,384 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// planDocument is the plan of 'plan'. It is generated from the resolved
+// runs and the same parameters, that the execution uses.
+type planDocument struct {
+	SchemaVersion string `json:"schemaVersion"`
+	// OrgURL is the URL of the organization of the default project.
+	OrgURL    string         `json:"orgUrl"`
+	Pipelines []planPipeline `json:"pipelines"`
+	// Enrichment are the enabled optional features, that only read.
+	Enrichment []string     `json:"enrichment,omitempty"`
+	Actions    []planAction `json:"actions"`
+	// ExitCodes maps the results of the runs to the exit code.
+	ExitCodes map[string]int `json:"exitCodes"`
+	// BestEffort is true, if the exit code of the result is suppressed.
+	BestEffort bool `json:"bestEffort,omitempty"`
+}
+
+// planPipeline is a resolved pipeline.
+type planPipeline struct {
+	Org        string `json:"org"`
+	Project    string `json:"project"`
+	Pipeline   string `json:"pipeline"`
+	PipelineID int    `json:"pipelineId"`
+	Branch     string `json:"branch,omitempty"`
+	Revision   int    `json:"revision,omitempty"`
+	QueueID    int    `json:"queueId,omitempty"`
+	Classic    bool   `json:"classic,omitempty"`
+}
+
+// planAction is an action with side effects, that the program would take.
+type planAction struct {
+	Action   string `json:"action"`
+	Pipeline string `json:"pipeline,omitempty"`
+	// Target is the URL, the path or the command of the action.
+	Target string `json:"target,omitempty"`
+	Detail string `json:"detail,omitempty"`
+	// Payload is the body of the request, secrets are masked.
+	Payload interface{} `json:"payload,omitempty"`
+}
+
+// plan makes the read-only calls of the execution, eg. it resolves the
+// pipelines, the branches, the agent queues and the revisions and checks
+// the parameters, and writes the actions, that the execution would take,
+// instead of starting the runs. A failed check ends the program with its
+// exit code, otherwise the exit code is 0.
+func (app *App) plan(ctx context.Context, w io.Writer) {
+	if app.skipIfDeployed.template != nil {
+		app.skipDeployedRuns(ctx, app.runs)
+	}
+	app.resolveDefinitionKinds(ctx, app.runs)
+	if len(app.environmentOverrides) > 0 {
+		app.resolveEnvironmentOverrides(ctx, app.runs)
+	}
+	if app.pool != "" {
+		app.resolveQueues(ctx, app.runs)
+	}
+	if app.pipelineRevision != "" {
+		app.resolveRevisions(ctx, app.runs)
+	}
+	if app.paramSchema != nil {
+		app.validateParameters(app.runs)
+	}
+	for _, pr := range app.runs {
+		app.checkIgnoredParameters(ctx, pr)
+	}
+	doc, err := app.planDocument()
+	if err != nil {
+		fmt.Fprintf(w, "Plan could not be created: %v\n", err)
+		app.exit(5)
+	}
+	if app.output == outputJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(doc)
+	} else {
+		err = writePlan(w, doc)
+	}
+	if err != nil {
+		fmt.Fprintf(w, "Plan could not be written: %v\n", err)
+		app.exit(5)
+	}
+	app.exit(0)
+}
+
+// planDocument returns the plan of the resolved runs.
+func (app *App) planDocument() (*planDocument, error) {
+	doc := &planDocument{
+		SchemaVersion: outputSchemaVersion,
+		OrgURL:        app.organizationURL(app.org),
+		Pipelines:     []planPipeline{},
+		Actions:       []planAction{},
+		ExitCodes:     make(map[string]int, len(resultExitCodes)),
+		BestEffort:    app.bestEffort,
+	}
+	for result, code := range resultExitCodes {
+		doc.ExitCodes[string(result)] = code
+	}
+	doc.Enrichment = app.planEnrichment()
+	add := func(action string, pipeline string, target string, detail string) {
+		doc.Actions = append(doc.Actions, planAction{Action: action, Pipeline: pipeline, Target: target, Detail: detail})
+	}
+	if app.auditLogFile != "" {
+		add("writeFile", "", app.auditLogFile, "audit log of the API calls")
+	}
+	if app.listenAddr != "" {
+		add("listen", "", app.listenAddr, "status endpoint")
+	}
+	if app.livenessAddr != "" {
+		add("listen", "", app.livenessAddr, "liveness endpoint")
+	}
+	if app.statusFile != "" {
+		add("writeFile", "", app.statusFile, "status of the runs")
+	}
+	for _, pr := range app.runs {
+		doc.Pipelines = append(doc.Pipelines, planPipeline{
+			Org:        pr.prj.org.name,
+			Project:    pr.prj.name,
+			Pipeline:   pr.name,
+			PipelineID: pr.pipelineID,
+			Branch:     pr.branch,
+			Revision:   pr.revision,
+			QueueID:    pr.queueID,
+			Classic:    pr.classic,
+		})
+		if pr.info.Result == resultDeployed {
+			add("skip", pr.name, "", fmt.Sprintf("the version is already deployed to environment '%s'", app.skipIfDeployed.environment))
+			continue
+		}
+		if len(app.guard) > 0 {
+			add("confirm", pr.name, "", "confirmation of guarded pipelines on the console")
+		}
+		if app.lockBackend != nil {
+			add("lock", pr.name, app.lockKey(pr), fmt.Sprintf("held up to %v", app.lockTTL))
+		}
+		if app.cancelSuperseded {
+			add("cancel", pr.name, "", "runs of the pipeline on the branch, that are superseded")
+		}
+		if len(app.paramsFromLastRun) > 0 {
+			add("read", pr.name, "", fmt.Sprintf("the parameters %s from the output variables of the last successful run", app.paramsFromLastRun.String()))
+		}
+		trigger, err := app.planTrigger(pr)
+		if err != nil {
+			return nil, err
+		}
+		doc.Actions = append(doc.Actions, trigger)
+		if app.runNameTemplate.template != nil {
+			add("rename", pr.name, "", "run name "+app.runNameTemplate.text)
+		}
+		if app.annotationsAsTags && len(app.annotations) > 0 {
+			tags := make([]string, 0, len(app.annotations))
+			for _, key := range app.annotations.keys() {
+				tags = append(tags, key+"="+app.annotations[key])
+			}
+			add("tag", pr.name, "", strings.Join(tags, ", "))
+		}
+		if app.annotationsAsProperties && len(app.annotations) > 0 {
+			add("properties", pr.name, "", strings.Join(app.annotations.keys(), ", "))
+		}
+		if app.commitStatus != commitStatusOff {
+			add("commitStatus", pr.name, "", string(app.commitStatus))
+		}
+		if app.reportToPRCheck {
+			add("prCheck", pr.name, "", fmt.Sprintf("'%s' on pull request %d, pending before the start and the result at the end", app.pullRequestCheckName(pr), app.pullRequest.ID))
+		}
+		for _, override := range app.environmentOverrides {
+			add("cancel", pr.name, "", fmt.Sprintf("the run, if it deploys to environment '%s'", override.from))
+		}
+		if app.approve || app.reject {
+			verb := "approve"
+			if app.reject {
+				verb = "reject"
+			}
+			add(verb, pr.name, "", fmt.Sprintf("the pending approval of stage '%s'", app.approveStage))
+		}
+		if app.retryOnCancel > 0 {
+			add("trigger", pr.name, "", fmt.Sprintf("again up to %d times, if the run is canceled", app.retryOnCancel))
+		}
+		if app.timeout > 0 {
+			add("cancel", pr.name, "", fmt.Sprintf("the run after the timeout of %v", app.timeout))
+		}
+		if app.deleteIfNeverStarted {
+			add("delete", pr.name, "", "the run, if it never started when the program stops waiting")
+		}
+		if len(app.stageTimeouts) > 0 {
+			add("cancel", pr.name, "", fmt.Sprintf("the stages %s after their timeout", app.stageTimeouts.String()))
+		}
+		if app.buildTagTemplate.template != nil {
+			add("createTag", pr.name, app.buildTagTemplate.text, "on the built commit, if the run succeeded")
+		}
+		if app.cleanupOnSuccess {
+			add("delete", pr.name, "", "the run, if it succeeded")
+		}
+		if app.failureIssue {
+			add("createWorkItem", pr.name, "", "bug, if the run fails")
+		}
+		if app.downloadLogsDir != "" {
+			add("writeFile", pr.name, app.downloadLogsDir, "logs of the run")
+		}
+		if app.downloadArtifactsDir != "" {
+			add("writeFile", pr.name, app.downloadArtifactsDir, "artifacts of the run")
+		}
+		if app.telemetryEndpoint != "" {
+			add("post", pr.name, app.telemetryEndpoint, "telemetry of the run")
+		}
+	}
+	if app.captureFile != "" {
+		add("writeFile", "", app.captureFile, "output variables of the runs")
+	}
+	for _, hook := range []struct {
+		when     string
+		commands stringSlice
+	}{
+		{"on success", app.hooks.onSuccess},
+		{"on failure", app.hooks.onFailure},
+		{"on completion", app.hooks.onComplete},
+	} {
+		for _, command := range hook.commands {
+			add("execute", "", command, hook.when)
+		}
+	}
+	if app.envFile != "" {
+		add("writeFile", "", app.envFile, "run information")
+	}
+	if app.reportMdFile != "" {
+		add("writeFile", "", app.reportMdFile, "Markdown report of the runs")
+	}
+	if app.output == outputDatadog {
+		add("send", "", app.statsdAddr, "metrics of the runs")
+	}
+	if app.output == outputInflux {
+		add("writeFile", "", app.influxFile, "runs in the InfluxDB line protocol, appended")
+	}
+	if app.output == outputGitHubSummary {
+		add("writeFile", "", os.Getenv(githubStepSummary), "table of the runs for the GitHub Actions step summary, appended")
+	}
+	return doc, nil
+}
+
+// planTrigger returns the request, that starts the run.
+func (app *App) planTrigger(pr *pipelineRun) (planAction, error) {
+	action := planAction{Action: "trigger", Pipeline: pr.name}
+	args := app.runPipelineArgs(pr)
+	parameters := maskParameters(*args.RunParameters.TemplateParameters)
+	projectURL := app.organizationURL(pr.prj.org.name) + "/" + url.PathEscape(pr.prj.name)
+	if app.triggerAPI(pr) == triggerBuilds {
+		body, err := app.queueBuildRequest(pr, parameters)
+		if err != nil {
+			return action, err
+		}
+		action.Target = "POST " + projectURL + "/_apis/build/builds"
+		action.Payload = body
+		return action, nil
+	}
+	params := *args.RunParameters
+	params.TemplateParameters = &parameters
+	action.Target = "POST " + projectURL + "/_apis/pipelines/" + strconv.Itoa(pr.pipelineID) + "/runs"
+	action.Payload = params
+	return action, nil
+}
+
+// planEnrichment returns the enabled features, that only read.
+func (app *App) planEnrichment() []string {
+	var list []string
+	if !app.skipParamValidation {
+		list = append(list, "ignored parameters")
+	}
+	if len(app.stageSLOs) > 0 {
+		list = append(list, "stage durations")
+	}
+	if app.approveStage != "" && !app.approve && !app.reject {
+		list = append(list, "stage approval")
+	}
+	if app.waitForDeployment != "" || app.waitForEnvironment != "" {
+		list = append(list, "deployment")
+	}
+	if app.capturesRunVariables() {
+		list = append(list, "run variables")
+	}
+	if app.reportMdFile != "" {
+		list = append(list, "report details")
+	}
+	if app.tokenExpiryWarn > 0 {
+		list = append(list, "token expiry")
+	}
+	if app.enforceMinScopes {
+		list = append(list, "token scopes")
+	}
+	return list
+}
+
+// writePlan writes the plan as text.
+func writePlan(w io.Writer, doc *planDocument) error {
+	fmt.Fprintf(w, "Organization: %s\n", doc.OrgURL)
+	fmt.Fprintln(w, "Pipelines:")
+	for _, p := range doc.Pipelines {
+		line := fmt.Sprintf("  %s/%s/%s (id %d)", p.Org, p.Project, p.Pipeline, p.PipelineID)
+		if p.Branch != "" {
+			line += " on " + p.Branch
+		}
+		if p.Revision > 0 {
+			line += fmt.Sprintf(", revision %d", p.Revision)
+		}
+		if p.QueueID > 0 {
+			line += fmt.Sprintf(", queue %d", p.QueueID)
+		}
+		if p.Classic {
+			line += ", classic build definition"
+		}
+		fmt.Fprintln(w, line)
+	}
+	if len(doc.Enrichment) > 0 {
+		fmt.Fprintf(w, "Enrichment: %s\n", strings.Join(doc.Enrichment, ", "))
+	}
+	fmt.Fprintln(w, "Actions:")
+	for i, a := range doc.Actions {
+		line := fmt.Sprintf("  %d. %s", i+1, a.Action)
+		if a.Pipeline != "" {
+			line += " [" + a.Pipeline + "]"
+		}
+		if a.Target != "" {
+			line += " " + a.Target
+		}
+		if a.Detail != "" {
+			line += ": " + a.Detail
+		}
+		fmt.Fprintln(w, line)
+		if a.Payload != nil {
+			payload, err := json.Marshal(a.Payload)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "     %s\n", payload)
+		}
+	}
+	results := make([]string, 0, len(doc.ExitCodes))
+	for result := range doc.ExitCodes {
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if doc.ExitCodes[results[i]] != doc.ExitCodes[results[j]] {
+			return doc.ExitCodes[results[i]] < doc.ExitCodes[results[j]]
+		}
+		return results[i] < results[j]
+	})
+	codes := make([]string, 0, len(results))
+	for _, result := range results {
+		codes = append(codes, fmt.Sprintf("%s %d", result, doc.ExitCodes[result]))
+	}
+	fmt.Fprintf(w, "Exit codes: %s\n", strings.Join(codes, ", "))
+	if doc.BestEffort {
+		fmt.Fprintln(w, "The exit code of the result is suppressed by best-effort mode.")
+	}
+	_, err := fmt.Fprintln(w, "No run was started.")
+	return err
+}
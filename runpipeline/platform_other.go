@@ -0,0 +1,39 @@
+//go:build !windows
+
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"os"
+	"time"
+)
+
+// nativeLineEnding is the line ending of 'line-endings native'.
+const nativeLineEnding = "\n"
+
+// signalCleanupLimit returns the time, that the cleanup after the signal
+// may take, or zero, if it is not limited.
+func signalCleanupLimit(sig os.Signal) time.Duration {
+	return 0
+}
+
+// replaceExecutable replaces the executable with the new file. The rename
+// is atomic, the running program keeps its file.
+func replaceExecutable(exe string, file string) error {
+	return os.Rename(file, exe)
+}
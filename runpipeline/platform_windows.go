@@ -0,0 +1,60 @@
+//go:build windows
+
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// nativeLineEnding is the line ending of 'line-endings native'.
+const nativeLineEnding = "\r\n"
+
+// consoleCloseLimit is the time for the cleanup after the console window
+// is closed or the user logs off. Windows kills the process about five
+// seconds after the event, that Go delivers as SIGTERM.
+const consoleCloseLimit = 4 * time.Second
+
+// signalCleanupLimit returns the time, that the cleanup after the signal
+// may take, or zero, if it is not limited. CTRL_C and CTRL_BREAK are
+// delivered as os.Interrupt and are not limited.
+func signalCleanupLimit(sig os.Signal) time.Duration {
+	if sig == syscall.SIGTERM {
+		return consoleCloseLimit
+	}
+	return 0
+}
+
+// replaceExecutable replaces the executable with the new file. Windows
+// does not replace a running executable, but it can be renamed. The old
+// executable is moved aside to '.old' and removed with the next update.
+func replaceExecutable(exe string, file string) error {
+	old := exe + ".old"
+	os.Remove(old)
+	if err := os.Rename(exe, old); err != nil {
+		return err
+	}
+	if err := os.Rename(file, exe); err != nil {
+		// the old executable is restored
+		os.Rename(old, exe)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	defaultPollInterval = 10 * time.Second
+	// minPollInterval is the first interval of the exponential strategy
+	// and the shortest interval of the adaptive strategy.
+	minPollInterval = 2 * time.Second
+	// adaptiveHistory is the number of completed runs, whose average
+	// duration is the expected duration of a run.
+	adaptiveHistory = 5
+)
+
+// PollStrategy decides how long to wait before the next status check of
+// a run. A strategy is created for every run.
+type PollStrategy interface {
+	// Next returns the wait time after the poll with the number polls,
+	// elapsed is the time since the run was created.
+	Next(polls int, elapsed time.Duration) time.Duration
+}
+
+// pollStrategyName is the flag 'poll-strategy'.
+type pollStrategyName string
+
+const (
+	pollFixed       pollStrategyName = "fixed"
+	pollExponential pollStrategyName = "exponential"
+	pollAdaptive    pollStrategyName = "adaptive"
+)
+
+func (n *pollStrategyName) String() string {
+	return string(*n)
+}
+
+func (n *pollStrategyName) Set(value string) error {
+	switch pollStrategyName(value) {
+	case pollFixed, pollExponential, pollAdaptive:
+		*n = pollStrategyName(value)
+	default:
+		return fmt.Errorf("unknown poll strategy '%s', use 'fixed', 'exponential' or 'adaptive'", value)
+	}
+	return nil
+}
+
+// fixedPoll waits the poll interval after every poll.
+type fixedPoll struct {
+	interval time.Duration
+}
+
+func (p fixedPoll) Next(int, time.Duration) time.Duration {
+	return p.interval
+}
+
+// exponentialPoll starts with 2s and doubles the wait time after every
+// poll up to the poll interval.
+type exponentialPoll struct {
+	interval time.Duration
+}
+
+func (p exponentialPoll) Next(polls int, _ time.Duration) time.Duration {
+	wait := minPollInterval
+	for i := 1; i < polls && wait < p.interval; i++ {
+		wait *= 2
+	}
+	return minDuration(wait, p.interval)
+}
+
+// adaptivePoll polls more frequently, the closer the run is to its
+// expected end. The wait time is the half of the time to the expected
+// end, or since the expected end for overdue runs, between 2s and the
+// poll interval. Without expected duration the poll interval is used.
+type adaptivePoll struct {
+	interval time.Duration
+	expected time.Duration
+}
+
+func (p adaptivePoll) Next(_ int, elapsed time.Duration) time.Duration {
+	if p.expected <= 0 {
+		return p.interval
+	}
+	distance := p.expected - elapsed
+	if distance < 0 {
+		distance = -distance
+	}
+	wait := distance / 2
+	if wait < minPollInterval {
+		wait = minPollInterval
+	}
+	return minDuration(wait, p.interval)
+}
+
+// pollStrategy creates the poll strategy of 'poll-strategy' for the run.
+func (app *App) pollStrategy(ctx context.Context, pr *pipelineRun) PollStrategy {
+	switch app.pollStrategyName {
+	case pollExponential:
+		return exponentialPoll{interval: app.pollInterval}
+	case pollAdaptive:
+		return adaptivePoll{interval: app.pollInterval, expected: app.expectedDuration(ctx, pr)}
+	default:
+		return fixedPoll{interval: app.pollInterval}
+	}
+}
+
+// expectedDuration returns the average duration of the latest completed
+// runs of the pipeline or zero, if it is not known.
+func (app *App) expectedDuration(ctx context.Context, pr *pipelineRun) time.Duration {
+	filter := runFilter{states: []string{"completed"}, maxCount: adaptiveHistory + 1}
+	records, err := app.listRuns(ctx, pr.prj, pr.pipelineID, filter)
+	if err != nil {
+		pr.log.Debugf("Runs of pipeline '%s' could not be read, the poll interval is fixed: %v", pr.name, err)
+		return 0
+	}
+	var total time.Duration
+	n := 0
+	for _, r := range records {
+		if r.ID == pr.runID || r.Created.IsZero() || r.Finished.Before(r.Created) || n == adaptiveHistory {
+			continue
+		}
+		total += r.Finished.Sub(r.Created)
+		n++
+	}
+	if n == 0 {
+		pr.log.Debugf("Pipeline '%s' has no completed run, the poll interval is fixed.", pr.name)
+		return 0
+	}
+	expected := total / time.Duration(n)
+	pr.log.Debugf("Run %d of pipeline '%s' is expected to take %v.", pr.runID, pr.name, expected.Round(time.Second))
+	return expected
+}
+
+// maxPollCountReached ends the program with exit code 13, because the run
+// is still not completed after 'max-poll-count' status checks. The URL
+// is logged, so that the run can be checked manually.
+func (app *App) maxPollCountReached(pr *pipelineRun) {
+	pr.log.Errorf("Run %d of pipeline '%s' is still in state '%s' after %d status checks, the program stops waiting (URL: %s).", pr.runID, pr.name, pr.info.State, app.maxPollCount, pr.info.URL)
+	pr.exitCode = 13
+	app.exit(13)
+}
@@ -0,0 +1,281 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/build"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/pipelinepermissions"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/pipelines"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/taskagent"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// buildsLocation is the location of the builds. The build is queued
+// without the SDK, because its model of the build has no template
+// parameters.
+var buildsLocation = uuid.MustParse("0cd358e1-9217-4d94-8269-1c1ee6f93dcf")
+
+// queueBuildBody is the build with the parameters of the pipeline.
+type queueBuildBody struct {
+	build.Build
+	TemplateParameters map[string]string `json:"templateParameters,omitempty"`
+}
+
+// demandExpression is a demand of the agent, eg. 'Agent.OS -equals
+// Windows_NT' or 'docker' for an existing capability.
+var demandExpression = regexp.MustCompile(`^[^\s]+( -(equals|gtVersion) \S.*)?$`)
+
+// demands is the flag 'demand'.
+type demands []string
+
+func (d *demands) String() string {
+	return strings.Join(*d, ", ")
+}
+
+func (d *demands) Set(value string) error {
+	value = strings.TrimSpace(value)
+	if !demandExpression.MatchString(value) {
+		return fmt.Errorf("demand '%s' is not like 'name', 'name -equals value' or 'name -gtVersion value'", value)
+	}
+	*d = append(*d, value)
+	return nil
+}
+
+// queueBuilds is true, if the runs are queued with the builds API, that
+// takes the agent pool and the demands. The pipelines API has no
+// parameters for them.
+func (app *App) queueBuilds() bool {
+	return app.pool != "" || len(app.demands) > 0
+}
+
+// checkQueueTemplate ends the program, if the run template has run
+// parameters, that the builds API does not take.
+func (app *App) checkQueueTemplate() {
+	if unsupported := app.unsupportedTemplateField(); unsupported != "" {
+		fmt.Fprintf(os.Stderr, "Parameters 'pool' and 'demand' can not be combined with '%s' of the run template.\n", unsupported)
+		flag.CommandLine.Usage()
+		app.exit(8)
+	}
+}
+
+// unsupportedTemplateField returns the first run parameter of the run
+// template, that the builds API does not take, or an empty string.
+func (app *App) unsupportedTemplateField() string {
+	if app.runTemplate == nil {
+		return ""
+	}
+	unsupported := ""
+	switch {
+	case app.runTemplate.StagesToSkip != nil && len(*app.runTemplate.StagesToSkip) > 0:
+		unsupported = "stagesToSkip"
+	case app.runTemplate.YamlOverride != nil && *app.runTemplate.YamlOverride != "":
+		unsupported = "yamlOverride"
+	case app.runTemplate.Resources != nil && (app.runTemplate.Resources.Builds != nil || app.runTemplate.Resources.Containers != nil ||
+		app.runTemplate.Resources.Packages != nil || app.runTemplate.Resources.Pipelines != nil):
+		unsupported = "resources"
+	case app.runTemplate.Resources != nil && app.runTemplate.Resources.Repositories != nil:
+		for name := range *app.runTemplate.Resources.Repositories {
+			if name != "self" {
+				unsupported = "resources"
+			}
+		}
+	}
+	return unsupported
+}
+
+// resolveQueues looks up the agent queue of 'pool' in the project of
+// every run. The program ends with exit code 35, if the pool does not
+// exist in the project or is not authorized for the pipeline.
+func (app *App) resolveQueues(ctx context.Context, runs []*pipelineRun) {
+	defer app.timer.begin("pool")()
+	queues := make(map[*project]int)
+	for _, pr := range runs {
+		id := 0
+		for prj, queueID := range queues {
+			if prj.org == pr.prj.org && prj.name == pr.prj.name {
+				id = queueID
+			}
+		}
+		if id == 0 {
+			id = app.queueID(ctx, pr.prj)
+			queues[pr.prj] = id
+		}
+		app.checkQueueAuthorized(ctx, pr, id)
+		pr.queueID = id
+	}
+}
+
+// queueID returns the id of the agent queue of 'pool' in the project.
+func (app *App) queueID(ctx context.Context, prj *project) int {
+	client, err := prj.org.taskAgentClient(ctx)
+	var queues *[]taskagent.TaskAgentQueue
+	if err == nil {
+		args := &taskagent.GetAgentQueuesArgs{
+			Project:   &prj.name,
+			QueueName: &app.pool,
+		}
+		queues, err = client.GetAgentQueues(ctx, *args)
+	}
+	if err != nil {
+		log.Errorf("Agent pools of project '%s' could not be read: %v", prj.name, err)
+		app.exit(35)
+	}
+	for _, queue := range *queues {
+		if queue.Id != nil && queue.Name != nil && strings.EqualFold(*queue.Name, app.pool) {
+			log.Debugf("Agent pool '%s' has queue id %d in project '%s'.", app.pool, *queue.Id, prj.name)
+			return *queue.Id
+		}
+	}
+	log.Errorf("Agent pool '%s' does not exist in project '%s' or the token may not use it.", app.pool, prj.name)
+	app.exit(35)
+	return 0
+}
+
+// checkQueueAuthorized ends the program, if the queue is not authorized
+// for the pipeline. If the permissions can not be read, the run is
+// queued and Azure DevOps decides.
+func (app *App) checkQueueAuthorized(ctx context.Context, pr *pipelineRun, queueID int) {
+	client, err := pipelinepermissions.NewClient(ctx, pr.prj.org.connection)
+	if err != nil {
+		log.Warnf("Permissions of agent pool '%s' could not be read: %v", app.pool, err)
+		return
+	}
+	resourceType := "queue"
+	resourceID := strconv.Itoa(queueID)
+	args := &pipelinepermissions.GetPipelinePermissionsForResourceArgs{
+		Project:      &pr.prj.name,
+		ResourceType: &resourceType,
+		ResourceId:   &resourceID,
+	}
+	permissions, err := client.GetPipelinePermissionsForResource(ctx, *args)
+	if err != nil {
+		log.Warnf("Permissions of agent pool '%s' could not be read: %v", app.pool, err)
+		return
+	}
+	if permissions.AllPipelines != nil && permissions.AllPipelines.Authorized != nil && *permissions.AllPipelines.Authorized {
+		return
+	}
+	if permissions.Pipelines != nil {
+		for _, p := range *permissions.Pipelines {
+			if p.Id != nil && *p.Id == pr.pipelineID && p.Authorized != nil && *p.Authorized {
+				return
+			}
+		}
+	}
+	log.Errorf("Agent pool '%s' is not authorized for pipeline '%s'. Authorize it in the security settings of the pool.", app.pool, pr.name)
+	app.exit(35)
+}
+
+// queueBuildRequest returns the build, that queues the run with the
+// builds API on the agent queue of the run and with the demands. Classic
+// build definitions get the variables only.
+func (app *App) queueBuildRequest(pr *pipelineRun, parameters map[string]string) (queueBuildBody, error) {
+	body := queueBuildBody{
+		Build: build.Build{
+			Definition: &build.DefinitionReference{Id: &pr.pipelineID},
+		},
+	}
+	if !pr.classic {
+		body.TemplateParameters = parameters
+	}
+	if pr.branch != "" {
+		branch := branchRef(pr.branch)
+		body.SourceBranch = &branch
+	}
+	if pr.revision > 0 {
+		body.Definition.Revision = &pr.revision
+	}
+	if pr.queueID > 0 {
+		body.Queue = &build.AgentPoolQueue{Id: &pr.queueID}
+	}
+	if len(app.demands) > 0 {
+		list := make([]interface{}, 0, len(app.demands))
+		for _, demand := range app.demands {
+			list = append(list, demand)
+		}
+		body.Demands = &list
+	}
+	if variables := app.queueVariables(); len(variables) > 0 {
+		encoded, err := json.Marshal(variables)
+		if err != nil {
+			return body, err
+		}
+		text := string(encoded)
+		body.Parameters = &text
+	}
+	return body, nil
+}
+
+// queueVariables returns the variables of the run template and of 'var',
+// that overrides them.
+func (app *App) queueVariables() map[string]string {
+	variables := make(map[string]string)
+	if app.runTemplate != nil && app.runTemplate.Variables != nil {
+		for name, variable := range *app.runTemplate.Variables {
+			if variable.Value != nil {
+				variables[name] = *variable.Value
+			}
+		}
+	}
+	for name, value := range app.variables {
+		variables[name] = value
+	}
+	return variables
+}
+
+// queueBuild queues the run with the builds API. The returned build is
+// converted to a run of the pipelines API, that the run is watched with.
+func (app *App) queueBuild(ctx context.Context, pr *pipelineRun, parameters map[string]string) (*pipelines.Run, error) {
+	body, err := app.queueBuildRequest(pr, parameters)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	connection := pr.prj.org.connection
+	client := azuredevops.NewClient(connection, connection.BaseUrl)
+	routeValues := map[string]string{
+		"project": pr.prj.name,
+	}
+	resp, err := client.Send(ctx, http.MethodPost, buildsLocation, "6.0", routeValues, nil, bytes.NewReader(encoded), "application/json", "application/json", nil)
+	if err != nil {
+		return nil, err
+	}
+	var queued build.Build
+	if err = client.UnmarshalBody(resp, &queued); err != nil {
+		return nil, err
+	}
+	if queued.Id == nil {
+		return nil, fmt.Errorf("the response contains no build")
+	}
+	return buildRun(&queued), nil
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"fmt"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/git"
+	log "github.com/sirupsen/logrus"
+)
+
+// pullRequestCheckName returns the name of the status of the run on the
+// pull request of 'report-to-pr-check'. With several runs the name of
+// 'pr-check-name' is followed by the pipeline, so that every run has its
+// own check.
+func (app *App) pullRequestCheckName(pr *pipelineRun) string {
+	switch {
+	case app.prCheckName == "":
+		return pr.name
+	case len(app.runs) > 1:
+		return app.prCheckName + "/" + pr.name
+	default:
+		return app.prCheckName
+	}
+}
+
+// postPullRequestCheck posts the state of the run as status to the pull
+// request of 'pr'. A later status with the same name replaces the
+// earlier one in the checks of the pull request. Failures are only
+// logged as warnings, the exit code is not changed.
+func (app *App) postPullRequestCheck(ctx context.Context, pr *pipelineRun, state git.GitStatusState, description string) {
+	client, err := pr.prj.org.gitClient(ctx)
+	if err != nil {
+		log.Warnf("Check '%s' could not be posted to pull request %d: %v", app.pullRequestCheckName(pr), app.pullRequest.ID, err)
+		return
+	}
+	genre := commitStatusGenre
+	name := app.pullRequestCheckName(pr)
+	status := &git.GitPullRequestStatus{
+		Context: &git.GitStatusContext{
+			Genre: &genre,
+			Name:  &name,
+		},
+		Description: &description,
+		State:       &state,
+	}
+	if pr.info.URL != "" {
+		targetURL := pr.info.URL
+		status.TargetUrl = &targetURL
+	}
+	args := &git.CreatePullRequestStatusArgs{
+		Status:        status,
+		RepositoryId:  &app.pullRequest.RepositoryID,
+		PullRequestId: &app.pullRequest.ID,
+		Project:       &app.prj,
+	}
+	if _, err = client.CreatePullRequestStatus(ctx, *args); err != nil {
+		log.Warnf("Check '%s' could not be posted to pull request %d: %v", name, app.pullRequest.ID, err)
+		return
+	}
+	pr.prCheckPending = state == git.GitStatusStateValues.Pending
+	log.Infof("Check '%s' with state '%s' posted to pull request %d.", name, state, app.pullRequest.ID)
+}
+
+// abandonPullRequestChecks replaces the pending checks of the runs, that
+// did not finish, with an error, when the program ends, so that the pull
+// request is not blocked by a check, that is never completed.
+func (app *App) abandonPullRequestChecks(ctx context.Context) {
+	if !app.reportToPRCheck {
+		return
+	}
+	for _, pr := range app.runs {
+		if pr.prCheckPending {
+			description := fmt.Sprintf("Pipeline '%s' could not be started", pr.name)
+			if pr.runID > 0 {
+				description = fmt.Sprintf("Run %s was not watched to the end", pr.info.BuildNumber)
+			}
+			app.postPullRequestCheck(ctx, pr, git.GitStatusStateValues.Error, description)
+		}
+	}
+}
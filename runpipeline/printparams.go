@@ -0,0 +1,178 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// printParameters prints the parameters declared by the pipelines as
+// table or with '-output json' as JSON Schema per pipeline and ends.
+func (app *App) printParameters(ctx context.Context, w io.Writer) {
+	for i, pr := range app.runs {
+		declared, err := app.getPipelineParameters(ctx, pr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Parameters of pipeline '%s' could not be read: %v\n", pr.name, err)
+			app.exit(1)
+		}
+		if app.output == outputJSON {
+			encoder := json.NewEncoder(w)
+			encoder.SetIndent("", "  ")
+			err = encoder.Encode(parametersSchema(pr, declared))
+		} else {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			err = writeParameters(w, pr, declared)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Parameters of pipeline '%s' could not be written: %v\n", pr.name, err)
+			app.exit(5)
+		}
+	}
+	app.exit(0)
+}
+
+func writeParameters(out io.Writer, pr *pipelineRun, declared []pipelineParameter) error {
+	fmt.Fprintf(out, "Pipeline '%s' (id %d) on %s:\n", pr.name, pr.pipelineID, branchRef(pr.branch))
+	if len(declared) == 0 {
+		fmt.Fprintln(out, "  no parameters")
+		return nil
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Name\tType\tDefault\tDescription\tRequired\tAllowed values")
+	for _, p := range declared {
+		required := "no"
+		if p.required() {
+			required = "yes"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", p.Name, p.typeName(), orDash(p.defaultText()), orDash(p.DisplayName), required, orDash(strings.Join(p.allowedValues(), ", ")))
+	}
+	return w.Flush()
+}
+
+func orDash(text string) string {
+	if text == "" {
+		return "-"
+	}
+	return text
+}
+
+// defaultText returns the default value in one line, structures are
+// written in the flow style of YAML.
+func (p pipelineParameter) defaultText() string {
+	if p.required() {
+		return ""
+	}
+	if value, ok := p.defaultValue(); ok {
+		return value
+	}
+	node := p.Default
+	node.Style = yaml.FlowStyle
+	data, err := yaml.Marshal(&node)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// parametersSchema returns the JSON Schema of the parameters, that can be
+// used as 'template-parameters-schema-file'.
+func parametersSchema(pr *pipelineRun, declared []pipelineParameter) map[string]interface{} {
+	properties := make(map[string]interface{}, len(declared))
+	required := []string{}
+	for _, p := range declared {
+		property := make(map[string]interface{})
+		if t := p.schemaType(); t != "" {
+			property["type"] = t
+		}
+		if p.DisplayName != "" {
+			property["description"] = p.DisplayName
+		}
+		if !p.required() {
+			if value, ok := p.schemaDefault(); ok {
+				property["default"] = value
+			}
+		} else {
+			required = append(required, p.Name)
+		}
+		if len(p.Values) > 0 {
+			enum := make([]interface{}, len(p.Values))
+			for i, value := range p.Values {
+				enum[i] = p.schemaValue(value)
+			}
+			property["enum"] = enum
+		}
+		properties[p.Name] = property
+	}
+	return map[string]interface{}{
+		"$schema":              "https://json-schema.org/draft/2020-12/schema",
+		"title":                fmt.Sprintf("Parameters of pipeline '%s'", pr.name),
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
+
+// schemaType maps the type of the parameter to a JSON type. Parameters of
+// type object may contain any YAML value.
+func (p pipelineParameter) schemaType() string {
+	switch t := p.typeName(); t {
+	case "string", "number", "boolean":
+		return t
+	case "step", "job", "deployment", "stage":
+		return "object"
+	case "stepList", "jobList", "deploymentList", "stageList":
+		return "array"
+	}
+	return ""
+}
+
+// schemaValue converts a value of a number or boolean parameter.
+func (p pipelineParameter) schemaValue(value string) interface{} {
+	switch p.typeName() {
+	case "number":
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return value
+}
+
+func (p pipelineParameter) schemaDefault() (interface{}, bool) {
+	if value, ok := p.defaultValue(); ok {
+		return p.schemaValue(value), true
+	}
+	var value interface{}
+	if err := p.Default.Decode(&value); err != nil {
+		return nil, false
+	}
+	return value, true
+}
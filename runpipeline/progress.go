@@ -0,0 +1,94 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// startProgress prints a summary of the runs of a batch every interval
+// of 'summary-interval' until the returned function is called. The
+// states are read from the snapshots of the status server, so that the
+// runs, that are changed by the watchers, are never read.
+func (app *App) startProgress(runs []*pipelineRun) func() {
+	if app.summaryInterval <= 0 || len(runs) < 2 {
+		return func() {}
+	}
+	// the summary is written to stderr, if stdout is a JSON document
+	var w io.Writer = os.Stdout
+	if !app.output.console() {
+		w = os.Stderr
+	}
+	ticker := time.NewTicker(app.summaryInterval)
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-ticker.C:
+				app.statusServer.printProgress(w)
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(stop)
+		<-stopped
+	}
+}
+
+// printProgress prints the completed runs with their result, the runs,
+// that are still running, and the pipelines, that are not started yet.
+func (s *statusServer) printProgress(w io.Writer) {
+	s.lock.Lock()
+	doc := s.document()
+	elapsed := time.Since(s.started).Round(time.Second)
+	s.lock.Unlock()
+
+	completed, running := 0, 0
+	for _, rs := range doc.Runs {
+		switch {
+		case rs.Result != "":
+			completed++
+		case rs.RunID > 0:
+			running++
+		}
+	}
+	fmt.Fprintf(w, "Progress after %s: %d completed, %d running, %d not started\n", elapsed, completed, running, len(doc.Runs)-completed-running)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Pipeline\tRun id\tStatus\tElapsed")
+	for _, rs := range doc.Runs {
+		switch {
+		case rs.Result == resultSkipped:
+			fmt.Fprintf(tw, "%s\t\t%s\t\n", rs.Pipeline, rs.Result)
+		case rs.Result != "":
+			fmt.Fprintf(tw, "%s\t%d\t%s\t\n", rs.Pipeline, rs.RunID, rs.Result)
+		case rs.RunID > 0:
+			fmt.Fprintf(tw, "%s\t%d\trunning\t%s\n", rs.Pipeline, rs.RunID, time.Since(rs.triggered).Round(time.Second))
+		default:
+			fmt.Fprintf(tw, "%s\t\tnot started\t\n", rs.Pipeline)
+		}
+	}
+	tw.Flush()
+}
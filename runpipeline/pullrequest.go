@@ -0,0 +1,98 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"fmt"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/git"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"strconv"
+)
+
+// pullRequestInfo describes the pull request given with 'pr'.
+type pullRequestInfo struct {
+	ID           int
+	Title        string
+	SourceBranch string
+	TargetBranch string
+	// RepositoryID is the repository of the pull request, that receives
+	// the checks of 'report-to-pr-check'
+	RepositoryID string
+}
+
+// envVars returns the pull request information as variables.
+func (pri *pullRequestInfo) envVars() []envVar {
+	return []envVar{
+		{"PR_ID", strconv.Itoa(pri.ID)},
+		{"PR_TITLE", pri.Title},
+		{"PR_SOURCE_BRANCH", pri.SourceBranch},
+		{"PR_TARGET_BRANCH", pri.TargetBranch},
+	}
+}
+
+// resolvePullRequest sets the branch of the run to the merge ref of the
+// pull request. If the merge ref does not exist yet, the source branch
+// of the pull request is used.
+func (app *App) resolvePullRequest(ctx context.Context) {
+	client, err := app.defaultProject.org.gitClient(ctx)
+	if err != nil {
+		log.Fatal("Error occurred during creation of git client. ", err)
+		os.Exit(1)
+	}
+	args := &git.GetPullRequestByIdArgs{
+		PullRequestId: &app.pullRequest.ID,
+		Project:       &app.prj,
+	}
+	pr, err := client.GetPullRequestById(ctx, *args)
+	if err != nil {
+		log.Fatalf("Pull request %d could not be read. %v", app.pullRequest.ID, err)
+		os.Exit(1)
+	}
+
+	app.pullRequest.Title = *pr.Title
+	app.pullRequest.SourceBranch = *pr.SourceRefName
+	app.pullRequest.TargetBranch = *pr.TargetRefName
+	app.pullRequest.RepositoryID = pr.Repository.Id.String()
+	log.Infof("Pull request %d '%s' merges '%s' into '%s'.", app.pullRequest.ID, app.pullRequest.Title, app.pullRequest.SourceBranch, app.pullRequest.TargetBranch)
+
+	if *pr.Status != git.PullRequestStatusValues.Active {
+		log.Errorf("Pull request %d is %s.", app.pullRequest.ID, *pr.Status)
+		app.exit(22)
+	}
+
+	mergeRef := fmt.Sprintf("refs/pull/%d/merge", app.pullRequest.ID)
+	filter := mergeRef[len("refs/"):]
+	repositoryID := pr.Repository.Id.String()
+	refsArgs := &git.GetRefsArgs{
+		RepositoryId: &repositoryID,
+		Project:      &app.prj,
+		Filter:       &filter,
+	}
+	refs, err := client.GetRefs(ctx, *refsArgs)
+	if err == nil {
+		for _, ref := range refs.Value {
+			if *ref.Name == mergeRef {
+				app.branch = mergeRef
+				return
+			}
+		}
+	}
+	log.Warnf("Merge ref '%s' does not exist. Branch '%s' is used.", mergeRef, app.pullRequest.SourceBranch)
+	app.branch = app.pullRequest.SourceBranch
+}
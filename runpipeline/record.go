@@ -0,0 +1,244 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// recordedHeaders are the response headers, that are recorded.
+var recordedHeaders = []string{"Content-Type", "Retry-After", "X-MS-ContinuationToken"}
+
+// exchange is a recorded API request and its response. The URL is
+// recorded without scheme and host, so that it can be replayed with
+// every base URL.
+type exchange struct {
+	Method       string            `json:"method"`
+	URL          string            `json:"url"`
+	RequestBody  string            `json:"requestBody,omitempty"`
+	Status       int               `json:"status"`
+	Headers      map[string]string `json:"headers,omitempty"`
+	ResponseBody string            `json:"responseBody"`
+}
+
+// recordTransport writes every exchange as numbered JSON file to a
+// directory or, without directory, keeps it in memory. The token is never
+// recorded.
+type recordTransport struct {
+	lock      sync.Mutex
+	next      http.RoundTripper
+	dir       string
+	token     string
+	count     int
+	exchanges []exchange
+}
+
+func (t *recordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	requestBody, err := readBody(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	responseBody, err := readBody(&resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	e := exchange{
+		Method:       req.Method,
+		URL:          t.sanitize(req.URL.RequestURI()),
+		RequestBody:  t.sanitize(requestBody),
+		Status:       resp.StatusCode,
+		Headers:      make(map[string]string),
+		ResponseBody: t.sanitize(responseBody),
+	}
+	for _, name := range recordedHeaders {
+		if value := resp.Header.Get(name); value != "" {
+			e.Headers[name] = value
+		}
+	}
+	return resp, t.write(e)
+}
+
+func (t *recordTransport) sanitize(value string) string {
+	if t.token == "" {
+		return value
+	}
+	return strings.ReplaceAll(value, t.token, "***")
+}
+
+func (t *recordTransport) write(e exchange) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.dir == "" {
+		t.exchanges = append(t.exchanges, e)
+		return nil
+	}
+	t.count++
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(t.dir, fmt.Sprintf("%04d.json", t.count)), data, 0644)
+}
+
+// recorded returns a copy of the exchanges, that are kept in memory.
+func (t *recordTransport) recorded() []exchange {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return append([]exchange(nil), t.exchanges...)
+}
+
+// readBody reads the body and replaces it with a reader of its content.
+func readBody(body *io.ReadCloser) (string, error) {
+	if *body == nil || *body == http.NoBody {
+		return "", nil
+	}
+	data, err := io.ReadAll(*body)
+	(*body).Close()
+	if err != nil {
+		return "", err
+	}
+	*body = io.NopCloser(bytes.NewReader(data))
+	return string(data), nil
+}
+
+// replayTransport answers the requests with recorded exchanges. Every
+// exchange is used once, the first unused exchange with the same method,
+// URL and body matches. A request without exchange ends the program.
+type replayTransport struct {
+	lock      sync.Mutex
+	exchanges []exchange
+	used      []bool
+	mismatch  func(message string)
+}
+
+func loadExchanges(dir string) ([]exchange, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no recorded exchanges in '%s'", dir)
+	}
+	sort.Strings(files)
+	exchanges := make([]exchange, 0, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var e exchange
+		if err = json.Unmarshal(data, &e); err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		exchanges = append(exchanges, e)
+	}
+	return exchanges, nil
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	requestBody, err := readBody(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+	actual := exchange{Method: req.Method, URL: req.URL.RequestURI(), RequestBody: requestBody}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	next := -1
+	for i, e := range t.exchanges {
+		if t.used[i] {
+			continue
+		}
+		if next == -1 || (e.Method == actual.Method && e.URL == actual.URL && t.exchanges[next].URL != actual.URL) {
+			// the diff shows the exchange of the same request, eg. with
+			// another body, or the next exchange
+			next = i
+		}
+		if e.Method == actual.Method && e.URL == actual.URL && sameBody(e.RequestBody, actual.RequestBody) {
+			t.used[i] = true
+			return replayResponse(req, e), nil
+		}
+	}
+	if next == -1 {
+		t.mismatch("Request is not recorded, all recorded exchanges are used:\n" + describeRequest("+ ", actual))
+	} else {
+		t.mismatch("Request does not match the recorded exchange:\n" + describeRequest("- ", t.exchanges[next]) + describeRequest("+ ", actual))
+	}
+	return nil, fmt.Errorf("request %s %s is not recorded", actual.Method, actual.URL)
+}
+
+// replayMismatch ends the program, if a request is not recorded. During
+// the exit sequence only the failed request is reported.
+func (app *App) replayMismatch(message string) {
+	fmt.Fprint(os.Stderr, message)
+	if !app.exiting.Load() {
+		app.exit(27)
+	}
+}
+
+func replayResponse(req *http.Request, e exchange) *http.Response {
+	header := make(http.Header)
+	for name, value := range e.Headers {
+		header.Set(name, value)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.Status, http.StatusText(e.Status)),
+		StatusCode:    e.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(e.ResponseBody)),
+		ContentLength: int64(len(e.ResponseBody)),
+		Request:       req,
+	}
+}
+
+// sameBody compares JSON bodies independent of formatting.
+func sameBody(recorded string, actual string) bool {
+	if recorded == actual {
+		return true
+	}
+	var r, a interface{}
+	if json.Unmarshal([]byte(recorded), &r) != nil || json.Unmarshal([]byte(actual), &a) != nil {
+		return false
+	}
+	rj, _ := json.Marshal(r)
+	aj, _ := json.Marshal(a)
+	return bytes.Equal(rj, aj)
+}
+
+func describeRequest(prefix string, e exchange) string {
+	s := prefix + e.Method + " " + e.URL + "\n"
+	if e.RequestBody != "" {
+		s += prefix + e.RequestBody + "\n"
+	}
+	return s
+}
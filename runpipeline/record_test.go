@@ -0,0 +1,200 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// locationDefinitions is the location id of the build definitions.
+const locationDefinitions = "dbeaf647-6167-421a-bda9-c9327b25e2e6"
+
+// routeRunFlow serves the pipeline 'build' with id 7, that is started
+// as run 1234 and is completed with the second status check.
+func routeRunFlow(f *fakeServer) {
+	f.route(locationPipelines, "{project}/_apis/pipelines/{pipelineId}", func(req *fakeRequest) (int, interface{}) {
+		return http.StatusOK, map[string]interface{}{"count": 1, "value": []interface{}{
+			map[string]interface{}{"id": 7, "name": "build", "folder": "\\"},
+		}}
+	})
+	f.route(locationDefinitions, "{project}/_apis/build/definitions/{definitionId}", func(req *fakeRequest) (int, interface{}) {
+		return http.StatusOK, map[string]interface{}{"id": 7, "name": "build", "process": map[string]interface{}{"type": 2}}
+	})
+	f.route(locationBuilds, "{project}/_apis/build/builds/{buildId}", func(req *fakeRequest) (int, interface{}) {
+		return http.StatusOK, map[string]interface{}{"id": 1234, "buildNumber": "20221016.1", "startTime": "2022-10-16T12:01:00Z"}
+	})
+	var lock sync.Mutex
+	checks := 0
+	f.route(locationRuns, "{project}/_apis/pipelines/{pipelineId}/runs/{runId}", func(req *fakeRequest) (int, interface{}) {
+		run := map[string]interface{}{
+			"id": 1234, "name": "20221016.1", "state": "inProgress",
+			"createdDate": "2022-10-16T12:00:00Z",
+			"url":         "https://dev.azure.com/org/prj/_apis/pipelines/7/runs/1234",
+			"pipeline":    map[string]interface{}{"id": 7, "name": "build"},
+			"_links":      map[string]interface{}{"web": map[string]interface{}{"href": "https://dev.azure.com/org/prj/_build/results?buildId=1234"}},
+		}
+		if req.Method == http.MethodGet {
+			lock.Lock()
+			checks++
+			if checks > 1 {
+				run["state"] = "completed"
+				run["result"] = "succeeded"
+				run["finishedDate"] = "2022-10-16T12:05:00Z"
+			}
+			lock.Unlock()
+		}
+		return http.StatusOK, run
+	})
+}
+
+// withTransport replaces the transport of the clients of the SDK during
+// the test.
+func withTransport(t *testing.T, transport http.RoundTripper) {
+	previous := http.DefaultTransport
+	http.DefaultTransport = transport
+	t.Cleanup(func() { http.DefaultTransport = previous })
+}
+
+func runFlow(t *testing.T, baseURL string) *RunResult {
+	t.Helper()
+	client := &Client{BaseURL: baseURL, Org: "org", Project: "prj", Token: "secret-token"}
+	result, err := client.Run(context.Background(), RunOptions{Pipeline: "build", Branch: "main", PollInterval: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+// replayFrom replays the exchanges of the directory and returns the
+// transport, its mismatches are collected.
+func replayFrom(t *testing.T, dir string) (*replayTransport, *[]string) {
+	t.Helper()
+	exchanges, err := loadExchanges(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lock sync.Mutex
+	var mismatches []string
+	transport := &replayTransport{exchanges: exchanges, used: make([]bool, len(exchanges)), mismatch: func(message string) {
+		lock.Lock()
+		defer lock.Unlock()
+		mismatches = append(mismatches, message)
+	}}
+	return transport, &mismatches
+}
+
+func unused(transport *replayTransport) int {
+	n := 0
+	for _, used := range transport.used {
+		if !used {
+			n++
+		}
+	}
+	return n
+}
+
+// TestReplayFixture starts and watches a run with the recorded fixture
+// of testdata/replay/run, that was recorded from routeRunFlow.
+func TestReplayFixture(t *testing.T) {
+	transport, mismatches := replayFrom(t, filepath.Join("testdata", "replay", "run"))
+	withTransport(t, transport)
+
+	// the locations of the recorded server are requested again
+	result := runFlow(t, "https://fixture.example.com")
+	if result.RunID != 1234 || result.Result != "succeeded" || result.ExitCode != 0 {
+		t.Errorf("run %d %s with exit code %d, want 1234 succeeded with exit code 0", result.RunID, result.Result, result.ExitCode)
+	}
+	if want := time.Date(2022, 10, 16, 12, 1, 0, 0, time.UTC); !result.Started.Equal(want) {
+		t.Errorf("started %v, want %v", result.Started, want)
+	}
+	if len(*mismatches) > 0 {
+		t.Errorf("mismatches %v", *mismatches)
+	}
+	if n := unused(transport); n > 0 {
+		t.Errorf("%d recorded exchanges are not used", n)
+	}
+}
+
+// TestReplayMismatch checks, that a request, that differs from the
+// recording, fails with the diff of the requests.
+func TestReplayMismatch(t *testing.T) {
+	transport, mismatches := replayFrom(t, filepath.Join("testdata", "replay", "run"))
+	withTransport(t, transport)
+
+	client := &Client{BaseURL: "https://mismatch.example.com", Org: "org", Project: "prj", Token: "secret-token"}
+	_, err := client.Run(context.Background(), RunOptions{Pipeline: "build", Branch: "develop", PollInterval: time.Millisecond})
+	if err == nil {
+		t.Fatal("run is started with an unrecorded request")
+	}
+	// the program ends with the first mismatch
+	if len(*mismatches) == 0 {
+		t.Fatal("no mismatch")
+	}
+	for _, want := range []string{"- POST /org/prj/_apis/pipelines/7/runs\n", "main", "+ POST /org/prj/_apis/pipelines/7/runs\n", "develop"} {
+		if !strings.Contains((*mismatches)[0], want) {
+			t.Errorf("mismatch does not contain %q:\n%s", want, (*mismatches)[0])
+		}
+	}
+}
+
+// TestRecordReplay records a run from the fake server and replays it
+// without the server.
+func TestRecordReplay(t *testing.T) {
+	f := newFakeServer(t)
+	routeRunFlow(f)
+	dir := t.TempDir()
+	withTransport(t, &recordTransport{next: http.DefaultTransport, dir: dir, token: "secret-token"})
+	recorded := runFlow(t, f.URL)
+	f.Close()
+
+	transport, mismatches := replayFrom(t, dir)
+	http.DefaultTransport = transport
+	replayed := runFlow(t, f.URL)
+	if *replayed != *recorded {
+		t.Errorf("replayed %+v, want %+v", replayed, recorded)
+	}
+	if len(*mismatches) > 0 {
+		t.Errorf("mismatches %v", *mismatches)
+	}
+}
+
+func TestRecordSanitize(t *testing.T) {
+	tests := []struct {
+		name  string
+		token string
+		value string
+		want  string
+	}{
+		{"query", "secret-token", "/org/_apis/connectionData?token=secret-token", "/org/_apis/connectionData?token=***"},
+		{"body", "secret-token", `{"password":"secret-token"}`, `{"password":"***"}`},
+		{"no token", "", `{"password":"secret-token"}`, `{"password":"secret-token"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := &recordTransport{token: tt.token}
+			if got := transport.sanitize(tt.value); got != tt.want {
+				t.Errorf("sanitize() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
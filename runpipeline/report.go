@@ -0,0 +1,130 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"fmt"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/pipelines"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// resultNoRuns is the result of a pipeline without completed run in
+// report mode.
+const resultNoRuns = "noRuns"
+
+// reportConcurrency limits the pipelines, that are read at once.
+const reportConcurrency = 8
+
+// runReport reads the latest completed run of every pipeline instead of
+// starting the pipelines. The runs are sorted with the worst result
+// first and the exit code of the worst run is returned. Pipelines
+// without completed run only fail the report with 'strict-report'.
+func (app *App) runReport(ctx context.Context, runs []*pipelineRun) int {
+	defer app.timer.begin("report")()
+	var wg sync.WaitGroup
+	limit := make(chan struct{}, reportConcurrency)
+	for _, pr := range runs {
+		wg.Add(1)
+		go func(pr *pipelineRun) {
+			defer wg.Done()
+			limit <- struct{}{}
+			defer func() { <-limit }()
+			app.reportRun(ctx, pr)
+		}(pr)
+	}
+	wg.Wait()
+
+	sort.SliceStable(runs, func(i, j int) bool {
+		return exitCodeSeverity[runs[i].exitCode] > exitCodeSeverity[runs[j].exitCode]
+	})
+	if app.output.console() {
+		printReport(runs)
+	}
+	app.run = &runs[0].info
+	return runs[0].exitCode
+}
+
+// reportRun reads the run of 'run-id' or the latest completed run of the
+// pipeline on the branch of the command line or the batch file, on any
+// branch otherwise.
+func (app *App) reportRun(ctx context.Context, pr *pipelineRun) {
+	runID := app.runID
+	if runID == 0 {
+		filter := runFilter{states: []string{"completed"}, maxCount: 1}
+		if pr.branch != "" {
+			filter.branch = branchRef(pr.branch)
+		}
+		records, err := app.listRuns(ctx, pr.prj, pr.pipelineID, filter)
+		if err != nil {
+			log.Errorf("Runs of pipeline '%s' could not be read: %v", pr.name, err)
+			pr.info.Result = resultNoRuns
+			pr.exitCode = 3
+			return
+		}
+		if len(records) == 0 {
+			log.Infof("Pipeline '%s' has no completed run.", pr.name)
+			pr.info.Result = resultNoRuns
+			if app.strictReport {
+				pr.exitCode = 3
+			}
+			return
+		}
+		runID = records[0].ID
+		pr.info.Result = records[0].Result
+	}
+	args := &pipelines.GetRunArgs{
+		Project:    &pr.prj.name,
+		PipelineId: &pr.pipelineID,
+		RunId:      &runID,
+	}
+	run, err := pr.prj.org.pipelines.GetRun(ctx, *args)
+	if err != nil {
+		log.Errorf("Run %d of pipeline '%s' could not be read: %v", runID, pr.name, err)
+		pr.exitCode = 3
+		return
+	}
+	pr.runID = runID
+	pr.info.update(run)
+	if pr.info.Result == "" {
+		// the run of 'run-id' is not completed yet
+		return
+	}
+	pr.exitCode = resultExitCode(pr.info.Result)
+}
+
+func printReport(runs []*pipelineRun) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Pipeline\tResult\tFinished\tDuration\tURL")
+	for _, pr := range runs {
+		finished := ""
+		if !pr.info.Finished.IsZero() {
+			finished = pr.info.Finished.Local().Format("2006-01-02 15:04")
+		}
+		duration := ""
+		if d := pr.info.duration(); d > 0 {
+			duration = d.Round(time.Second).String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", pr.name, pr.info.statusText(), finished, duration, pr.info.URL)
+	}
+	w.Flush()
+}
@@ -0,0 +1,490 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"fmt"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/build"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/test"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// maxJobErrors limits the error messages of a failed job in the report.
+const maxJobErrors = 5
+
+// reportDetails are the optional data of a run for the Markdown report,
+// that are read when the run is finished. Data, that could not be read,
+// stay nil.
+type reportDetails struct {
+	Branch     string
+	Commit     string
+	CommitURL  string
+	Stages     []reportStage
+	FailedJobs []reportJob
+	Tests      *reportTests
+	Artifacts  []reportArtifact
+}
+
+type reportStage struct {
+	Name     string
+	Result   string
+	Duration time.Duration
+}
+
+type reportJob struct {
+	Stage  string
+	Name   string
+	Errors []string
+}
+
+type reportTests struct {
+	Total  int
+	Passed int
+	Failed int
+	Other  int
+}
+
+type reportArtifact struct {
+	Name string
+	URL  string
+}
+
+// reportRun is a run in the template of the Markdown report.
+type reportRun struct {
+	Org         string
+	Project     string
+	Pipeline    string
+	PipelineID  int
+	RunID       int
+	BuildNumber string
+	URL         string
+	Result      string
+	ExitCode    int
+	Phases      string
+	Duration    time.Duration
+	Parameters  []reportParameter
+	// Timeline is false, if the stages and jobs could not be read
+	Timeline bool
+	reportDetails
+}
+
+type reportParameter struct {
+	Name  string
+	Value string
+}
+
+// reportData are the values of the template of the Markdown report.
+type reportData struct {
+	Time     string
+	ExitCode int
+	Runs     []reportRun
+}
+
+// reportFuncs are the functions of the template of the Markdown report.
+var reportFuncs = template.FuncMap{
+	"md":       markdownText,
+	"emoji":    resultEmoji,
+	"duration": reportDuration,
+	"short":    shortCommit,
+}
+
+// markdownReportTemplate renders the report. Every value, that may be
+// missing, has a text for its absence, so that the document is valid
+// Markdown without the optional data.
+const markdownReportTemplate = `# Pipeline runs
+
+Generated {{.Time}}, exit code {{.ExitCode}}.
+{{if gt (len .Runs) 1}}
+| Pipeline | Run | Branch | Result | Duration |
+|----------|-----|--------|--------|----------|
+{{- range .Runs}}
+| {{md .Pipeline}} | {{if .URL}}[{{md .BuildNumber}}]({{.URL}}){{else}}{{md .BuildNumber}}{{end}} | {{md .Branch}} | {{emoji .Result}} {{md .Result}} | {{duration .Duration}} |
+{{- end}}
+{{end}}
+{{- range .Runs}}
+## {{emoji .Result}} {{md .Pipeline}}{{if .BuildNumber}} {{md .BuildNumber}}{{end}}
+
+- **Pipeline:** {{md .Org}}/{{md .Project}}/{{md .Pipeline}} (id {{.PipelineID}})
+- **Run:** {{if .RunID}}{{if .URL}}[{{.RunID}}]({{.URL}}){{else}}{{.RunID}}{{end}}{{else}}not started{{end}}
+- **Branch:** {{if .Branch}}{{md .Branch}}{{else}}-{{end}}
+- **Commit:** {{if .CommitURL}}[{{short .Commit}}]({{.CommitURL}}){{else if .Commit}}{{short .Commit}}{{else}}-{{end}}
+- **Result:** {{emoji .Result}} {{if .Result}}{{md .Result}}{{else}}unknown{{end}} (exit code {{.ExitCode}})
+- **Times:** {{.Phases}}
+- **Duration:** {{duration .Duration}}
+
+### Parameters
+{{if .Parameters}}
+| Name | Value |
+|------|-------|
+{{- range .Parameters}}
+| {{md .Name}} | {{md .Value}} |
+{{- end}}
+{{else}}
+No parameters.
+{{end}}
+### Stages
+{{if .Stages}}
+| Stage | Result | Duration |
+|-------|--------|----------|
+{{- range .Stages}}
+| {{md .Name}} | {{emoji .Result}} {{md .Result}} | {{duration .Duration}} |
+{{- end}}
+{{else if .Timeline}}
+No stages.
+{{else}}
+The timeline is not available.
+{{end}}
+{{- if .FailedJobs}}
+### Failed jobs
+
+| Stage | Job | Errors |
+|-------|-----|--------|
+{{- range .FailedJobs}}
+| {{md .Stage}} | {{md .Name}} | {{range $i, $e := .Errors}}{{if $i}}<br>{{end}}{{md $e}}{{end}} |
+{{- end}}
+{{end}}
+### Tests
+{{with .Tests}}
+| Total | Passed | Failed | Other |
+|-------|--------|--------|-------|
+| {{.Total}} | {{.Passed}} | {{.Failed}} | {{.Other}} |
+{{else}}
+No test results are available.
+{{end}}
+### Artifacts
+{{if .Artifacts}}
+{{range .Artifacts}}- {{if .URL}}[{{md .Name}}]({{.URL}}){{else}}{{md .Name}}{{end}}
+{{end}}{{else}}
+No artifacts are available.
+{{end}}
+{{- end}}`
+
+var markdownReport = template.Must(template.New("report-md").Funcs(reportFuncs).Parse(markdownReportTemplate))
+
+// markdownEscaper escapes the characters, that format Markdown, and the
+// line breaks, that would end a table row.
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`,
+	"<", "&lt;", ">", "&gt;", "#", `\#`, "|", `\|`, "\r\n", " ", "\n", " ",
+)
+
+func markdownText(text string) string {
+	return markdownEscaper.Replace(text)
+}
+
+func resultEmoji(result string) string {
+	switch result {
+	case "succeeded":
+		return "✅"
+	case "partiallySucceeded", "succeededWithIssues":
+		return "⚠️"
+	case "failed":
+		return "❌"
+	case "canceled", "abandoned":
+		return "⛔"
+	case resultSkipped, resultDeployed:
+		return "⏭️"
+	}
+	return "❔"
+}
+
+func reportDuration(d time.Duration) string {
+	if d <= 0 {
+		return "-"
+	}
+	return d.Round(time.Second).String()
+}
+
+func shortCommit(commit string) string {
+	if len(commit) > 8 {
+		return commit[:8]
+	}
+	return commit
+}
+
+// collectReportDetails reads the commit, the timeline, the test results
+// and the artifacts of the finished run for the Markdown report. Missing
+// data are only logged.
+func (app *App) collectReportDetails(ctx context.Context, pr *pipelineRun) {
+	details := &reportDetails{Branch: strings.TrimPrefix(pr.branch, "refs/heads/")}
+	pr.reportDetails = details
+	if pr.runID <= 0 {
+		return
+	}
+	done := app.timer.begin("reportMd")
+	defer done()
+	client, err := pr.prj.org.buildClient(ctx)
+	if err != nil {
+		pr.log.Warnf("Details of run %d of pipeline '%s' could not be read for the report: %v", pr.runID, pr.name, err)
+		return
+	}
+	if b, err := app.getBuild(ctx, client, pr); err != nil {
+		pr.log.Warnf("Commit of run %d of pipeline '%s' could not be read for the report: %v", pr.runID, pr.name, err)
+	} else {
+		if b.SourceBranch != nil {
+			details.Branch = strings.TrimPrefix(*b.SourceBranch, "refs/heads/")
+		}
+		if b.SourceVersion != nil {
+			details.Commit = *b.SourceVersion
+			details.CommitURL = app.commitURL(pr, b)
+		}
+	}
+	if app.capabilities.available(subsystemTimeline) && app.budget.allowOptional("reportTimeline") {
+		args := &build.GetBuildTimelineArgs{
+			Project: &pr.prj.name,
+			BuildId: &pr.runID,
+		}
+		timeline, err := client.GetBuildTimeline(ctx, *args)
+		if app.capabilities.denied(pr.log, subsystemTimeline, err) {
+			// the report says, that the timeline is not available
+		} else if err != nil {
+			pr.log.Warnf("Timeline of run %d of pipeline '%s' could not be read for the report: %v", pr.runID, pr.name, err)
+		} else {
+			details.Stages, details.FailedJobs = timelineSummary(timeline)
+			if details.Stages == nil {
+				details.Stages = []reportStage{}
+			}
+		}
+	}
+	if app.capabilities.available(subsystemTests) && app.budget.allowOptional("reportTests") {
+		tests, err := app.testTotals(ctx, pr)
+		if !app.capabilities.denied(pr.log, subsystemTests, err) && err != nil {
+			pr.log.Warnf("Test results of run %d of pipeline '%s' could not be read for the report: %v", pr.runID, pr.name, err)
+		}
+		details.Tests = tests
+	}
+	if app.capabilities.available(subsystemArtifacts) && app.budget.allowOptional("reportArtifacts") {
+		args := &build.GetArtifactsArgs{
+			Project: &pr.prj.name,
+			BuildId: &pr.runID,
+		}
+		artifacts, err := client.GetArtifacts(ctx, *args)
+		if app.capabilities.denied(pr.log, subsystemArtifacts, err) {
+			return
+		}
+		if err != nil {
+			pr.log.Warnf("Artifacts of run %d of pipeline '%s' could not be read for the report: %v", pr.runID, pr.name, err)
+			return
+		}
+		for _, artifact := range *artifacts {
+			if artifact.Name == nil {
+				continue
+			}
+			a := reportArtifact{Name: *artifact.Name}
+			if artifact.Resource != nil && artifact.Resource.DownloadUrl != nil {
+				a.URL = *artifact.Resource.DownloadUrl
+			}
+			details.Artifacts = append(details.Artifacts, a)
+		}
+	}
+}
+
+// commitURL links the commit of the build in Azure Repos or GitHub.
+func (app *App) commitURL(pr *pipelineRun, b *build.Build) string {
+	if b.Repository == nil || b.Repository.Type == nil || b.Repository.Id == nil {
+		return ""
+	}
+	switch *b.Repository.Type {
+	case "TfsGit":
+		return fmt.Sprintf("%s/%s/_git/%s/commit/%s", app.organizationURL(pr.prj.org.name), url.PathEscape(pr.prj.name), url.PathEscape(*b.Repository.Id), *b.SourceVersion)
+	case "GitHub":
+		return fmt.Sprintf("https://github.com/%s/commit/%s", *b.Repository.Id, *b.SourceVersion)
+	}
+	return ""
+}
+
+// timelineSummary returns the stages in their order and the failed jobs
+// with the errors of their tasks.
+func timelineSummary(timeline *build.Timeline) ([]reportStage, []reportJob) {
+	if timeline == nil || timeline.Records == nil {
+		return nil, nil
+	}
+	records := *timeline.Records
+	byID := make(map[string]*build.TimelineRecord, len(records))
+	for i := range records {
+		if records[i].Id != nil {
+			byID[records[i].Id.String()] = &records[i]
+		}
+	}
+	// ancestor returns the next parent record of the type
+	ancestor := func(record *build.TimelineRecord, recordType string) *build.TimelineRecord {
+		for record != nil {
+			if record.Type != nil && *record.Type == recordType {
+				return record
+			}
+			if record.ParentId == nil {
+				return nil
+			}
+			record = byID[record.ParentId.String()]
+		}
+		return nil
+	}
+
+	var stageRecords []*build.TimelineRecord
+	jobs := make(map[*build.TimelineRecord]*reportJob)
+	var failed []*build.TimelineRecord
+	for i := range records {
+		record := &records[i]
+		switch {
+		case record.Type != nil && *record.Type == "Stage":
+			stageRecords = append(stageRecords, record)
+		case record.Type != nil && *record.Type == "Job" && record.Result != nil && *record.Result == build.TaskResultValues.Failed:
+			job := &reportJob{Name: stringValue(record.Name)}
+			if stage := ancestor(record, "Stage"); stage != nil {
+				job.Stage = stringValue(stage.Name)
+			}
+			jobs[record] = job
+			failed = append(failed, record)
+		}
+	}
+	for i := range records {
+		record := &records[i]
+		if record.Issues == nil {
+			continue
+		}
+		job := jobs[ancestor(record, "Job")]
+		if job == nil {
+			continue
+		}
+		for _, issue := range *record.Issues {
+			if issue.Type != nil && *issue.Type == build.IssueTypeValues.Error && issue.Message != nil && len(job.Errors) < maxJobErrors {
+				job.Errors = append(job.Errors, *issue.Message)
+			}
+		}
+	}
+
+	sort.SliceStable(stageRecords, func(i, j int) bool {
+		return intValue(stageRecords[i].Order) < intValue(stageRecords[j].Order)
+	})
+	stages := make([]reportStage, 0, len(stageRecords))
+	for _, record := range stageRecords {
+		stage := reportStage{Name: stringValue(record.Name)}
+		if record.Result != nil {
+			stage.Result = string(*record.Result)
+		} else if record.State != nil {
+			stage.Result = string(*record.State)
+		}
+		if record.StartTime != nil && record.FinishTime != nil {
+			stage.Duration = record.FinishTime.Time.Sub(record.StartTime.Time)
+		}
+		stages = append(stages, stage)
+	}
+	var failedJobs []reportJob
+	for _, record := range failed {
+		failedJobs = append(failedJobs, *jobs[record])
+	}
+	return stages, failedJobs
+}
+
+// testTotals sums the test runs of the build.
+func (app *App) testTotals(ctx context.Context, pr *pipelineRun) (*reportTests, error) {
+	client, err := pr.prj.org.testClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	buildURI := fmt.Sprintf("vstfs:///Build/Build/%d", pr.runID)
+	details := true
+	args := &test.GetTestRunsArgs{
+		Project:           &pr.prj.name,
+		BuildUri:          &buildURI,
+		IncludeRunDetails: &details,
+	}
+	runs, err := client.GetTestRuns(ctx, *args)
+	if err != nil {
+		return nil, err
+	}
+	if runs == nil || len(*runs) == 0 {
+		return nil, nil
+	}
+	totals := &reportTests{}
+	for _, run := range *runs {
+		totals.Total += intValue(run.TotalTests)
+		totals.Passed += intValue(run.PassedTests)
+		totals.Other += intValue(run.IncompleteTests) + intValue(run.NotApplicableTests)
+	}
+	totals.Failed = totals.Total - totals.Passed - totals.Other
+	if totals.Failed < 0 {
+		totals.Failed = 0
+	}
+	return totals, nil
+}
+
+// writeMarkdownReport writes the report of all runs to the file of
+// 'report-md'.
+func (app *App) writeMarkdownReport(code int) error {
+	data := reportData{Time: time.Now().Local().Format(time.RFC1123), ExitCode: code}
+	for _, pr := range app.runs {
+		run := reportRun{
+			Org:         pr.prj.org.name,
+			Project:     pr.prj.name,
+			Pipeline:    pr.name,
+			PipelineID:  pr.pipelineID,
+			RunID:       pr.info.ID,
+			BuildNumber: pr.info.BuildNumber,
+			URL:         pr.info.URL,
+			Result:      pr.info.Result,
+			ExitCode:    pr.exitCode,
+			Phases:      phasesText(pr.info.Created, pr.info.Started, pr.info.Finished),
+		}
+		if run.RunID == 0 && pr.runID > 0 {
+			run.RunID = pr.runID
+		}
+		if len(app.runs) == 1 {
+			run.ExitCode = code
+		}
+		if !pr.info.Created.IsZero() && !pr.info.Finished.IsZero() {
+			run.Duration = pr.info.Finished.Sub(pr.info.Created)
+		}
+		parameters := maskParameters(app.runParameters(pr))
+		for name, value := range parameters {
+			run.Parameters = append(run.Parameters, reportParameter{name, value})
+		}
+		sort.Slice(run.Parameters, func(i, j int) bool { return run.Parameters[i].Name < run.Parameters[j].Name })
+		if pr.reportDetails != nil {
+			run.reportDetails = *pr.reportDetails
+			run.Timeline = pr.reportDetails.Stages != nil
+		} else {
+			run.Branch = strings.TrimPrefix(pr.branch, "refs/heads/")
+		}
+		data.Runs = append(data.Runs, run)
+	}
+	var report strings.Builder
+	if err := markdownReport.Execute(&report, data); err != nil {
+		return err
+	}
+	return os.WriteFile(app.reportMdFile, []byte(report.String()), 0644)
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func intValue(i *int) int {
+	if i == nil {
+		return 0
+	}
+	return *i
+}
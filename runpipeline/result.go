@@ -0,0 +1,69 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/build"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/pipelines"
+	log "github.com/sirupsen/logrus"
+	"strings"
+	"sync"
+)
+
+// resultExitCodes maps every known result to the exit code. It is the
+// only mapping of results, the results of the pipelines API, the builds
+// API and the deployment jobs are normalized to these values. Builds and
+// deployment jobs can be partially successful and skipped pipelines of
+// sequential mode and already deployed pipelines of 'skip-if-env-deployed'
+// have no result of Azure DevOps.
+var resultExitCodes = map[pipelines.RunResult]int{
+	pipelines.RunResultValues.Succeeded:                             0,
+	pipelines.RunResultValues.Failed:                                1,
+	pipelines.RunResultValues.Canceled:                              2,
+	pipelines.RunResultValues.Unknown:                               3,
+	pipelines.RunResult(build.BuildResultValues.None):               3,
+	pipelines.RunResult(build.BuildResultValues.PartiallySucceeded): 3,
+	pipelines.RunResult(resultSkipped):                              3,
+	pipelines.RunResult(resultDeployed):                             0,
+}
+
+// unknownResults are the unknown results, that were logged already.
+var unknownResults sync.Map
+
+// normalizeResult returns the known result, that matches the value
+// case-insensitive, or the value itself.
+func normalizeResult(value string) pipelines.RunResult {
+	for result := range resultExitCodes {
+		if strings.EqualFold(string(result), value) {
+			return result
+		}
+	}
+	return pipelines.RunResult(value)
+}
+
+// resultExitCode maps the result of a run to the exit code. Results,
+// that are not known, eg. new results of a newer API version, have exit
+// code 3 and are logged once with their raw value.
+func resultExitCode(result string) int {
+	if code, ok := resultExitCodes[normalizeResult(result)]; ok {
+		return code
+	}
+	if _, logged := unknownResults.LoadOrStore(result, true); !logged {
+		log.Warnf("Result '%s' of a run is not known, the exit code is 3.", result)
+	}
+	return 3
+}
@@ -0,0 +1,155 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/build"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/pipelines"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/taskagent"
+	"github.com/sirupsen/logrus/hooks/test"
+	"reflect"
+	"testing"
+)
+
+// enumValues returns the values of an enum of the SDK, eg.
+// pipelines.RunResultValues, by the names of the fields.
+func enumValues(values interface{}) map[string]string {
+	result := map[string]string{}
+	v := reflect.ValueOf(values)
+	for i := 0; i < v.NumField(); i++ {
+		result[v.Type().Field(i).Name] = v.Field(i).String()
+	}
+	return result
+}
+
+// TestResultExitCodes checks, that every result of the SDK has an explicit
+// exit code, so that a new value of an SDK update is not mapped to exit
+// code 3 silently.
+func TestResultExitCodes(t *testing.T) {
+	tests := []struct {
+		name   string
+		values interface{}
+		// want are the exit codes by the names of the fields
+		want map[string]int
+	}{
+		{"pipelines", pipelines.RunResultValues, map[string]int{
+			"Succeeded": 0, "Failed": 1, "Canceled": 2, "Unknown": 3,
+		}},
+		{"builds", build.BuildResultValues, map[string]int{
+			"Succeeded": 0, "Failed": 1, "Canceled": 2, "None": 3, "PartiallySucceeded": 3,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := enumValues(tt.values)
+			for name, value := range values {
+				want, ok := tt.want[name]
+				if !ok {
+					t.Errorf("result %s ('%s') of the SDK has no expected exit code", name, value)
+					continue
+				}
+				if _, ok := resultExitCodes[pipelines.RunResult(value)]; !ok {
+					t.Errorf("result %s ('%s') has no mapping in resultExitCodes", name, value)
+				}
+				if got := resultExitCode(value); got != want {
+					t.Errorf("resultExitCode(%q) = %d, want %d", value, got, want)
+				}
+			}
+			for name := range tt.want {
+				if _, ok := values[name]; !ok {
+					t.Errorf("result %s is not a value of the SDK", name)
+				}
+			}
+		})
+	}
+}
+
+// TestDeploymentResults checks, that every result of a deployment job is
+// mapped to a result with an exit code.
+func TestDeploymentResults(t *testing.T) {
+	for name, value := range enumValues(taskagent.TaskResultValues) {
+		result, ok := deploymentResults[taskagent.TaskResult(value)]
+		if !ok {
+			t.Errorf("deployment result %s ('%s') has no mapping in deploymentResults", name, value)
+			continue
+		}
+		if _, ok := resultExitCodes[pipelines.RunResult(result)]; !ok {
+			t.Errorf("deployment result %s is mapped to '%s', that has no exit code", name, result)
+		}
+	}
+}
+
+// TestResultExitCode checks the exit codes of the results, that are
+// written in other cases or are not known.
+func TestResultExitCode(t *testing.T) {
+	tests := []struct {
+		result string
+		want   int
+	}{
+		{"succeeded", 0},
+		{"SUCCEEDED", 0},
+		{"partiallysucceeded", 3},
+		{resultSkipped, 3},
+		{resultDeployed, 0},
+		{"postponed", 3},
+		{"", 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.result, func(t *testing.T) {
+			if got := resultExitCode(tt.result); got != tt.want {
+				t.Errorf("resultExitCode(%q) = %d, want %d", tt.result, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestNormalizeResult checks, that known results are normalized case
+// insensitive and unknown results keep their raw value.
+func TestNormalizeResult(t *testing.T) {
+	tests := []struct {
+		value string
+		want  pipelines.RunResult
+	}{
+		{"Failed", pipelines.RunResultValues.Failed},
+		{"partiallySucceeded", pipelines.RunResult(build.BuildResultValues.PartiallySucceeded)},
+		{"AlreadyDeployed", resultDeployed},
+		{"Postponed", "Postponed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := normalizeResult(tt.value); got != tt.want {
+				t.Errorf("normalizeResult(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestUnknownResultLoggedOnce checks, that an unknown result is logged
+// once with its raw value.
+func TestUnknownResultLoggedOnce(t *testing.T) {
+	hook := test.NewGlobal()
+	defer hook.Reset()
+	resultExitCode("notYetKnown")
+	resultExitCode("notYetKnown")
+	resultExitCode("NotYetKnown")
+	if got := len(hook.AllEntries()); got != 2 {
+		t.Errorf("%d log entries, want 2, one per raw value", got)
+	}
+	if entry := hook.LastEntry(); entry == nil || entry.Message != "Result 'NotYetKnown' of a run is not known, the exit code is 3." {
+		t.Errorf("last entry = %v", entry)
+	}
+}
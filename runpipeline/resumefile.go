@@ -0,0 +1,152 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"os"
+)
+
+// resumeDocument is the content of the file of 'poll-on-exit-resume-file'.
+type resumeDocument struct {
+	Runs []resumeRun `json:"runs"`
+}
+
+// resumeRun is a started run, that the next invocation polls instead of
+// starting the pipeline again.
+type resumeRun struct {
+	Org        string `json:"org"`
+	Prj        string `json:"prj"`
+	PipelineID int    `json:"pipelineId"`
+	// Branch is the full ref, the pipeline can be started on several
+	// branches.
+	Branch string `json:"branch"`
+	RunID  int    `json:"runId"`
+}
+
+// writeResumeFile writes the started runs to the resume file on SIGTERM,
+// so that the next invocation resumes polling them. The runs are handed
+// over, their pending pull request checks are not abandoned and the hooks
+// are left to the next invocation. It returns
+// false, if no run was started or the file could not be written.
+func (app *App) writeResumeFile() bool {
+	var doc resumeDocument
+	for _, pr := range app.runs {
+		if pr.runID <= 0 {
+			continue
+		}
+		doc.Runs = append(doc.Runs, resumeRun{
+			Org:        pr.prj.org.name,
+			Prj:        pr.prj.name,
+			PipelineID: pr.pipelineID,
+			Branch:     pr.branch,
+			RunID:      pr.runID,
+		})
+	}
+	if len(doc.Runs) == 0 {
+		return false
+	}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err == nil {
+		err = writeFileAtomic(app.resumeFile, append(data, '\n'))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Resume file '%s' could not be written: %v\n", app.resumeFile, err)
+		return false
+	}
+	for _, pr := range app.runs {
+		if pr.runID > 0 {
+			pr.prCheckPending = false
+		}
+	}
+	app.handedOver = true
+	log.Warnf("Runs are written to resume file '%s', the next invocation resumes polling them.", app.resumeFile)
+	return true
+}
+
+// readResumeFile marks the runs of the resume file as resumed. It does
+// nothing, if the file does not exist. Runs of other pipelines in the
+// file are ignored with a warning, a run is only resumed on its branch.
+func (app *App) readResumeFile(runs []*pipelineRun) {
+	data, err := os.ReadFile(app.resumeFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	var doc resumeDocument
+	if err == nil {
+		err = json.Unmarshal(data, &doc)
+	}
+	if err != nil {
+		log.Errorf("Resume file '%s' could not be read: %v", app.resumeFile, err)
+		app.exit(44)
+	}
+	for _, entry := range doc.Runs {
+		pr := findResumedRun(runs, entry)
+		if pr == nil {
+			log.Warnf("Run %d of pipeline id %d on branch '%s' in '%s/%s' of the resume file is not one of the given pipelines and is not resumed.",
+				entry.RunID, entry.PipelineID, entry.Branch, entry.Org, entry.Prj)
+			continue
+		}
+		pr.resumedRunID = entry.RunID
+	}
+}
+
+func findResumedRun(runs []*pipelineRun, entry resumeRun) *pipelineRun {
+	for _, pr := range runs {
+		if pr.prj.org.name == entry.Org && pr.prj.name == entry.Prj && pr.pipelineID == entry.PipelineID &&
+			pr.branch == entry.Branch && pr.resumedRunID == 0 {
+			return pr
+		}
+	}
+	return nil
+}
+
+// notResumed returns the runs, that are started, because they are not in
+// the resume file.
+func notResumed(runs []*pipelineRun) []*pipelineRun {
+	var starting []*pipelineRun
+	for _, pr := range runs {
+		if pr.resumedRunID == 0 {
+			starting = append(starting, pr)
+		}
+	}
+	return starting
+}
+
+// resumeRun takes over the run of the resume file instead of starting the
+// pipeline. The timeout of the run starts again.
+func (app *App) resumeRun(pr *pipelineRun) {
+	pr.runID = pr.resumedRunID
+	pr.info.ID = pr.runID
+	pr.triggerAPI = app.triggerAPI(pr)
+	pr.prCheckPending = app.reportToPRCheck
+	pr.log = runLogger(pr)
+	pr.log.Infof("Run %d of pipeline '%s' is resumed from '%s'.", pr.runID, pr.name, app.resumeFile)
+	pr.deadline = app.runDeadline(pr)
+	app.statusServer.update(pr, false)
+}
+
+// removeResumeFile deletes the resume file, after the runs are watched to
+// the end.
+func (app *App) removeResumeFile() {
+	if err := os.Remove(app.resumeFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Warnf("Resume file '%s' could not be deleted: %v", app.resumeFile, err)
+	}
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResumeFile(t *testing.T) {
+	prj := &project{org: &organization{name: "org"}, name: "prj"}
+	started := []*pipelineRun{
+		{prj: prj, name: "deploy", pipelineID: 42, branch: "refs/heads/main", runID: 1234},
+		{prj: prj, name: "deploy", pipelineID: 42, branch: "refs/heads/release/1.0", runID: 1235},
+		{prj: prj, name: "build", pipelineID: 7, branch: "refs/heads/main"},
+	}
+	file := filepath.Join(t.TempDir(), "resume.json")
+	app := &App{resumeFile: file, runs: started}
+	if !app.writeResumeFile() {
+		t.Fatal("resume file is not written")
+	}
+	if !app.handedOver {
+		t.Error("runs are not handed over")
+	}
+
+	tests := []struct {
+		name   string
+		branch string
+		want   int
+	}{
+		{"main", "refs/heads/main", 1234},
+		{"release", "refs/heads/release/1.0", 1235},
+		{"other branch", "refs/heads/develop", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pr := &pipelineRun{prj: prj, name: "deploy", pipelineID: 42, branch: tt.branch}
+			build := &pipelineRun{prj: prj, name: "build", pipelineID: 7, branch: "refs/heads/main"}
+			next := &App{resumeFile: file}
+			next.readResumeFile([]*pipelineRun{pr, build})
+			if pr.resumedRunID != tt.want {
+				t.Errorf("resumed run %d, want %d", pr.resumedRunID, tt.want)
+			}
+			if build.resumedRunID != 0 {
+				t.Errorf("run %d of a pipeline, that was not started, is resumed", build.resumedRunID)
+			}
+		})
+	}
+}
+
+func TestReadResumeFileInvalid(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "resume.json")
+	if err := os.WriteFile(file, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	app := &App{resumeFile: file}
+	if code := exitCodeOf(t, app, func() { app.readResumeFile(nil) }); code != 44 {
+		t.Errorf("exit code %d, want 44", code)
+	}
+}
+
+// TestRunHooksHandedOver checks, that the hooks are left to the next
+// invocation, if the runs are handed over on SIGTERM.
+func TestRunHooksHandedOver(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "hook")
+	app := &App{
+		run:   &runInfo{},
+		runs:  []*pipelineRun{{name: "deploy", runID: 1234}},
+		hooks: hooks{onFailure: stringSlice{"echo failed > " + marker}, onComplete: stringSlice{"echo complete > " + marker}},
+	}
+	tests := []struct {
+		name       string
+		handedOver bool
+		executed   bool
+	}{
+		{"handed over", true, false},
+		{"canceled", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Remove(marker)
+			app.handedOver = tt.handedOver
+			if code := app.runHooks(143); code != 143 {
+				t.Errorf("exit code %d, want 143", code)
+			}
+			if _, err := os.Stat(marker); (err == nil) != tt.executed {
+				t.Errorf("hook executed %v, want %v", err == nil, tt.executed)
+			}
+		})
+	}
+}
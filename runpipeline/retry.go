@@ -0,0 +1,69 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/build"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/webapi"
+	"strings"
+)
+
+// systemIdentityMarkers identify the service accounts of Azure DevOps,
+// that cancel runs e.g. when the agent is lost.
+var systemIdentityMarkers = []string{"Build Service", "Microsoft.VisualStudio.Services.TFS", "Azure Pipelines"}
+
+// canceledBySystem is true, if the run was canceled by Azure DevOps and
+// not by a user. If this can not be determined, false is returned.
+func (app *App) canceledBySystem(ctx context.Context, pr *pipelineRun) bool {
+	client, err := pr.prj.org.buildClient(ctx)
+	if err != nil {
+		pr.log.Warnf("Cancellation of run %d could not be checked: %v", pr.runID, err)
+		return false
+	}
+	args := &build.GetBuildArgs{
+		Project: &pr.prj.name,
+		BuildId: &pr.runID,
+	}
+	b, err := client.GetBuild(ctx, *args)
+	if err != nil {
+		pr.log.Warnf("Cancellation of run %d could not be checked: %v", pr.runID, err)
+		return false
+	}
+	return isSystemIdentity(b.LastChangedBy)
+}
+
+// isSystemIdentity is true, if the identity is a service account of Azure
+// DevOps. A missing identity is not known to be one, so that a run
+// canceled by an unknown user is not started again.
+func isSystemIdentity(identity *webapi.IdentityRef) bool {
+	if identity == nil {
+		return false
+	}
+	if identity.Descriptor != nil && (strings.HasPrefix(*identity.Descriptor, "svc.") || strings.HasPrefix(*identity.Descriptor, "s2s.")) {
+		return true
+	}
+	for _, marker := range systemIdentityMarkers {
+		if identity.DisplayName != nil && strings.Contains(*identity.DisplayName, marker) {
+			return true
+		}
+		if identity.UniqueName != nil && strings.Contains(*identity.UniqueName, marker) {
+			return true
+		}
+	}
+	return false
+}
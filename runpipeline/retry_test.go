@@ -0,0 +1,46 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/webapi"
+	"testing"
+)
+
+func TestIsSystemIdentity(t *testing.T) {
+	name := func(s string) *string { return &s }
+	tests := []struct {
+		name     string
+		identity *webapi.IdentityRef
+		want     bool
+	}{
+		{"missing", nil, false},
+		{"empty", &webapi.IdentityRef{}, false},
+		{"service descriptor", &webapi.IdentityRef{Descriptor: name("svc.MDAwMDAwMDAtMDAwMA")}, true},
+		{"s2s descriptor", &webapi.IdentityRef{Descriptor: name("s2s.MDAwMDAwMDAtMDAwMA")}, true},
+		{"build service", &webapi.IdentityRef{DisplayName: name("prj Build Service (org)")}, true},
+		{"tfs", &webapi.IdentityRef{UniqueName: name("Microsoft.VisualStudio.Services.TFS")}, true},
+		{"user", &webapi.IdentityRef{Descriptor: name("aad.NzA1ZDg"), DisplayName: name("Jane Doe"), UniqueName: name("jane@example.com")}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isSystemIdentity(tt.identity); got != tt.want {
+				t.Errorf("isSystemIdentity() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"fmt"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/build"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/pipelines"
+	log "github.com/sirupsen/logrus"
+)
+
+// stableTag is the tag of the runs, whose revision of the pipeline is
+// used with 'use-pipeline-revision stable'.
+const stableTag = "stable"
+
+// pipelineRevision is the flag 'use-pipeline-revision'.
+type pipelineRevision string
+
+const (
+	revisionLatest pipelineRevision = "latest"
+	revisionStable pipelineRevision = "stable"
+)
+
+func (r *pipelineRevision) String() string {
+	return string(*r)
+}
+
+func (r *pipelineRevision) Set(value string) error {
+	switch pipelineRevision(value) {
+	case revisionLatest, revisionStable:
+		*r = pipelineRevision(value)
+	default:
+		return fmt.Errorf("unknown revision '%s', use 'latest' or 'stable'", value)
+	}
+	return nil
+}
+
+// resolveRevisions looks up the revision of the pipeline of every run,
+// that the run is started with. The program ends with exit code 36, if
+// the revision can not be determined.
+func (app *App) resolveRevisions(ctx context.Context, runs []*pipelineRun) {
+	defer app.timer.begin("revision")()
+	for _, pr := range runs {
+		var revision int
+		var err error
+		if app.pipelineRevision == revisionStable {
+			revision, err = app.stableRevision(ctx, pr)
+		} else {
+			revision, err = app.latestRevision(ctx, pr)
+		}
+		if err != nil {
+			log.Errorf("Revision of pipeline '%s' could not be determined: %v", pr.name, err)
+			app.exit(36)
+		}
+		log.Infof("Pipeline '%s' is started with its %s revision %d.", pr.name, app.pipelineRevision, revision)
+		pr.revision = revision
+	}
+}
+
+// latestRevision returns the current revision of the pipeline.
+func (app *App) latestRevision(ctx context.Context, pr *pipelineRun) (int, error) {
+	args := &pipelines.GetPipelineArgs{
+		Project:    &pr.prj.name,
+		PipelineId: &pr.pipelineID,
+	}
+	pipeline, err := pr.prj.org.pipelines.GetPipeline(ctx, *args)
+	if err != nil {
+		return 0, err
+	}
+	if pipeline.Revision == nil {
+		return 0, fmt.Errorf("the pipeline has no revision")
+	}
+	return *pipeline.Revision, nil
+}
+
+// stableRevision returns the revision of the pipeline, that the latest
+// run with the tag 'stable' used.
+func (app *App) stableRevision(ctx context.Context, pr *pipelineRun) (int, error) {
+	client, err := pr.prj.org.buildClient(ctx)
+	if err != nil {
+		return 0, err
+	}
+	args := &build.GetBuildsArgs{
+		Project:     &pr.prj.name,
+		Definitions: &[]int{pr.pipelineID},
+		TagFilters:  &[]string{stableTag},
+		QueryOrder:  &build.BuildQueryOrderValues.QueueTimeDescending,
+		Top:         intPtr(1),
+	}
+	builds, err := client.GetBuilds(ctx, *args)
+	if err != nil {
+		return 0, err
+	}
+	if len(builds.Value) == 0 {
+		return 0, fmt.Errorf("no run is tagged '%s'", stableTag)
+	}
+	b := builds.Value[0]
+	if b.Definition == nil || b.Definition.Revision == nil {
+		return 0, fmt.Errorf("run %d tagged '%s' has no revision", *b.Id, stableTag)
+	}
+	return *b.Definition.Revision, nil
+}
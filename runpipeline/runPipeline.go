@@ -0,0 +1,1817 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/git"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/pipelines"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const ADOURL = "https://dev.azure.com"
+
+type App struct {
+	baseURL string
+	org     string
+	prj     string
+	token   string
+	// tokenSaved is true, if the token is read from the keyring
+	tokenSaved bool
+	pipelines  []string
+	ids        []int
+	branch     string
+	yamlPath   string
+	parameters []string
+	// variables are the variables of 'var', that are set at queue time
+	variables map[string]string
+
+	branchDefault string
+	// branchFromPipeline prefers the default branch of the pipeline to
+	// 'branch-default', that is only used, if it can not be read
+	branchFromPipeline bool
+	branchPattern      *regexp.Regexp
+
+	batch      *batchFile
+	timeout    time.Duration
+	deadline   time.Time
+	sequential bool
+	stageSLOs  stageSLOs
+	// stageTimeouts cancel the stages, that run longer
+	stageTimeouts stageSLOs
+	// summaryInterval is the interval of the progress summaries of a batch
+	summaryInterval time.Duration
+	// pollOnExit writes the started runs to resumeFile on SIGTERM, the
+	// runs of an existing resumeFile are polled instead of started
+	pollOnExit bool
+	resumeFile string
+	// handedOver is true, if the runs are written to resumeFile
+	handedOver bool
+	// runNameTemplate is the template of the name of the runs
+	runNameTemplate runNameTemplate
+	// jobDeadline is the time, when the program stops waiting, before the
+	// job of Azure DevOps, that runs the program, is killed
+	jobDeadline    time.Time
+	deadlineMargin time.Duration
+
+	// pollStrategyName selects the wait time between the status checks
+	pollStrategyName pollStrategyName
+	pollInterval     time.Duration
+	// maxPollCount is the maximum number of status checks of a run
+	maxPollCount int
+	// pipelineExistsRetry waits for pipelines, that do not exist yet, up to
+	// pipelineExistsTimeout
+	pipelineExistsRetry   bool
+	pipelineExistsTimeout time.Duration
+	// includeDisabled looks up disabled pipelines by name as well and
+	// warns about them
+	includeDisabled bool
+
+	// annotations are passed through to the outputs
+	annotations             annotations
+	annotationsAsTags       bool
+	annotationsAsProperties bool
+	// environmentOverrides are the environments, that runs must not use
+	environmentOverrides environmentOverrides
+	// waitForDeployment is the environment, whose deployment decides the
+	// result instead of the whole run
+	waitForDeployment string
+	// waitForEnvironment is the environment, whose deployment is awaited
+	// after the run is completed
+	waitForEnvironment        string
+	waitForEnvironmentTimeout time.Duration
+	// skipIfDeployed is the environment and the version, whose deployment
+	// makes starting the pipeline unnecessary
+	skipIfDeployed skipIfDeployed
+	// approveStage is the stage, whose pending approval is reported and
+	// with 'approve' or 'reject' decided
+	approveStage   string
+	approve        bool
+	reject         bool
+	approveMessage string
+	// capabilities are the optional subsystems, that the token may use
+	capabilities capabilities
+	// promptLock serializes the questions on the console of concurrent
+	// runs
+	promptLock sync.Mutex
+
+	pullRequest *pullRequestInfo
+	// reportToPRCheck posts the state of the runs as checks to the pull
+	// request, prCheckName replaces the pipeline as name of the checks
+	reportToPRCheck bool
+	prCheckName     string
+
+	runTemplate        *pipelines.RunPipelineParameters
+	presetParameters   map[string]string
+	promptedParameters map[string]string
+	interactive        bool
+	interactiveParams  bool
+	stdin              *bufio.Reader
+
+	// fileParameters are the parameters of 'params-file', the secrets
+	// are references until they are resolved
+	fileParameters    map[string]string
+	paramsSecrets     map[string]string
+	resolveAKVSecrets bool
+	keyVault          *keyVault
+	// paramsFromLastRun are the parameters, that are read from the output
+	// variables of the last successful run
+	paramsFromLastRun lastRunParameters
+
+	failOnIgnoredParams bool
+	skipParamValidation bool
+	paramSchemaFile     string
+	paramSchema         *paramSchema
+
+	// report reads the latest runs instead of starting the pipelines
+	report       bool
+	strictReport bool
+
+	// apiVersion replaces the API version of all requests
+	apiVersion apiVersion
+	// serverAPIVersion is the API version of the pipelines API of the
+	// server, nil if unknown
+	serverAPIVersion *azuredevops.Version
+	// userAgentValue is appended to the 'User-Agent' header of all
+	// requests or replaces it
+	userAgentValue   string
+	userAgentReplace bool
+
+	guard   []string
+	confirm []string
+
+	orgs           map[string]*organization
+	orgsLock       sync.Mutex
+	orgTokens      map[string]string
+	defaultProject *project
+
+	infoLog    bool
+	verboseLog bool
+	warnLog    bool
+
+	lockBackend LockBackend
+	lockTTL     time.Duration
+	lockWait    time.Duration
+	heldLocks   []string
+
+	commitStatus  commitStatusMode
+	retryOnCancel int
+	// triggerMaxAttempts are the attempts of the start of a run including
+	// the first after network errors and server errors
+	triggerMaxAttempts    int
+	triggerRetryBaseDelay time.Duration
+
+	downloadLogsDir      string
+	downloadArtifactsDir string
+
+	pool    string
+	demands demands
+	// pipelineRevision selects the revision of the pipelines, that the
+	// runs are started with
+	pipelineRevision pipelineRevision
+
+	failureIssue              bool
+	failureIssueAreaPath      string
+	failureIssueIterationPath string
+	// buildTagTemplate is the template of the Git tag, that is created on
+	// the commit of a succeeded run
+	buildTagTemplate buildTagTemplate
+	buildTagMessage  string
+
+	cancelSuperseded       bool
+	cancelSupersededMaxAge time.Duration
+	// deleteIfNeverStarted deletes the queued runs, when the program gives
+	// up waiting for them
+	deleteIfNeverStarted bool
+	// cleanupOnSuccess deletes the succeeded runs after they are reported
+	cleanupOnSuccess bool
+
+	envFile       string
+	envFileAppend bool
+	lineEnding    lineEnding
+	// captureFile receives the output variables of the runs
+	captureFile string
+	// reportMdFile receives the report of the runs as Markdown
+	reportMdFile string
+
+	output     outputFormat
+	statsdAddr string
+	// influxFile receives the lines of '-output influx'
+	influxFile string
+	timing     bool
+	timer      *phaseTimer
+	budget     *apiBudget
+	clock      *serverClock
+
+	telemetryEndpoint string
+	telemetryToken    string
+
+	auditLog     *auditLog
+	auditLogFile string
+	replay       bool
+	fixtures     *fixtureGenerator
+
+	listenAddr   string
+	livenessAddr string
+	statusFile   string
+	statusServer *statusServer
+
+	hooks hooks
+
+	enforceMinScopes bool
+
+	// tokenExpiryWarn is the window, in which an expiring token is
+	// reported
+	tokenExpiryWarn     time.Duration
+	failOnExpiringToken bool
+	tokenExpires        *time.Time
+
+	// checkConnectivity verifies, that Azure DevOps is reachable and
+	// healthy, before the first request
+	checkConnectivity   bool
+	failOnDegraded      bool
+	connectivityProblem string
+
+	bestEffort     bool
+	mappedExitCode int
+	// explainOnly prints the plan of the program instead of executing it
+	explainOnly bool
+	// planOnly makes the read-only calls and prints the actions with side
+	// effects instead of executing them
+	planOnly bool
+	// parametersOnly prints the parameters of the pipelines instead of
+	// the plan
+	parametersOnly bool
+	// embedded is true, if the program is used as library by a Client,
+	// exit returns the exit code as error instead of ending the process
+	embedded bool
+	// exitCause is the error of fail, that the library returns as cause
+	// of the exit
+	exitCause error
+	// command is the subcommand of the command line, args are the
+	// arguments after it
+	command command
+	args    []string
+	// runID is the run of the commands 'status' and 'cancel'
+	runID int
+	// flagsOnly defines the flags without parsing the command line, eg.
+	// for the shell completion
+	flagsOnly bool
+
+	runs []*pipelineRun
+	run  *runInfo
+	// exiting is set by the first call of exit, that runs the exit
+	// sequence
+	exiting atomic.Bool
+}
+
+// pipelineRun is a pipeline that is triggered and watched.
+type pipelineRun struct {
+	prj        *project
+	folder     string
+	name       string
+	pipelineID int
+	branch     string
+	parameters map[string]string
+	timeout    time.Duration
+	deadline   time.Time
+	runID      int
+	exitCode   int
+	info       runInfo
+
+	ignoredParameters []string
+	// environmentOverridden is true, if the run targeted an overridden
+	// environment and was canceled
+	environmentOverridden bool
+	// deployment is the deployment to the environment of
+	// 'wait-for-deployment'
+	deployment *deploymentInfo
+	// approval is the approval of the stage of 'approve-stage'
+	approval *approvalInfo
+	// queueID is the agent queue of 'pool' in the project of the run
+	queueID int
+	// triggered is the local time, when the run was requested
+	triggered time.Time
+	// revision is the revision of the pipeline of 'use-pipeline-revision'
+	revision int
+	// classic is true, if the pipeline is a classic build definition,
+	// that is queued and watched with the builds API
+	classic bool
+	// triggerAPI is the API, that started the run, 'pipelines' or 'builds'
+	triggerAPI string
+	// reportDetails are the optional data of the run for 'report-md'
+	reportDetails *reportDetails
+	// deleted is true, if the run was deleted by 'cleanup-on-success'
+	deleted bool
+	// timedOutStages are the stages, that ran longer than their timeout
+	// of 'timeout-per-stage' and were canceled
+	timedOutStages map[string]bool
+	// prCheckPending is true, while the check of 'report-to-pr-check' on
+	// the pull request is pending
+	prCheckPending bool
+	// resumedRunID is the run of 'poll-on-exit-resume-file', that is
+	// polled instead of starting the pipeline
+	resumedRunID int
+	// log is the logger of the run, that is created when the run is
+	// started, so that the entries of concurrent runs can be told apart
+	log *log.Entry
+}
+
+// pipelineLogger returns a logger for the pipeline, before it is resolved
+// to a run.
+func pipelineLogger(name string) *log.Entry {
+	return log.WithField("pipeline", name)
+}
+
+// runLogger returns a logger, that adds the pipeline, the run id and the
+// branch of the run to every entry.
+func runLogger(pr *pipelineRun) *log.Entry {
+	return log.WithFields(log.Fields{
+		"pipeline": pr.name,
+		"runId":    pr.runID,
+		"branch":   strings.TrimPrefix(pr.branch, "refs/heads/"),
+	})
+}
+
+type stringSlice []string
+
+func (s *stringSlice) String() string {
+	return fmt.Sprintf("%s", *s)
+}
+
+func (s *stringSlice) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+type intSlice []int
+
+func (s *intSlice) String() string {
+	return fmt.Sprintf("%v", *s)
+}
+
+func (s *intSlice) Set(value string) error {
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	*s = append(*s, i)
+	return nil
+}
+
+var paramsSlice stringSlice
+var pipelinesSlice stringSlice
+var pipelineIDsSlice intSlice
+var confirmSlice stringSlice
+var varsSlice stringSlice
+
+func (app *App) ParseCommandLine() {
+	paramOrgString := flag.String("org", "", "Azure DevOps organization.")
+	paramPrjString := flag.String("prj", "", "Azure DevOps project.")
+	paramBaseURLString := flag.String("ado-base-url", ADOURL, "Base URL of Azure DevOps, the organization is appended as path")
+	paramTokenString := flag.String("token", "", "Azure DevOps personal access token")
+	flag.Var(&pipelinesSlice, "pipeline", "Azure DevOps pipeline name or org/project/name, can be repeated")
+	flag.Var(&pipelineIDsSlice, "pipeline-id", "Azure DevOps pipeline id, can be repeated")
+	paramBatchFile := flag.String("batch-file", "", "YAML file with pipelines, that are started together")
+	paramGroupFile := flag.String("pipeline-group-file", "", "YAML file with named groups of pipelines")
+	paramGroup := flag.String("group", "", "Name of the pipeline group, that is started")
+	paramParallel := flag.Bool("parallel", false, "Starts all pipelines at once and watches them concurrently (default)")
+	flag.BoolVar(&app.sequential, "sequential", false, "Starts the pipelines one after another, stops after the first unsuccessful run")
+	flag.DurationVar(&app.timeout, "timeout", 0, "Maximum time of the program, runs are canceled after this time")
+	paramDeadline := flag.String("deadline", "", "Time like '2022-10-16T12:00:00Z', when the job of the program ends, default from SYSTEM_JOBTIMEOUT")
+	flag.DurationVar(&app.deadlineMargin, "deadline-margin", defaultDeadlineMargin, "Time before the deadline, when the program stops waiting")
+	flag.Var(&app.stageSLOs, "assert-stage-duration", "Maximum duration of a stage like 'stage=10m', can be repeated")
+	flag.Var(&app.stageTimeouts, "timeout-per-stage", "Cancels a stage, that runs longer than its timeout like 'stage=10m', can be repeated")
+	flag.Var(&app.environmentOverrides, "environment-override", "Environment like 'from=to', runs deploying to 'from' are canceled, can be repeated")
+	flag.StringVar(&app.waitForDeployment, "wait-for-deployment", "", "Environment, the program ends when the deployment of the run to it is finished")
+	flag.StringVar(&app.waitForEnvironment, "wait-for-environment", "", "Environment, whose deployment of the run is awaited after the run is completed")
+	flag.DurationVar(&app.waitForEnvironmentTimeout, "wait-for-environment-timeout", 15*time.Minute, "Maximum wait time for the deployment of 'wait-for-environment'")
+	flag.Var(&app.skipIfDeployed, "skip-if-env-deployed", "Environment and version like 'prod={{.Parameters.version}}', the pipeline is not started, if its last deployment to the environment is tagged with the version")
+	flag.StringVar(&app.approveStage, "approve-stage", "", "Stage, whose pending approval is reported and decided with 'approve' or 'reject'")
+	flag.BoolVar(&app.approve, "approve", false, "Approves the pending approval of 'approve-stage' after confirmation on the console or with 'approve-message'")
+	flag.BoolVar(&app.reject, "reject", false, "Rejects the pending approval of 'approve-stage' after confirmation on the console or with 'approve-message'")
+	flag.StringVar(&app.approveMessage, "approve-message", "", "Comment of the approval, decides it without confirmation on the console")
+	flag.Var(&app.runNameTemplate, "run-name", "Name of the run as Go template, eg. 'Deploy-{{.Branch}}-{{.Timestamp}}'")
+	app.pollStrategyName = pollFixed
+	flag.Var(&app.pollStrategyName, "poll-strategy", "Wait time between the status checks, 'fixed', 'exponential' or 'adaptive'")
+	flag.DurationVar(&app.summaryInterval, "summary-interval", 0, "Prints a summary of the completed, running and not started runs of several pipelines every interval, eg. 1m")
+	flag.BoolVar(&app.pollOnExit, "poll-on-exit", false, "Writes the started runs to 'poll-on-exit-resume-file' on SIGTERM, so that the next invocation resumes polling them")
+	flag.StringVar(&app.resumeFile, "poll-on-exit-resume-file", "", "File of 'poll-on-exit', whose runs are polled instead of started, if it exists")
+	flag.DurationVar(&app.pollInterval, "poll-interval", defaultPollInterval, "Maximum wait time between the status checks of a run")
+	flag.IntVar(&app.maxPollCount, "max-poll-count", 0, "Maximum number of status checks of a run, the program ends with exit code 13 after them")
+	flag.Var(&app.annotations, "annotation", "Annotation like 'key=value', that is passed to the outputs, can be repeated")
+	flag.BoolVar(&app.annotationsAsTags, "annotation-as-tags", false, "Adds the annotations as 'key=value' tags to the runs")
+	flag.BoolVar(&app.annotationsAsProperties, "annotation-as-properties", false, "Adds the annotations as properties to the runs")
+	paramBranchString := flag.String("branch", "", "Branch for pipeline run, default is the default branch of the pipeline")
+	flag.StringVar(&app.branchDefault, "branch-default", "", "Branch for pipeline run, if 'branch' is not specified, eg. master")
+	flag.BoolVar(&app.branchFromPipeline, "branch-default-from-pipeline", false, "Uses the default branch of the pipeline, if 'branch' is not specified, and 'branch-default' only, if it can not be read")
+	paramBranchFromGit := flag.Bool("branch-from-git", false, "Uses the current branch of the git repository in the working directory")
+	paramBranchPattern := flag.String("branch-pattern", "", "Regular expression, that the branch must match")
+	paramYamlPathString := flag.String("pipeline-yaml-path", "", "Path of the YAML file, that defines the pipeline")
+	flag.BoolVar(&app.pipelineExistsRetry, "pipeline-exists-retry", false, "Waits for a pipeline, that does not exist yet, eg. because it is created at the same time")
+	flag.DurationVar(&app.pipelineExistsTimeout, "pipeline-exists-timeout", defaultPipelineExistsTimeout, "Maximum wait time of 'pipeline-exists-retry' for a pipeline")
+	flag.BoolVar(&app.includeDisabled, "include-disabled-pipelines", false, "Looks up disabled pipelines by name as well and warns, if a pipeline is disabled or paused")
+	paramPullRequest := flag.Int("pr", 0, "Id of the pull request, that is merged in the pipeline run")
+	flag.BoolVar(&app.reportToPRCheck, "report-to-pr-check", false, "Posts a pending check to the pull request of 'pr' before the start and the result at the end")
+	flag.StringVar(&app.prCheckName, "pr-check-name", "", "Name of the check of 'report-to-pr-check', default is the name of the pipeline")
+	flag.Var(&paramsSlice, "param", "Parameter as string like 'key=value'")
+	flag.Var(&app.paramsFromLastRun, "param-from-last-run", "Parameter like 'key=source_key' with the value of the output variable 'source_key' of the last successful run, can be repeated")
+	flag.Var(&varsSlice, "var", "Variable of the run like 'key=value', that is settable at queue time, can be repeated")
+	paramParamsFile := flag.String("params-file", "", "YAML file with the parameters and secret references of the runs")
+	paramInterpolation := flag.Bool("pipeline-parameter-interpolation", false, "Replaces references like '${name}' to other parameters in the values of 'params-file'")
+	flag.BoolVar(&app.resolveAKVSecrets, "resolve-akv-secrets", false, "Resolves the secrets of 'params-file' from Azure Key Vault before the runs are started")
+	flag.StringVar(&app.pool, "pool", "", "Agent pool of the runs, the runs are queued with the builds API")
+	flag.Var(&app.pipelineRevision, "use-pipeline-revision", "Starts the runs with the 'latest' revision of the pipeline or the revision of the latest run tagged 'stable'")
+	flag.Var(&app.demands, "demand", "Demand of the agent like 'Agent.OS -equals Windows_NT', can be repeated")
+	paramRunTemplate := flag.String("pipeline-run-template", "", "YAML file with the run parameters of the pipelines API, that the other parameters override")
+	paramConfigString := flag.String("config", "", "Configuration file with parameter presets")
+	paramPresetString := flag.String("preset", "", "Name of the parameter preset from the configuration file")
+	flag.BoolVar(&app.failOnIgnoredParams, "fail-on-ignored-params", false, "Ends the program, if the pipeline does not declare a given parameter")
+	flag.BoolVar(&app.skipParamValidation, "skip-param-validation", false, "Sends the parameters without checking them against the pipeline")
+	flag.StringVar(&app.paramSchemaFile, "template-parameters-schema-file", "", "JSON Schema file, that the parameters are validated against before the start")
+	flag.Var(&app.apiVersion, "api-version", "API version of all requests instead of the detected version, eg. '6.0-preview.1'")
+	flag.StringVar(&app.userAgentValue, "user-agent", "", "Appended to the 'User-Agent' header of all requests, eg. 'release-bot/2.1'")
+	flag.BoolVar(&app.userAgentReplace, "user-agent-replace", false, "Replaces the 'User-Agent' header of all requests with 'user-agent'")
+	flag.Var(&confirmSlice, "confirm", "Name of a pipeline, that matches the guard of the configuration file, can be repeated")
+	paramInteractive := flag.Bool("interactive", false, "Prompts for required pipeline parameters, that are not specified")
+	flag.BoolVar(&app.interactiveParams, "interactive-params", false, "Prompts for all declared pipeline parameters and asks for confirmation before the start")
+	flag.IntVar(&app.retryOnCancel, "graceful-retry-on-cancel", 0, "Starts the pipeline again up to n times, if the run was canceled by Azure DevOps")
+	flag.IntVar(&app.triggerMaxAttempts, "trigger-max-retries", defaultTriggerAttempts, "Attempts of the start of a run including the first after network errors and 5xx responses, 1 disables the retries")
+	flag.DurationVar(&app.triggerRetryBaseDelay, "trigger-retry-base-delay", defaultTriggerRetryBaseDelay, "Upper bound of the random wait time before the first retry of the start, doubled for every further retry")
+	flag.BoolVar(&app.cancelSuperseded, "cancel-superseded", false, "Cancels queued and running runs of the pipeline on the same branch before the start")
+	flag.DurationVar(&app.cancelSupersededMaxAge, "cancel-superseded-max-age", 0, "Cancels only superseded runs, that are queued within this duration, eg. 2h")
+	flag.BoolVar(&app.deleteIfNeverStarted, "delete-if-never-started", false, "Cancels and deletes a run, that never started, when the program gives up waiting for it")
+	flag.BoolVar(&app.cleanupOnSuccess, "cleanup-on-success", false, "Deletes a run, that succeeded, after its outputs are written")
+	lockBackend := lockBackendFile
+	flag.Var(&lockBackend, "lock-backend", "Storage of the locks, 'file', 'redis' or 'etcd'")
+	paramLockDir := flag.String("lock-dir", "", "Shared directory for locks, that prevent parallel runs of a pipeline on a branch")
+	paramLockRedisAddr := flag.String("lock-redis-addr", "", "Address host:port of the Redis server for locks")
+	paramLockRedisPassword := flag.String("lock-redis-password", "", "Password of the Redis server for locks")
+	paramLockEtcdEndpoints := flag.String("lock-etcd-endpoints", "", "Comma separated URLs of the etcd servers for locks")
+	flag.DurationVar(&app.lockTTL, "lock-ttl", time.Hour, "Time after that a lock expires")
+	flag.DurationVar(&app.lockWait, "lock-wait", 0, "Time to wait for a lock held by another process")
+	flag.Var(&app.commitStatus, "set-commit-status", "Posts the result as status to the built commit or pull request,\nuse '=pending+final' to post a pending status after queueing")
+	flag.BoolVar(&app.failureIssue, "failure-issue", false, "Creates a bug work item for every failed run")
+	flag.StringVar(&app.failureIssueAreaPath, "failure-issue-area-path", "", "Area path of the bug work items, requires 'failure-issue'")
+	flag.StringVar(&app.failureIssueIterationPath, "failure-issue-iteration-path", "", "Iteration path of the bug work items, requires 'failure-issue'")
+	flag.Var(&app.buildTagTemplate, "build-tag", "Git tag as Go template, that is created on the built commit of a succeeded run, eg. 'deployed-to-prod-{{.RunID}}'")
+	flag.StringVar(&app.buildTagMessage, "build-tag-message", "", "Message of the tag of 'build-tag', creates an annotated instead of a lightweight tag")
+	paramVerboseOutput := flag.Bool("v", false, "Logging with verbose output")
+	paramInfoOutput := flag.Bool("i", false, "Logging with info output")
+	paramWarnOutput := flag.Bool("w", false, "Logging with warn output")
+	paramEnvFile := flag.String("env-file", "", "Writes run information as KEY=value lines to this file")
+	flag.StringVar(&app.captureFile, "capture-run-variables", "", "File, that receives the output variables of the completed runs")
+	flag.StringVar(&app.reportMdFile, "report-md", "", "Writes a report of the runs as Markdown to this file at the end")
+	flag.Var(&app.lineEnding, "line-endings", "Line ending of the env file, the run variables and the status file, 'lf', 'crlf' or 'native'")
+	flag.StringVar(&app.downloadLogsDir, "download-logs", "", "Directory, that the logs of the finished runs are downloaded to as zip")
+	flag.StringVar(&app.downloadArtifactsDir, "download-artifacts", "", "Directory, that the artifacts of the finished runs are downloaded to")
+	paramEnvFileAppend := flag.Bool("env-file-append", false, "Appends to the env file instead of truncating it")
+	app.output = outputText
+	flag.Var(&app.output, "output", "Format of the result, 'text', 'json', 'tap', 'datadog', 'influx' or 'github-workflow-summary'")
+	flag.StringVar(&app.statsdAddr, "statsd-addr", defaultStatsdAddr, "Address of DogStatsD for '-output datadog'")
+	flag.StringVar(&app.influxFile, "influx-file", "", "File, to which '-output influx' appends the runs in the InfluxDB line protocol")
+	flag.StringVar(&app.telemetryEndpoint, "telemetry-endpoint", "", "HTTP URL of a collector, that receives a JSON document of every finished run")
+	flag.StringVar(&app.telemetryToken, "telemetry-token", "", "Bearer token of the collector of 'telemetry-endpoint'")
+	flag.BoolVar(&app.bestEffort, "best-effort", false, "Exits with code 0 for every result of the run, configuration errors still fail")
+	paramAuditLogFile := flag.String("audit-log-file", "", "Appends a JSON line for every trigger, status check and cancel and for the invocation to this file")
+	paramAuditVerify := flag.String("audit-verify", "", "Checks, that every line of this audit log file is a complete record, and ends")
+	paramRecordDir := flag.String("record", "", "Records all API requests and responses to this directory")
+	paramReplayDir := flag.String("replay", "", "Answers all API requests from the exchanges recorded in this directory")
+	paramFixturesDir := flag.String("generate-fixtures", "", "Writes the API requests and responses as Go test server to this directory")
+	paramMaxAPICalls := flag.Int("max-api-calls", 0, "Maximum number of API requests, the polling is stretched when the budget runs low")
+	flag.BoolVar(&app.timing, "timing", false, "Prints the elapsed time of the phases of the program at the end")
+	flag.Var(&app.hooks.onSuccess, "on-success", "Command, that is executed if the runs succeeded, can be repeated")
+	flag.Var(&app.hooks.onFailure, "on-failure", "Command, that is executed if a run did not succeed, can be repeated")
+	flag.Var(&app.hooks.onComplete, "on-complete", "Command, that is executed when the runs are completed, can be repeated")
+	flag.BoolVar(&app.hooks.fatal, "hook-failures-fatal", false, "Ends the program with exit code 28, if a hook fails")
+	flag.DurationVar(&app.tokenExpiryWarn, "token-expiry-warn", 0, "Warns, if the token expires within this duration, eg. '168h'")
+	flag.BoolVar(&app.failOnExpiringToken, "fail-on-expiring-token", false, "Ends the program, if the token expires within 'token-expiry-warn'")
+	paramConnectRetries := flag.Int("connect-retries", defaultConnectRetries, "Retries of the first request to Azure DevOps, if the connection fails, eg. by DNS errors after a VPN connect")
+	flag.BoolVar(&app.checkConnectivity, "verify-connectivity", false, "Checks, that Azure DevOps is reachable and healthy, before the first request")
+	flag.BoolVar(&app.failOnDegraded, "fail-on-ado-degraded", false, "Ends the program, if Azure DevOps is not reachable or not healthy")
+	flag.BoolVar(&app.enforceMinScopes, "enforce-min-scopes", false, "Warns, if the token has broader scopes than 'Build (Read & execute)'")
+	paramListen := flag.String("listen", "", "Address of the HTTP endpoints '/healthz' and '/status' while waiting, eg. ':8080'")
+	flag.StringVar(&app.livenessAddr, "liveness-addr", "", "Address of the HTTP endpoint '/healthz' only, eg. ':8081' for a liveness probe")
+	flag.StringVar(&app.statusFile, "status-file", "", "JSON file, that is replaced with the '/status' document while waiting")
+
+	var credentials credentialCommand
+	flag.BoolVar(&credentials.save, "save-credentials", false, "Saves the token of the organization in the keyring of the operating system and ends")
+	flag.BoolVar(&credentials.delete, "delete-credentials", false, "Deletes the token of the organization from the keyring and ends")
+	flag.BoolVar(&credentials.list, "list-credentials", false, "Lists the organizations with a token in the keyring and ends")
+
+	flag.BoolVar(&app.report, "report", false, "Reports the latest completed run of the pipelines instead of starting them")
+	flag.BoolVar(&app.strictReport, "strict-report", false, "Fails the report, if a pipeline has no completed run")
+
+	var paramPrintSchema schemaKind
+	flag.BoolVar(&app.explainOnly, "explain", false, "Prints the steps, that the program would take, without any API call and ends")
+	flag.BoolVar(&app.planOnly, "plan", false, "Resolves the pipelines with read-only calls, prints the actions, that the program would take, and ends")
+	paramSelfUpdate := flag.Bool("self-update", false, "Replaces the program with the latest release, if it is newer, and ends")
+	paramSelfUpdateCheck := flag.Bool("self-update-check", false, "Checks for a newer release and ends with exit code 10, if there is one")
+	flag.Var(&paramPrintSchema, "print-schema", "Prints the JSON Schema of the 'json', 'events', 'invocation', 'result', 'status' or 'telemetry' document or the 'parameters' of the pipeline and ends")
+	flag.IntVar(&app.runID, "run-id", 0, "Run of the commands 'status' and 'cancel'")
+	paramHelp := flag.Bool("h", false, "Shows usage of this command.")
+
+	useCommandFlags(app.command)
+	showUsage()
+	if app.flagsOnly {
+		return
+	}
+	flag.CommandLine.Parse(app.args)
+
+	app.envFile = *paramEnvFile
+	app.listenAddr = *paramListen
+	app.envFileAppend = *paramEnvFileAppend
+
+	if *paramHelp {
+		flag.CommandLine.Usage()
+		app.exit(0)
+	}
+
+	if paramPrintSchema != "" && paramPrintSchema != schemaParameters {
+		if err := writeSchema(os.Stdout, paramPrintSchema); err != nil {
+			fmt.Fprintf(os.Stderr, "Schema could not be written: %v\n", err)
+			app.exit(5)
+		}
+		app.exit(0)
+	}
+
+	if *paramAuditVerify != "" {
+		corrupt, err := verifyAuditLog(*paramAuditVerify, os.Stdout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Audit log file '%s' could not be read: %v\n", *paramAuditVerify, err)
+			app.exit(5)
+		}
+		if corrupt > 0 {
+			app.exit(41)
+		}
+		app.exit(0)
+	}
+
+	if *paramSelfUpdate && *paramSelfUpdateCheck {
+		fmt.Fprintln(os.Stderr, "Parameter 'self-update' can not be combined with parameter 'self-update-check'.")
+		flag.CommandLine.Usage()
+		app.exit(8)
+	}
+	if *paramSelfUpdate || *paramSelfUpdateCheck {
+		app.runSelfUpdate(*paramSelfUpdateCheck)
+	}
+
+	if credentials.given() {
+		app.runCredentialCommand(credentials, *paramOrgString, *paramTokenString)
+	}
+
+	if *paramOrgString == "" {
+		fmt.Fprintln(os.Stderr, "Parameter 'org' is empty.")
+		flag.CommandLine.Usage()
+		app.exit(1)
+	}
+	if *paramPrjString == "" {
+		fmt.Fprintln(os.Stderr, "Parameter 'prj' is empty.")
+		flag.CommandLine.Usage()
+		app.exit(2)
+	}
+	if *paramTokenString == "" {
+		// the token can be saved with 'save-credentials'
+		token, err := loadCredential(*paramOrgString)
+		if err != nil || token == "" {
+			fmt.Fprintf(os.Stderr, "Parameter 'token' is empty and no token of organization '%s' is saved.\n", *paramOrgString)
+			flag.CommandLine.Usage()
+			app.exit(3)
+		}
+		*paramTokenString = token
+		app.tokenSaved = true
+	}
+	switch {
+	case app.runID != 0 && app.command != commandStatus && app.command != commandCancel:
+		fmt.Fprintln(os.Stderr, "Parameter 'run-id' requires the command 'status' or 'cancel'.")
+		flag.CommandLine.Usage()
+		app.exit(5)
+	case app.runID < 0:
+		fmt.Fprintln(os.Stderr, "Parameter 'run-id' must be positive.")
+		flag.CommandLine.Usage()
+		app.exit(5)
+	case app.command == commandCancel && app.runID == 0:
+		fmt.Fprintln(os.Stderr, "Command 'cancel' requires parameter 'run-id'.")
+		flag.CommandLine.Usage()
+		app.exit(5)
+	case app.command == commandStatus:
+		// the status is the report of the run or the latest completed run
+		app.report = true
+	}
+	// the pipelines of a report can be listed in the configuration file,
+	// the pipeline of 'cancel' is optional and 'list' has none
+	reportFromConfig := app.report && *paramConfigString != ""
+	noPipeline := app.command == commandList || app.command == commandCancel
+	if len(pipelinesSlice) == 0 && len(pipelineIDsSlice) == 0 && *paramBatchFile == "" && *paramGroup == "" && !reportFromConfig && !noPipeline {
+		fmt.Fprintln(os.Stderr, "Parameter 'pipeline' is empty.")
+		flag.CommandLine.Usage()
+		app.exit(4)
+	}
+	if app.runID > 0 && (len(pipelinesSlice)+len(pipelineIDsSlice) > 1 || *paramBatchFile != "" || *paramGroup != "") {
+		fmt.Fprintln(os.Stderr, "Parameter 'run-id' can not be combined with more than one pipeline.")
+		flag.CommandLine.Usage()
+		app.exit(8)
+	}
+
+	if *paramPullRequest != 0 && isFlagSet("branch") {
+		fmt.Fprintln(os.Stderr, "Parameter 'pr' can not be combined with parameter 'branch'.")
+		flag.CommandLine.Usage()
+		app.exit(8)
+	}
+	if *paramBranchFromGit && (isFlagSet("branch") || *paramPullRequest != 0) {
+		fmt.Fprintln(os.Stderr, "Parameter 'branch-from-git' can not be combined with parameter 'branch' or 'pr'.")
+		flag.CommandLine.Usage()
+		app.exit(8)
+	}
+	if *paramBranchPattern != "" && *paramPullRequest != 0 {
+		fmt.Fprintln(os.Stderr, "Parameter 'branch-pattern' can not be combined with parameter 'pr'.")
+		flag.CommandLine.Usage()
+		app.exit(8)
+	}
+	if app.waitForDeployment != "" && app.waitForEnvironment != "" {
+		fmt.Fprintln(os.Stderr, "Parameter 'wait-for-environment' can not be combined with parameter 'wait-for-deployment'.")
+		flag.CommandLine.Usage()
+		app.exit(8)
+	}
+	if app.waitForEnvironment == "" && isFlagSet("wait-for-environment-timeout") {
+		fmt.Fprintln(os.Stderr, "Parameter 'wait-for-environment-timeout' requires parameter 'wait-for-environment'.")
+		flag.CommandLine.Usage()
+		app.exit(5)
+	}
+	if app.approve && app.reject {
+		fmt.Fprintln(os.Stderr, "Parameter 'approve' can not be combined with parameter 'reject'.")
+		flag.CommandLine.Usage()
+		app.exit(8)
+	}
+	if (app.approve || app.reject) && app.approveStage == "" {
+		fmt.Fprintln(os.Stderr, "Parameters 'approve' and 'reject' require parameter 'approve-stage'.")
+		flag.CommandLine.Usage()
+		app.exit(5)
+	}
+	if app.approveMessage != "" && !app.approve && !app.reject {
+		fmt.Fprintln(os.Stderr, "Parameter 'approve-message' requires parameter 'approve' or 'reject'.")
+		flag.CommandLine.Usage()
+		app.exit(5)
+	}
+	if (app.approve || app.reject) && app.approveMessage == "" && !isTerminal(os.Stdin) {
+		fmt.Fprintln(os.Stderr, "Parameters 'approve' and 'reject' require a console for the confirmation or parameter 'approve-message'.")
+		flag.CommandLine.Usage()
+		app.exit(5)
+	}
+	if app.waitForEnvironmentTimeout <= 0 {
+		fmt.Fprintln(os.Stderr, "Parameter 'wait-for-environment-timeout' must be positive.")
+		flag.CommandLine.Usage()
+		app.exit(5)
+	}
+
+	if *paramParallel && app.sequential {
+		fmt.Fprintln(os.Stderr, "Parameter 'parallel' can not be combined with parameter 'sequential'.")
+		flag.CommandLine.Usage()
+		app.exit(8)
+	}
+
+	if *paramGroup != "" {
+		if *paramGroupFile == "" {
+			fmt.Fprintln(os.Stderr, "Parameter 'group' requires parameter 'pipeline-group-file'.")
+			flag.CommandLine.Usage()
+			app.exit(5)
+		}
+		groups, err := loadGroupFile(*paramGroupFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Pipeline group file '%s' could not be read: %v\n", *paramGroupFile, err)
+			app.exit(5)
+		}
+		group, ok := groups.Groups[*paramGroup]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Group '%s' is not defined in pipeline group file '%s'.\n", *paramGroup, *paramGroupFile)
+			app.exit(6)
+		}
+		pipelinesSlice = append(pipelinesSlice, group...)
+	}
+
+	if app.paramSchemaFile != "" {
+		schema, err := loadParamSchema(app.paramSchemaFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Parameter schema file '%s' could not be read: %v\n", app.paramSchemaFile, err)
+			app.exit(5)
+		}
+		app.paramSchema = schema
+	}
+
+	deadline, err := jobDeadline(*paramDeadline, os.Getenv, time.Now(), app.deadlineMargin)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Deadline of the job could not be determined: %v\n", err)
+		app.exit(5)
+	}
+	app.jobDeadline = deadline
+
+	if app.pollInterval <= 0 {
+		fmt.Fprintln(os.Stderr, "Parameter 'poll-interval' must be positive.")
+		flag.CommandLine.Usage()
+		app.exit(5)
+	}
+	for _, timeout := range app.stageTimeouts {
+		if timeout.max <= 0 {
+			fmt.Fprintf(os.Stderr, "Timeout of stage '%s' of parameter 'timeout-per-stage' must be positive.\n", timeout.stage)
+			flag.CommandLine.Usage()
+			app.exit(5)
+		}
+	}
+	if app.maxPollCount < 0 {
+		fmt.Fprintln(os.Stderr, "Parameter 'max-poll-count' must not be negative.")
+		flag.CommandLine.Usage()
+		app.exit(5)
+	}
+	if app.summaryInterval < 0 {
+		fmt.Fprintln(os.Stderr, "Parameter 'summary-interval' must not be negative.")
+		flag.CommandLine.Usage()
+		app.exit(5)
+	}
+	if app.pollOnExit && app.resumeFile == "" {
+		fmt.Fprintln(os.Stderr, "Parameter 'poll-on-exit' requires parameter 'poll-on-exit-resume-file'.")
+		flag.CommandLine.Usage()
+		app.exit(5)
+	}
+	if app.resumeFile != "" && app.report {
+		fmt.Fprintln(os.Stderr, "Parameter 'poll-on-exit-resume-file' can not be combined with parameter 'report' or the command 'status'.")
+		flag.CommandLine.Usage()
+		app.exit(8)
+	}
+	if isFlagSet("pipeline-exists-timeout") && !app.pipelineExistsRetry {
+		fmt.Fprintln(os.Stderr, "Parameter 'pipeline-exists-timeout' requires parameter 'pipeline-exists-retry'.")
+		flag.CommandLine.Usage()
+		app.exit(5)
+	}
+	if app.pipelineExistsTimeout <= 0 {
+		fmt.Fprintln(os.Stderr, "Parameter 'pipeline-exists-timeout' must be positive.")
+		flag.CommandLine.Usage()
+		app.exit(5)
+	}
+
+	if app.failOnDegraded && !app.checkConnectivity {
+		fmt.Fprintln(os.Stderr, "Parameter 'fail-on-ado-degraded' requires parameter 'verify-connectivity'.")
+		flag.CommandLine.Usage()
+		app.exit(5)
+	}
+	if app.failOnExpiringToken && app.tokenExpiryWarn <= 0 {
+		fmt.Fprintln(os.Stderr, "Parameter 'fail-on-expiring-token' requires parameter 'token-expiry-warn'.")
+		flag.CommandLine.Usage()
+		app.exit(5)
+	}
+
+	if strings.ContainsAny(app.userAgentValue, "\r\n") {
+		fmt.Fprintln(os.Stderr, "Parameter 'user-agent' must not contain line breaks.")
+		flag.CommandLine.Usage()
+		app.exit(5)
+	}
+	if app.userAgentReplace && app.userAgentValue == "" {
+		fmt.Fprintln(os.Stderr, "Parameter 'user-agent-replace' requires parameter 'user-agent'.")
+		flag.CommandLine.Usage()
+		app.exit(5)
+	}
+
+	if app.telemetryEndpoint != "" {
+		if u, err := url.Parse(app.telemetryEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fmt.Fprintln(os.Stderr, "Parameter 'telemetry-endpoint' is not a HTTP URL.")
+			flag.CommandLine.Usage()
+			app.exit(5)
+		}
+	} else if app.telemetryToken != "" {
+		fmt.Fprintln(os.Stderr, "Parameter 'telemetry-token' requires parameter 'telemetry-endpoint'.")
+		flag.CommandLine.Usage()
+		app.exit(5)
+	}
+
+	if app.output == outputInflux && app.influxFile == "" {
+		fmt.Fprintln(os.Stderr, "Format 'influx' of parameter 'output' requires parameter 'influx-file'.")
+		flag.CommandLine.Usage()
+		app.exit(5)
+	}
+	if app.output != outputInflux && app.influxFile != "" {
+		fmt.Fprintln(os.Stderr, "Parameter 'influx-file' requires format 'influx' of parameter 'output'.")
+		flag.CommandLine.Usage()
+		app.exit(5)
+	}
+
+	if !app.failureIssue && (app.failureIssueAreaPath != "" || app.failureIssueIterationPath != "") {
+		fmt.Fprintln(os.Stderr, "Parameters 'failure-issue-area-path' and 'failure-issue-iteration-path' require parameter 'failure-issue'.")
+		flag.CommandLine.Usage()
+		app.exit(5)
+	}
+	if app.buildTagMessage != "" && app.buildTagTemplate.template == nil {
+		fmt.Fprintln(os.Stderr, "Parameter 'build-tag-message' requires parameter 'build-tag'.")
+		flag.CommandLine.Usage()
+		app.exit(5)
+	}
+
+	if *paramBatchFile != "" {
+		batch, err := loadBatchFile(*paramBatchFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Batch file '%s' could not be read: %v\n", *paramBatchFile, err)
+			app.exit(5)
+		}
+		app.batch = batch
+	}
+
+	if *paramRunTemplate != "" {
+		template, err := loadRunTemplate(*paramRunTemplate)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Run template '%s' could not be read: %v\n", *paramRunTemplate, err)
+			app.exit(5)
+		}
+		app.runTemplate = template
+	}
+	if app.queueBuilds() {
+		app.checkQueueTemplate()
+	}
+
+	if *paramPresetString != "" && *paramConfigString == "" {
+		fmt.Fprintln(os.Stderr, "Parameter 'preset' requires parameter 'config'.")
+		flag.CommandLine.Usage()
+		app.exit(5)
+	}
+	cfg := &config{}
+	if *paramConfigString != "" {
+		var err error
+		cfg, err = loadConfig(*paramConfigString)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Configuration file '%s' could not be read: %v\n", *paramConfigString, err)
+			app.exit(5)
+		}
+	}
+	app.orgTokens = cfg.Tokens
+	if *paramAuditLogFile == "" {
+		*paramAuditLogFile = cfg.AuditLogFile
+	}
+	if reportFromConfig && len(pipelinesSlice) == 0 && len(pipelineIDsSlice) == 0 && *paramBatchFile == "" && *paramGroup == "" {
+		if len(cfg.Report) == 0 {
+			fmt.Fprintf(os.Stderr, "Parameter 'pipeline' is empty and configuration file '%s' has no report.\n", *paramConfigString)
+			flag.CommandLine.Usage()
+			app.exit(4)
+		}
+		pipelinesSlice = append(pipelinesSlice, cfg.Report...)
+	}
+	app.guard = cfg.Guard
+	app.confirm = confirmSlice
+	if *paramPresetString != "" {
+		preset, ok := cfg.Presets[*paramPresetString]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Preset '%s' is not defined in configuration file '%s'.\n", *paramPresetString, *paramConfigString)
+			app.exit(6)
+		}
+		app.presetParameters = preset
+	}
+	if *paramParamsFile != "" {
+		file, err := loadParamsFile(*paramParamsFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Parameter file '%s' could not be read: %v\n", *paramParamsFile, err)
+			app.exit(5)
+		}
+		if len(file.Secrets) > 0 && !app.resolveAKVSecrets {
+			fmt.Fprintf(os.Stderr, "Parameter file '%s' has secrets, that require parameter 'resolve-akv-secrets'.\n", *paramParamsFile)
+			flag.CommandLine.Usage()
+			app.exit(5)
+		}
+		if *paramInterpolation {
+			if err = file.interpolate(); err != nil {
+				fmt.Fprintf(os.Stderr, "Parameter file '%s' could not be read: %v\n", *paramParamsFile, err)
+				app.exit(5)
+			}
+		}
+		app.useParamsFile(file)
+	} else if app.resolveAKVSecrets {
+		fmt.Fprintln(os.Stderr, "Parameter 'resolve-akv-secrets' requires parameter 'params-file'.")
+		flag.CommandLine.Usage()
+		app.exit(5)
+	} else if *paramInterpolation {
+		fmt.Fprintln(os.Stderr, "Parameter 'pipeline-parameter-interpolation' requires parameter 'params-file'.")
+		flag.CommandLine.Usage()
+		app.exit(5)
+	}
+
+	app.baseURL = *paramBaseURLString
+	app.org = *paramOrgString
+	app.prj = *paramPrjString
+	app.token = *paramTokenString
+	for _, name := range pipelinesSlice {
+		if containsString(app.pipelines, name) {
+			fmt.Fprintf(os.Stderr, "Pipeline '%s' is specified more than once.\n", name)
+		} else {
+			app.pipelines = append(app.pipelines, name)
+		}
+	}
+	for _, id := range pipelineIDsSlice {
+		if containsInt(app.ids, id) {
+			fmt.Fprintf(os.Stderr, "Pipeline id %d is specified more than once.\n", id)
+		} else {
+			app.ids = append(app.ids, id)
+		}
+	}
+	app.branch = *paramBranchString
+	if *paramBranchFromGit {
+		branch, err := gitBranch()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Branch could not be detected from git: %v\n", err)
+			app.exit(9)
+		}
+		app.branch = branch
+	}
+	if *paramBranchPattern != "" {
+		pattern, err := regexp.Compile(*paramBranchPattern)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Parameter 'branch-pattern' is not a valid regular expression: %v\n", err)
+			app.exit(9)
+		}
+		app.branchPattern = pattern
+	}
+	app.yamlPath = *paramYamlPathString
+	if *paramPullRequest != 0 {
+		app.pullRequest = &pullRequestInfo{ID: *paramPullRequest}
+	}
+	if app.reportToPRCheck && app.pullRequest == nil {
+		fmt.Fprintln(os.Stderr, "Parameter 'report-to-pr-check' requires parameter 'pr'.")
+		flag.CommandLine.Usage()
+		app.exit(5)
+	}
+	if app.prCheckName != "" && !app.reportToPRCheck {
+		fmt.Fprintln(os.Stderr, "Parameter 'pr-check-name' requires parameter 'report-to-pr-check'.")
+		flag.CommandLine.Usage()
+		app.exit(5)
+	}
+
+	for i := 0; i < len(paramsSlice); i++ {
+		if strings.Contains(paramsSlice[i], "=") {
+			app.parameters = append(app.parameters, paramsSlice[i])
+		} else {
+			fmt.Fprintln(os.Stderr, "Parameters 'param' does not contain '='.")
+		}
+	}
+	for _, kv := range varsSlice {
+		key, value, ok := strings.Cut(kv, "=")
+		if !ok || key == "" {
+			fmt.Fprintf(os.Stderr, "Parameter 'var' is not like 'key=value': %s\n", kv)
+			flag.CommandLine.Usage()
+			app.exit(5)
+		}
+		if app.variables == nil {
+			app.variables = make(map[string]string)
+		}
+		app.variables[key] = value
+	}
+
+	app.interactive = *paramInteractive
+	if app.interactiveParams && app.interactive {
+		fmt.Fprintln(os.Stderr, "Parameter 'interactive-params' can not be combined with parameter 'interactive'.")
+		flag.CommandLine.Usage()
+		app.exit(8)
+	}
+	if app.interactiveParams && !isTerminal(os.Stdin) {
+		fmt.Fprintln(os.Stderr, "Parameter 'interactive-params' requires a console.")
+		flag.CommandLine.Usage()
+		app.exit(5)
+	}
+	lockFlags := map[string]lockBackendKind{"lock-dir": lockBackendFile, "lock-redis-addr": lockBackendRedis, "lock-redis-password": lockBackendRedis, "lock-etcd-endpoints": lockBackendEtcd}
+	for _, name := range []string{"lock-dir", "lock-redis-addr", "lock-redis-password", "lock-etcd-endpoints"} {
+		if backend := lockFlags[name]; isFlagSet(name) && lockBackend != backend {
+			fmt.Fprintf(os.Stderr, "Parameter '%s' requires parameter 'lock-backend' %s.\n", name, backend)
+			flag.CommandLine.Usage()
+			app.exit(5)
+		}
+	}
+	switch {
+	case *paramLockDir != "":
+		app.lockBackend = newFileLockBackend(*paramLockDir)
+	case lockBackend == lockBackendFile && isFlagSet("lock-backend"):
+		fmt.Fprintln(os.Stderr, "Parameter 'lock-backend' file requires parameter 'lock-dir'.")
+		flag.CommandLine.Usage()
+		app.exit(5)
+	case lockBackend == lockBackendRedis:
+		if *paramLockRedisAddr == "" {
+			fmt.Fprintln(os.Stderr, "Parameter 'lock-backend' redis requires parameter 'lock-redis-addr'.")
+			flag.CommandLine.Usage()
+			app.exit(5)
+		}
+		app.lockBackend = newRedisLockBackend(*paramLockRedisAddr, *paramLockRedisPassword)
+	case lockBackend == lockBackendEtcd:
+		var endpoints []string
+		for _, endpoint := range strings.Split(*paramLockEtcdEndpoints, ",") {
+			if endpoint = strings.TrimSpace(endpoint); endpoint != "" {
+				endpoints = append(endpoints, endpoint)
+			}
+		}
+		if len(endpoints) == 0 {
+			fmt.Fprintln(os.Stderr, "Parameter 'lock-backend' etcd requires parameter 'lock-etcd-endpoints'.")
+			flag.CommandLine.Usage()
+			app.exit(5)
+		}
+		app.lockBackend = newEtcdLockBackend(endpoints)
+	}
+
+	if app.planOnly {
+		for _, name := range []string{"explain", "report", "interactive", "interactive-params", "record", "generate-fixtures"} {
+			if isFlagSet(name) {
+				fmt.Fprintf(os.Stderr, "Parameter 'plan' can not be combined with parameter '%s'.\n", name)
+				flag.CommandLine.Usage()
+				app.exit(8)
+			}
+		}
+	}
+	if paramPrintSchema == schemaParameters {
+		for _, name := range []string{"plan", "explain", "report", "interactive", "interactive-params", "record", "generate-fixtures"} {
+			if isFlagSet(name) {
+				fmt.Fprintf(os.Stderr, "Parameter 'print-schema' parameters can not be combined with parameter '%s'.\n", name)
+				flag.CommandLine.Usage()
+				app.exit(8)
+			}
+		}
+		// the parameters are read without side effects like the plan
+		app.planOnly = true
+		app.parametersOnly = true
+	}
+	app.auditLogFile = *paramAuditLogFile
+	if *paramAuditLogFile != "" && !app.planOnly {
+		auditLog, err := openAuditLog(*paramAuditLogFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Audit log file '%s' could not be opened: %v\n", *paramAuditLogFile, err)
+			app.exit(5)
+		}
+		app.auditLog = auditLog
+	}
+	if *paramRecordDir != "" && *paramReplayDir != "" {
+		fmt.Fprintln(os.Stderr, "Parameter 'record' can not be combined with parameter 'replay'.")
+		flag.CommandLine.Usage()
+		app.exit(8)
+	}
+	if app.resolveAKVSecrets && (*paramRecordDir != "" || *paramReplayDir != "" || *paramFixturesDir != "") {
+		fmt.Fprintln(os.Stderr, "Parameter 'resolve-akv-secrets' can not be combined with parameter 'record', 'replay' or 'generate-fixtures', the recorded requests would contain the secrets.")
+		flag.CommandLine.Usage()
+		app.exit(8)
+	}
+	if app.triggerMaxAttempts < 1 {
+		fmt.Fprintln(os.Stderr, "Parameter 'trigger-max-retries' must be at least 1, the first attempt.")
+		flag.CommandLine.Usage()
+		app.exit(5)
+	}
+	if app.triggerRetryBaseDelay < 0 {
+		fmt.Fprintln(os.Stderr, "Parameter 'trigger-retry-base-delay' must not be negative.")
+		flag.CommandLine.Usage()
+		app.exit(5)
+	}
+	transport := http.DefaultTransport
+	if *paramConnectRetries < 0 {
+		fmt.Fprintln(os.Stderr, "Parameter 'connect-retries' must not be negative.")
+		flag.CommandLine.Usage()
+		app.exit(5)
+	}
+	if *paramConnectRetries > 0 {
+		transport = newWarmUpTransport(*paramConnectRetries, transport)
+	}
+	if *paramRecordDir != "" {
+		if err := os.MkdirAll(*paramRecordDir, 0755); err != nil {
+			fmt.Fprintf(os.Stderr, "Record directory '%s' could not be created: %v\n", *paramRecordDir, err)
+			app.exit(5)
+		}
+		transport = &recordTransport{next: transport, dir: *paramRecordDir, token: *paramTokenString}
+	}
+	if *paramReplayDir != "" {
+		exchanges, err := loadExchanges(*paramReplayDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Recorded exchanges could not be read: %v\n", err)
+			app.exit(5)
+		}
+		transport = &replayTransport{exchanges: exchanges, used: make([]bool, len(exchanges)), mismatch: app.replayMismatch}
+		app.replay = true
+	}
+	if *paramFixturesDir != "" {
+		if *paramRecordDir != "" || *paramReplayDir != "" {
+			fmt.Fprintln(os.Stderr, "Parameter 'generate-fixtures' can not be combined with parameter 'record' or 'replay'.")
+			flag.CommandLine.Usage()
+			app.exit(8)
+		}
+		if err := os.MkdirAll(*paramFixturesDir, 0755); err != nil {
+			fmt.Fprintf(os.Stderr, "Fixture directory '%s' could not be created: %v\n", *paramFixturesDir, err)
+			app.exit(5)
+		}
+		recorder := &recordTransport{next: transport, token: *paramTokenString}
+		transport = recorder
+		app.fixtures = &fixtureGenerator{dir: *paramFixturesDir, recorder: recorder}
+	}
+	app.budget = newAPIBudget(*paramMaxAPICalls, transport)
+
+	app.infoLog = *paramInfoOutput
+	app.warnLog = *paramWarnOutput
+	app.verboseLog = *paramVerboseOutput
+}
+
+// isZeroValue is true for default values, that are not shown in the usage.
+func isZeroValue(value string) bool {
+	switch value {
+	case "", "false", "[]", "0", "0s":
+		return true
+	}
+	return false
+}
+
+// isFlagSet is true, if the flag is given on the command line.
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+func showUsage() {
+	flag.Usage = func() {
+		flagSet := flag.CommandLine
+		order := []string{"org", "prj", "ado-base-url", "api-version", "user-agent", "user-agent-replace", "token", "pipeline", "pipeline-id", "batch-file", "pipeline-group-file", "group", "parallel", "sequential", "timeout", "deadline", "deadline-margin", "assert-stage-duration", "timeout-per-stage", "poll-strategy", "poll-interval", "max-poll-count", "summary-interval", "poll-on-exit", "poll-on-exit-resume-file", "pipeline-yaml-path", "pipeline-exists-retry", "pipeline-exists-timeout", "include-disabled-pipelines", "run-name", "annotation", "annotation-as-tags", "annotation-as-properties", "environment-override", "wait-for-deployment", "wait-for-environment", "wait-for-environment-timeout", "skip-if-env-deployed", "approve-stage", "approve", "reject", "approve-message", "branch", "branch-default", "branch-default-from-pipeline", "branch-from-git", "branch-pattern", "pr", "report-to-pr-check", "pr-check-name", "param", "param-from-last-run", "var", "params-file", "pipeline-parameter-interpolation", "resolve-akv-secrets", "pool", "demand", "use-pipeline-revision", "pipeline-run-template", "config", "preset", "fail-on-ignored-params", "skip-param-validation", "template-parameters-schema-file", "confirm", "interactive", "interactive-params", "graceful-retry-on-cancel", "trigger-max-retries", "trigger-retry-base-delay", "cancel-superseded", "cancel-superseded-max-age", "delete-if-never-started", "cleanup-on-success", "lock-backend", "lock-dir", "lock-redis-addr", "lock-redis-password", "lock-etcd-endpoints", "lock-ttl", "lock-wait", "set-commit-status", "failure-issue", "failure-issue-area-path", "failure-issue-iteration-path", "build-tag", "build-tag-message", "env-file", "env-file-append", "capture-run-variables", "report-md", "line-endings", "download-logs", "download-artifacts", "output", "statsd-addr", "influx-file", "telemetry-endpoint", "telemetry-token", "timing", "max-api-calls", "audit-log-file", "audit-verify", "record", "replay", "generate-fixtures", "enforce-min-scopes", "token-expiry-warn", "fail-on-expiring-token", "connect-retries", "verify-connectivity", "fail-on-ado-degraded", "listen", "liveness-addr", "status-file", "on-success", "on-failure", "on-complete", "hook-failures-fatal", "best-effort", "report", "strict-report", "run-id", "save-credentials", "delete-credentials", "list-credentials", "explain", "plan", "print-schema", "self-update", "self-update-check", "w", "i", "v", "h"}
+
+		fmt.Fprintf(flagSet.Output(), "Usage of %s:\n", flagSet.Name())
+
+		for _, name := range order {
+			var b strings.Builder
+			fflag := flagSet.Lookup(name)
+			if fflag == nil {
+				// the flag is not a flag of the command
+				continue
+			}
+			fmt.Fprintf(&b, "  -%s", fflag.Name) // Two spaces before -; see next two comments.
+			name, usage := flag.UnquoteUsage(fflag)
+			if len(name) > 0 {
+				b.WriteString(" ")
+				b.WriteString(name)
+			}
+			// Boolean flags of one ASCII letter are so common we
+			// treat them specially, putting their usage on the same line.
+			if b.Len() <= 4 { // space, space, '-', 'x'.
+				b.WriteString("\t")
+			} else {
+				// Four spaces before the tab triggers good alignment
+				// for both 4- and 8-space tab stops.
+				b.WriteString("\n    \t")
+			}
+			b.WriteString(strings.ReplaceAll(usage, "\n", "\n    \t"))
+			if !isZeroValue(fflag.DefValue) {
+				fmt.Fprintf(&b, " (default %q)", fflag.DefValue)
+			}
+
+			fmt.Fprint(flagSet.Output(), b.String(), "\n")
+		}
+	}
+}
+
+// Main is the command line program. It parses the command line, starts
+// and watches the runs and ends the process with the exit code. The
+// version of the build is used in the 'User-Agent' header and by
+// 'self-update'.
+func Main(buildVersion string) {
+	if len(os.Args) > 1 && isCommand(os.Args[1]) {
+		executeCommand(buildVersion)
+		return
+	}
+	runCommand(buildVersion, commandRun, os.Args[1:])
+}
+
+// runCommand parses the flags of the command and executes it. It ends
+// the process with the exit code.
+func runCommand(buildVersion string, cmd command, args []string) {
+	version = buildVersion
+	customFormatter := new(log.TextFormatter)
+	customFormatter.FullTimestamp = true
+	log.SetFormatter(customFormatter)
+	log.SetOutput(os.Stdout)
+	log.SetLevel(log.ErrorLevel)
+
+	app := &App{run: &runInfo{}, clock: &serverClock{}, command: cmd, args: args}
+	log.StandardLogger().ExitFunc = app.exit
+	app.ParseCommandLine()
+	if app.explainOnly {
+		app.explain(os.Stdout)
+		app.exit(0)
+	}
+	app.timer = newPhaseTimer()
+	if app.timeout > 0 {
+		app.deadline = time.Now().Add(app.timeout)
+	}
+
+	if !app.output.console() {
+		// stdout is reserved for the result document
+		log.SetOutput(os.Stderr)
+	}
+
+	if app.warnLog {
+		log.SetLevel(log.WarnLevel)
+	}
+	if app.infoLog {
+		log.SetLevel(log.InfoLevel)
+	}
+	if app.verboseLog {
+		log.SetLevel(log.DebugLevel)
+	}
+
+	if !app.jobDeadline.IsZero() {
+		log.Infof("The program stops waiting at %s, before the job ends.", app.jobDeadline.Local().Format(time.RFC3339))
+	}
+
+	app.handleSignals()
+	if app.listenAddr != "" && !app.planOnly {
+		app.listen(app.listenAddr)
+	}
+	if app.livenessAddr != "" && !app.planOnly {
+		app.listenLiveness(app.livenessAddr)
+	}
+	if app.statusFile != "" && !app.planOnly {
+		app.useStatusFile(app.statusFile)
+	}
+	if app.summaryInterval > 0 && !app.planOnly {
+		// the summaries are printed from the snapshots of the runs
+		app.ensureStatusServer()
+	}
+
+	if app.checkConnectivity {
+		app.verifyConnectivity(context.Background())
+	}
+	app.resolveSecrets(context.Background())
+	// the clients of the SDK use the default transport
+	http.DefaultTransport = app.transport()
+
+	ctx := context.Background()
+	done := app.timer.begin("clientInit")
+	app.defaultProject = app.project(ctx, app.org, app.prj)
+	done()
+	app.checkServerVersion(ctx, app.defaultProject.org)
+	if app.tokenExpiryWarn > 0 {
+		app.checkTokenExpiry(ctx, app.defaultProject.org)
+	}
+	if app.auditLog != nil {
+		app.auditLog.caller = app.callerIdentity(ctx)
+	}
+
+	if app.pullRequest != nil {
+		done = app.timer.begin("pullRequest")
+		app.resolvePullRequest(ctx)
+		done()
+	}
+	switch app.command {
+	case commandList:
+		app.exit(app.listPipelines(ctx))
+	case commandCancel:
+		app.runs = app.resolvePipelines(ctx)
+		app.exit(app.cancelCommandRun(ctx))
+	}
+	done = app.timer.begin("resolve")
+	app.runs = app.resolvePipelines(ctx)
+	if app.report {
+		// the latest run on any branch is reported, if no branch is given
+		for _, pr := range app.runs {
+			if pr.branch == "" {
+				pr.branch = app.branch
+			}
+		}
+	} else {
+		app.resolveBranches(ctx, app.runs)
+	}
+	done()
+	if app.parametersOnly {
+		app.printParameters(ctx, os.Stdout)
+	}
+	if app.planOnly {
+		app.plan(ctx, os.Stdout)
+	}
+	for _, pr := range app.runs {
+		app.statusServer.update(pr, false)
+	}
+	if app.report {
+		app.mappedExitCode = app.runReport(ctx, app.runs)
+	} else {
+		app.mappedExitCode = app.startRuns(ctx)
+	}
+	if app.bestEffort && app.mappedExitCode != 0 {
+		fmt.Fprintf(os.Stderr, "Exit code %d of the run result is suppressed by best-effort mode.\n", app.mappedExitCode)
+		app.exit(0)
+	}
+	app.exit(app.mappedExitCode)
+}
+
+// startRuns checks the resolved pipelines, starts them and waits for the
+// runs. It returns the exit code of the run result.
+func (app *App) startRuns(ctx context.Context) int {
+	code := 0
+	runs := app.runs
+	if app.skipIfDeployed.template != nil {
+		runs = app.skipDeployedRuns(ctx, runs)
+		if len(runs) == 0 {
+			if len(app.runs) == 1 {
+				app.run = &app.runs[0].info
+				return 0
+			}
+			return app.summarize(app.runs)
+		}
+	}
+	starting := runs
+	if app.resumeFile != "" {
+		app.readResumeFile(runs)
+		starting = notResumed(runs)
+	}
+	if len(app.guard) > 0 {
+		app.checkGuard(ctx, starting)
+	}
+	if len(app.paramsFromLastRun) > 0 {
+		app.resolveLastRunParameters(ctx, starting)
+	}
+	app.resolveDefinitionKinds(ctx, runs)
+	if len(app.environmentOverrides) > 0 {
+		app.resolveEnvironmentOverrides(ctx, runs)
+	}
+	if app.pool != "" {
+		app.resolveQueues(ctx, runs)
+	}
+	if app.pipelineRevision != "" {
+		app.resolveRevisions(ctx, runs)
+	}
+	if app.enforceMinScopes {
+		app.checkTokenScopes(ctx, runs)
+	}
+	if app.interactive {
+		app.promptParameters(ctx, starting)
+	}
+	if app.interactiveParams {
+		app.promptDeclaredParameters(ctx, starting)
+	}
+	if app.paramSchema != nil {
+		app.validateParameters(starting)
+	}
+	stopProgress := app.startProgress(runs)
+	if app.sequential {
+		code = app.runSequential(ctx, runs)
+	} else {
+		for _, pr := range runs {
+			app.startRun(ctx, pr)
+		}
+		code = app.watchRuns(ctx, runs)
+	}
+	stopProgress()
+	if app.resumeFile != "" {
+		app.removeResumeFile()
+	}
+	if app.deploymentEnvironment() != "" && app.output.console() {
+		printDeployments(os.Stdout, app.runs)
+	}
+	if app.captureFile != "" {
+		if err := app.writeRunVariables(app.captureFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Run variables file '%s' could not be written: %v\n", app.captureFile, err)
+		}
+	}
+	if len(app.stageSLOs) > 0 {
+		// a violated stage duration only fails a successful run
+		if sloCode := app.checkStageDurations(ctx, app.runs); code == 0 {
+			code = sloCode
+		}
+	}
+	return code
+}
+
+// startRun triggers the run of the pipeline or takes over the run of the
+// resume file. The program ends, if the run can not be started.
+func (app *App) startRun(ctx context.Context, pr *pipelineRun) {
+	if pr.resumedRunID > 0 {
+		app.resumeRun(pr)
+		return
+	}
+	if app.lockBackend != nil {
+		done := app.timer.begin("lock")
+		app.acquireLock(pr)
+		done()
+	}
+	app.checkIgnoredParameters(ctx, pr)
+	if app.cancelSuperseded {
+		done := app.timer.begin("cancelSuperseded")
+		app.cancelSupersededRuns(ctx, pr)
+		done()
+	}
+	if app.reportToPRCheck {
+		app.postPullRequestCheck(ctx, pr, git.GitStatusStateValues.Pending, fmt.Sprintf("Pipeline '%s' is starting", pr.name))
+	}
+	// the run id is added to the logger, when the run is started
+	pr.log = runLogger(pr)
+	pr.runID = app.runPipeline(ctx, pr)
+	if pr.runID == -1 {
+		pr.log.Errorf("Pipeline '%s' start failed.", pr.name)
+		app.fail(1, fmt.Errorf("pipeline '%s' start failed", pr.name))
+	}
+	pr.log = runLogger(pr)
+	if app.runNameTemplate.template != nil {
+		app.setRunName(ctx, pr)
+	}
+	if app.annotationsAsTags && len(app.annotations) > 0 {
+		app.tagAnnotations(ctx, pr)
+	}
+	if app.annotationsAsProperties && len(app.annotations) > 0 {
+		app.propertyAnnotations(ctx, pr)
+	}
+	pr.deadline = app.runDeadline(pr)
+	app.statusServer.update(pr, false)
+	if app.commitStatus == commitStatusPendingFinal {
+		app.setCommitStatus(ctx, pr, git.GitStatusStateValues.Pending, fmt.Sprintf("Run %s is queued", pr.info.BuildNumber))
+	}
+}
+
+// exit is the single exit point of the program. Fatal log entries are
+// routed here as well, so that the run information is written on every
+// terminal path before the process ends. The exit sequence runs once,
+// also if several goroutines end the program at the same time.
+func (app *App) exit(code int) {
+	if app.embedded {
+		panic(exitCode(code))
+	}
+	if !app.exiting.CompareAndSwap(false, true) {
+		// the exit sequence runs in another goroutine, eg. a watcher ran
+		// out of time while a signal arrived, and ends the program. The
+		// sequence itself never calls exit.
+		select {}
+	}
+	app.run.ExitCode = code
+	if app.planOnly || app.command == commandList {
+		// the plan and the list of the pipelines have no side effects
+		os.Exit(code)
+	}
+	app.releaseLocks()
+	app.abandonPullRequestChecks(context.Background())
+	app.statusServer.saveFile()
+	app.statusServer.close()
+	code = app.runHooks(code)
+	app.run.ExitCode = code
+	if app.auditLog != nil {
+		app.writeInvocation(code)
+	}
+	if app.envFile != "" && !app.explainOnly {
+		if err := app.writeEnvFile(); err != nil {
+			fmt.Fprintf(os.Stderr, "Env file '%s' could not be written: %v\n", app.envFile, err)
+		}
+	}
+	if app.reportMdFile != "" && !app.explainOnly {
+		if err := app.writeMarkdownReport(code); err != nil {
+			fmt.Fprintf(os.Stderr, "Report file '%s' could not be written: %v\n", app.reportMdFile, err)
+		}
+	}
+	if app.fixtures != nil {
+		if path, err := app.writeFixture(); err != nil {
+			fmt.Fprintf(os.Stderr, "Fixture could not be written to '%s': %v\n", app.fixtures.dir, err)
+		} else if path != "" {
+			log.Infof("Fixture is written to '%s'.", path)
+		}
+	}
+	// the timer is started after the command line is parsed
+	if app.timer != nil {
+		app.writeOutput(code)
+	}
+	app.reportConnectivityProblem(code)
+	os.Exit(code)
+}
+
+// fail ends the program with the exit code like exit. The library returns
+// the error as cause of the exit.
+func (app *App) fail(code int, err error) {
+	if app.embedded {
+		app.exitCause = err
+	}
+	app.exit(code)
+}
+
+// handleSignals ends the program via exit on SIGINT and SIGTERM, so that
+// the locks are released and the hooks and outputs are not skipped. On
+// Windows CTRL_C and CTRL_BREAK arrive as SIGINT, closing the console,
+// logging off and shutting down as SIGTERM.
+func (app *App) handleSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		log.Warnf("Signal '%v' received, the program ends.", sig)
+		ctx := context.Background()
+		if limit := signalCleanupLimit(sig); limit > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, limit)
+			defer cancel()
+		}
+		// the runs of the resume file, that never started, are polled by
+		// the next invocation instead of being deleted
+		handedOver := sig == syscall.SIGTERM && app.pollOnExit && app.writeResumeFile()
+		if !handedOver {
+			app.deleteUnfinishedNeverStarted(ctx)
+		}
+		code := 1
+		if s, ok := sig.(syscall.Signal); ok {
+			code = 128 + int(s)
+		}
+		app.exit(code)
+	}()
+}
+
+// organizationURL combines the base URL of Azure DevOps and the
+// organization, eg. https://server.company.com/tfs/DefaultCollection.
+func (app *App) organizationURL(org string) string {
+	return strings.TrimRight(app.baseURL, "/") + "/" + org
+}
+
+func initClient(ctx context.Context, url string, token string) (pipelines.Client, *azuredevops.Connection) {
+	connection := azuredevops.NewPatConnection(url, token)
+	pipelineClient := pipelines.NewClient(ctx, connection)
+
+	return pipelineClient, connection
+}
+
+func (app *App) logStatus(ctx context.Context, pr *pipelineRun) int {
+	exitCode := 0
+	strategy := app.pollStrategy(ctx, pr)
+	for polls := 1; ; polls++ {
+		if app.budget.exhausted() {
+			app.budgetExhausted(pr)
+		}
+		done := app.timer.begin("poll")
+		auditCtx, call := app.auditContext(ctx, "status_check", pr.name, pr.pipelineID, pr.runID)
+		result, ec, run := app.getRunStatus(auditCtx, pr)
+		done()
+		pr.info.update(run)
+		call.done(0, pr.info.statusText())
+		app.statusServer.update(pr, true)
+		if len(app.environmentOverrides) > 0 && result != "completed" {
+			app.checkEnvironmentOverrides(ctx, pr)
+		}
+		if app.approveStage != "" && result != "completed" {
+			app.checkApproval(ctx, pr)
+		}
+		var stageWait time.Duration
+		if len(app.stageTimeouts) > 0 && result != "completed" {
+			stageWait = app.checkStageTimeouts(ctx, pr)
+		}
+		if app.waitForDeployment != "" {
+			if deployed, code := app.checkDeployment(ctx, pr); deployed {
+				exitCode = code
+				break
+			}
+			if result == "completed" && pr.deployment != nil && pr.deployment.EnvironmentID != 0 {
+				pr.log.Warnf("Run %d of pipeline '%s' did not deploy to environment '%s', the result of the whole run is used.", pr.runID, pr.name, app.waitForDeployment)
+			}
+		}
+		if result == "completed" {
+			exitCode = ec
+			if len(pr.timedOutStages) > 0 {
+				exitCode = 14
+			}
+			break
+		} else {
+			pr.log.Debugf("... '%s (id: %d)' is still running.", pr.name, pr.pipelineID)
+		}
+		if app.maxPollCount > 0 && polls >= app.maxPollCount {
+			app.maxPollCountReached(pr)
+		}
+		elapsed := app.runElapsed(pr)
+		wait := app.budget.pollInterval(strategy.Next(polls, elapsed))
+		if stageWait > 0 {
+			wait = minDuration(wait, stageWait)
+		}
+		if app.replay {
+			// the recorded responses are available immediately
+			wait = 0
+		}
+		if !pr.deadline.IsZero() {
+			remaining := time.Until(pr.deadline)
+			if remaining <= 0 {
+				exitCode = app.timeoutRun(ctx, pr)
+				break
+			}
+			wait = minDuration(wait, remaining)
+		}
+		if !app.jobDeadline.IsZero() {
+			remaining := time.Until(app.jobDeadline)
+			if remaining <= 0 {
+				app.jobDeadlineReached()
+			}
+			wait = minDuration(wait, remaining)
+		}
+		select {
+		case <-ctx.Done():
+			pr.log.Errorf("Waiting for run %d of pipeline '%s' is canceled: %v", pr.runID, pr.name, ctx.Err())
+			app.fail(1, ctx.Err())
+		case <-time.After(wait):
+		}
+	}
+	pr.log.Infof("Pipeline '%s (id: %d)' with run id '%d' finished. Exit code will be %d", pr.name, pr.pipelineID, pr.runID, exitCode)
+	if !pr.info.Finished.IsZero() {
+		pr.log.Debugf("Run %d of pipeline '%s' took %v.", pr.runID, pr.name, app.clock.serverDuration(pr.log, "duration of the run", pr.info.Created, pr.info.Finished).Round(time.Second))
+	}
+
+	return exitCode
+}
+
+func (app *App) getRunStatus(ctx context.Context, pr *pipelineRun) (string, int, *pipelines.Run) {
+	exitCode := 3
+	logger := pr.log
+
+	run, err := app.readRun(ctx, pr)
+	if err != nil {
+		logger.Error("Error occurred during get pipeline run status. ", err)
+		app.fail(1, err)
+	}
+	if run != nil {
+		state := fmt.Sprintf("%v", *run.State)
+		if run.FinishedDate != nil {
+			finishedDate := (*run.FinishedDate).Time
+			runResult := string(pipelines.RunResultValues.Unknown)
+			if run.Result != nil {
+				runResult = string(normalizeResult(string(*run.Result)))
+			}
+			exitCode = resultExitCode(runResult)
+			url := *run.Url
+			if pr.info.Started.IsZero() && !pr.classic {
+				app.readStartTime(ctx, pr)
+			}
+			var created time.Time
+			if run.CreatedDate != nil {
+				created = run.CreatedDate.Time
+			}
+			phases := phasesText(created, pr.info.Started, finishedDate)
+			if exitCode == 3 {
+				logger.Warnf("Pipeline %s is in state '%s' with result '%s', %s (URL: %s).", *run.Pipeline.Name, state, runResult, phases, url)
+			} else {
+				logger.Infof("Pipeline %s is in state '%s' with result '%s', %s (URL: %s).", *run.Pipeline.Name, state, runResult, phases, url)
+			}
+		}
+		return state, exitCode, run
+	}
+	return "unknown", exitCode, nil
+}
+
+func (app *App) getParameters() map[string]string {
+	p := make(map[string]string)
+
+	if app.runTemplate != nil && app.runTemplate.TemplateParameters != nil {
+		for key, value := range *app.runTemplate.TemplateParameters {
+			p[key] = value
+		}
+	}
+	for key, value := range app.fileParameters {
+		p[key] = value
+	}
+	for key, value := range app.presetParameters {
+		p[key] = value
+	}
+	for key, value := range app.promptedParameters {
+		p[key] = value
+	}
+	for _, kvp := range app.parameters {
+		kv := strings.Split(kvp, "=")
+		if len(kv) == 2 {
+			p[kv[0]] = kv[1]
+		}
+	}
+
+	return p
+}
+
+// runParameters returns the parameters of the run, the parameters of the
+// batch file override the parameters of the command line.
+func (app *App) runParameters(pr *pipelineRun) map[string]string {
+	p := app.getParameters()
+	for key, value := range pr.parameters {
+		p[key] = value
+	}
+	return p
+}
+
+// runPipelineArgs returns the arguments to start a run of the pipeline
+// on the branch of the run.
+func (app *App) runPipelineArgs(pr *pipelineRun) *pipelines.RunPipelineArgs {
+	params := app.runTemplateParameters()
+	if params.Resources == nil {
+		params.Resources = &pipelines.RunResourcesParameters{}
+	}
+	if params.Resources.Repositories == nil {
+		m := make(map[string]pipelines.RepositoryResourceParameters)
+		params.Resources.Repositories = &m
+	}
+	self := (*params.Resources.Repositories)["self"]
+	self.RefName = &pr.branch
+	(*params.Resources.Repositories)["self"] = self
+
+	v := app.runParameters(pr)
+	params.TemplateParameters = &v
+	if len(app.variables) > 0 {
+		variables := make(map[string]pipelines.Variable)
+		if params.Variables != nil {
+			for name, variable := range *params.Variables {
+				variables[name] = variable
+			}
+		}
+		for name, value := range app.variables {
+			value := value
+			variables[name] = pipelines.Variable{Value: &value}
+		}
+		params.Variables = &variables
+	}
+
+	args := &pipelines.RunPipelineArgs{
+		RunParameters: params,
+		Project:       &pr.prj.name,
+		PipelineId:    &pr.pipelineID,
+	}
+	if pr.revision > 0 {
+		args.PipelineVersion = &pr.revision
+	}
+	return args
+}
+
+func (app *App) runPipeline(ctx context.Context, pr *pipelineRun) int {
+	defer app.timer.begin("trigger")()
+	runId := -1
+
+	args := app.runPipelineArgs(pr)
+	auditCtx, call := app.auditContext(ctx, "trigger", pr.name, pr.pipelineID, 0)
+	call.setParameters(*args.RunParameters.TemplateParameters)
+	var run *pipelines.Run
+	var err error
+	pr.triggered = time.Now()
+	pr.triggerAPI = app.triggerAPI(pr)
+	run, err = app.runPipelineWithRetry(ctx, pr, func() (*pipelines.Run, error) {
+		if pr.triggerAPI == triggerBuilds {
+			return app.queueBuild(auditCtx, pr, *args.RunParameters.TemplateParameters)
+		}
+		return pr.prj.org.pipelines.RunPipeline(auditCtx, *args)
+	})
+	if err != nil {
+		pr.log.Error(err)
+		app.fail(1, err)
+	}
+	if run != nil {
+		pr.info.update(run)
+		call.done(*run.Id, pr.info.statusText())
+		runId = *run.Id
+		runState := fmt.Sprintf("%v", *run.State)
+		pr.log.WithField("runId", runId).Debugf("Run pipeline '%s'. Run id is '%d' and state is '%s'.", pr.name, runId, runState)
+	}
+	return runId
+}
+
+func (app *App) getPipelineID(ctx context.Context, prj *project, name string) int {
+	result, err := app.findPipelines(ctx, prj, name)
+	if err != nil {
+		pipelineLogger(name).Error("Error occurred during get pipelines call.", err)
+		app.fail(1, err)
+	}
+	if app.yamlPath != "" {
+		return app.selectByYamlPath(ctx, prj, name, result)
+	}
+	i := 0
+	pid := -1
+	for _, pref := range result {
+		if pid == -1 {
+			pid = getID(pref, name)
+		}
+		if pid != -1 {
+			return pid
+		}
+		i++
+	}
+	return pid
+}
+
+func getID(pipeline pipelines.Pipeline, name string) int {
+	if fmt.Sprintf("%v", *pipeline.Name) == name {
+		pipelineLogger(name).Infof("Pipeline %s has ID %d.", name, *pipeline.Id)
+		return *pipeline.Id
+	} else {
+		return -1
+	}
+}
@@ -0,0 +1,102 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/build"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// runNameTemplate is the value of the flag 'run-name'. The value is a
+// Go template, that is parsed when the flag is set.
+type runNameTemplate struct {
+	text     string
+	template *template.Template
+}
+
+func (t *runNameTemplate) String() string {
+	return t.text
+}
+
+func (t *runNameTemplate) Set(value string) error {
+	tmpl, err := template.New("run-name").Option("missingkey=error").Parse(value)
+	if err != nil {
+		return err
+	}
+	t.text = value
+	t.template = tmpl
+	return nil
+}
+
+// runNameData are the values available in the template of 'run-name'.
+type runNameData struct {
+	Org        string
+	Project    string
+	Pipeline   string
+	Branch     string
+	Timestamp  string
+	Parameters map[string]string
+}
+
+// runName returns the name of the run from the template.
+func (app *App) runName(pr *pipelineRun) (string, error) {
+	data := runNameData{
+		Org:        pr.prj.org.name,
+		Project:    pr.prj.name,
+		Pipeline:   pr.name,
+		Branch:     strings.TrimPrefix(pr.branch, "refs/heads/"),
+		Timestamp:  time.Now().UTC().Format("20060102-150405"),
+		Parameters: app.runParameters(pr),
+	}
+	var name strings.Builder
+	if err := app.runNameTemplate.template.Execute(&name, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(name.String()), nil
+}
+
+// setRunName sets the name of the started run. The run parameters of
+// the pipelines API have no name, therefore the build number of the run
+// is updated. Failures are only logged as warnings.
+func (app *App) setRunName(ctx context.Context, pr *pipelineRun) {
+	name, err := app.runName(pr)
+	if err != nil {
+		pr.log.Warnf("Name of run %d of pipeline '%s' could not be created: %v", pr.runID, pr.name, err)
+		return
+	}
+	if name == "" {
+		return
+	}
+	client, err := pr.prj.org.buildClient(ctx)
+	if err == nil {
+		args := &build.UpdateBuildArgs{
+			Build:   &build.Build{BuildNumber: &name},
+			Project: &pr.prj.name,
+			BuildId: &pr.runID,
+		}
+		_, err = client.UpdateBuild(ctx, *args)
+	}
+	if err != nil {
+		pr.log.Warnf("Name of run %d of pipeline '%s' could not be set: %v", pr.runID, pr.name, err)
+		return
+	}
+	pr.info.BuildNumber = name
+	pr.log.Infof("Run %d of pipeline '%s' is named '%s'.", pr.runID, pr.name, name)
+}
@@ -0,0 +1,258 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/build"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/pipelines"
+	log "github.com/sirupsen/logrus"
+	"sort"
+	"time"
+)
+
+// listRunsCap is the maximum number of runs returned by the pipelines
+// API. If the list is capped, the builds API is used instead.
+const listRunsCap = 10000
+
+// buildPageSize is the number of builds fetched per request.
+const buildPageSize = 200
+
+// runRecord is a run in the list of runs of a pipeline.
+type runRecord struct {
+	ID     int
+	State  string
+	Result string
+	// Branch is only known, if the runs are read from the builds API.
+	Branch   string
+	Created  time.Time
+	Finished time.Time
+}
+
+// runFilter selects runs from the list of runs of a pipeline. Empty
+// fields do not filter.
+type runFilter struct {
+	// branch is the full ref, eg. refs/heads/main.
+	branch string
+	// states are the states of the pipelines API: inProgress, canceling
+	// and completed.
+	states []string
+	// results are succeeded, partiallySucceeded, failed and canceled.
+	results  []string
+	maxCount int
+	maxAge   time.Duration
+	// now is the estimated time of the server, that maxAge is measured
+	// from
+	now time.Time
+}
+
+func (f runFilter) matches(r runRecord) bool {
+	if f.branch != "" && r.Branch != f.branch {
+		return false
+	}
+	if len(f.states) > 0 && !containsString(f.states, r.State) {
+		return false
+	}
+	if len(f.results) > 0 && !containsString(f.results, r.Result) {
+		return false
+	}
+	if f.maxAge > 0 && f.now.Sub(r.Created) > f.maxAge {
+		return false
+	}
+	return true
+}
+
+// apply returns the matching runs, newest first and bounded by maxCount.
+func (f runFilter) apply(records []runRecord) []runRecord {
+	var selected []runRecord
+	for _, r := range records {
+		if f.matches(r) {
+			selected = append(selected, r)
+		}
+	}
+	sort.SliceStable(selected, func(i, j int) bool {
+		return selected[i].Created.After(selected[j].Created)
+	})
+	if f.maxCount > 0 && len(selected) > f.maxCount {
+		selected = selected[:f.maxCount]
+	}
+	return selected
+}
+
+// listRuns returns the runs of the pipeline, that match the filter,
+// newest first. The pipelines API is used, as long as its list is not
+// capped and no branch is filtered, the builds API otherwise.
+func (app *App) listRuns(ctx context.Context, prj *project, pipelineID int, filter runFilter) ([]runRecord, error) {
+	if filter.now.IsZero() {
+		filter.now = app.clock.now()
+	}
+	if filter.branch == "" {
+		records, err := app.listPipelineRuns(ctx, prj, pipelineID)
+		if err != nil {
+			return nil, err
+		}
+		if len(records) < listRunsCap {
+			return filter.apply(records), nil
+		}
+		log.Debugf("List of runs of pipeline %d is capped at %d runs, the builds are listed instead.", pipelineID, listRunsCap)
+	}
+	records, err := app.listBuildRuns(ctx, prj, pipelineID, filter)
+	if err != nil {
+		return nil, err
+	}
+	return filter.apply(records), nil
+}
+
+// listPipelineRuns reads the runs from the pipelines API.
+func (app *App) listPipelineRuns(ctx context.Context, prj *project, pipelineID int) ([]runRecord, error) {
+	args := &pipelines.ListRunsArgs{
+		Project:    &prj.name,
+		PipelineId: &pipelineID,
+	}
+	runs, err := prj.org.pipelines.ListRuns(ctx, *args)
+	if err != nil {
+		return nil, err
+	}
+	var records []runRecord
+	if runs == nil {
+		return records, nil
+	}
+	for _, run := range *runs {
+		r := runRecord{}
+		if run.Id != nil {
+			r.ID = *run.Id
+		}
+		if run.State != nil {
+			r.State = string(*run.State)
+		}
+		if run.Result != nil {
+			r.Result = string(normalizeResult(string(*run.Result)))
+		}
+		if run.CreatedDate != nil {
+			r.Created = run.CreatedDate.Time
+		}
+		if run.FinishedDate != nil {
+			r.Finished = run.FinishedDate.Time
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+// buildStatuses are the statuses of the builds API for the states of the
+// pipelines API.
+var buildStatuses = map[string][]build.BuildStatus{
+	"inProgress": {build.BuildStatusValues.NotStarted, build.BuildStatusValues.InProgress, build.BuildStatusValues.Postponed},
+	"canceling":  {build.BuildStatusValues.Cancelling},
+	"completed":  {build.BuildStatusValues.Completed},
+}
+
+// listBuildRuns reads the runs from the builds API page by page. The
+// states, the branch and the age are filtered by the server. The pages
+// are fetched until maxCount matching runs are found.
+func (app *App) listBuildRuns(ctx context.Context, prj *project, pipelineID int, filter runFilter) ([]runRecord, error) {
+	client, err := prj.org.buildClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	statuses := []build.BuildStatus{build.BuildStatusValues.All}
+	if len(filter.states) > 0 {
+		statuses = nil
+		for _, state := range filter.states {
+			statuses = append(statuses, buildStatuses[state]...)
+		}
+	}
+
+	var records []runRecord
+	for _, status := range statuses {
+		status := status
+		matching := 0
+		token := ""
+		pages := 0
+		for {
+			args := &build.GetBuildsArgs{
+				Project:      &prj.name,
+				Definitions:  &[]int{pipelineID},
+				StatusFilter: &status,
+				QueryOrder:   &build.BuildQueryOrderValues.QueueTimeDescending,
+				Top:          intPtr(buildPageSize),
+			}
+			if filter.branch != "" {
+				args.BranchName = &filter.branch
+			}
+			if filter.maxAge > 0 {
+				args.MinTime = &azuredevops.Time{Time: filter.now.Add(-filter.maxAge)}
+			}
+			if token != "" {
+				args.ContinuationToken = &token
+			}
+			page, err := client.GetBuilds(ctx, *args)
+			if err != nil {
+				return nil, err
+			}
+			pages++
+			for _, b := range page.Value {
+				r := buildRecord(b)
+				records = append(records, r)
+				if filter.matches(r) {
+					matching++
+				}
+			}
+			token = page.ContinuationToken
+			if token == "" || (filter.maxCount > 0 && matching >= filter.maxCount) {
+				break
+			}
+		}
+		log.Debugf("%d page(s) of builds with status '%s' of pipeline %d fetched.", pages, status, pipelineID)
+	}
+	return records, nil
+}
+
+// buildRecord maps a build to a run of the pipelines API.
+func buildRecord(b build.Build) runRecord {
+	r := runRecord{}
+	if b.Id != nil {
+		r.ID = *b.Id
+	}
+	if b.Status != nil {
+		for state, statuses := range buildStatuses {
+			for _, status := range statuses {
+				if status == *b.Status {
+					r.State = state
+				}
+			}
+		}
+	}
+	if b.Result != nil && *b.Result != build.BuildResultValues.None {
+		r.Result = string(normalizeResult(string(*b.Result)))
+	}
+	if b.SourceBranch != nil {
+		r.Branch = *b.SourceBranch
+	}
+	if b.QueueTime != nil {
+		r.Created = b.QueueTime.Time
+	}
+	if b.FinishTime != nil {
+		r.Finished = b.FinishTime.Time
+	}
+	return r
+}
+
+func intPtr(i int) *int {
+	return &i
+}
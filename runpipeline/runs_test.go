@@ -0,0 +1,158 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// queuedAt is the queue time of the builds and runs served by the tests.
+var queuedAt = time.Date(2022, 10, 16, 12, 0, 0, 0, time.UTC)
+
+// routeBuildPages serves the builds of pipeline 1 newest first in pages
+// of the requested size, that are continued by the index of the next
+// build as token.
+func routeBuildPages(f *fakeServer, count int) {
+	f.route(locationBuilds, "{project}/_apis/build/builds/{buildId}", func(req *fakeRequest) (int, interface{}) {
+		query := req.URL.Query()
+		start, _ := strconv.Atoi(query.Get("continuationToken"))
+		top, _ := strconv.Atoi(query.Get("$top"))
+		end := start + top
+		if end >= count {
+			end = count
+		} else {
+			req.header.Set("X-MS-ContinuationToken", strconv.Itoa(end))
+		}
+		builds := []interface{}{}
+		for i := start; i < end; i++ {
+			branch := "refs/heads/main"
+			if i%2 == 1 {
+				branch = "refs/heads/develop"
+			}
+			builds = append(builds, map[string]interface{}{
+				"id": count - i, "status": "completed", "result": "succeeded", "sourceBranch": branch,
+				"queueTime":  queuedAt.Add(-time.Duration(i) * time.Minute).Format(time.RFC3339),
+				"definition": map[string]interface{}{"id": 1, "name": "build"},
+			})
+		}
+		return http.StatusOK, map[string]interface{}{"count": len(builds), "value": builds}
+	})
+}
+
+// routePipelineRuns serves the runs of pipeline 1 of the pipelines API.
+func routePipelineRuns(f *fakeServer, count int) {
+	f.route(locationRuns, "{project}/_apis/pipelines/{pipelineId}/runs/{runId}", func(req *fakeRequest) (int, interface{}) {
+		runs := make([]interface{}, 0, count)
+		for i := 0; i < count; i++ {
+			runs = append(runs, map[string]interface{}{
+				"id": count - i, "state": "completed", "result": "succeeded",
+				"createdDate": queuedAt.Add(-time.Duration(i) * time.Minute).Format(time.RFC3339),
+			})
+		}
+		return http.StatusOK, map[string]interface{}{"count": len(runs), "value": runs}
+	})
+}
+
+func TestListRuns(t *testing.T) {
+	tests := []struct {
+		name      string
+		runs      int
+		builds    int
+		filter    runFilter
+		want      int
+		newest    int
+		requested []string
+	}{
+		{"pipelines API", 30, 0, runFilter{maxCount: 10}, 10, 30, []string{
+			"GET /org/prj/_apis/pipelines/1/runs",
+		}},
+		{"all pages", 0, 450, runFilter{branch: "refs/heads/main"}, 225, 450, []string{
+			"GET /org/prj/_apis/build/builds?%24top=200&branchName=refs%2Fheads%2Fmain&definitions=1&queryOrder=queueTimeDescending&statusFilter=all",
+			"GET /org/prj/_apis/build/builds?%24top=200&branchName=refs%2Fheads%2Fmain&continuationToken=200&definitions=1&queryOrder=queueTimeDescending&statusFilter=all",
+			"GET /org/prj/_apis/build/builds?%24top=200&branchName=refs%2Fheads%2Fmain&continuationToken=400&definitions=1&queryOrder=queueTimeDescending&statusFilter=all",
+		}},
+		{"enough matching runs", 0, 450, runFilter{branch: "refs/heads/main", maxCount: 150}, 150, 450, []string{
+			"GET /org/prj/_apis/build/builds?%24top=200&branchName=refs%2Fheads%2Fmain&definitions=1&queryOrder=queueTimeDescending&statusFilter=all",
+			"GET /org/prj/_apis/build/builds?%24top=200&branchName=refs%2Fheads%2Fmain&continuationToken=200&definitions=1&queryOrder=queueTimeDescending&statusFilter=all",
+		}},
+		{"capped list", listRunsCap, 250, runFilter{}, 250, 250, []string{
+			"GET /org/prj/_apis/pipelines/1/runs",
+			"GET /org/prj/_apis/build/builds?%24top=200&definitions=1&queryOrder=queueTimeDescending&statusFilter=all",
+			"GET /org/prj/_apis/build/builds?%24top=200&continuationToken=200&definitions=1&queryOrder=queueTimeDescending&statusFilter=all",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeServer(t)
+			routePipelineRuns(f, tt.runs)
+			routeBuildPages(f, tt.builds)
+			app := &App{clock: &serverClock{}}
+
+			records, err := app.listRuns(context.Background(), f.project(), 1, tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != tt.want {
+				t.Errorf("%d runs, want %d", len(records), tt.want)
+			}
+			if len(records) > 0 && records[0].ID != tt.newest {
+				t.Errorf("newest run %d, want %d", records[0].ID, tt.newest)
+			}
+			requested := f.requested()
+			if fmt.Sprint(requested) != fmt.Sprint(tt.requested) {
+				t.Errorf("requested %v, want %v", requested, tt.requested)
+			}
+		})
+	}
+}
+
+func TestRunFilterApply(t *testing.T) {
+	records := []runRecord{
+		{ID: 1, State: "completed", Result: "failed", Branch: "refs/heads/main", Created: queuedAt.Add(-3 * time.Hour)},
+		{ID: 2, State: "completed", Result: "succeeded", Branch: "refs/heads/develop", Created: queuedAt.Add(-2 * time.Hour)},
+		{ID: 3, State: "inProgress", Branch: "refs/heads/main", Created: queuedAt.Add(-time.Hour)},
+		{ID: 4, State: "completed", Result: "succeeded", Branch: "refs/heads/main", Created: queuedAt},
+	}
+	tests := []struct {
+		name   string
+		filter runFilter
+		want   string
+	}{
+		{"all newest first", runFilter{}, "[4 3 2 1]"},
+		{"branch", runFilter{branch: "refs/heads/main"}, "[4 3 1]"},
+		{"states", runFilter{states: []string{"inProgress"}}, "[3]"},
+		{"results", runFilter{results: []string{"succeeded", "failed"}}, "[4 2 1]"},
+		{"max count", runFilter{maxCount: 2}, "[4 3]"},
+		{"max age", runFilter{maxAge: 90 * time.Minute, now: queuedAt}, "[4 3]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ids []int
+			for _, r := range tt.filter.apply(records) {
+				ids = append(ids, r.ID)
+			}
+			if got := fmt.Sprint(ids); got != tt.want {
+				t.Errorf("apply() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/pipelines"
+	"gopkg.in/yaml.v3"
+	"os"
+)
+
+// loadRunTemplate reads the run parameters of the pipelines API from a
+// YAML file. The keys are the names of the REST API, eg.
+// 'templateParameters' and 'stagesToSkip'. Values of template parameters,
+// that are no strings, are converted to strings.
+func loadRunTemplate(path string) (*pipelines.RunPipelineParameters, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var content map[string]interface{}
+	if err = yaml.Unmarshal(data, &content); err != nil {
+		return nil, err
+	}
+	if parameters, ok := content["templateParameters"].(map[string]interface{}); ok {
+		for name, value := range parameters {
+			switch value.(type) {
+			case string:
+			case map[string]interface{}, []interface{}:
+				encoded, err := json.Marshal(value)
+				if err != nil {
+					return nil, fmt.Errorf("template parameter '%s': %v", name, err)
+				}
+				parameters[name] = string(encoded)
+			default:
+				parameters[name] = fmt.Sprint(value)
+			}
+		}
+	}
+	encoded, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+	template := &pipelines.RunPipelineParameters{}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(template); err != nil {
+		return nil, err
+	}
+	if template.PreviewRun != nil && *template.PreviewRun {
+		return nil, fmt.Errorf("'previewRun' is not supported, the run is watched")
+	}
+	return template, nil
+}
+
+// templateBranch returns the branch of the repository 'self' of the run
+// template or an empty string.
+func (app *App) templateBranch() string {
+	if app.runTemplate == nil || app.runTemplate.Resources == nil || app.runTemplate.Resources.Repositories == nil {
+		return ""
+	}
+	self, ok := (*app.runTemplate.Resources.Repositories)["self"]
+	if !ok || self.RefName == nil {
+		return ""
+	}
+	return *self.RefName
+}
+
+// runTemplateParameters returns a copy of the run template, that the
+// run parameters of the command line can be set in, or empty run
+// parameters without template.
+func (app *App) runTemplateParameters() *pipelines.RunPipelineParameters {
+	params := &pipelines.RunPipelineParameters{}
+	if app.runTemplate == nil {
+		return params
+	}
+	*params = *app.runTemplate
+	if params.Resources != nil {
+		resources := *params.Resources
+		if resources.Repositories != nil {
+			repositories := make(map[string]pipelines.RepositoryResourceParameters, len(*resources.Repositories))
+			for name, repository := range *resources.Repositories {
+				repositories[name] = repository
+			}
+			resources.Repositories = &repositories
+		}
+		params.Resources = &resources
+	}
+	return params
+}
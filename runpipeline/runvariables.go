@@ -0,0 +1,149 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// timelineLocation is the location of the timeline of a build. The
+// timeline is read without the SDK, because its model of the timeline
+// records has no variables.
+var timelineLocation = uuid.MustParse("8baac422-4c6e-4de5-8532-db96d92acffa")
+
+// timelineVariables is the part of the timeline with the output
+// variables of the jobs.
+type timelineVariables struct {
+	Records []struct {
+		Type      string `json:"type"`
+		Name      string `json:"name"`
+		Variables map[string]struct {
+			Value    *string `json:"value"`
+			IsSecret bool    `json:"isSecret"`
+		} `json:"variables"`
+	} `json:"records"`
+}
+
+// capturesRunVariables is true, if the output variables of the runs are
+// written to the file of 'capture-run-variables' or to the env file.
+func (app *App) capturesRunVariables() bool {
+	return app.captureFile != "" || app.envFile != ""
+}
+
+// captureRunVariables reads the output variables of the completed run
+// from its timeline and adds them to the outputs of the run. Secret
+// variables have no value and are skipped.
+func (app *App) captureRunVariables(ctx context.Context, pr *pipelineRun) {
+	if pr.runID <= 0 || !app.capabilities.available(subsystemTimeline) || !app.budget.allowOptional("runVariables") {
+		return
+	}
+	variables, err := readRunVariables(ctx, pr.prj, pr.runID)
+	if app.capabilities.denied(pr.log, subsystemTimeline, err) {
+		return
+	}
+	if err != nil {
+		pr.log.Warnf("Variables of run %d of pipeline '%s' could not be read: %v", pr.runID, pr.name, err)
+		return
+	}
+	if pr.info.Outputs == nil {
+		pr.info.Outputs = make(map[string]string)
+	}
+	for name, value := range variables {
+		pr.info.Outputs[name] = value
+	}
+	pr.log.Debugf("%d variable(s) of run %d of pipeline '%s' captured.", len(pr.info.Outputs), pr.runID, pr.name)
+}
+
+// readRunVariables returns the output variables of the run from its
+// timeline. Secret variables have no value and are skipped.
+func readRunVariables(ctx context.Context, prj *project, runID int) (map[string]string, error) {
+	connection := prj.org.connection
+	client := azuredevops.NewClient(connection, connection.BaseUrl)
+	routeValues := map[string]string{
+		"project": prj.name,
+		"buildId": strconv.Itoa(runID),
+	}
+	resp, err := client.Send(ctx, http.MethodGet, timelineLocation, "6.0", routeValues, nil, nil, "", "application/json", nil)
+	if err != nil {
+		return nil, err
+	}
+	var timeline timelineVariables
+	if err = client.UnmarshalBody(resp, &timeline); err != nil {
+		return nil, err
+	}
+	variables := make(map[string]string)
+	for _, record := range timeline.Records {
+		for name, variable := range record.Variables {
+			if variable.IsSecret || variable.Value == nil {
+				continue
+			}
+			variables[name] = *variable.Value
+		}
+	}
+	return variables, nil
+}
+
+// writeRunVariables writes the output variables of all runs as KEY=VALUE
+// lines or, with '-output json', as JSON object.
+func (app *App) writeRunVariables(path string) error {
+	variables := make(map[string]string)
+	for _, pr := range app.runs {
+		for name, value := range pr.info.Outputs {
+			if previous, ok := variables[name]; ok && previous != value {
+				log.Warnf("Variable '%s' is set by more than one run, the value of pipeline '%s' is used.", name, pr.name)
+			}
+			variables[name] = value
+		}
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	eol := app.lineEnding.sequence()
+	if app.output == outputJSON {
+		encoder := json.NewEncoder(&lineEndingWriter{f, eol})
+		encoder.SetIndent("", "  ")
+		if err = encoder.Encode(variables); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+	names := make([]string, 0, len(variables))
+	for name := range variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		key := envNameInvalidChars.ReplaceAllString(strings.ToUpper(name), "_")
+		if _, err = fmt.Fprint(f, key, "=", quoteEnvValue(variables[name]), eol); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
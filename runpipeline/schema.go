@@ -0,0 +1,154 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// outputSchemaVersion is the version of the structured outputs. It must
+// be increased with every change of the documents, that changes their
+// schema. The schemas of every version are kept in testdata/schema.
+const outputSchemaVersion = "2"
+
+// schemaKind is the flag 'print-schema'.
+type schemaKind string
+
+const (
+	schemaJSON       schemaKind = "json"
+	schemaEvents     schemaKind = "events"
+	schemaInvocation schemaKind = "invocation"
+	schemaResult     schemaKind = "result"
+	schemaStatus     schemaKind = "status"
+	schemaTelemetry  schemaKind = "telemetry"
+	// schemaParameters is the schema of the parameters of a pipeline,
+	// that is read from its YAML file
+	schemaParameters schemaKind = "parameters"
+)
+
+func (k *schemaKind) String() string {
+	return string(*k)
+}
+
+func (k *schemaKind) Set(value string) error {
+	switch schemaKind(value) {
+	case schemaJSON, schemaEvents, schemaInvocation, schemaResult, schemaStatus, schemaTelemetry, schemaParameters:
+		*k = schemaKind(value)
+	default:
+		return fmt.Errorf("unknown schema '%s', use 'json', 'events', 'invocation', 'result', 'status', 'telemetry' or 'parameters'", value)
+	}
+	return nil
+}
+
+// schemaDocuments are the documents of the schemas. The result document
+// of '-output json' is the result of the program, the audit log contains
+// the events and the invocations.
+var schemaDocuments = map[schemaKind]struct {
+	title string
+	value interface{}
+}{
+	schemaJSON:       {"Result document of runPipeline -output json", resultDocument{}},
+	schemaResult:     {"Result document of runPipeline -output json", resultDocument{}},
+	schemaEvents:     {"Event of the audit log of runPipeline", auditRecord{}},
+	schemaInvocation: {"Invocation of the audit log of runPipeline", auditInvocation{}},
+	schemaStatus:     {"Status document of the endpoint /status of runPipeline", statusDocument{}},
+	schemaTelemetry:  {"Telemetry of a run of runPipeline", telemetryEvent{}},
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// writeSchema writes the JSON Schema of the document, that is generated
+// from its Go struct.
+func writeSchema(w io.Writer, kind schemaKind) error {
+	doc := schemaDocuments[kind]
+	schema := jsonSchema(reflect.TypeOf(doc.value))
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["title"] = doc.title
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(schema)
+}
+
+// jsonSchema returns the schema of the type. Fields without 'omitempty'
+// are required, the field 'schemaVersion' is constant.
+func jsonSchema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": jsonSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": jsonSchema(t.Elem())}
+	case reflect.Struct:
+		properties := make(map[string]interface{})
+		required := []string{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			tag := field.Tag.Get("json")
+			if field.Anonymous && tag == "" && field.Type.Kind() == reflect.Struct {
+				// the fields of embedded structs are fields of the document
+				embedded := jsonSchema(field.Type)
+				for name, property := range embedded["properties"].(map[string]interface{}) {
+					properties[name] = property
+				}
+				required = append(required, embedded["required"].([]string)...)
+				continue
+			}
+			if !field.IsExported() || tag == "-" {
+				continue
+			}
+			name, options, _ := strings.Cut(tag, ",")
+			if name == "" {
+				name = field.Name
+			}
+			property := jsonSchema(field.Type)
+			if name == "schemaVersion" {
+				property["const"] = outputSchemaVersion
+			}
+			omitempty := strings.Contains(options, "omitempty")
+			if field.Type.Kind() == reflect.Ptr && !omitempty {
+				// required pointers are null, if they have no value
+				property["type"] = []interface{}{property["type"], "null"}
+			}
+			properties[name] = property
+			if !omitempty {
+				required = append(required, name)
+			}
+		}
+		return map[string]interface{}{"type": "object", "properties": properties, "required": required}
+	default:
+		return map[string]interface{}{}
+	}
+}
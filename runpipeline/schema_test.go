@@ -0,0 +1,129 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+var updateSchemas = flag.Bool("update-schemas", false, "writes the schemas of the current schema version to testdata/schema")
+
+// TestSchemaCompatibility compares the schemas of the structured outputs
+// with the schemas of testdata/schema/<version>. A change of a document
+// fails, until outputSchemaVersion is increased and the schemas of the
+// new version are written with 'go test -run TestSchemaCompatibility
+// -update-schemas'.
+func TestSchemaCompatibility(t *testing.T) {
+	dir := filepath.Join("testdata", "schema", outputSchemaVersion)
+	if *updateSchemas {
+		if _, err := os.Stat(dir); err == nil {
+			t.Fatalf("schemas of version %s exist, a changed schema needs a new schema version", outputSchemaVersion)
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var kinds []string
+	for kind := range schemaDocuments {
+		kinds = append(kinds, string(kind))
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		t.Run(kind, func(t *testing.T) {
+			var b bytes.Buffer
+			if err := writeSchema(&b, schemaKind(kind)); err != nil {
+				t.Fatal(err)
+			}
+			file := filepath.Join(dir, kind+".json")
+			if *updateSchemas {
+				if err := os.WriteFile(file, b.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatalf("schema of version %s is missing, write it with -update-schemas: %v", outputSchemaVersion, err)
+			}
+			if !bytes.Equal(b.Bytes(), want) {
+				t.Errorf("schema '%s' differs from %s, increase outputSchemaVersion and write the schemas with -update-schemas:\n%s", kind, file, b.String())
+			}
+		})
+	}
+}
+
+// TestSchemaVersionField checks, that every document has the constant
+// field 'schemaVersion'.
+func TestSchemaVersionField(t *testing.T) {
+	for kind, doc := range schemaDocuments {
+		t.Run(string(kind), func(t *testing.T) {
+			var b bytes.Buffer
+			if err := writeSchema(&b, kind); err != nil {
+				t.Fatal(err)
+			}
+			var schema struct {
+				Properties map[string]struct {
+					Const string `json:"const"`
+				} `json:"properties"`
+				Required []string `json:"required"`
+			}
+			if err := json.Unmarshal(b.Bytes(), &schema); err != nil {
+				t.Fatal(err)
+			}
+			if got := schema.Properties["schemaVersion"].Const; got != outputSchemaVersion {
+				t.Errorf("schemaVersion of %s is '%s', want '%s'", doc.title, got, outputSchemaVersion)
+			}
+			if !containsString(schema.Required, "schemaVersion") {
+				t.Errorf("schemaVersion of %s is not required", doc.title)
+			}
+		})
+	}
+}
+
+func TestJSONSchema(t *testing.T) {
+	type embedded struct {
+		Inner string `json:"inner"`
+	}
+	type document struct {
+		embedded
+		Name     string            `json:"name"`
+		Count    int               `json:"count,omitempty"`
+		Ratio    float64           `json:"ratio"`
+		Finished *int64            `json:"finished"`
+		Tags     []string          `json:"tags,omitempty"`
+		Labels   map[string]string `json:"labels"`
+		Hidden   string            `json:"-"`
+		internal string
+	}
+	got, err := json.Marshal(jsonSchema(reflect.TypeOf(document{})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"properties":{"count":{"type":"integer"},"finished":{"type":["integer","null"]},"inner":{"type":"string"},` +
+		`"labels":{"additionalProperties":{"type":"string"},"type":"object"},"name":{"type":"string"},"ratio":{"type":"number"},` +
+		`"tags":{"items":{"type":"string"},"type":"array"}},"required":["inner","name","ratio","finished","labels"],"type":"object"}`
+	if string(got) != want {
+		t.Errorf("jsonSchema() = %s, want %s", got, want)
+	}
+}
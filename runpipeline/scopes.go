@@ -0,0 +1,91 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+)
+
+// scopeProbe is a read-only request, that only succeeds if the token
+// has a scope, that is not needed to start pipelines.
+type scopeProbe struct {
+	scope string
+	// project is true, if the path is relative to the project and not
+	// to the organization
+	project bool
+	path    string
+}
+
+var scopeProbes = []scopeProbe{
+	{"Code (Read)", true, "_apis/git/repositories?api-version=6.0"},
+	{"Work Items (Read)", true, "_apis/wit/queries?$depth=0&api-version=6.0"},
+	{"Variable Groups (Read)", true, "_apis/distributedtask/variablegroups?$top=1&api-version=6.0-preview.2"},
+	{"Service Connections (Read)", true, "_apis/serviceendpoint/endpoints?api-version=6.0-preview.4"},
+	{"Agent Pools (Read)", false, "_apis/distributedtask/pools?api-version=6.0"},
+}
+
+// checkTokenScopes probes the token of every organization of the runs
+// with read-only requests outside of the scope 'Build (Read & execute)'.
+// A token with broader scopes is reported as security warning.
+func (app *App) checkTokenScopes(ctx context.Context, runs []*pipelineRun) {
+	defer app.timer.begin("scopes")()
+	checked := make(map[*organization]bool)
+	for _, pr := range runs {
+		if checked[pr.prj.org] {
+			continue
+		}
+		checked[pr.prj.org] = true
+		var broader []string
+		for _, probe := range scopeProbes {
+			if app.probeScope(ctx, pr.prj, probe) {
+				broader = append(broader, probe.scope)
+			}
+		}
+		if len(broader) > 0 {
+			log.Warnf("Security: the token of organization '%s' has the scopes %s, that are not needed. Reduce the token to 'Build (Read & execute)'.", pr.prj.org.name, strings.Join(broader, ", "))
+		} else {
+			log.Infof("Token of organization '%s' has no unneeded scopes.", pr.prj.org.name)
+		}
+	}
+}
+
+// probeScope is true, if the request of the probe succeeds.
+func (app *App) probeScope(ctx context.Context, prj *project, probe scopeProbe) bool {
+	url := app.organizationURL(prj.org.name) + "/"
+	if probe.project {
+		url += prj.name + "/"
+	}
+	url += probe.path
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false
+	}
+	req.Header.Set("Authorization", prj.org.connection.AuthorizationString)
+	req.Header.Set("Accept", "application/json")
+	resp, err := (&http.Client{}).Do(req)
+	if err != nil {
+		log.Debugf("Scope '%s' could not be probed: %v", probe.scope, err)
+		return false
+	}
+	resp.Body.Close()
+	log.Debugf("Probe of scope '%s' returned %d.", probe.scope, resp.StatusCode)
+	// invalid tokens are redirected to the sign-in page with 203
+	return resp.StatusCode == http.StatusOK
+}
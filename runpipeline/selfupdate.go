@@ -0,0 +1,269 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// releasesURL is the latest release of the program on GitHub. A mirror
+	// with the same API can be set with RUNPIPELINE_RELEASES_URL.
+	releasesURL = "https://api.github.com/repos/IntershopCommunicationsAG/runPipeline/releases/latest"
+	// checksumsAsset is the file of a release with the SHA-256 checksums of
+	// the archives, as written by sha256sum.
+	checksumsAsset = "checksums.txt"
+	// maxAssetSize limits the download of an asset.
+	maxAssetSize = 256 << 20
+	// selfUpdateTimeout limits the requests of the update.
+	selfUpdateTimeout = 5 * time.Minute
+)
+
+// release is the part of a GitHub release, that the update uses.
+type release struct {
+	TagName string `json:"tag_name"`
+	Assets  []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+func (r *release) assetURL(name string) (string, error) {
+	for _, asset := range r.Assets {
+		if asset.Name == name {
+			return asset.URL, nil
+		}
+	}
+	return "", fmt.Errorf("release %s has no asset '%s'", r.TagName, name)
+}
+
+// runSelfUpdate compares the version with the latest release and, unless
+// only checked, replaces the executable with the release. With
+// 'self-update-check' the program ends with exit code 10, if an update is
+// available. Failures leave the executable untouched and end the program
+// with exit code 37.
+func (app *App) runSelfUpdate(checkOnly bool) {
+	latest, err := latestRelease()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Latest release could not be read: %v\n", err)
+		app.exit(37)
+	}
+	if !newerVersion(latest.TagName, version) {
+		fmt.Printf("runPipeline %s is up to date.\n", version)
+		app.exit(0)
+	}
+	if checkOnly {
+		fmt.Printf("runPipeline %s is available, this is %s.\n", latest.TagName, version)
+		app.exit(10)
+	}
+	if err = selfUpdate(latest); err != nil {
+		fmt.Fprintf(os.Stderr, "Update to %s failed, the executable is not changed: %v\n", latest.TagName, err)
+		app.exit(37)
+	}
+	fmt.Printf("runPipeline is updated from %s to %s.\n", version, latest.TagName)
+	app.exit(0)
+}
+
+func latestRelease() (*release, error) {
+	url := releasesURL
+	if mirror := os.Getenv(envPrefix + "RELEASES_URL"); mirror != "" {
+		url = mirror
+	}
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	// the token raises the rate limit, it is only sent to the API
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	data, err := download(req)
+	if err != nil {
+		return nil, err
+	}
+	var latest release
+	if err = json.Unmarshal(data, &latest); err != nil {
+		return nil, err
+	}
+	if latest.TagName == "" {
+		return nil, fmt.Errorf("the release has no tag")
+	}
+	return &latest, nil
+}
+
+// selfUpdate downloads the archive of the platform, verifies its checksum
+// and replaces the executable with the program of the archive.
+func selfUpdate(latest *release) error {
+	archive := fmt.Sprintf("runPipeline.%s.%s.tar.gz", runtime.GOOS, runtime.GOARCH)
+	checksum, err := releaseChecksum(latest, archive)
+	if err != nil {
+		return err
+	}
+	archiveURL, err := latest.assetURL(archive)
+	if err != nil {
+		return err
+	}
+	data, err := downloadURL(archiveURL)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != checksum {
+		return fmt.Errorf("checksum of '%s' does not match '%s'", archive, checksumsAsset)
+	}
+	program, err := extractProgram(data)
+	if err != nil {
+		return err
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(exe), "."+filepath.Base(exe)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(program); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp.Name(), 0o755); err != nil {
+		return err
+	}
+	return replaceExecutable(exe, tmp.Name())
+}
+
+// releaseChecksum returns the checksum of the asset from the checksums
+// file of the release.
+func releaseChecksum(latest *release, asset string) (string, error) {
+	url, err := latest.assetURL(checksumsAsset)
+	if err != nil {
+		return "", err
+	}
+	data, err := downloadURL(url)
+	if err != nil {
+		return "", err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		// binary mode of sha256sum marks the name with '*'
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == asset {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("'%s' has no checksum of '%s'", checksumsAsset, asset)
+}
+
+// extractProgram returns the executable of the archive.
+func extractProgram(archive []byte) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, err
+	}
+	reader := tar.NewReader(gz)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("the archive contains no program")
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := filepath.Base(header.Name)
+		if header.Typeflag == tar.TypeReg && (name == "runPipeline" || name == "runPipeline.exe") {
+			return io.ReadAll(io.LimitReader(reader, maxAssetSize))
+		}
+	}
+}
+
+func downloadURL(url string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return download(req)
+}
+
+func download(req *http.Request) ([]byte, error) {
+	req.Header.Set("User-Agent", userAgentProduct())
+	client := &http.Client{Timeout: selfUpdateTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", req.URL, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxAssetSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxAssetSize {
+		return nil, fmt.Errorf("%s is larger than %d bytes", req.URL, maxAssetSize)
+	}
+	return data, nil
+}
+
+var releaseVersion = regexp.MustCompile(`^v?(\d+)\.(\d+)\.(\d+)`)
+
+// newerVersion is true, if the release is newer than the version. Builds
+// without version like 'dev' are older than every release.
+func newerVersion(latest string, current string) bool {
+	l := releaseVersion.FindStringSubmatch(latest)
+	if l == nil {
+		return false
+	}
+	c := releaseVersion.FindStringSubmatch(current)
+	if c == nil {
+		return true
+	}
+	for i := 1; i <= 3; i++ {
+		lv, _ := strconv.Atoi(l[i])
+		cv, _ := strconv.Atoi(c[i])
+		if lv != cv {
+			return lv > cv
+		}
+	}
+	return false
+}
@@ -0,0 +1,170 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// runsLocation is the location of the runs of the pipelines API, that is
+// used to start and watch the runs.
+const runsLocation = "7859261e-d2e9-4a68-b820-a5d84cc5bb3d"
+
+var apiVersionPattern = regexp.MustCompile(`^(\d+\.\d+)(-preview(\.\d+)?)?$`)
+
+// apiVersion is the value of the flag 'api-version', eg. '6.0' or
+// '6.0-preview.1'.
+type apiVersion string
+
+func (v *apiVersion) String() string {
+	return string(*v)
+}
+
+func (v *apiVersion) Set(value string) error {
+	if !apiVersionPattern.MatchString(value) {
+		return fmt.Errorf("use 'major.minor' with optional '-preview.n', eg. '6.0' or '6.0-preview.1'")
+	}
+	*v = apiVersion(value)
+	return nil
+}
+
+// version returns the version without preview suffix.
+func (v apiVersion) version() *azuredevops.Version {
+	match := apiVersionPattern.FindStringSubmatch(string(v))
+	if match == nil {
+		return nil
+	}
+	version, _ := azuredevops.NewVersion(match[1])
+	return version
+}
+
+// serverFeature is a feature of the pipelines API, that older servers
+// do not support, eg. Azure DevOps Server 2019 or 2020.
+type serverFeature struct {
+	name       string
+	minVersion string
+	// flag is the parameter, that needs the feature, if used is true.
+	flag string
+	used func(app *App) bool
+}
+
+// previewRuns are runs, that only return the expanded YAML.
+var previewRuns = serverFeature{"preview runs", "6.0", "fail-on-ignored-params", func(app *App) bool {
+	return app.failOnIgnoredParams && !app.skipParamValidation
+}}
+
+var serverFeatures = []serverFeature{previewRuns}
+
+// checkServerVersion reads the API version of the pipelines API from the
+// resource locations of the organization and ends the program with exit
+// code 32, if a given parameter needs a feature, that the server does
+// not support. With 'api-version' the detected version is replaced.
+func (app *App) checkServerVersion(ctx context.Context, org *organization) {
+	defer app.timer.begin("serverVersion")()
+	version := app.apiVersion.version()
+	if version == nil {
+		detected, err := app.serverVersion(ctx, org)
+		if err != nil {
+			log.Warnf("API version of organization '%s' could not be read: %v", org.name, err)
+			return
+		}
+		if detected == nil {
+			log.Errorf("The pipelines API is not supported by this server version of organization '%s', Azure DevOps Server 2020 or newer is needed.", org.name)
+			app.exit(32)
+		}
+		version = detected
+		log.Infof("Pipelines API of organization '%s' supports API version %s.", org.name, version)
+	} else {
+		log.Infof("API version %s is used for organization '%s'.", app.apiVersion, org.name)
+	}
+	app.serverAPIVersion = version
+	for _, feature := range serverFeatures {
+		if app.supports(feature) || !feature.used(app) {
+			continue
+		}
+		log.Errorf("Parameter '%s' needs %s, that is not supported by this server version (API version %s, %s needed).", feature.flag, feature.name, version, feature.minVersion)
+		app.exit(32)
+	}
+}
+
+// supports is true, if the server supports the feature. If the version
+// is not known, all features are supported.
+func (app *App) supports(feature serverFeature) bool {
+	if app.serverAPIVersion == nil {
+		return true
+	}
+	min, err := azuredevops.NewVersion(feature.minVersion)
+	if err != nil {
+		return true
+	}
+	return app.serverAPIVersion.CompareTo(*min) >= 0
+}
+
+// serverVersion returns the maximum API version of the runs of the
+// pipelines API, nil if the server does not have the pipelines API.
+func (app *App) serverVersion(ctx context.Context, org *organization) (*azuredevops.Version, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodOptions, app.organizationURL(org.name)+"/_apis", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", org.connection.AuthorizationString)
+	req.Header.Set("Accept", "application/json")
+	resp, err := (&http.Client{}).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("resource locations returned %s", resp.Status)
+	}
+	var locations struct {
+		Value []azuredevops.ApiResourceLocation `json:"value"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&locations); err != nil {
+		return nil, err
+	}
+	for _, location := range locations.Value {
+		if location.Id == nil || location.Id.String() != runsLocation || location.MaxVersion == nil {
+			continue
+		}
+		return azuredevops.NewVersion(*location.MaxVersion)
+	}
+	return nil, nil
+}
+
+// apiVersionTransport sends all requests with the API version of the
+// parameter 'api-version' instead of the negotiated version of the SDK.
+type apiVersionTransport struct {
+	version apiVersion
+	next    http.RoundTripper
+}
+
+func (t *apiVersionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	accept := req.Header.Get("Accept")
+	if i := strings.Index(accept, ";api-version="); i >= 0 {
+		req = req.Clone(req.Context())
+		req.Header.Set("Accept", accept[:i]+";api-version="+string(t.version))
+	}
+	return t.next.RoundTrip(req)
+}
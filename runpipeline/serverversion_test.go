@@ -0,0 +1,137 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestCheckServerVersion simulates older servers, that advertise a lower
+// API version of the pipelines API or none at all.
+func TestCheckServerVersion(t *testing.T) {
+	tests := []struct {
+		name          string
+		maxVersion    string
+		runs          bool
+		override      apiVersion
+		failOnIgnored bool
+		code          int
+		version       string
+	}{
+		{"current", "7.1", true, "", true, -1, "7.1"},
+		{"server 2020", "6.0", true, "", true, -1, "6.0"},
+		{"server 2019 with preview runs", "5.1", true, "", true, 32, "5.1"},
+		{"server 2019 without preview runs", "5.1", true, "", false, -1, "5.1"},
+		{"no pipelines API", "5.0", false, "", false, 32, ""},
+		{"override", "7.1", true, "5.1", true, 32, "5.1"},
+		{"override with preview", "5.1", true, "6.0-preview.1", true, -1, "6.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeServer(t)
+			f.maxVersion = tt.maxVersion
+			if tt.runs {
+				f.route(locationRuns, "{project}/_apis/pipelines/{pipelineId}/runs/{runId}", func(req *fakeRequest) (int, interface{}) {
+					return http.StatusNotFound, ""
+				})
+			}
+			app := &App{baseURL: f.URL, timer: newPhaseTimer(), apiVersion: tt.override, failOnIgnoredParams: tt.failOnIgnored}
+
+			code := exitCodeOf(t, app, func() { app.checkServerVersion(context.Background(), f.project().org) })
+			if code != tt.code {
+				t.Errorf("exit code %d, want %d", code, tt.code)
+			}
+			version := ""
+			if app.serverAPIVersion != nil {
+				version = app.serverAPIVersion.String()
+			}
+			if version != tt.version {
+				t.Errorf("API version %s, want %s", version, tt.version)
+			}
+			if tt.override != "" && len(f.requested()) > 0 {
+				t.Errorf("locations are read despite 'api-version': %v", f.requested())
+			}
+		})
+	}
+}
+
+// TestCheckServerVersionUnknown checks, that all features are assumed,
+// if the version can not be read.
+func TestCheckServerVersionUnknown(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	app := &App{baseURL: server.URL, timer: newPhaseTimer(), failOnIgnoredParams: true}
+	org := &organization{name: "org", connection: azuredevops.NewPatConnection(server.URL+"/org", "token")}
+
+	if code := exitCodeOf(t, app, func() { app.checkServerVersion(context.Background(), org) }); code != -1 {
+		t.Errorf("exit code %d, want none", code)
+	}
+	if !app.supports(previewRuns) {
+		t.Error("preview runs are not supported by an unknown version")
+	}
+}
+
+func TestAPIVersionSet(t *testing.T) {
+	tests := []struct {
+		value string
+		valid bool
+	}{
+		{"6.0", true},
+		{"7.1-preview", true},
+		{"6.0-preview.1", true},
+		{"6", false},
+		{"6.0-beta", false},
+		{"latest", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			var v apiVersion
+			if err := v.Set(tt.value); (err == nil) != tt.valid {
+				t.Errorf("Set(%s) = %v, want valid %v", tt.value, err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestAPIVersionTransport(t *testing.T) {
+	var accept string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accept = r.Header.Get("Accept")
+	}))
+	defer server.Close()
+	client := &http.Client{Transport: &apiVersionTransport{version: "5.1", next: http.DefaultTransport}}
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	req.Header.Set("Accept", "application/json;api-version=7.1-preview.1")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if accept != "application/json;api-version=5.1" {
+		t.Errorf("Accept %s, want the version of 'api-version'", accept)
+	}
+	if req.Header.Get("Accept") != "application/json;api-version=7.1-preview.1" {
+		t.Error("header of the request is changed")
+	}
+}
@@ -0,0 +1,176 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"fmt"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/build"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/taskagent"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// resultDeployed is the result of a pipeline, that is not started,
+// because its version is already deployed to the environment of
+// 'skip-if-env-deployed'.
+const resultDeployed = "alreadyDeployed"
+
+// skipIfDeployed is the value of the flag 'skip-if-env-deployed'. The
+// version is a Go template, that is parsed when the flag is set.
+type skipIfDeployed struct {
+	environment string
+	version     string
+	template    *template.Template
+}
+
+func (s *skipIfDeployed) String() string {
+	if s.environment == "" {
+		return ""
+	}
+	return s.environment + "=" + s.version
+}
+
+func (s *skipIfDeployed) Set(value string) error {
+	environment, version, ok := strings.Cut(value, "=")
+	if !ok || environment == "" || version == "" {
+		return fmt.Errorf("use 'environment=version', eg. 'prod={{.Parameters.version}}'")
+	}
+	tmpl, err := template.New("skip-if-env-deployed").Option("missingkey=error").Parse(version)
+	if err != nil {
+		return err
+	}
+	s.environment, s.version, s.template = environment, version, tmpl
+	return nil
+}
+
+// deployedVersionData are the values available in the version of
+// 'skip-if-env-deployed'.
+type deployedVersionData struct {
+	Parameters map[string]string
+	Env        map[string]string
+}
+
+// deployedVersion returns the version of 'skip-if-env-deployed' for the
+// run.
+func (app *App) deployedVersion(pr *pipelineRun) (string, error) {
+	env := make(map[string]string)
+	for _, kv := range os.Environ() {
+		if key, value, ok := strings.Cut(kv, "="); ok {
+			env[key] = value
+		}
+	}
+	data := deployedVersionData{Parameters: app.runParameters(pr), Env: env}
+	var version strings.Builder
+	if err := app.skipIfDeployed.template.Execute(&version, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(version.String()), nil
+}
+
+// skipDeployedRuns marks the runs, whose version is already deployed to
+// the environment of 'skip-if-env-deployed', as deployed and returns the
+// other runs. The program ends with exit code 5, if the version of a run
+// can not be created.
+func (app *App) skipDeployedRuns(ctx context.Context, runs []*pipelineRun) []*pipelineRun {
+	defer app.timer.begin("skipIfDeployed")()
+	var pending []*pipelineRun
+	for _, pr := range runs {
+		version, err := app.deployedVersion(pr)
+		if err != nil || version == "" {
+			log.Errorf("Version of pipeline '%s' for parameter 'skip-if-env-deployed' could not be created: %v", pr.name, err)
+			app.exit(5)
+		}
+		runID := app.lastDeployment(ctx, pr, app.skipIfDeployed.environment)
+		if runID > 0 && app.hasVersionTag(ctx, pr, runID, version) {
+			message := fmt.Sprintf("Version '%s' of pipeline '%s' is already deployed to environment '%s' by run %d, the pipeline is not started.", version, pr.name, app.skipIfDeployed.environment, runID)
+			log.Info(message)
+			if app.output.console() && !app.planOnly {
+				fmt.Println(message)
+			}
+			pr.info.Result = resultDeployed
+			continue
+		}
+		log.Debugf("Version '%s' of pipeline '%s' is not the last deployment to environment '%s'.", version, pr.name, app.skipIfDeployed.environment)
+		pending = append(pending, pr)
+	}
+	return pending
+}
+
+// lastDeployment returns the id of the latest run of the pipeline, that
+// deployed successfully to the environment, or 0. If the deployments
+// can not be read, a warning is logged and the pipeline is started.
+func (app *App) lastDeployment(ctx context.Context, pr *pipelineRun, environment string) int {
+	client, err := pr.prj.org.taskAgentClient(ctx)
+	if err != nil {
+		log.Warnf("Deployments of environment '%s' could not be read, pipeline '%s' is started: %v", environment, pr.name, err)
+		return 0
+	}
+	id := app.environmentID(ctx, client, pr.prj, environment)
+	if id == 0 {
+		log.Warnf("Project '%s' has no environment '%s', pipeline '%s' is started.", pr.prj.name, environment, pr.name)
+		return 0
+	}
+	args := &taskagent.GetEnvironmentDeploymentExecutionRecordsArgs{
+		Project:       &pr.prj.name,
+		EnvironmentId: &id,
+		Top:           intPtr(environmentDeploymentsTop),
+	}
+	records, err := client.GetEnvironmentDeploymentExecutionRecords(ctx, *args)
+	if err != nil {
+		log.Warnf("Deployments of environment '%s' could not be read, pipeline '%s' is started: %v", environment, pr.name, err)
+		return 0
+	}
+	// the latest deployments come first
+	for _, record := range records.Value {
+		if record.Definition == nil || record.Definition.Id == nil || *record.Definition.Id != pr.pipelineID {
+			continue
+		}
+		if record.Owner == nil || record.Owner.Id == nil || record.Result == nil || *record.Result != taskagent.TaskResultValues.Succeeded {
+			continue
+		}
+		return *record.Owner.Id
+	}
+	return 0
+}
+
+// hasVersionTag is true, if the run is tagged with the version or with
+// 'version=<version>', eg. by '-annotation version=1.2.3
+// -annotation-as-tags'.
+func (app *App) hasVersionTag(ctx context.Context, pr *pipelineRun, runID int, version string) bool {
+	client, err := pr.prj.org.buildClient(ctx)
+	var tags *[]string
+	if err == nil {
+		args := &build.GetBuildTagsArgs{
+			Project: &pr.prj.name,
+			BuildId: &runID,
+		}
+		tags, err = client.GetBuildTags(ctx, *args)
+	}
+	if err != nil || tags == nil {
+		log.Warnf("Tags of run %d of pipeline '%s' could not be read, the pipeline is started: %v", runID, pr.name, err)
+		return false
+	}
+	for _, tag := range *tags {
+		if tag == version || tag == "version="+version {
+			return true
+		}
+	}
+	return false
+}
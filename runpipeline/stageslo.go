@@ -0,0 +1,154 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"fmt"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/build"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// stageSLO is the maximum duration of a stage.
+type stageSLO struct {
+	stage string
+	max   time.Duration
+}
+
+// stageSLOs is the value of the flag 'assert-stage-duration'.
+type stageSLOs []stageSLO
+
+func (s *stageSLOs) String() string {
+	var list []string
+	for _, slo := range *s {
+		list = append(list, slo.stage+"="+slo.max.String())
+	}
+	return fmt.Sprintf("%s", list)
+}
+
+func (s *stageSLOs) Set(value string) error {
+	kv := strings.SplitN(value, "=", 2)
+	if len(kv) != 2 || kv[0] == "" {
+		return fmt.Errorf("use 'stage=duration', eg. 'Build=10m'")
+	}
+	max, err := time.ParseDuration(kv[1])
+	if err != nil {
+		return err
+	}
+	*s = append(*s, stageSLO{stage: kv[0], max: max})
+	return nil
+}
+
+// stageViolation is a stage, that took longer than its maximum.
+type stageViolation struct {
+	pipeline string
+	runID    int
+	stage    string
+	duration time.Duration
+	max      time.Duration
+}
+
+// checkStageDurations compares the durations of the stages of all
+// finished runs with their maximum. Violations are printed as table and
+// the exit code is 11, if any stage took too long.
+func (app *App) checkStageDurations(ctx context.Context, runs []*pipelineRun) int {
+	defer app.timer.begin("stageDurations")()
+	var violations []stageViolation
+	for _, pr := range runs {
+		if pr.runID <= 0 || pr.info.Result == resultSkipped || !app.capabilities.available(subsystemTimeline) || !app.budget.allowOptional("stageDurations") {
+			continue
+		}
+		durations, err := app.stageDurations(ctx, pr)
+		if app.capabilities.denied(pr.log, subsystemTimeline, err) {
+			continue
+		}
+		if err != nil {
+			pr.log.Warnf("Timeline of run %d of pipeline '%s' could not be read: %v", pr.runID, pr.name, err)
+			continue
+		}
+		for _, slo := range app.stageSLOs {
+			duration, ok := durations[slo.stage]
+			if !ok {
+				pr.log.Warnf("Stage '%s' of pipeline '%s' did not run in run %d.", slo.stage, pr.name, pr.runID)
+				continue
+			}
+			pr.log.Debugf("Stage '%s' of pipeline '%s' took %v (max %v).", slo.stage, pr.name, duration, slo.max)
+			if duration > slo.max {
+				violations = append(violations, stageViolation{pr.name, pr.runID, slo.stage, duration, slo.max})
+			}
+		}
+	}
+	if len(violations) == 0 {
+		return 0
+	}
+	log.Errorf("%d stage(s) exceeded the maximum duration.", len(violations))
+	var out io.Writer = os.Stdout
+	if !app.output.console() {
+		// stdout is reserved for the result document
+		out = os.Stderr
+	}
+	printStageViolations(out, violations)
+	return 11
+}
+
+// stageDurations reads the timeline of the run and returns the duration
+// of every finished stage by name and identifier.
+func (app *App) stageDurations(ctx context.Context, pr *pipelineRun) (map[string]time.Duration, error) {
+	client, err := pr.prj.org.buildClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	args := &build.GetBuildTimelineArgs{
+		Project: &pr.prj.name,
+		BuildId: &pr.runID,
+	}
+	timeline, err := client.GetBuildTimeline(ctx, *args)
+	if err != nil {
+		return nil, err
+	}
+	durations := make(map[string]time.Duration)
+	if timeline == nil || timeline.Records == nil {
+		return durations, nil
+	}
+	for _, record := range *timeline.Records {
+		if record.Type == nil || *record.Type != "Stage" || record.StartTime == nil || record.FinishTime == nil {
+			continue
+		}
+		duration := record.FinishTime.Time.Sub(record.StartTime.Time)
+		if record.Name != nil {
+			durations[*record.Name] = duration
+		}
+		if record.Identifier != nil {
+			durations[*record.Identifier] = duration
+		}
+	}
+	return durations, nil
+}
+
+func printStageViolations(out io.Writer, violations []stageViolation) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Pipeline\tRun id\tStage\tDuration\tMax")
+	for _, v := range violations {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%v\t%v\n", v.pipeline, v.runID, v.stage, v.duration.Round(time.Second), v.max)
+	}
+	w.Flush()
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/build"
+	"time"
+)
+
+// checkStageTimeouts reads the timeline of the unfinished run and cancels
+// every stage of 'timeout-per-stage', that is in progress for longer
+// than its timeout. A stage is canceled once, the run goes on with the
+// next stages, as defined by the conditions of the pipeline. A failed
+// cancellation is requested again with the next status check. It returns
+// the time until the next timeout of a stage in progress or zero, so
+// that the next status check is not later.
+func (app *App) checkStageTimeouts(ctx context.Context, pr *pipelineRun) time.Duration {
+	if !app.capabilities.available(subsystemTimeline) || !app.budget.allowOptional("stageTimeouts") {
+		return 0
+	}
+	client, err := pr.prj.org.buildClient(ctx)
+	if err != nil {
+		pr.log.Warnf("Timeline of run %d of pipeline '%s' could not be read: %v", pr.runID, pr.name, err)
+		return 0
+	}
+	args := &build.GetBuildTimelineArgs{
+		Project: &pr.prj.name,
+		BuildId: &pr.runID,
+	}
+	timeline, err := client.GetBuildTimeline(ctx, *args)
+	if app.capabilities.denied(pr.log, subsystemTimeline, err) {
+		return 0
+	}
+	if err != nil {
+		pr.log.Warnf("Timeline of run %d of pipeline '%s' could not be read: %v", pr.runID, pr.name, err)
+		return 0
+	}
+	if timeline == nil || timeline.Records == nil {
+		return 0
+	}
+	var next time.Duration
+	now := app.clock.now()
+	for _, record := range *timeline.Records {
+		if record.Type == nil || *record.Type != "Stage" || record.Identifier == nil || record.StartTime == nil ||
+			record.State == nil || *record.State != build.TimelineRecordStateValues.InProgress {
+			continue
+		}
+		stage := *record.Identifier
+		if pr.timedOutStages[stage] {
+			continue
+		}
+		timeout, ok := app.stageTimeout(record)
+		if !ok {
+			continue
+		}
+		elapsed := now.Sub(record.StartTime.Time)
+		if remaining := timeout - elapsed; remaining > 0 {
+			if next == 0 || remaining < next {
+				next = remaining
+			}
+			continue
+		}
+		name := stage
+		if record.Name != nil {
+			name = *record.Name
+		}
+		pr.log.Errorf("Stage '%s' of run %d of pipeline '%s' is running for %v, longer than its timeout of %v, and is canceled.", name, pr.runID, pr.name, elapsed.Round(time.Second), timeout)
+		if !app.cancelStage(ctx, client, pr, stage, name) {
+			continue
+		}
+		if pr.timedOutStages == nil {
+			pr.timedOutStages = make(map[string]bool)
+		}
+		pr.timedOutStages[stage] = true
+	}
+	return next
+}
+
+// stageTimeout returns the timeout of the stage by its name or its
+// identifier.
+func (app *App) stageTimeout(record build.TimelineRecord) (time.Duration, bool) {
+	for _, timeout := range app.stageTimeouts {
+		if (record.Name != nil && *record.Name == timeout.stage) || *record.Identifier == timeout.stage {
+			return timeout.max, true
+		}
+	}
+	return 0, false
+}
+
+// cancelStage requests the cancellation of the stage by its identifier
+// with the stages API of the builds. It is false, if the stage could not
+// be canceled, a failure is only logged as warning.
+func (app *App) cancelStage(ctx context.Context, client build.Client, pr *pipelineRun, stage string, name string) bool {
+	state := build.StageUpdateTypeValues.Cancel
+	args := &build.UpdateStageArgs{
+		UpdateParameters: &build.UpdateStageParameters{State: &state},
+		BuildId:          &pr.runID,
+		StageRefName:     &stage,
+		Project:          &pr.prj.name,
+	}
+	auditCtx, call := app.auditContext(ctx, "cancel", pr.name, pr.pipelineID, pr.runID)
+	if err := client.UpdateStage(auditCtx, *args); err != nil {
+		pr.log.Warnf("Stage '%s' of run %d of pipeline '%s' could not be canceled, it is tried again with the next status check: %v", name, pr.runID, pr.name, err)
+		return false
+	}
+	call.done(0, "stage "+stage+" canceled")
+	pr.log.Infof("Stage '%s' of run %d of pipeline '%s' is canceled.", name, pr.runID, pr.name)
+	return true
+}
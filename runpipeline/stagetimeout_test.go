@@ -0,0 +1,77 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// TestCheckStageTimeouts checks, that a stage counts as timed out only,
+// when its cancellation succeeded, and that a failed cancellation is
+// requested again with the next status check.
+func TestCheckStageTimeouts(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		// timedOut is the state of the stage after every check
+		timedOut []bool
+		cancels  int
+	}{
+		{"canceled", []int{http.StatusNoContent}, []bool{true, true, true}, 1},
+		{"canceled after a failure", []int{http.StatusInternalServerError, http.StatusNoContent}, []bool{false, true, true}, 2},
+		{"never canceled", []int{http.StatusConflict, http.StatusConflict, http.StatusConflict}, []bool{false, false, false}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			started := time.Now().Add(-40 * time.Minute).UTC().Format(time.RFC3339)
+			f := newFakeServer(t)
+			f.route(locationTimeline, "{project}/_apis/build/builds/{buildId}/timeline/{timelineId}", func(req *fakeRequest) (int, interface{}) {
+				return http.StatusOK, map[string]interface{}{"records": []interface{}{
+					map[string]interface{}{"type": "Stage", "identifier": "Build", "name": "Build", "state": "completed", "startTime": started},
+					map[string]interface{}{"type": "Stage", "identifier": "Deploy", "name": "Deploy", "state": "inProgress", "startTime": started},
+				}}
+			})
+			cancels := 0
+			f.route(locationStages, "{project}/_apis/build/builds/{buildId}/stages/{stageRefName}", func(req *fakeRequest) (int, interface{}) {
+				if req.Method != http.MethodPatch || req.values["stageRefName"] != "Deploy" {
+					t.Errorf("unexpected request %s %s", req.Method, req.URL.Path)
+				}
+				status := tt.statuses[cancels]
+				cancels++
+				if status != http.StatusNoContent {
+					return status, map[string]string{"message": "stage can not be canceled"}
+				}
+				return status, ""
+			})
+			app := &App{clock: &serverClock{}, budget: newAPIBudget(0, http.DefaultTransport), stageTimeouts: stageSLOs{{stage: "Deploy", max: 30 * time.Minute}}}
+			pr := testRun(f.project(), "release", 1, 1234)
+
+			for i, want := range tt.timedOut {
+				app.checkStageTimeouts(context.Background(), pr)
+				if pr.timedOutStages["Deploy"] != want {
+					t.Errorf("check %d: timed out %v, want %v", i+1, pr.timedOutStages["Deploy"], want)
+				}
+			}
+			if cancels != tt.cancels {
+				t.Errorf("%d cancellations, want %d", cancels, tt.cancels)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"encoding/json"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+)
+
+// statusFileHeartbeat is the number of polls without a change of the
+// state, after that the status file is written again, so that readers
+// see the time of the last poll.
+const statusFileHeartbeat = 5
+
+// useStatusFile writes the '/status' document to the file of
+// 'status-file' while the program waits for the runs. If the file can
+// not be written, the program ends before a pipeline is triggered.
+func (app *App) useStatusFile(path string) {
+	s := app.ensureStatusServer()
+	s.lock.Lock()
+	s.fileEOL = app.lineEnding.sequence()
+	data, err := json.MarshalIndent(s.document(), "", "  ")
+	if err == nil {
+		err = writeFileAtomic(path, withLineEnding(append(data, '\n'), s.fileEOL))
+	}
+	if err == nil {
+		s.file = path
+	}
+	s.lock.Unlock()
+	if err != nil {
+		log.Errorf("Status file '%s' could not be written: %v", path, err)
+		app.exit(5)
+	}
+	log.Infof("Status is written to '%s'.", path)
+}
+
+// saveFile writes the status file. It is safe to call on nil.
+func (s *statusServer) saveFile() {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	warn := s.writeFile()
+	s.lock.Unlock()
+	warn()
+}
+
+// writeFile replaces the status file with the current document. The
+// document is written to a temporary file in the same directory, that is
+// renamed, so that readers never see a partial document, even if the
+// program is killed while writing. The lock must be held, the returned
+// function logs a failure after the lock is released, because the log
+// hook locks the server as well.
+func (s *statusServer) writeFile() func() {
+	if s.file == "" {
+		return func() {}
+	}
+	data, err := json.MarshalIndent(s.document(), "", "  ")
+	if err == nil {
+		err = writeFileAtomic(s.file, withLineEnding(append(data, '\n'), s.fileEOL))
+	}
+	if err == nil || s.fileFailed {
+		return func() {}
+	}
+	// a failure is logged once, not on every poll
+	s.fileFailed = true
+	file := s.file
+	return func() {
+		log.Warnf("Status file '%s' could not be written: %v", file, err)
+	}
+}
+
+// writeFileAtomic writes the data to a temporary file next to the path and
+// renames it to the path.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,85 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/build"
+	log "github.com/sirupsen/logrus"
+	"strings"
+)
+
+// branchRef returns the full ref name of a branch.
+func branchRef(branch string) string {
+	if strings.HasPrefix(branch, "refs/") {
+		return branch
+	}
+	return "refs/heads/" + branch
+}
+
+// cancelSupersededRuns cancels all queued and running runs of the
+// pipeline on the same ref. Runs of other refs are never touched and
+// failures are only logged as warnings.
+func (app *App) cancelSupersededRuns(ctx context.Context, pr *pipelineRun) {
+	if !app.budget.allowOptional("cancelSuperseded") {
+		return
+	}
+	client, err := pr.prj.org.buildClient(ctx)
+	if err != nil {
+		log.Warnf("Superseded runs of pipeline '%s' could not be canceled: %v", pr.name, err)
+		return
+	}
+	filter := runFilter{
+		branch: branchRef(pr.branch),
+		states: []string{"inProgress"},
+		maxAge: app.cancelSupersededMaxAge,
+	}
+	runs, err := app.listRuns(ctx, pr.prj, pr.pipelineID, filter)
+	if err != nil {
+		log.Warnf("Superseded runs of pipeline '%s' could not be listed: %v", pr.name, err)
+		return
+	}
+	for _, r := range runs {
+		app.cancelRun(ctx, client, pr, r.ID)
+	}
+}
+
+// cancelRun cancels the run of the pipeline. Failures are only logged
+// as warnings.
+func (app *App) cancelRun(ctx context.Context, client build.Client, pr *pipelineRun, runID int) {
+	if err := app.cancelBuild(ctx, client, pr, runID); err != nil {
+		log.Warnf("Run %d of pipeline '%s' could not be canceled: %v", runID, pr.name, err)
+		return
+	}
+	log.Infof("Run %d of pipeline '%s' is canceled.", runID, pr.name)
+}
+
+// cancelBuild requests the cancellation of the run of the pipeline.
+func (app *App) cancelBuild(ctx context.Context, client build.Client, pr *pipelineRun, runID int) error {
+	status := build.BuildStatusValues.Cancelling
+	args := &build.UpdateBuildArgs{
+		Build:   &build.Build{Status: &status},
+		Project: &pr.prj.name,
+		BuildId: &runID,
+	}
+	auditCtx, call := app.auditContext(ctx, "cancel", pr.name, pr.pipelineID, runID)
+	if _, err := client.UpdateBuild(auditCtx, *args); err != nil {
+		return err
+	}
+	call.done(0, string(status))
+	return nil
+}
@@ -0,0 +1,59 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// writeTAP writes the runs in the Test Anything Protocol format, one
+// test point for every run. If the program ends before a pipeline is
+// resolved, the harness is told to bail out. The annotations are written
+// as comments after the plan.
+func writeTAP(w io.Writer, runs []*pipelineRun, annotations annotations, code int) {
+	if len(runs) == 0 && code != 0 {
+		fmt.Fprintf(w, "Bail out! Program ended with exit code %d.\n", code)
+		return
+	}
+	fmt.Fprintf(w, "1..%d\n", len(runs))
+	for _, key := range annotations.keys() {
+		fmt.Fprintf(w, "# annotation %s: %s\n", key, annotations[key])
+	}
+	for i, pr := range runs {
+		if pr.info.Result == resultSkipped {
+			fmt.Fprintf(w, "ok %d - Pipeline '%s' # SKIP not started after an unsuccessful run\n", i+1, pr.name)
+			continue
+		}
+		status := "ok"
+		if pr.exitCode != 0 || pr.info.Result == "" {
+			status = "not ok"
+		}
+		result := pr.info.Result
+		if result == "" {
+			result = "did not finish"
+		}
+		fmt.Fprintf(w, "%s %d - Pipeline '%s' %s\n", status, i+1, pr.name, result)
+		if pr.info.URL != "" {
+			fmt.Fprintf(w, "# url: %s\n", pr.info.URL)
+		}
+		if d := pr.info.duration(); d > 0 {
+			fmt.Fprintf(w, "# duration: %v\n", d.Round(time.Second))
+		}
+	}
+}
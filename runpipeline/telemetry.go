@@ -0,0 +1,120 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// telemetryTimeout limits the request to the collector, so that an
+// unreachable collector does not delay the program.
+const telemetryTimeout = 10 * time.Second
+
+// telemetryEvent is the payload, that is posted to the collector of
+// 'telemetry-endpoint' after every run.
+type telemetryEvent struct {
+	SchemaVersion string `json:"schemaVersion"`
+
+	Org         string `json:"org"`
+	Project     string `json:"project"`
+	Pipeline    string `json:"pipeline"`
+	PipelineID  int    `json:"pipelineId"`
+	RunID       int    `json:"runId"`
+	BuildNumber string `json:"buildNumber,omitempty"`
+	Branch      string `json:"branch,omitempty"`
+	State       string `json:"state,omitempty"`
+	Result      string `json:"result,omitempty"`
+	ExitCode    int    `json:"exitCode"`
+	URL         string `json:"url,omitempty"`
+	runTimestamps
+	DurationSeconds float64     `json:"durationSeconds,omitempty"`
+	Annotations     annotations `json:"annotations,omitempty"`
+}
+
+// telemetryClient is not the client of the SDK, requests to the collector
+// are no API calls of Azure DevOps.
+var telemetryClient = &http.Client{
+	Timeout:   telemetryTimeout,
+	Transport: &http.Transport{Proxy: http.ProxyFromEnvironment},
+}
+
+// newTelemetryEvent returns the payload of the run.
+func newTelemetryEvent(pr *pipelineRun, annotations annotations) telemetryEvent {
+	event := telemetryEvent{
+		SchemaVersion: outputSchemaVersion,
+
+		Org:         pr.prj.org.name,
+		Project:     pr.prj.name,
+		Pipeline:    pr.name,
+		PipelineID:  pr.pipelineID,
+		RunID:       pr.runID,
+		BuildNumber: pr.info.BuildNumber,
+		Branch:      strings.TrimPrefix(pr.branch, "refs/heads/"),
+		State:       pr.info.State,
+		Result:      pr.info.Result,
+		ExitCode:    pr.exitCode,
+		URL:         pr.info.URL,
+		Annotations: annotations,
+
+		runTimestamps: pr.info.timestamps(),
+	}
+	event.DurationSeconds = pr.info.duration().Seconds()
+	return event
+}
+
+// sendTelemetry posts the payload of the finished run to the collector.
+// Failures are only logged as warnings.
+func (app *App) sendTelemetry(ctx context.Context, pr *pipelineRun) {
+	if err := app.postTelemetry(ctx, newTelemetryEvent(pr, app.annotations)); err != nil {
+		pr.log.Warnf("Telemetry of run %d of pipeline '%s' could not be sent to '%s': %v", pr.runID, pr.name, app.telemetryEndpoint, err)
+		return
+	}
+	pr.log.Debugf("Telemetry of run %d of pipeline '%s' sent.", pr.runID, pr.name)
+}
+
+func (app *App) postTelemetry(ctx context.Context, event telemetryEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, app.telemetryEndpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", app.userAgent(""))
+	if app.telemetryToken != "" {
+		req.Header.Set("Authorization", "Bearer "+app.telemetryToken)
+	}
+	resp, err := telemetryClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("collector returned %s", resp.Status)
+	}
+	return nil
+}
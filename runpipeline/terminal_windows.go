@@ -0,0 +1,71 @@
+//go:build windows
+
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"golang.org/x/sys/windows"
+	"os"
+	"strings"
+	"unicode/utf16"
+	"unsafe"
+)
+
+// isTerminal is true, if the file is a console or the terminal of Git Bash,
+// MSYS2 or Cygwin.
+func isTerminal(f *os.File) bool {
+	var mode uint32
+	if windows.GetConsoleMode(windows.Handle(f.Fd()), &mode) == nil {
+		return true
+	}
+	return isMinttyPipe(f)
+}
+
+// isMinttyPipe is true, if the file is the pipe of a pseudo terminal of
+// mintty, that Git Bash, MSYS2 and Cygwin use instead of a console. Its
+// name is like '\msys-1888ae32e00d56aa-pty0-from-master'.
+func isMinttyPipe(f *os.File) bool {
+	handle := windows.Handle(f.Fd())
+	if t, err := windows.GetFileType(handle); err != nil || t != windows.FILE_TYPE_PIPE {
+		return false
+	}
+	// FILE_NAME_INFO is the length of the name in bytes and the name
+	var buf [4 + windows.MAX_PATH*2]byte
+	if windows.GetFileInformationByHandleEx(handle, windows.FileNameInfo, &buf[0], uint32(len(buf))) != nil {
+		return false
+	}
+	length := *(*uint32)(unsafe.Pointer(&buf[0])) / 2
+	if length > windows.MAX_PATH {
+		return false
+	}
+	name := string(utf16.Decode((*[windows.MAX_PATH]uint16)(unsafe.Pointer(&buf[4]))[:length:length]))
+	return isMinttyPipeName(name)
+}
+
+func isMinttyPipeName(name string) bool {
+	token := strings.Split(name, "-")
+	if len(token) < 5 {
+		return false
+	}
+	prefix := strings.TrimPrefix(token[0], `\Device\NamedPipe`)
+	if prefix != `\msys` && prefix != `\cygwin` {
+		return false
+	}
+	return token[1] != "" && strings.HasPrefix(token[2], "pty") &&
+		(token[3] == "from" || token[3] == "to") && token[4] == "master"
+}
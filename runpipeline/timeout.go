@@ -0,0 +1,56 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"time"
+)
+
+// resultTimedOut is the result of a run, that was canceled after its
+// timeout.
+const resultTimedOut = "timedOut"
+
+// runDeadline returns the time, when the run is canceled. The timeout of
+// the pipeline starts with the trigger and is limited by the 'timeout'
+// of the program.
+func (app *App) runDeadline(pr *pipelineRun) time.Time {
+	deadline := app.deadline
+	if pr.timeout > 0 {
+		runDeadline := time.Now().Add(pr.timeout)
+		if deadline.IsZero() || runDeadline.Before(deadline) {
+			deadline = runDeadline
+		}
+	}
+	return deadline
+}
+
+// timeoutRun cancels the run and marks it as timed out.
+func (app *App) timeoutRun(ctx context.Context, pr *pipelineRun) int {
+	pr.log.Errorf("Pipeline '%s (id: %d)' with run id '%d' timed out and is canceled.", pr.name, pr.pipelineID, pr.runID)
+	client, err := pr.prj.org.buildClient(ctx)
+	if err != nil {
+		pr.log.Warnf("Run %d of pipeline '%s' could not be canceled: %v", pr.runID, pr.name, err)
+	} else {
+		app.cancelRun(ctx, client, pr, pr.runID)
+		if app.deleteIfNeverStarted {
+			app.deleteNeverStarted(ctx, pr, true)
+		}
+	}
+	pr.info.Result = resultTimedOut
+	return 24
+}
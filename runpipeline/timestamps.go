@@ -0,0 +1,91 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// runTimestamps are the times, when a run was queued, started and
+// finished, as Unix epoch seconds and as ISO-8601 strings in UTC. They
+// are embedded in every structured output, a phase, that did not
+// happen, eg. the start of a run, that never started, is null.
+type runTimestamps struct {
+	CreatedAt  *int64  `json:"createdAt"`
+	Created    *string `json:"created"`
+	StartedAt  *int64  `json:"startedAt"`
+	Started    *string `json:"started"`
+	FinishedAt *int64  `json:"finishedAt"`
+	Finished   *string `json:"finished"`
+}
+
+// timestamps returns the times of the phases of the run.
+func (ri *runInfo) timestamps() runTimestamps {
+	var t runTimestamps
+	t.CreatedAt, t.Created = epochTime(ri.Created)
+	t.StartedAt, t.Started = epochTime(ri.Started)
+	t.FinishedAt, t.Finished = epochTime(ri.Finished)
+	return t
+}
+
+// epochTime returns the Unix epoch seconds and the ISO-8601 string of
+// the time, nil for the zero time.
+func epochTime(t time.Time) (*int64, *string) {
+	if t.IsZero() {
+		return nil, nil
+	}
+	epoch := t.Unix()
+	iso := t.UTC().Format(time.RFC3339)
+	return &epoch, &iso
+}
+
+// phasesText describes the times of the phases in local time for the
+// log, eg. 'created Sun, 16 Oct 2022 12:00:00 CEST, started ..., finished
+// ...'. A phase, that did not happen, is '-'.
+func phasesText(created time.Time, started time.Time, finished time.Time) string {
+	format := func(t time.Time) string {
+		if t.IsZero() {
+			return "-"
+		}
+		return t.Local().Format(time.RFC1123)
+	}
+	return fmt.Sprintf("created %s, started %s, finished %s", format(created), format(started), format(finished))
+}
+
+// readStartTime reads the start time of the finished run from its build,
+// because the pipelines API has none. A run, that never started, keeps
+// the zero time. Failures are only logged.
+func (app *App) readStartTime(ctx context.Context, pr *pipelineRun) {
+	if pr.runID <= 0 || !app.budget.allowOptional("startTime") {
+		return
+	}
+	client, err := pr.prj.org.buildClient(ctx)
+	if err != nil {
+		pr.log.Debugf("Start time of run %d of pipeline '%s' could not be read: %v", pr.runID, pr.name, err)
+		return
+	}
+	b, err := app.getBuild(ctx, client, pr)
+	if err != nil {
+		pr.log.Debugf("Start time of run %d of pipeline '%s' could not be read: %v", pr.runID, pr.name, err)
+		return
+	}
+	if b.StartTime != nil {
+		pr.info.Started = b.StartTime.Time
+	}
+}
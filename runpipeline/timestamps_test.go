@@ -0,0 +1,93 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// TestRunTimestamps pins the field names and the values of the
+// timestamps, that consumers of the structured outputs parse.
+func TestRunTimestamps(t *testing.T) {
+	created := time.Date(2022, 10, 16, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		info runInfo
+		want string
+	}{
+		{"finished", runInfo{Created: created, Started: created.Add(30 * time.Second), Finished: created.Add(10 * time.Minute)},
+			`{"createdAt":1665921600,"created":"2022-10-16T12:00:00Z","startedAt":1665921630,"started":"2022-10-16T12:00:30Z","finishedAt":1665922200,"finished":"2022-10-16T12:10:00Z"}`},
+		{"never started", runInfo{Created: created, Finished: created.Add(time.Minute)},
+			`{"createdAt":1665921600,"created":"2022-10-16T12:00:00Z","startedAt":null,"started":null,"finishedAt":1665921660,"finished":"2022-10-16T12:01:00Z"}`},
+		{"not triggered", runInfo{},
+			`{"createdAt":null,"created":null,"startedAt":null,"started":null,"finishedAt":null,"finished":null}`},
+		{"local time zone", runInfo{Created: created.In(time.FixedZone("CEST", 2*3600))},
+			`{"createdAt":1665921600,"created":"2022-10-16T12:00:00Z","startedAt":null,"started":null,"finishedAt":null,"finished":null}`},
+		{"fraction of a second", runInfo{Created: created.Add(999 * time.Millisecond)},
+			`{"createdAt":1665921600,"created":"2022-10-16T12:00:00Z","startedAt":null,"started":null,"finishedAt":null,"finished":null}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.info.timestamps())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("timestamps() = %s, want %s", data, tt.want)
+			}
+		})
+	}
+}
+
+// TestTimestampsEmbedded checks, that the timestamps are top level fields
+// of every structured output.
+func TestTimestampsEmbedded(t *testing.T) {
+	pr := testRun(&project{name: "prj", org: &organization{name: "org"}}, "build", 1, 10)
+	pr.info.Created = time.Date(2022, 10, 16, 12, 0, 0, 0, time.UTC)
+	ts := pr.info.timestamps()
+	tests := []struct {
+		name   string
+		output interface{}
+	}{
+		{"json output", runDocument{runTimestamps: ts}},
+		{"telemetry", newTelemetryEvent(pr, nil)},
+		{"status", runStatus{runTimestamps: ts}},
+		{"audit", auditRun{runTimestamps: ts}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var fields map[string]interface{}
+			if err := json.Unmarshal(data, &fields); err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range []string{"createdAt", "created", "startedAt", "started", "finishedAt", "finished"} {
+				if _, ok := fields[name]; !ok {
+					t.Errorf("field '%s' is missing in %s", name, data)
+				}
+			}
+			if fields["createdAt"] != float64(1665921600) {
+				t.Errorf("createdAt = %v, want 1665921600", fields["createdAt"])
+			}
+		})
+	}
+}
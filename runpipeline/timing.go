@@ -0,0 +1,98 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"strings"
+	"sync"
+	"time"
+)
+
+// phaseTimer measures the elapsed time of the phases of the program.
+// Phases, that are measured more than once (eg. polls), are summed up.
+type phaseTimer struct {
+	lock   sync.Mutex
+	start  time.Time
+	order  []string
+	phases map[string]*phaseTiming
+}
+
+type phaseTiming struct {
+	count int
+	total time.Duration
+}
+
+func newPhaseTimer() *phaseTimer {
+	return &phaseTimer{start: time.Now(), phases: make(map[string]*phaseTiming)}
+}
+
+// begin starts the measurement of a phase. The returned function ends
+// the measurement, eg. 'defer app.timer.begin("trigger")()'.
+func (t *phaseTimer) begin(name string) func() {
+	start := time.Now()
+	return func() {
+		elapsed := time.Since(start)
+		t.add(name, elapsed)
+		log.Debugf("Phase '%s' took %v.", name, elapsed.Round(time.Millisecond))
+	}
+}
+
+func (t *phaseTimer) add(name string, elapsed time.Duration) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	phase, ok := t.phases[name]
+	if !ok {
+		phase = &phaseTiming{}
+		t.phases[name] = phase
+		t.order = append(t.order, name)
+	}
+	phase.count++
+	phase.total += elapsed
+}
+
+// milliseconds returns the duration of all phases and the total
+// duration of the program in milliseconds.
+func (t *phaseTimer) milliseconds() map[string]int64 {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	ms := make(map[string]int64, len(t.phases)+1)
+	for name, phase := range t.phases {
+		ms[name] = phase.total.Milliseconds()
+	}
+	ms["total"] = time.Since(t.start).Milliseconds()
+	return ms
+}
+
+// breakdown returns all phases in the order of their first measurement
+// as one line.
+func (t *phaseTimer) breakdown() string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	parts := make([]string, 0, len(t.order)+1)
+	for _, name := range t.order {
+		phase := t.phases[name]
+		part := fmt.Sprintf("%s %v", name, phase.total.Round(time.Millisecond))
+		if phase.count > 1 {
+			part += fmt.Sprintf(" (%dx)", phase.count)
+		}
+		parts = append(parts, part)
+	}
+	parts = append(parts, fmt.Sprintf("total %v", time.Since(t.start).Round(time.Millisecond)))
+	return "Timing: " + strings.Join(parts, ", ")
+}
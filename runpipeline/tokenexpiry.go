@@ -0,0 +1,126 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// patListPath is the path of the personal access tokens of the user in
+// the token lifecycle API. The API is only available in Azure DevOps
+// Services and only if the organization permits it for the token.
+const patListPath = "_apis/tokens/pats?api-version=7.1-preview.1"
+
+// patList is the response of the token lifecycle API.
+type patList struct {
+	PatTokens []struct {
+		DisplayName string    `json:"displayName"`
+		ValidFrom   time.Time `json:"validFrom"`
+		ValidTo     time.Time `json:"validTo"`
+	} `json:"patTokens"`
+}
+
+// checkTokenExpiry warns, if the token expires within the window of
+// 'token-expiry-warn'. With 'fail-on-expiring-token' the program ends
+// with exit code 33 instead. If the expiry can not be determined, it is
+// only logged at debug level.
+func (app *App) checkTokenExpiry(ctx context.Context, org *organization) {
+	defer app.timer.begin("tokenExpiry")()
+	expiry, err := app.tokenExpiry(ctx, org)
+	if err != nil {
+		log.Debugf("Expiry of the token of organization '%s' is not known: %v", org.name, err)
+		return
+	}
+	app.tokenExpires = &expiry
+	remaining := time.Until(expiry)
+	if remaining > app.tokenExpiryWarn {
+		log.Debugf("Token of organization '%s' expires %s.", org.name, expiry.Format(time.RFC1123))
+		return
+	}
+	message := fmt.Sprintf("Token of organization '%s' expires %s (in %v).", org.name, expiry.Format(time.RFC1123), remaining.Round(time.Hour))
+	if remaining <= 0 {
+		message = fmt.Sprintf("Token of organization '%s' has expired.", org.name)
+	}
+	if app.failOnExpiringToken {
+		log.Errorf("%s Rotate the token.", message)
+		app.exit(33)
+	}
+	log.Warnf("%s Rotate the token.", message)
+}
+
+// tokenExpiry returns the expiry of the token. The token lifecycle API
+// lists the tokens of the user without their secret, therefore the
+// expiry is only known, if the user has one valid token. A token, that
+// is rejected as expired, expired now.
+func (app *App) tokenExpiry(ctx context.Context, org *organization) (time.Time, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, app.tokenAPIURL(org.name)+"/"+patListPath, nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	req.Header.Set("Authorization", org.connection.AuthorizationString)
+	req.Header.Set("Accept", "application/json")
+	resp, err := (&http.Client{}).Do(req)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized && strings.Contains(strings.ToLower(string(body)), "has expired") {
+		return time.Now().Truncate(time.Second), nil
+	}
+	if resp.StatusCode != http.StatusOK || !strings.Contains(resp.Header.Get("Content-Type"), "json") {
+		return time.Time{}, fmt.Errorf("token lifecycle API returned %s", resp.Status)
+	}
+	var list patList
+	if err = json.Unmarshal(body, &list); err != nil {
+		return time.Time{}, err
+	}
+	var valid []time.Time
+	now := time.Now()
+	for _, token := range list.PatTokens {
+		if token.ValidFrom.Before(now) && token.ValidTo.After(now) {
+			valid = append(valid, token.ValidTo)
+		}
+	}
+	if len(valid) != 1 {
+		return time.Time{}, fmt.Errorf("the user has %d valid tokens, the token can not be identified", len(valid))
+	}
+	return valid[0], nil
+}
+
+// tokenAPIURL returns the URL of the organization in the identity
+// service of Azure DevOps Services, eg. https://vssps.dev.azure.com/org.
+// Other base URLs are used as they are.
+func (app *App) tokenAPIURL(org string) string {
+	u, err := url.Parse(app.baseURL)
+	if err == nil && strings.EqualFold(u.Hostname(), "dev.azure.com") {
+		u.Host = "vssps." + u.Host
+		return strings.TrimRight(u.String(), "/") + "/" + org
+	}
+	return app.organizationURL(org)
+}
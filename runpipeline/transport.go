@@ -0,0 +1,103 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	log "github.com/sirupsen/logrus"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxRateLimitRetries limits the retries of one request, that is
+// rejected by the rate limiting of Azure DevOps.
+const maxRateLimitRetries = 10
+
+// transport returns the chain of HTTP transports, that is used by the
+// clients of the SDK: the audit log sees the final response of a
+// request, retries after rate limiting are counted by the budget and
+// blocked requests end the program after they are logged.
+func (app *App) transport() http.RoundTripper {
+	var transport http.RoundTripper = &rateLimitTransport{next: app.budget}
+	if app.apiVersion != "" {
+		transport = &apiVersionTransport{version: app.apiVersion, next: transport}
+	}
+	transport = &userAgentTransport{app: app, next: transport}
+	if app.auditLog != nil {
+		transport = &auditTransport{next: transport}
+	}
+	if !app.replay {
+		// the recorded responses have the date of the recording
+		transport = &clockTransport{clock: app.clock, next: transport}
+	}
+	return &conditionalAccessTransport{app: app, next: transport}
+}
+
+// rateLimitTransport retries requests, that are rejected with HTTP 429,
+// after the delay of the Retry-After header.
+type rateLimitTransport struct {
+	next http.RoundTripper
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for retry := 1; ; retry++ {
+		resp, err := t.next.RoundTrip(req)
+		if err != nil || resp.StatusCode != http.StatusTooManyRequests || retry > maxRateLimitRetries {
+			return resp, err
+		}
+		if req.Body != nil && req.GetBody == nil {
+			return resp, err
+		}
+		delay := retryAfter(resp.Header.Get("Retry-After")) + time.Duration(rand.Int63n(int64(time.Second)))
+		log.Warnf("Request %s %s is rate limited, retry %d in %v.", req.Method, req.URL.Path, retry, delay.Round(time.Millisecond))
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if call, ok := req.Context().Value(auditCallKey{}).(*auditCall); ok {
+			call.addRateLimitWait(delay)
+		}
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+// retryAfter reads the delay in seconds or as HTTP date. Without header
+// the delay is one second.
+func retryAfter(value string) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay
+		}
+		return 0
+	}
+	return time.Second
+}
@@ -0,0 +1,137 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/build"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/pipelines"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"math/big"
+	"net"
+	"time"
+)
+
+const (
+	// defaultTriggerAttempts are the attempts of the request, that starts
+	// a run, including the first, after network errors and server errors.
+	defaultTriggerAttempts = 3
+	// defaultTriggerRetryBaseDelay is the upper bound of the wait time
+	// before the first retry, it is doubled for every further retry.
+	defaultTriggerRetryBaseDelay = time.Second
+	// triggerRetryMaxDelay limits the upper bound of the wait time.
+	triggerRetryMaxDelay = 30 * time.Second
+)
+
+// runPipelineWithRetry calls trigger up to 'trigger-max-retries' times
+// including the first call, if it failed with a network error or a
+// server error. The wait time before a retry is chosen at random between
+// zero and the exponential backoff (full jitter), so that the invocations
+// of a CI system, that failed at the same time, don't retry at the same
+// time. Responses with 4xx status are never retried.
+//
+// Starting a run is not idempotent. Only a request, that was not sent, is
+// repeated right away. After any other failure the server may have queued
+// the run before the response was lost, so the runs queued since the
+// start are read first and the request is only repeated, if there is
+// none.
+func (app *App) runPipelineWithRetry(ctx context.Context, pr *pipelineRun, trigger func() (*pipelines.Run, error)) (*pipelines.Run, error) {
+	run, err := trigger()
+	for attempt := 2; attempt <= app.triggerMaxAttempts && err != nil && triggerRetryable(ctx, err); attempt++ {
+		retry := attempt - 1
+		delay := fullJitter(app.triggerRetryBaseDelay, retry)
+		log.Warnf("Start of pipeline '%s' failed, retry %d/%d in %v: %v", pr.name, retry, app.triggerMaxAttempts-1, delay.Round(time.Millisecond), err)
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(delay):
+		}
+		if !dialFailed(err) {
+			queued, lookupErr := app.queuedRun(ctx, pr)
+			if lookupErr != nil {
+				log.Warnf("Runs of pipeline '%s' could not be read, the start is not repeated, because the run may have been queued: %v", pr.name, lookupErr)
+				return nil, err
+			}
+			if queued != nil {
+				log.Warnf("Run %d of pipeline '%s' was queued by the failed start, it is not started again.", *queued.Id, pr.name)
+				return queued, nil
+			}
+		}
+		run, err = trigger()
+	}
+	return run, err
+}
+
+// triggerRetryable is true for network errors and responses with 5xx
+// status. Errors of the program, eg. an exhausted budget of API calls,
+// and the end of the context are not retried.
+func triggerRetryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || errors.Is(err, errBudgetExhausted) {
+		return false
+	}
+	if code := responseStatus(err); code != 0 {
+		return code >= 500
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// queuedRun returns the run of the pipeline on the branch of the run, that
+// was queued since the start was requested, or nil. If there is more than
+// one, the oldest is the run of the failed request. The run is read with
+// the builds API, that knows the runs of both kinds of pipelines.
+func (app *App) queuedRun(ctx context.Context, pr *pipelineRun) (*pipelines.Run, error) {
+	filter := runFilter{branch: pr.branch, maxAge: time.Since(pr.triggered) + clockSkewTolerance}
+	records, err := app.listRuns(ctx, pr.prj, pr.pipelineID, filter)
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+	client, err := pr.prj.org.buildClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	oldest := records[len(records)-1].ID
+	b, err := client.GetBuild(ctx, build.GetBuildArgs{Project: &pr.prj.name, BuildId: &oldest})
+	if err != nil {
+		return nil, err
+	}
+	return buildRun(b), nil
+}
+
+// fullJitter returns a random wait time between zero and base doubled for
+// every retry after the first, at most triggerRetryMaxDelay. The random
+// number is taken from crypto/rand, that needs no seed.
+func fullJitter(base time.Duration, retry int) time.Duration {
+	ceiling := base
+	for i := 1; i < retry && ceiling < triggerRetryMaxDelay; i++ {
+		ceiling *= 2
+	}
+	if ceiling > triggerRetryMaxDelay {
+		ceiling = triggerRetryMaxDelay
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(ceiling)+1))
+	if err != nil {
+		return ceiling
+	}
+	return time.Duration(n.Int64())
+}
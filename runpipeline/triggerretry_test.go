@@ -0,0 +1,189 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/pipelines"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestDialFailed(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"dns", &net.DNSError{Err: "no such host", Name: "dev.azure.com"}, true},
+		{"refused", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+		{"wrapped dial", fmt.Errorf("Post: %w", &net.OpError{Op: "dial", Err: errors.New("i/o timeout")}), true},
+		{"read", &net.OpError{Op: "read", Err: errors.New("connection reset by peer")}, false},
+		{"eof", io.ErrUnexpectedEOF, false},
+		{"server error", azuredevops.WrappedError{StatusCode: intPtr(503)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dialFailed(tt.err); got != tt.want {
+				t.Errorf("dialFailed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTriggerRetryable(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want bool
+	}{
+		{"server error", context.Background(), azuredevops.WrappedError{StatusCode: intPtr(503)}, true},
+		{"bad request", context.Background(), azuredevops.WrappedError{StatusCode: intPtr(400)}, false},
+		{"dial", context.Background(), &net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+		{"eof", context.Background(), io.EOF, true},
+		{"budget", context.Background(), errBudgetExhausted, false},
+		{"canceled", canceled, io.EOF, false},
+		{"other", context.Background(), errors.New("invalid parameter"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := triggerRetryable(tt.ctx, tt.err); got != tt.want {
+				t.Errorf("triggerRetryable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRunPipelineWithRetry checks, that a start, that failed after the
+// request was sent, is only repeated, if no run was queued since.
+func TestRunPipelineWithRetry(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+	tests := []struct {
+		name     string
+		err      error
+		queued   bool
+		triggers int
+		lookups  bool
+		want     int
+	}{
+		{"not sent", refused, true, 2, false, 200},
+		{"queued before the response was lost", io.ErrUnexpectedEOF, true, 1, true, 150},
+		{"server error and not queued", azuredevops.WrappedError{StatusCode: intPtr(503)}, false, 2, true, 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeServer(t)
+			f.route(locationBuilds, "{project}/_apis/build/builds/{buildId}", func(req *fakeRequest) (int, interface{}) {
+				queued := map[string]interface{}{
+					"id": 150, "buildNumber": "20221016.1", "status": "notStarted",
+					"sourceBranch": "refs/heads/main", "queueTime": time.Now().UTC().Format(time.RFC3339),
+					"definition": map[string]interface{}{"id": 1, "name": "build"},
+				}
+				if req.values["buildId"] != "" {
+					return http.StatusOK, queued
+				}
+				builds := []interface{}{}
+				if tt.queued {
+					builds = append(builds, queued)
+				}
+				return http.StatusOK, map[string]interface{}{"count": len(builds), "value": builds}
+			})
+			app := &App{clock: &serverClock{}, triggerMaxAttempts: 3}
+			pr := testRun(f.project(), "build", 1, 0)
+			pr.triggered = time.Now()
+
+			triggers := 0
+			run, err := app.runPipelineWithRetry(context.Background(), pr, func() (*pipelines.Run, error) {
+				triggers++
+				if triggers == 1 {
+					return nil, tt.err
+				}
+				id := 200
+				return &pipelines.Run{Id: &id}, nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *run.Id != tt.want {
+				t.Errorf("run %d, want %d", *run.Id, tt.want)
+			}
+			if triggers != tt.triggers {
+				t.Errorf("%d starts, want %d", triggers, tt.triggers)
+			}
+			if lookups := len(f.requested()) > 0; lookups != tt.lookups {
+				t.Errorf("runs read %v, want %v: %v", lookups, tt.lookups, f.requested())
+			}
+		})
+	}
+}
+
+// TestRunPipelineWithRetryLookupFailed checks, that the start is not
+// repeated, if it is not known, whether the run was queued.
+func TestRunPipelineWithRetryLookupFailed(t *testing.T) {
+	f := newFakeServer(t)
+	f.route(locationBuilds, "{project}/_apis/build/builds/{buildId}", func(req *fakeRequest) (int, interface{}) {
+		return http.StatusInternalServerError, map[string]string{"message": "database unavailable"}
+	})
+	app := &App{clock: &serverClock{}, triggerMaxAttempts: 3}
+	pr := testRun(f.project(), "build", 1, 0)
+	pr.triggered = time.Now()
+
+	triggers := 0
+	_, err := app.runPipelineWithRetry(context.Background(), pr, func() (*pipelines.Run, error) {
+		triggers++
+		return nil, io.ErrUnexpectedEOF
+	})
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("error %v, want the error of the start", err)
+	}
+	if triggers != 1 {
+		t.Errorf("%d starts, want 1", triggers)
+	}
+}
+
+// TestRunPipelineWithRetryAttempts checks, that 'trigger-max-retries'
+// counts the attempts including the first.
+func TestRunPipelineWithRetryAttempts(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+	for _, attempts := range []int{1, 2, 3} {
+		t.Run(fmt.Sprint(attempts), func(t *testing.T) {
+			app := &App{clock: &serverClock{}, triggerMaxAttempts: attempts}
+			pr := testRun(nil, "build", 1, 0)
+
+			triggers := 0
+			_, err := app.runPipelineWithRetry(context.Background(), pr, func() (*pipelines.Run, error) {
+				triggers++
+				return nil, refused
+			})
+			if !errors.Is(err, refused) {
+				t.Errorf("error %v, want the error of the start", err)
+			}
+			if triggers != attempts {
+				t.Errorf("%d starts, want %d", triggers, attempts)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"net/http"
+	"strings"
+)
+
+// version is the version of the program. It is passed to Main by the
+// command line program, that is built with its version, eg.
+// go build -ldflags "-X main.version=v1.4.0".
+var version = "dev"
+
+// userAgentProduct identifies the program in the 'User-Agent' header.
+func userAgentProduct() string {
+	return "runPipeline/" + version
+}
+
+// userAgent returns the 'User-Agent' header of a request, whose client
+// sent the header. The program and 'user-agent' are appended, or
+// 'user-agent' replaces the header with 'user-agent-replace'.
+func (app *App) userAgent(header string) string {
+	if app.userAgentReplace {
+		return app.userAgentValue
+	}
+	parts := []string{}
+	if header != "" {
+		parts = append(parts, header)
+	}
+	parts = append(parts, userAgentProduct())
+	if app.userAgentValue != "" {
+		parts = append(parts, app.userAgentValue)
+	}
+	return strings.Join(parts, " ")
+}
+
+// userAgentTransport sets the 'User-Agent' header of every request. The
+// SDK sends its own header, that does not name the program.
+type userAgentTransport struct {
+	app  *App
+	next http.RoundTripper
+}
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", t.app.userAgent(req.Header.Get("User-Agent")))
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,115 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"errors"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultConnectRetries are the retries of the first request to a
+	// host, they wait 1s, 2s, 4s and 8s, about 15 seconds in total.
+	defaultConnectRetries = 4
+	connectRetryDelay     = time.Second
+	connectRetryMaxDelay  = 8 * time.Second
+)
+
+// warmUpTransport retries the first request to a host, if the connection
+// can not be established, eg. because DNS is not ready right after a VPN
+// connect. The warm-up of a host ends with its first response or error,
+// that is not retried, later requests are not retried anymore. Responses
+// are never retried, also not 401 or other 4xx responses.
+type warmUpTransport struct {
+	next    http.RoundTripper
+	retries int
+
+	lock sync.Mutex
+	warm map[string]bool
+}
+
+func newWarmUpTransport(retries int, next http.RoundTripper) *warmUpTransport {
+	return &warmUpTransport{next: next, retries: retries, warm: make(map[string]bool)}
+}
+
+func (t *warmUpTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.lock.Lock()
+	warm := t.warm[req.URL.Host]
+	t.lock.Unlock()
+	if warm {
+		return t.next.RoundTrip(req)
+	}
+	delay := connectRetryDelay
+	for retry := 1; ; retry++ {
+		resp, err := t.next.RoundTrip(req)
+		if err == nil || retry > t.retries || req.Context().Err() != nil || !connectionFailed(req, err) ||
+			req.Body != nil && req.GetBody == nil {
+			t.lock.Lock()
+			t.warm[req.URL.Host] = true
+			t.lock.Unlock()
+			return resp, err
+		}
+		log.Infof("Connection to '%s' failed, retry %d/%d in %v: %v", req.URL.Host, retry, t.retries, delay, err)
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+		delay = minDuration(2*delay, connectRetryMaxDelay)
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+// connectionFailed is true for errors of the network, before the request
+// reached the server: DNS errors, refused connections and timeouts of the
+// connect. Timeouts of the TLS handshake are only retried for requests,
+// that do not change anything, because the request may have been sent.
+func connectionFailed(req *http.Request, err error) bool {
+	if dialFailed(err) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		switch req.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			return true
+		}
+	}
+	return false
+}
+
+// dialFailed is true for DNS errors and errors of the connect, the
+// request was not sent then.
+func dialFailed(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
@@ -0,0 +1,165 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// refusingDialer refuses the first connections with a dial to a closed
+// port, like a host, whose network is not ready yet.
+type refusingDialer struct {
+	lock   sync.Mutex
+	refuse int
+	dials  int
+	closed string
+}
+
+// newRefusingDialer returns a dialer, that refuses the first connections.
+func newRefusingDialer(t *testing.T, refuse int) *refusingDialer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := l.Addr().String()
+	l.Close()
+	return &refusingDialer{refuse: refuse, closed: closed}
+}
+
+func (d *refusingDialer) DialContext(ctx context.Context, network string, addr string) (net.Conn, error) {
+	d.lock.Lock()
+	d.dials++
+	if d.dials <= d.refuse {
+		addr = d.closed
+	}
+	d.lock.Unlock()
+	return (&net.Dialer{}).DialContext(ctx, network, addr)
+}
+
+// TestWarmUpTransport checks, that refused connections are retried for
+// the first request to a host only.
+func TestWarmUpTransport(t *testing.T) {
+	tests := []struct {
+		name    string
+		refuse  int
+		retries int
+		method  string
+		dials   int
+		failed  bool
+	}{
+		{"connected", 0, 4, http.MethodGet, 1, false},
+		{"refused", 2, 4, http.MethodGet, 3, false},
+		{"refused too often", 2, 1, http.MethodGet, 2, true},
+		{"no retries", 1, 0, http.MethodGet, 1, true},
+		{"post with body", 1, 4, http.MethodPost, 2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var bodies []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				bodies = append(bodies, string(body))
+			}))
+			defer server.Close()
+			d := newRefusingDialer(t, tt.refuse)
+			client := &http.Client{Transport: newWarmUpTransport(tt.retries, &http.Transport{DialContext: d.DialContext})}
+
+			req, err := http.NewRequest(tt.method, server.URL, strings.NewReader("run"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := client.Do(req)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if failed := err != nil; failed != tt.failed {
+				t.Errorf("failed = %v (%v), want %v", failed, err, tt.failed)
+			}
+			if d.dials != tt.dials {
+				t.Errorf("%d connections, want %d", d.dials, tt.dials)
+			}
+			if !tt.failed && (len(bodies) != 1 || bodies[0] != "run") {
+				t.Errorf("server received %q, want the body once", bodies)
+			}
+		})
+	}
+}
+
+// TestWarmUpTransportWarm checks, that a refused connection is not
+// retried after the first response of the host.
+func TestWarmUpTransportWarm(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	d := newRefusingDialer(t, 0)
+	client := &http.Client{Transport: newWarmUpTransport(4, &http.Transport{DialContext: d.DialContext, DisableKeepAlives: true})}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	d.refuse = 2
+	if _, err := client.Get(server.URL); err == nil {
+		t.Error("request of the warm host succeeded, want the refused connection")
+	}
+	if d.dials != 2 {
+		t.Errorf("%d connections, want 2", d.dials)
+	}
+}
+
+// timeoutError is a timeout of the network, eg. of the TLS handshake.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// TestConnectionFailed checks, that timeouts are only retried for requests,
+// that do not change anything.
+func TestConnectionFailed(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+	tests := []struct {
+		name   string
+		method string
+		err    error
+		want   bool
+	}{
+		{"refused get", http.MethodGet, refused, true},
+		{"refused post", http.MethodPost, refused, true},
+		{"timeout get", http.MethodGet, timeoutError{}, true},
+		{"timeout options", http.MethodOptions, timeoutError{}, true},
+		{"timeout post", http.MethodPost, timeoutError{}, false},
+		{"timeout patch", http.MethodPatch, timeoutError{}, false},
+		{"reset", http.MethodGet, &net.OpError{Op: "read", Err: errors.New("connection reset by peer")}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, "https://dev.azure.com/org", nil)
+			if got := connectionFailed(req, tt.err); got != tt.want {
+				t.Errorf("connectionFailed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
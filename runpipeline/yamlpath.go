@@ -0,0 +1,71 @@
+/*
+ * Copyright 2022 Intershop Communications AG.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package runpipeline
+
+import (
+	"context"
+	"github.com/microsoft/azure-devops-go-api/azuredevops/v6/pipelines"
+	log "github.com/sirupsen/logrus"
+	"strings"
+)
+
+// normalizeYamlPath makes paths of YAML files comparable.
+func normalizeYamlPath(path string) string {
+	return strings.ToLower(strings.TrimLeft(strings.ReplaceAll(path, "\\", "/"), "/"))
+}
+
+// pipelineYamlPath returns the path of the YAML file of the pipeline.
+func (app *App) pipelineYamlPath(ctx context.Context, prj *project, pipelineID int) string {
+	definition, err := app.getDefinition(ctx, prj, pipelineID)
+	if err != nil {
+		log.Warnf("Definition of pipeline with id %d could not be read: %v", pipelineID, err)
+		return ""
+	}
+	return yamlFilename(definition)
+}
+
+// selectByYamlPath returns the id of the pipeline with the name, that is
+// defined in the YAML file given by 'pipeline-yaml-path'. If no pipeline
+// with this name uses the file, the first one is used with a warning.
+func (app *App) selectByYamlPath(ctx context.Context, prj *project, name string, list []pipelines.Pipeline) int {
+	pid := -1
+	for _, pref := range list {
+		if *pref.Name != name {
+			continue
+		}
+		if pid == -1 {
+			pid = *pref.Id
+		}
+		if normalizeYamlPath(app.pipelineYamlPath(ctx, prj, *pref.Id)) == normalizeYamlPath(app.yamlPath) {
+			log.Infof("Pipeline %s has ID %d and is defined in '%s'.", name, *pref.Id, app.yamlPath)
+			return *pref.Id
+		}
+	}
+	if pid != -1 {
+		log.Warnf("Pipeline %s (id: %d) is not defined in '%s'. You may trigger the wrong pipeline.", name, pid, app.yamlPath)
+	}
+	return pid
+}
+
+// verifyYamlPath warns, if the pipeline is not defined in the YAML file
+// given by 'pipeline-yaml-path'.
+func (app *App) verifyYamlPath(ctx context.Context, prj *project, name string, pipelineID int) {
+	path := app.pipelineYamlPath(ctx, prj, pipelineID)
+	if normalizeYamlPath(path) != normalizeYamlPath(app.yamlPath) {
+		log.Warnf("Pipeline %s (id: %d) is defined in '%s' and not in '%s'. You may trigger the wrong pipeline.", name, pipelineID, path, app.yamlPath)
+	}
+}